@@ -0,0 +1,8 @@
+// Command fylshr shares a folder over HTTP. See pkg/fylshr to embed it.
+package main
+
+import "github.com/stuff7/fylshr/pkg/fylshr"
+
+func main() {
+	fylshr.Main()
+}
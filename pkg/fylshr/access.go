@@ -0,0 +1,109 @@
+package fylshr
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// maxRateClients caps how many clients requestLimiter remembers, like the
+// other caches it starts over when full.
+const maxRateClients = 1024
+
+// blockReason returns why r's client may not use the server, or "" if it may:
+// -deny wins over -allow, which when given must contain the client. Clients
+// of a Unix socket have no address and are left to the socket's permissions.
+func blockReason(r *http.Request, allow, deny []netip.Prefix) string {
+	if viaUnixSocket(r) {
+		return ""
+	}
+	ip, err := netip.ParseAddr(clientIP(r))
+	if err != nil {
+		return "unknown address"
+	}
+	ip = ip.Unmap()
+
+	for _, prefix := range deny {
+		if prefix.Contains(ip) {
+			return "denied"
+		}
+	}
+	if len(allow) == 0 {
+		return ""
+	}
+	for _, prefix := range allow {
+		if prefix.Contains(ip) {
+			return ""
+		}
+	}
+	return "not allowed"
+}
+
+// viaUnixSocket reports whether r came over a -listen unix: socket, usually
+// from a reverse proxy.
+func viaUnixSocket(r *http.Request) bool {
+	_, ok := r.Context().Value(http.LocalAddrContextKey).(*net.UnixAddr)
+	return ok
+}
+
+// requestLimiter lets each client make rps requests per second on average,
+// in bursts of up to a second's worth.
+type requestLimiter struct {
+	sync.Mutex
+	rps     float64
+	clients map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRequestLimiter(rps float64) *requestLimiter {
+	return &requestLimiter{rps: rps, clients: map[string]*bucket{}}
+}
+
+// allow reports whether ip has a request left, using it up.
+func (l *requestLimiter) allow(ip string) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	now, burst := time.Now(), max(l.rps, 1)
+	b := l.clients[ip]
+	if b == nil {
+		if len(l.clients) >= maxRateClients {
+			clear(l.clients)
+		}
+		b = &bucket{tokens: burst}
+		l.clients[ip] = b
+	} else {
+		b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*l.rps)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// serveBlocked refuses r, logging it with the reason even with -quiet-paths.
+func serveBlocked(w http.ResponseWriter, r *http.Request, args Args, status int, reason string) {
+	sw := &statusWriter{ResponseWriter: w, blocked: reason}
+	if args.logSink != nil {
+		defer args.logSink.record(sw, r, time.Now())
+	}
+	if !args.silent {
+		defer logRequest(sw, r, args, time.Now())
+	}
+
+	if status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", "1")
+		writeError(sw, r, status, "429 too many requests")
+		return
+	}
+	writeError(sw, r, status, "403 forbidden")
+}
@@ -0,0 +1,94 @@
+package fylshr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBlockReason(t *testing.T) {
+	tests := []struct {
+		remote, allow, deny, want string
+	}{
+		{"192.168.1.5:1234", "", "", ""},
+		{"192.168.1.5:1234", "192.168.1.0/24", "", ""},
+		{"192.168.2.5:1234", "192.168.1.0/24", "", "not allowed"},
+		{"192.168.1.5:1234", "192.168.1.5", "", ""},
+		{"192.168.1.6:1234", "192.168.1.5", "", "not allowed"},
+		{"192.168.1.5:1234", "", "192.168.1.5", "denied"},
+		{"192.168.1.5:1234", "192.168.1.0/24", "192.168.1.5/32", "denied"},
+		{"[::ffff:192.168.1.5]:1234", "192.168.1.0/24", "", ""},
+		{"[fe80::1]:1234", "192.168.1.0/24, fe80::/10", "", ""},
+		{"[2001:db8::1]:1234", "192.168.1.0/24", "", "not allowed"},
+		{"nonsense", "", "", "unknown address"},
+	}
+	for _, tt := range tests {
+		allow, err := parsePrefixes(tt.allow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		deny, err := parsePrefixes(tt.deny)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remote
+		if got := blockReason(r, allow, deny); got != tt.want {
+			t.Errorf("blockReason(%s, -allow %q, -deny %q) = %q, want %q", tt.remote, tt.allow, tt.deny, got, tt.want)
+		}
+	}
+}
+
+func TestAllowDeny(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	tests := []struct {
+		name   string
+		flags  []string
+		status int
+	}{
+		{"open", nil, http.StatusOK},
+		{"allowed", []string{"-allow", "127.0.0.0/8,::1"}, http.StatusOK},
+		{"not allowed", []string{"-allow", "10.0.0.0/8"}, http.StatusForbidden},
+		{"denied", []string{"-deny", "127.0.0.1"}, http.StatusForbidden},
+		{"denied though allowed", []string{"-allow", "127.0.0.0/8", "-deny", "127.0.0.1"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, dir, tt.flags...)
+			for _, path := range []string{"/a.txt", "/", healthPath} {
+				if resp, body := do(t, srv, http.MethodGet, path, nil); resp.StatusCode != tt.status || tt.status != http.StatusOK && body == "hello" {
+					t.Errorf("GET %s = %d, want %d", path, resp.StatusCode, tt.status)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxRPS(t *testing.T) {
+	srv := newTestServer(t, t.TempDir(), "-max-rps", "3")
+	for i := range 3 {
+		if resp, _ := do(t, srv, http.MethodGet, "/", nil); resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d of the burst = %d, want 200", i+1, resp.StatusCode)
+		}
+	}
+	resp, _ := do(t, srv, http.MethodGet, "/", nil)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "1" {
+		t.Errorf("request over the burst = %d Retry-After %q, want 429 1", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+}
+
+func TestRequestLimiter(t *testing.T) {
+	l := newRequestLimiter(0.5)
+	if !l.allow("a") || l.allow("a") {
+		t.Errorf("-max-rps 0.5 allowed other than a single request at once")
+	}
+	if !l.allow("b") {
+		t.Errorf("another client shares the limit of the first")
+	}
+	l.clients["a"].last = l.clients["a"].last.Add(-2 * time.Second)
+	if !l.allow("a") {
+		t.Errorf("no request allowed 2s later at 0.5 per second")
+	}
+}
@@ -0,0 +1,242 @@
+package fylshr
+
+import (
+	"cmp"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const accessStatsPath = "/_stats"
+
+// statsHistory is how many minutes of bytes sent the -stats page shows.
+const statsHistory = 60
+
+// internalPaths are endpoints of the server, whose responses aren't
+// downloads.
+var internalPaths = []string{accessStatsPath, eventsPath, managePath, metricsPath, healthPath, pastePath, pinPath, searchPath, thumbPath, tusPath, statsPath, configPath}
+
+// fileStats are the downloads of a file, count being the ones from its start
+// and bytes including resumed ranges.
+type fileStats struct {
+	count   int
+	bytes   int64
+	clients map[string]struct{}
+	last    time.Time
+}
+
+type clientStats struct {
+	requests  uint64
+	downloads int
+	bytes     int64
+	last      time.Time
+}
+
+// start tracks r as an active transfer until it's recorded.
+func (s *session) start(r *http.Request) *transfer {
+	t := &transfer{name: r.URL.Path, start: time.Now()}
+	t.total.Store(-1)
+	s.Lock()
+	s.transfers[t] = clientIP(r)
+	s.Unlock()
+	return t
+}
+
+// credit spreads bytes sent from start to end over the minutes of history,
+// so a long download doesn't show as a spike when it ends. Callers hold the
+// lock.
+func (s *session) credit(start, end time.Time, bytes int64) {
+	first, last := start.Unix()/60, end.Unix()/60
+	first = max(first, last-statsHistory+1)
+	minutes := last - first + 1
+	for minute := first; minute <= last; minute++ {
+		bucket := &s.history[minute%statsHistory]
+		if bucket.minute != minute {
+			bucket.minute, bucket.bytes = minute, 0
+		}
+		bucket.bytes += bytes / minutes
+		if minute == last {
+			bucket.bytes += bytes % minutes
+		}
+	}
+}
+
+type fileReport struct {
+	Path      string    `json:"path"`
+	Downloads int       `json:"downloads"`
+	Clients   int       `json:"clients"`
+	Bytes     int64     `json:"bytes"`
+	Last      time.Time `json:"last"`
+}
+
+type clientReport struct {
+	IP        string    `json:"ip"`
+	Requests  uint64    `json:"requests"`
+	Downloads int       `json:"downloads"`
+	Bytes     int64     `json:"bytes"`
+	Last      time.Time `json:"last"`
+}
+
+type minuteReport struct {
+	Time  time.Time `json:"time"`
+	Bytes int64     `json:"bytes"`
+}
+
+type transferReport struct {
+	Path   string    `json:"path"`
+	IP     string    `json:"ip"`
+	Start  time.Time `json:"start"`
+	Bytes  int64     `json:"bytes"`
+	Total  int64     `json:"total"`
+	Offset int64     `json:"offset"`
+}
+
+type statsReport struct {
+	Uptime    string           `json:"uptime"`
+	Requests  uint64           `json:"requests"`
+	Bytes     int64            `json:"bytes"`
+	Files     []fileReport     `json:"files"`
+	Clients   []clientReport   `json:"clients"`
+	History   []minuteReport   `json:"history"`
+	Transfers []transferReport `json:"transfers"`
+}
+
+// report returns what s served, the most downloaded files and the busiest
+// clients first.
+func (s *session) report(now time.Time) statsReport {
+	s.Lock()
+	defer s.Unlock()
+	report := statsReport{
+		Uptime:    now.Sub(startTime).Round(time.Second).String(),
+		Requests:  s.requests,
+		Bytes:     s.bytes,
+		Files:     []fileReport{},
+		Clients:   []clientReport{},
+		History:   []minuteReport{},
+		Transfers: []transferReport{},
+	}
+
+	for name, file := range s.downloads {
+		report.Files = append(report.Files, fileReport{name, file.count, len(file.clients), file.bytes, file.last})
+	}
+	slices.SortFunc(report.Files, func(a, b fileReport) int {
+		return cmp.Or(cmp.Compare(b.Downloads, a.Downloads), cmp.Compare(b.Bytes, a.Bytes), strings.Compare(a.Path, b.Path))
+	})
+
+	for ip, client := range s.clients {
+		report.Clients = append(report.Clients, clientReport{ip, client.requests, client.downloads, client.bytes, client.last})
+	}
+	slices.SortFunc(report.Clients, func(a, b clientReport) int {
+		return cmp.Or(cmp.Compare(b.Bytes, a.Bytes), strings.Compare(a.IP, b.IP))
+	})
+
+	current := now.Unix() / 60
+	for minute := max(current-statsHistory+1, startTime.Unix()/60); minute <= current; minute++ {
+		var bytes int64
+		if bucket := s.history[minute%statsHistory]; bucket.minute == minute {
+			bytes = bucket.bytes
+		}
+		report.History = append(report.History, minuteReport{time.Unix(minute*60, 0), bytes})
+	}
+
+	for t, ip := range s.transfers {
+		report.Transfers = append(report.Transfers, transferReport{t.name, ip, t.start, t.bytes.Load(), t.total.Load(), t.offset.Load()})
+	}
+	slices.SortFunc(report.Transfers, func(a, b transferReport) int { return a.Start.Compare(b.Start) })
+	return report
+}
+
+// serveAccessStats answers the -stats page, refreshing itself, or its JSON
+// with ?format=json.
+func serveAccessStats(w http.ResponseWriter, r *http.Request, s *session, look *look) {
+	now := time.Now()
+	report := s.report(now)
+	w.Header().Set("Cache-Control", "no-store")
+	if r.URL.Query().Get("format") == "json" || prefersJSON(r) {
+		if r.URL.Query().Has("download") {
+			w.Header().Set("Content-Disposition", `attachment; filename="fylshr-stats-`+now.Format("20060102-150405")+`.json"`)
+		}
+		writeJSON(w, r, report)
+		return
+	}
+
+	var peak int64 = 1
+	for _, m := range report.History {
+		peak = max(peak, m.Bytes)
+	}
+	type bar struct {
+		Time    string
+		Size    string
+		Percent int64
+	}
+	history := make([]bar, len(report.History))
+	for i, m := range report.History {
+		history[i] = bar{m.Time.Format("15:04"), formatSize(uint64(m.Bytes)), m.Bytes * 100 / peak}
+	}
+
+	var page strings.Builder
+	statsTemplate.Execute(&page, struct {
+		statsReport
+		Size    string
+		History []bar
+		JSON    string
+		Style   template.HTML
+	}{report, formatSize(uint64(report.Bytes)), history, "?format=json&download", template.HTML(look.style)})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(page.Len()))
+	writeBody(w, r, []byte(page.String()))
+}
+
+var statsTemplate = template.Must(template.New("stats").Funcs(template.FuncMap{
+	"size": func(n int64) string { return formatSize(uint64(n)) },
+	"ago":  func(t time.Time) string { return time.Since(t).Round(time.Second).String() },
+}).Parse(`<!doctype html>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width">
+<meta http-equiv="refresh" content="5">
+<title>Statistics</title>
+<p>{{.Requests}} requests, {{.Size}} to {{len .Clients}} clients in {{.Uptime}} · <a href="{{.JSON}}">Export JSON</a></p>
+<h2>Active transfers</h2>
+<table class="listing">
+<thead><tr><th>File</th><th>Client</th><th>Sent</th><th>Running</th></tr></thead>
+<tbody>
+{{- range .Transfers}}
+<tr><td>{{.Path}}</td><td>{{.IP}}</td><td class="size">{{size .Bytes}}{{if ge .Total 0}} / {{size .Total}}{{end}}</td><td class="time">{{ago .Start}}</td></tr>
+{{- else}}
+<tr><td>None</td></tr>
+{{- end}}
+</tbody>
+</table>
+<h2>Downloads</h2>
+<table class="listing">
+<thead><tr><th>File</th><th>Downloads</th><th>Clients</th><th>Sent</th><th>Last</th></tr></thead>
+<tbody>
+{{- range .Files}}
+<tr><td>{{.Path}}</td><td class="size">{{.Downloads}}</td><td class="size">{{.Clients}}</td><td class="size">{{size .Bytes}}</td><td class="time">{{ago .Last}} ago</td></tr>
+{{- else}}
+<tr><td>None</td></tr>
+{{- end}}
+</tbody>
+</table>
+<h2>Clients</h2>
+<table class="listing">
+<thead><tr><th>IP</th><th>Requests</th><th>Downloads</th><th>Sent</th><th>Last</th></tr></thead>
+<tbody>
+{{- range .Clients}}
+<tr><td>{{.IP}}</td><td class="size">{{.Requests}}</td><td class="size">{{.Downloads}}</td><td class="size">{{size .Bytes}}</td><td class="time">{{ago .Last}} ago</td></tr>
+{{- end}}
+</tbody>
+</table>
+<h2>Sent per minute</h2>
+<table class="listing">
+<tbody>
+{{- range .History}}
+<tr><td class="time">{{.Time}}</td><td><meter min="0" max="100" value="{{.Percent}}"></meter></td><td class="size">{{.Size}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+{{.Style}}
+`))
@@ -0,0 +1,121 @@
+package fylshr
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAccessStats checks what /_stats reports of the downloads, clients and
+// active transfers, as JSON and as a page, and who may see it.
+func TestAccessStats(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "b.txt": "0123456789"})
+	args := testArgs(t, dir, "-stats")
+	h := newHandler(args)
+	requests := []struct {
+		path, remote string
+	}{
+		{"/a.txt", "192.0.2.1:1"},
+		{"/a.txt", "192.0.2.2:1"},
+		{"/b.txt", "192.0.2.2:1"},
+		{"/missing.txt", "192.0.2.3:1"},
+		{healthPath, "192.0.2.3:1"},
+		{accessStatsPath, "192.0.2.3:1"},
+	}
+	for _, req := range requests {
+		r := httptest.NewRequest(http.MethodGet, req.path, nil)
+		r.RemoteAddr = req.remote
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	active := args.session.start(httptest.NewRequest(http.MethodGet, "/big.iso", nil))
+	active.bytes.Store(3)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, accessStatsPath+"?format=json", nil))
+	var report statsReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil || w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("GET %s?format=json = %q, %v", accessStatsPath, w.Body, err)
+	}
+	if len(report.Files) != 2 || report.Files[0].Path != "/a.txt" || report.Files[0].Downloads != 2 || report.Files[0].Clients != 2 || report.Files[0].Bytes != 10 || report.Files[1].Path != "/b.txt" {
+		t.Errorf("-stats files = %+v, want /a.txt downloaded twice by two clients then /b.txt", report.Files)
+	}
+	clients := map[string]clientReport{}
+	for _, client := range report.Clients {
+		clients[client.IP] = client
+	}
+	if c := clients["192.0.2.2"]; len(clients) != 3 || c.Requests != 2 || c.Downloads != 2 || c.Bytes != 15 || clients["192.0.2.3"].Downloads != 0 {
+		t.Errorf("-stats clients = %+v, want 192.0.2.2 with 2 downloads of 15 bytes", report.Clients)
+	}
+	if len(report.History) == 0 || report.History[len(report.History)-1].Bytes < 15 {
+		t.Errorf("-stats history = %+v, want this minute's bytes", report.History)
+	}
+	if len(report.Transfers) != 1 || report.Transfers[0].Path != "/big.iso" || report.Transfers[0].IP != "192.0.2.1" || report.Transfers[0].Bytes != 3 || report.Transfers[0].Total != -1 {
+		t.Errorf("-stats transfers = %+v, want /big.iso", report.Transfers)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, accessStatsPath+"?format=json&download", nil))
+	if got := w.Header().Get("Content-Disposition"); !strings.HasPrefix(got, `attachment; filename="fylshr-stats-`) {
+		t.Errorf("-stats export Content-Disposition %q, want an attachment", got)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, accessStatsPath, nil))
+	for _, want := range []string{`<meta http-equiv="refresh" content="5">`, "<td>/a.txt</td>", "<td>192.0.2.2</td>", "<td>/big.iso</td>", `<a href="?format=json&amp;download">Export JSON</a>`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("-stats page has no %s", want)
+		}
+	}
+
+	tests := []struct {
+		flags   []string
+		headers []string
+		status  int
+	}{
+		{nil, nil, http.StatusNotFound},
+		{[]string{"-stats", "-token", "s3cret"}, nil, http.StatusUnauthorized},
+		{[]string{"-stats", "-token", "s3cret"}, []string{"Authorization: Bearer s3cret"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if resp, _ := do(t, newTestServer(t, dir, tt.flags...), http.MethodGet, accessStatsPath, nil, tt.headers...); resp.StatusCode != tt.status {
+			t.Errorf("%v GET %s %v = %d, want %d", tt.flags, accessStatsPath, tt.headers, resp.StatusCode, tt.status)
+		}
+	}
+}
+
+// TestStatsCredit checks that the bytes of a long download are spread over
+// the minutes it took, within the history kept.
+func TestStatsCredit(t *testing.T) {
+	end := time.Unix(6000*60+30, 0)
+	tests := []struct {
+		took  time.Duration
+		bytes int64
+		want  []int64
+	}{
+		{0, 100, []int64{100}},
+		{3 * time.Minute, 301, []int64{75, 75, 75, 76}},
+		{2 * time.Hour, 600, []int64{10, 10, 10}},
+	}
+	for _, tt := range tests {
+		s := newSession()
+		s.credit(end.Add(-tt.took), end, tt.bytes)
+		var total int64
+		for _, bucket := range s.history {
+			total += bucket.bytes
+		}
+		last := int64(6000)
+		for i, want := range tt.want {
+			minute := last - int64(len(tt.want)-1-i)
+			if bucket := s.history[minute%statsHistory]; bucket.minute != minute || bucket.bytes != want {
+				t.Errorf("%d bytes in %s credit minute %d with %d, want %d", tt.bytes, tt.took, minute, bucket.bytes, want)
+			}
+		}
+		if total != tt.bytes {
+			t.Errorf("%d bytes in %s credit %d", tt.bytes, tt.took, total)
+		}
+	}
+}
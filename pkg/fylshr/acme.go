@@ -0,0 +1,140 @@
+package fylshr
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newACMEManager obtains and renews the certificates of domains from Let's
+// Encrypt with -acme, keeping them in cacheDir so restarts don't request new
+// ones, or in the user cache directory by default.
+func newACMEManager(domains []string, cacheDir, email string) *autocert.Manager {
+	if cacheDir == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			dir = os.TempDir()
+		}
+		cacheDir = filepath.Join(dir, "fylshr", "acme")
+	}
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cacheDir),
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Email:      email,
+	}
+}
+
+// serveACMEHTTP answers HTTP-01 challenges on port 80 and redirects
+// everything else there to HTTPS on the port of the first TCP listener. Port
+// 80 being taken or privileged isn't fatal, certificates can still be
+// obtained with TLS-ALPN-01 when the server listens on 443.
+func serveACMEHTTP(m *autocert.Manager, listeners []net.Listener) {
+	port := ""
+	if p := tcpPort(listeners); p != 443 {
+		port = ":" + strconv.Itoa(p)
+	}
+
+	l, err := net.Listen("tcp", ":80")
+	if err != nil {
+		log.Printf("-acme: %s, not redirecting HTTP to HTTPS", err)
+		return
+	}
+	srv := &http.Server{Handler: m.HTTPHandler(httpsRedirect(port))}
+	if err := srv.Serve(l); err != nil {
+		log.Printf("-acme: %s", err)
+	}
+}
+
+// httpsRedirect redirects to the same URL over HTTPS on port, like ":8443",
+// or the default one if empty.
+func httpsRedirect(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		http.Redirect(w, r, "https://"+strings.TrimSuffix(host, ".")+port+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// tcpPort returns the port of the first TCP listener, or 0 for none.
+func tcpPort(listeners []net.Listener) int {
+	for _, l := range listeners {
+		if addr, ok := l.Addr().(*net.TCPAddr); ok {
+			return addr.Port
+		}
+	}
+	return 0
+}
+
+// parseDomains splits the comma separated -domain list, which must be plain
+// host names, lowercased.
+func parseDomains(list string) ([]string, error) {
+	var domains []string
+	for _, domain := range strings.Split(list, ",") {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" {
+			continue
+		}
+		if strings.ContainsAny(domain, ":/ ") || net.ParseIP(domain) != nil {
+			return nil, fmt.Errorf("%q is not a domain name", domain)
+		}
+		domains = append(domains, domain)
+	}
+	if len(domains) == 0 {
+		return nil, errors.New("no domain name")
+	}
+	return domains, nil
+}
+
+const acmeChallengePath = "/.well-known/acme-challenge/"
+
+// serveACMEChallenge serves a single challenge token from webroot, outside of
+// the served folder and regardless of any rule that applies to it.
+func serveACMEChallenge(w http.ResponseWriter, r *http.Request, webroot, token string) {
+	if !isACMEToken(token) {
+		writeError(w, r, http.StatusNotFound, "404 page not found")
+		return
+	}
+
+	f, err := os.Open(filepath.Join(webroot, token))
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, "404 page not found")
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		writeError(w, r, http.StatusNotFound, "404 page not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	http.ServeContent(w, r, token, info.ModTime(), f)
+}
+
+// isACMEToken reports whether token only uses the base64url alphabet, as
+// required by RFC 8555.
+func isACMEToken(token string) bool {
+	if token == "" {
+		return false
+	}
+
+	for _, c := range token {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,174 @@
+package fylshr
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestACMEChallenge(t *testing.T) {
+	dir, webroot := t.TempDir(), t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", ".well-known/acme-challenge/folder-token": "from the folder"})
+	writeFiles(t, webroot, map[string]string{"abc-DEF_123": "abc-DEF_123.thumbprint", "sub/x": "nested", "a.b": "dotted"})
+
+	tests := []struct {
+		flags  []string
+		path   string
+		status int
+		body   string
+	}{
+		{nil, acmeChallengePath + "abc-DEF_123", http.StatusOK, "abc-DEF_123.thumbprint"},
+		{[]string{"-token", "s3cret"}, acmeChallengePath + "abc-DEF_123", http.StatusOK, "abc-DEF_123.thumbprint"},
+		{[]string{"-auth", "user:pass"}, acmeChallengePath + "abc-DEF_123", http.StatusOK, "abc-DEF_123.thumbprint"},
+		{[]string{"-token", "s3cret"}, "/a.txt", http.StatusUnauthorized, ""},
+		{nil, acmeChallengePath + "missing", http.StatusNotFound, ""},
+		{nil, acmeChallengePath + "folder-token", http.StatusNotFound, ""},
+		{nil, acmeChallengePath + "a.b", http.StatusNotFound, ""},
+		{nil, acmeChallengePath + "sub", http.StatusNotFound, ""},
+		{nil, acmeChallengePath + "sub/x", http.StatusNotFound, ""},
+		{nil, acmeChallengePath, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, append([]string{"-acme-webroot", webroot}, tt.flags...)...)
+		resp, body := do(t, srv, http.MethodGet, tt.path, nil)
+		if resp.StatusCode != tt.status || tt.body != "" && body != tt.body {
+			t.Errorf("%v GET %s = %d %q, want %d %q", tt.flags, tt.path, resp.StatusCode, body, tt.status, tt.body)
+		}
+		if tt.status == http.StatusOK && resp.Header.Get("Content-Type") != "text/plain" {
+			t.Errorf("%v GET %s Content-Type %q, want text/plain", tt.flags, tt.path, resp.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestIsACMEToken(t *testing.T) {
+	tests := []struct {
+		token string
+		want  bool
+	}{
+		{"abc-DEF_123", true},
+		{"LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0", true},
+		{"", false},
+		{"a.b", false},
+		{"a/b", false},
+		{"a b", false},
+		{"a=", false},
+		{"é", false},
+	}
+	for _, tt := range tests {
+		if got := isACMEToken(tt.token); got != tt.want {
+			t.Errorf("isACMEToken(%q) = %v, want %v", tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestParseDomains(t *testing.T) {
+	tests := []struct {
+		list string
+		want string
+		ok   bool
+	}{
+		{"files.example.com", "files.example.com", true},
+		{" Files.Example.com, www.example.com ", "files.example.com www.example.com", true},
+		{"files.example.com,", "files.example.com", true},
+		{"", "", false},
+		{" , ", "", false},
+		{"192.0.2.1", "", false},
+		{"files.example.com:443", "", false},
+		{"https://files.example.com", "", false},
+	}
+	for _, tt := range tests {
+		domains, err := parseDomains(tt.list)
+		if got := strings.Join(domains, " "); got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("parseDomains(%q) = %q, %v, want %q", tt.list, got, err, tt.want)
+		}
+	}
+}
+
+// TestACMEFlags checks what -acme sets up: TLS for -domain only, port 443
+// by default and certificates kept in -acme-cache.
+func TestACMEFlags(t *testing.T) {
+	cache := t.TempDir()
+	tests := []struct {
+		flags []string
+		ports []string
+	}{
+		{nil, []string{"443"}},
+		{[]string{"-port", "8443"}, []string{"8443"}},
+		{[]string{"-listen", "127.0.0.1:8443"}, nil},
+	}
+	for _, tt := range tests {
+		flags := append([]string{"-silent", "-folder", t.TempDir(), "-acme", "-domain", "Files.Example.com,www.example.com", "-acme-cache", cache}, tt.flags...)
+		args := parseTestArgs(t, flags...)
+		if !args.tls || args.acme == nil || !slices.Equal(args.ports, tt.ports) || !slices.Equal(args.domains, []string{"files.example.com", "www.example.com"}) {
+			t.Errorf("%v = tls %v ports %v domains %v, want tls on ports %v", tt.flags, args.tls, args.ports, args.domains, tt.ports)
+			continue
+		}
+		if args.acme.Cache != autocert.DirCache(cache) {
+			t.Errorf("-acme-cache keeps certificates in %v, want %s", args.acme.Cache, cache)
+		}
+		for host, ok := range map[string]bool{"files.example.com": true, "www.example.com": true, "other.example.com": false} {
+			if err := args.acme.HostPolicy(context.Background(), host); (err == nil) != ok {
+				t.Errorf("-acme for %s = %v, want allowed %v", host, err, ok)
+			}
+		}
+		config, err := newTLSConfig(args)
+		if err != nil || config.MinVersion != tls.VersionTLS12 || !slices.Contains(config.NextProtos, "acme-tls/1") {
+			t.Errorf("-acme TLS config %+v, %v, want TLS 1.2 and TLS-ALPN-01", config, err)
+		}
+	}
+
+	fails := []struct {
+		flags []string
+		want  string
+	}{
+		{[]string{"-acme"}, "-acme needs -domain"},
+		{[]string{"-acme", "-domain", "192.0.2.1"}, "invalid -domain"},
+		{[]string{"-acme", "-domain", "files.example.com", "-cert", "cert.pem", "-key", "key.pem"}, "-acme and -cert are exclusive"},
+	}
+	for _, tt := range fails {
+		out, err := mainCommand(append([]string{"-folder", t.TempDir(), "-dry-run"}, tt.flags...)...).CombinedOutput()
+		if err == nil || !strings.Contains(string(out), tt.want) {
+			t.Errorf("%v = %v %q, want it to fail with %q", tt.flags, err, out, tt.want)
+		}
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		port, host, target, want string
+	}{
+		{"", "files.example.com", "/a.txt", "https://files.example.com/a.txt"},
+		{"", "files.example.com:80", "/sub/?sort=size", "https://files.example.com/sub/?sort=size"},
+		{":8443", "files.example.com.", "/", "https://files.example.com:8443/"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		r.Host = tt.host
+		w := httptest.NewRecorder()
+		httpsRedirect(tt.port).ServeHTTP(w, r)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != tt.want {
+			t.Errorf("http://%s%s redirects %d to %q, want %q", tt.host, tt.target, w.Code, w.Header().Get("Location"), tt.want)
+		}
+	}
+}
+
+func TestBannerDomains(t *testing.T) {
+	l := bannerListener(t)
+	args := testArgs(t, t.TempDir())
+	args.banner, args.domains = "text", []string{"files.example.com", "www.example.com"}
+	banner := capture(t, &os.Stdout, func() { printBanner(args, []net.Listener{l}) })
+	for _, domain := range args.domains {
+		if want := fmt.Sprintf("https://%s:%d\n", domain, l.Addr().(*net.TCPAddr).Port); !strings.Contains(banner, want) {
+			t.Errorf("-acme banner %q doesn't show %q", banner, want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package fylshr
+
+import (
+	"cmp"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// virtualInterfaces are name prefixes of the bridges and tunnels containers
+// and VMs add, whose addresses other machines can't reach.
+var virtualInterfaces = []string{"docker", "br-", "veth", "virbr", "vmnet", "vboxnet", "cni", "flannel", "podman", "lxc", "lxd"}
+
+// lanAddr is an address of a network interface, zoned when it's an IPv6
+// link-local address that only means something on that interface.
+type lanAddr struct {
+	iface string
+	ip    netip.Addr
+}
+
+// lanAddrs returns the addresses other machines may reach the server on, or
+// those of the interface iface only, best first: IPv4 before IPv6, global
+// before link-local, and the ones of virtual interfaces last.
+func lanAddrs(iface string) ([]lanAddr, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []lanAddr
+	found := false
+	for _, i := range interfaces {
+		if iface != "" && i.Name != iface {
+			continue
+		}
+		found = true
+		if i.Flags&net.FlagUp == 0 || i.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		ifaceAddrs, err := i.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range ifaceAddrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip, ok := netip.AddrFromSlice(ipnet.IP)
+			if !ok {
+				continue
+			}
+			ip = ip.Unmap()
+			switch {
+			case ip.IsLoopback() || ip.IsMulticast() || ip.IsUnspecified():
+				continue
+			// 169.254.x.x is what's left without DHCP, nobody can reach it.
+			case ip.Is4() && ip.IsLinkLocalUnicast():
+				continue
+			case ip.Is6() && ip.IsLinkLocalUnicast():
+				ip = ip.WithZone(i.Name)
+			}
+			addrs = append(addrs, lanAddr{i.Name, ip})
+		}
+	}
+	if iface != "" && !found {
+		return nil, fmt.Errorf("no interface %s", iface)
+	}
+
+	slices.SortStableFunc(addrs, func(a, b lanAddr) int {
+		return cmp.Compare(a.rank(), b.rank())
+	})
+	return addrs, nil
+}
+
+func (a lanAddr) rank() int {
+	rank := 0
+	if a.ip.Is6() {
+		rank = 1
+	}
+	if a.ip.IsLinkLocalUnicast() {
+		rank = 2
+	}
+	if slices.ContainsFunc(virtualInterfaces, func(prefix string) bool { return strings.HasPrefix(a.iface, prefix) }) {
+		rank += 3
+	}
+	return rank
+}
+
+// bannerAddrs returns the addresses the banner prints for a listener on all
+// of them, ipv4 and ipv6 telling which families it accepts.
+func bannerAddrs(args Args, ipv4, ipv6 bool) []netip.Addr {
+	if args.advertiseIP.IsValid() {
+		return []netip.Addr{args.advertiseIP}
+	}
+	var addrs []netip.Addr
+	for _, a := range args.lanAddrs {
+		if a.ip.Is4() && ipv4 || a.ip.Is6() && ipv6 {
+			addrs = append(addrs, a.ip)
+		}
+	}
+	return addrs
+}
+
+// hostPort joins ip and port for a URL, in brackets for IPv6 and with the
+// % of a zone escaped.
+func hostPort(ip netip.Addr, port string) string {
+	return net.JoinHostPort(strings.Replace(ip.String(), "%", "%25", 1), port)
+}
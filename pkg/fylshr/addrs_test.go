@@ -0,0 +1,130 @@
+package fylshr
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHostPort(t *testing.T) {
+	tests := []struct {
+		ip, want string
+	}{
+		{"192.168.1.5", "192.168.1.5:8080"},
+		{"2001:db8::1", "[2001:db8::1]:8080"},
+		{"fe80::1%eth0", "[fe80::1%25eth0]:8080"},
+	}
+	for _, tt := range tests {
+		if got := hostPort(netip.MustParseAddr(tt.ip), "8080"); got != tt.want {
+			t.Errorf("hostPort(%s) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestLanAddrRank(t *testing.T) {
+	tests := []struct {
+		iface, ip string
+		want      int
+	}{
+		{"eth0", "192.168.1.5", 0},
+		{"eth0", "2001:db8::5", 1},
+		{"eth0", "fe80::1%eth0", 2},
+		{"docker0", "172.17.0.1", 3},
+		{"br-1a2b", "fd00::1", 4},
+		{"veth0", "fe80::2%veth0", 5},
+	}
+	for _, tt := range tests {
+		if got := (lanAddr{tt.iface, netip.MustParseAddr(tt.ip)}).rank(); got != tt.want {
+			t.Errorf("rank of %s on %s = %d, want %d", tt.ip, tt.iface, got, tt.want)
+		}
+	}
+}
+
+// TestLanAddrs checks the addresses of this machine's interfaces: none of
+// loopback, link-local IPv6 ones zoned, and -interface naming a missing one
+// refused.
+func TestLanAddrs(t *testing.T) {
+	addrs, err := lanAddrs("")
+	if err != nil {
+		t.Skip(err)
+	}
+	for i, a := range addrs {
+		if a.ip.IsLoopback() || a.ip.Is6() && a.ip.IsLinkLocalUnicast() && a.ip.Zone() != a.iface {
+			t.Errorf("lanAddrs has %s of %s", a.ip, a.iface)
+		}
+		if i > 0 && addrs[i-1].rank() > a.rank() {
+			t.Errorf("lanAddrs lists %s before %s", addrs[i-1].ip, a.ip)
+		}
+	}
+
+	interfaces, _ := net.Interfaces()
+	for _, i := range interfaces {
+		if i.Flags&net.FlagLoopback != 0 {
+			if addrs, err := lanAddrs(i.Name); err != nil || len(addrs) != 0 {
+				t.Errorf("lanAddrs(%s) = %v, %v, want no address", i.Name, addrs, err)
+			}
+		}
+	}
+	if _, err := lanAddrs("missing0"); err == nil {
+		t.Errorf("lanAddrs(missing0) finds it")
+	}
+}
+
+// TestBannerAddrs checks which interface addresses the banner prints for each
+// -network, and that -advertise-ip replaces them.
+func TestBannerAddrs(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+	addrs := []lanAddr{
+		{"eth0", netip.MustParseAddr("192.168.1.5")},
+		{"eth0", netip.MustParseAddr("2001:db8::5")},
+		{"eth0", netip.MustParseAddr("fe80::1%eth0")},
+	}
+
+	tests := []struct {
+		flags []string
+		want  []string
+	}{
+		{[]string{"-network", "tcp4"}, []string{"192.168.1.5"}},
+		{[]string{"-network", "tcp6"}, []string{"[2001:db8::5]", "[fe80::1%25eth0]"}},
+		{[]string{"-network", "dual"}, []string{"192.168.1.5", "[2001:db8::5]", "[fe80::1%25eth0]"}},
+		{[]string{"-network", "dual", "-advertise-ip", "203.0.113.7"}, []string{"203.0.113.7"}},
+		{[]string{"-network", "dual", "-advertise-ip", "::ffff:203.0.113.7"}, []string{"203.0.113.7"}},
+	}
+	for _, tt := range tests {
+		args := testArgs(t, t.TempDir(), tt.flags...)
+		args.banner, args.lanAddrs = "text", addrs
+		banner := capture(t, &os.Stdout, func() { printBanner(args, []net.Listener{l}) })
+		var got []string
+		for _, line := range strings.Split(banner, "\n") {
+			if host, ok := strings.CutPrefix(line, "http://"); ok && !strings.HasPrefix(host, "localhost:") {
+				got = append(got, strings.TrimSuffix(host, ":"+strconv.Itoa(port)))
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%v banner %q lists %q, want %q", tt.flags, banner, got, tt.want)
+		}
+	}
+
+	fails := []struct {
+		flags []string
+		want  string
+	}{
+		{[]string{"-interface", "missing0"}, "invalid -interface: no interface missing0"},
+		{[]string{"-advertise-ip", "files.example.com"}, "invalid -advertise-ip"},
+	}
+	for _, tt := range fails {
+		out, err := mainCommand(append([]string{"-folder", t.TempDir(), "-dry-run"}, tt.flags...)...).CombinedOutput()
+		if err == nil || !strings.Contains(string(out), tt.want) {
+			t.Errorf("%v = %v %q, want it to fail with %q", tt.flags, err, out, tt.want)
+		}
+	}
+}
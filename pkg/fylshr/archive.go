@@ -0,0 +1,277 @@
+package fylshr
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"cmp"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+)
+
+const archivePath = "/_archive"
+
+// archiveFormats are the formats a directory can be downloaded as, with ?zip
+// or ?tar.gz, and those of a selection POSTed to archivePath.
+var archiveFormats = []string{"zip", "tar.gz"}
+
+// archiveMethods are accepted under archivePath.
+var archiveMethods = []string{http.MethodPost}
+
+// archiveWriter is an archive being streamed to the client.
+type archiveWriter interface {
+	// add writes the entry name for info, with the contents read from src for
+	// a regular file, the target link for a symlink, or nothing for a
+	// directory. Only errors writing to the client are returned.
+	add(name string, info fs.FileInfo, link string, src io.Reader) error
+	Close() error
+}
+
+// zipArchive only holds regular files, zip having no portable way to keep
+// symlinks and permissions.
+type zipArchive struct{ *zip.Writer }
+
+func (a zipArchive) add(name string, info fs.FileInfo, link string, src io.Reader) error {
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return nil
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	dst, err := a.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// tarArchive keeps the permissions of files and directories, and symlinks as
+// symlinks.
+type tarArchive struct {
+	tw *tar.Writer
+	gz *gzip.Writer
+}
+
+func (a tarArchive) add(name string, info fs.FileInfo, link string, src io.Reader) error {
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return nil
+	}
+	header.Name = name
+	if err := a.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if src != nil {
+		// A file growing while it's read is cut at the size in its header.
+		_, err = io.CopyN(a.tw, src, header.Size)
+	}
+	return err
+}
+
+func (a tarArchive) Close() error {
+	return cmp.Or(a.tw.Close(), a.gz.Close())
+}
+
+// newArchive sends the headers of the download of dir as format, and returns
+// the archive to write it or nil for a HEAD request.
+func newArchive(w http.ResponseWriter, r *http.Request, dir, format string) archiveWriter {
+	name := path.Base(dir)
+	if dir == "/" {
+		name = "files"
+	}
+	contentType := "application/zip"
+	if format == "tar.gz" {
+		contentType = "application/gzip"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + "." + format}))
+	if r.Method == http.MethodHead {
+		return nil
+	}
+
+	if format == "tar.gz" {
+		gz := gzip.NewWriter(w)
+		return tarArchive{tw: tar.NewWriter(gz), gz: gz}
+	}
+	return zipArchive{zip.NewWriter(w)}
+}
+
+// serveArchive streams the directory dir of fsys as a zip or tar.gz archive,
+// built while it's sent so nothing is buffered. Subdirectories allowed rejects
+// are left out, as are files that can't be read, since the response has long
+// started. localPath gives the file of a symlink, to read its target.
+func serveArchive(w http.ResponseWriter, r *http.Request, fsys http.FileSystem, localPath func(string) string, dir, format string, allowed func(name string) bool) {
+	f, err := fsys.Open(dir)
+	if err != nil {
+		writeListingError(w, r, err)
+		return
+	}
+	f.Close()
+
+	a := newArchive(w, r, dir, format)
+	if a == nil {
+		return
+	}
+	if err := addToArchive(a, fsys, localPath, dir, "", allowed); err != nil {
+		log.Printf("%s %s: %s", format, dir, err)
+	}
+	if err := a.Close(); err != nil {
+		log.Printf("%s %s: %s", format, dir, err)
+	}
+}
+
+// serveSelection streams one archive of the files and directories selected in
+// the listing of the form field dir, POSTed to archivePath as path fields
+// naming entries of dir, in the format zip or tar.gz. Everything selected is
+// checked before the download starts so a bad selection is an error rather
+// than a short archive.
+func serveSelection(w http.ResponseWriter, r *http.Request, fsys http.FileSystem, localPath func(string) string, allowed func(name string) bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, r, http.StatusMethodNotAllowed, "405 method not allowed")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "400 bad form")
+		return
+	}
+	dir := path.Clean("/" + r.PostForm.Get("dir"))
+	format := cmp.Or(r.PostForm.Get("format"), "zip")
+	if !slices.Contains(archiveFormats, format) {
+		writeError(w, r, http.StatusBadRequest, "400 format must be zip or tar.gz")
+		return
+	}
+
+	type selected struct {
+		name string
+		info fs.FileInfo
+	}
+	var selection []selected
+	for _, p := range r.PostForm["path"] {
+		name := path.Join(dir, p)
+		if path.Dir(name) != dir || name == dir {
+			writeError(w, r, http.StatusBadRequest, "400 "+p+" is not in "+dir)
+			return
+		}
+		if slices.ContainsFunc(selection, func(s selected) bool { return s.name == name }) {
+			continue
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			writeListingError(w, r, err)
+			return
+		}
+		info, err := f.Stat()
+		f.Close()
+		if err != nil {
+			writeListingError(w, r, err)
+			return
+		}
+		if info.IsDir() && !allowed(name+"/") || !allowed(name) {
+			writeError(w, r, http.StatusForbidden, "403 forbidden")
+			return
+		}
+		if link, err := os.Lstat(localPath(name)); err == nil && link.Mode()&fs.ModeSymlink != 0 && format == "tar.gz" {
+			info = link
+		}
+		selection = append(selection, selected{name, info})
+	}
+	if len(selection) == 0 {
+		writeError(w, r, http.StatusBadRequest, "400 nothing selected")
+		return
+	}
+
+	a := newArchive(w, r, dir, format)
+	for _, s := range selection {
+		if err := addEntry(a, fsys, localPath, s.name, path.Base(s.name), s.info, allowed); err != nil {
+			log.Printf("%s %s: %s", format, dir, err)
+			break
+		}
+	}
+	if err := a.Close(); err != nil {
+		log.Printf("%s %s: %s", format, dir, err)
+	}
+}
+
+// addToArchive adds the contents of dir under prefix in the archive. Only
+// errors writing to the client stop it.
+func addToArchive(a archiveWriter, fsys http.FileSystem, localPath func(string) string, dir, prefix string, allowed func(name string) bool) error {
+	f, err := fsys.Open(dir)
+	if err != nil {
+		return nil
+	}
+	infos, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return nil
+	}
+
+	for _, info := range infos {
+		if err := addEntry(a, fsys, localPath, path.Join(dir, info.Name()), prefix+info.Name(), info, allowed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addEntry adds the file name of fsys as the entry of the archive, with its
+// contents if it's a directory allowed accepts.
+func addEntry(a archiveWriter, fsys http.FileSystem, localPath func(string) string, name, entry string, info fs.FileInfo, allowed func(name string) bool) error {
+	switch {
+	case info.IsDir():
+		if !allowed(name + "/") {
+			return nil
+		}
+		if err := a.add(entry+"/", info, "", nil); err != nil {
+			return err
+		}
+		return addToArchive(a, fsys, localPath, name, entry+"/", allowed)
+	case info.Mode()&fs.ModeSymlink != 0:
+		link, err := os.Readlink(localPath(name))
+		if err != nil {
+			return nil
+		}
+		return a.add(entry, info, link, nil)
+	case info.Mode().IsRegular():
+		src, err := fsys.Open(name)
+		if err != nil {
+			return nil
+		}
+		defer src.Close()
+		return a.add(entry, info, "", src)
+	}
+	return nil
+}
+
+// archiveFormat returns the format of ?zip or ?tar.gz, or "" for neither.
+func archiveFormat(r *http.Request) string {
+	query := r.URL.Query()
+	for _, format := range archiveFormats {
+		if query.Has(format) {
+			return format
+		}
+	}
+	return ""
+}
+
+// archiveHref links to the archive of the listed directory in format, keeping
+// the query so a ?token= still applies.
+func archiveHref(r *http.Request, format string) string {
+	query := r.URL.Query()
+	query.Del("sort")
+	query.Del("order")
+	query.Del("view")
+	query.Set(format, "")
+	return "?" + query.Encode()
+}
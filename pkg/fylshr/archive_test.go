@@ -0,0 +1,175 @@
+package fylshr
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"cmp"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// archiveEntries lists the entries of a zip or tar.gz body as name, or
+// name -> target for symlinks, with the contents and modes of files. Zip
+// archives only hold regular files.
+func archiveEntries(t *testing.T, format, body string) (names []string, contents map[string]string, modes map[string]fs.FileMode) {
+	t.Helper()
+	contents, modes = map[string]string{}, map[string]fs.FileMode{}
+	if format == "zip" {
+		zr, err := zip.NewReader(strings.NewReader(body), int64(len(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := io.ReadAll(rc)
+			rc.Close()
+			contents[f.Name] = string(b)
+			modes[f.Name] = f.Mode()
+		}
+		return names, contents, modes
+	}
+
+	gz, err := gzip.NewReader(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return names, contents, modes
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := h.Name
+		if h.Typeflag == tar.TypeSymlink {
+			name += " -> " + h.Linkname
+		}
+		names = append(names, name)
+		b, _ := io.ReadAll(tr)
+		contents[h.Name] = string(b)
+		modes[h.Name] = h.FileInfo().Mode()
+	}
+}
+
+func archiveTree(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.txt":            "hello",
+		"sub/b.txt":        "nested",
+		"sub/run.sh":       "#!/bin/sh",
+		".env":             "SECRET=1",
+		"debug.log":        "log",
+		"sec/" + tokenFile: "s3cret",
+		"sec/f.txt":        "private",
+	})
+	if err := os.Chmod(filepath.Join(dir, "sub", "run.sh"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("b.txt", filepath.Join(dir, "sub", "link")); err != nil {
+		t.Skipf("symlinks: %s", err)
+	}
+	return dir
+}
+
+func TestArchive(t *testing.T) {
+	dir := archiveTree(t)
+	srv := newTestServer(t, dir, "-exclude", "*.log")
+
+	tests := []struct {
+		name, target, format, filename string
+		want                           []string
+	}{
+		{"zip", "/?zip", "zip", "files.zip", []string{"a.txt", "sub/b.txt", "sub/run.sh"}},
+		{"zip with token", "/?zip&token=s3cret", "zip", "files.zip", []string{"a.txt", "sec/f.txt", "sub/b.txt", "sub/run.sh"}},
+		{"zip of a folder", "/sub/?zip", "zip", "sub.zip", []string{"b.txt", "run.sh"}},
+		{"tar.gz", "/sub/?tar.gz", "tar.gz", "sub.tar.gz", []string{"b.txt", "link -> b.txt", "run.sh"}},
+		{"tar.gz of the root", "/?tar.gz", "tar.gz", "files.tar.gz", []string{"a.txt", "sub/", "sub/b.txt", "sub/link -> b.txt", "sub/run.sh"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, srv, http.MethodGet, tt.target, nil)
+			if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Disposition"), `filename=`+tt.filename) {
+				t.Fatalf("GET %s = %d Content-Disposition %q, want 200 %s", tt.target, resp.StatusCode, resp.Header.Get("Content-Disposition"), tt.filename)
+			}
+			names, contents, modes := archiveEntries(t, tt.format, body)
+			slices.Sort(names)
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("GET %s has %q, want %q", tt.target, names, tt.want)
+			}
+			for name, content := range contents {
+				if strings.Contains(content, "SECRET") || strings.Contains(content, "s3cret") {
+					t.Errorf("GET %s has %s with %q", tt.target, name, content)
+				}
+				if strings.HasSuffix(name, "run.sh") && modes[name].Perm() != 0o755 {
+					t.Errorf("GET %s has %s with mode %s, want 0755", tt.target, name, modes[name])
+				}
+				if strings.HasSuffix(name, "b.txt") && content != "nested" {
+					t.Errorf("GET %s has %s with %q, want nested", tt.target, name, content)
+				}
+			}
+		})
+	}
+
+	if resp, _ := do(t, srv, http.MethodGet, "/sec/?zip", nil); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET /sec/?zip = %d, want 403", resp.StatusCode)
+	}
+	if resp, body := do(t, srv, http.MethodGet, "/a.txt?zip", nil); body != "hello" {
+		t.Errorf("GET /a.txt?zip = %d %q, want the file", resp.StatusCode, body)
+	}
+}
+
+func TestArchiveSelection(t *testing.T) {
+	dir := archiveTree(t)
+	srv := newTestServer(t, dir)
+
+	tests := []struct {
+		name   string
+		form   url.Values
+		status int
+		want   []string
+	}{
+		{"files", url.Values{"dir": {"/"}, "path": {"a.txt", "sub"}}, http.StatusOK, []string{"a.txt", "sub/b.txt", "sub/run.sh"}},
+		{"tar.gz", url.Values{"dir": {"/sub"}, "path": {"link", "b.txt", "b.txt"}, "format": {"tar.gz"}}, http.StatusOK, []string{"b.txt", "link -> b.txt"}},
+		{"outside the dir", url.Values{"dir": {"/sub"}, "path": {"../a.txt"}}, http.StatusBadRequest, nil},
+		{"nested", url.Values{"dir": {"/"}, "path": {"sub/b.txt"}}, http.StatusBadRequest, nil},
+		{"nothing", url.Values{"dir": {"/"}}, http.StatusBadRequest, nil},
+		{"missing", url.Values{"dir": {"/"}, "path": {"nope.txt"}}, http.StatusNotFound, nil},
+		{"other format", url.Values{"dir": {"/"}, "path": {"a.txt"}, "format": {"rar"}}, http.StatusBadRequest, nil},
+		{"token dir", url.Values{"dir": {"/"}, "path": {"sec"}}, http.StatusForbidden, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, srv, http.MethodPost, archivePath, strings.NewReader(tt.form.Encode()), "Content-Type: application/x-www-form-urlencoded")
+			if resp.StatusCode != tt.status {
+				t.Fatalf("POST %v = %d %s, want %d", tt.form, resp.StatusCode, body, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			names, _, _ := archiveEntries(t, cmp.Or(tt.form.Get("format"), "zip"), body)
+			slices.Sort(names)
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("POST %v has %q, want %q", tt.form, names, tt.want)
+			}
+		})
+	}
+
+	if resp, _ := do(t, srv, http.MethodGet, archivePath, nil); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET %s = %d, want 405", archivePath, resp.StatusCode)
+	}
+}
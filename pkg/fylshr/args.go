@@ -0,0 +1,962 @@
+package fylshr
+
+import (
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+type Args struct {
+	ports            portFlags
+	listen           listenFlags
+	folder           string
+	silent           bool
+	headers          headerFlags
+	favicon          string
+	du               bool
+	basePath         string
+	obscure          bool
+	noKeepAlive      bool
+	acmeWebroot      string
+	debug            bool
+	parseUA          bool
+	requestTimeout   time.Duration
+	noCompress       bool
+	gzipLevel        int
+	brotliLevel      int
+	compressRaw      bool
+	cacheControl     string
+	etag             string
+	cacheControlExt  cacheControlFlags
+	debugEndpoints   bool
+	systemd          bool
+	logFormat        string
+	logFile          io.Writer
+	dryRun           bool
+	color            bool
+	xsendfile        string
+	xsendfilePrefix  string
+	maintenance      *atomic.Bool
+	maintenanceAllow []netip.Prefix
+	noRedirectSlash  bool
+	tui              *dashboard
+	disposition      string
+	attachExt        []string
+	inlineExt        []string
+	imageNegotiation bool
+	quietPaths       []string
+	methods          []string
+	network          string
+	maxFileSize      int64
+	prefixMethods    prefixMethodFlags
+	configEndpoint   bool
+	lanOnly          bool
+	rootPage         string
+	rootPageStyle    bool
+	follow           bool
+	defaultType      string
+	sniff            bool
+	shutdownTimeout  time.Duration
+	noLAN            bool
+	lanAddrs         []lanAddr
+	advertiseIP      netip.Addr
+	digest           []string
+	overlay          folderFlags
+	progress         *progress
+	inbox            string
+	sitemap          string
+	banner           string
+	spaHash          *regexp.Regexp
+	profile          bool
+	profileAddr      string
+	indexLang        string
+	rewrites         []rewriteRule
+	bufferSize       int
+	logSink          *logSink
+	hooks            *hooks
+	pin              *pinGate
+	upload           bool
+	uploadLimits     uploadLimits
+	qr               bool
+	share            *share
+	auth             string
+	token            string
+	tls              bool
+	acme             *autocert.Manager
+	domains          []string
+	certFile         string
+	keyFile          string
+	minTLS           uint16
+	tlsCiphers       string
+	http3            bool
+	webdav           bool
+	limitRate        int64
+	limitTotal       int64
+	mdns             bool
+	thumbnails       bool
+	thumbSlots       chan struct{}
+	thumbCache       *thumbCache
+	gallery          bool
+	dirsFirst        bool
+	title            string
+	dateFormat       func(t time.Time) string
+	hideDotfiles     bool
+	allowDot         []string
+	followSymlinks   bool
+	exclude          []ignoreRule
+	gitignore        bool
+	allow            []netip.Prefix
+	deny             []netip.Prefix
+	maxRPS           float64
+	maxConns         int
+	maxConnsPerIP    int
+	paste            bool
+	receive          bool
+	manage           bool
+	mounts           []mount
+	checksums        bool
+	render           bool
+	spa              bool
+	metrics          bool
+	stats            bool
+	live             bool
+	watch            bool
+	// What the server keeps between requests, its own even when a process
+	// runs several.
+	session        *session
+	requestMetrics *metrics
+	sitemapCache   *sitemapCache
+	look           *look
+	mimeTypes      mimeTypes
+}
+
+// layers returns the served folders in order of precedence.
+func (args Args) layers() []string {
+	return append([]string{args.folder}, args.overlay...)
+}
+
+// tokenAllowed reports whether r has the token of every layer's nearest token
+// file for name.
+func (args Args) tokenAllowed(r *http.Request, name string) bool {
+	for _, folder := range args.layers() {
+		if !checkDirToken(r, folder, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// localPath returns the file name in the first layer that has it, or in
+// -folder when none does, mirroring overlayFS.
+func (args Args) localPath(name string) string {
+	name = filepath.FromSlash(path.Clean("/" + name))
+	for _, folder := range args.layers() {
+		p := filepath.Join(folder, name)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+		if hasFileAncestor(http.Dir(folder), filepath.ToSlash(name)) {
+			break
+		}
+	}
+	return filepath.Join(args.folder, name)
+}
+
+// isFile reports whether name is a regular file of the folder or mounts,
+// whose body is sent as is.
+func (args Args) isFile(name string) bool {
+	local := args.localPath(name)
+	if m, rel := args.mountFor(name); m != nil {
+		local = filepath.Join(m.dir, filepath.FromSlash(rel))
+	}
+	info, err := os.Stat(local)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// landed returns the callback of uploads for r, firing the hooks of
+// -on-upload and -webhook-url.
+func (args Args) landed(r *http.Request) func(name string, start time.Time) {
+	return func(name string, start time.Time) {
+		if args.hooks != nil {
+			args.hooks.uploaded(r, args.folder, name, start)
+		}
+	}
+}
+
+// hidden reports whether the file server should pretend the file name doesn't
+// exist.
+func (args Args) hidden(name string, info fs.FileInfo) bool {
+	if info.Name() == tokenFile || args.escapes(name) {
+		return true
+	}
+	if args.maxFileSize > 0 && !info.IsDir() && info.Size() > args.maxFileSize {
+		return true
+	}
+	return args.excluded(name, info.IsDir())
+}
+
+// parseArgs defines the flags of the command on flags and parses arguments,
+// then with settings the FYLSHR_* variables and the -config file. Invalid
+// values are fatal.
+func parseArgs(flags *flag.FlagSet, arguments []string, settings bool) (Args, error) {
+	var ports portFlags
+	flags.Var(&ports, "port", "Port to listen, can be repeated or comma separated (default 1080 without -listen)")
+	var listens listenFlags
+	flags.Var(&listens, "listen", "Address to listen on as host:port, [::]:port or unix:/path, can be repeated")
+	folder := flags.String("folder", "public", "Folder to serve")
+	var mounts mountFlags
+	flags.Var(&mounts, "mount", "Serve a folder under a path instead of -folder, as /prefix=folder, can be repeated; / lists the mounts")
+	silent := flags.Bool("silent", false, "Do not log requests")
+	var headers headerFlags
+	flags.Var(&headers, "header", "Response header as \"Name: Value\", can be repeated (the file server may override Content-Type, Content-Length, Last-Modified and Content-Range)")
+	favicon := flags.String("favicon", "", "Icon served at /favicon.ico when the folder has none")
+	du := flags.Bool("du", false, "Count files and size of the served folder at startup")
+	basePath := flags.String("base-path", "", "URL prefix to strip when served behind a proxy at a subpath, e.g. /files")
+	obscure := flags.Bool("obscure", false, "Serve everything under a random /s/<secret>/ prefix printed at startup, and 404 anywhere else")
+	noKeepAlive := flags.Bool("no-keepalive", false, "Close connections after each request")
+	acmeWebroot := flags.String("acme-webroot", "", "Directory with ACME HTTP-01 tokens served at "+acmeChallengePath)
+	debug := flags.Bool("debug", false, "Dump request and response headers to stderr")
+	parseUA := flags.Bool("parse-ua", false, "Log browser and OS instead of the raw User-Agent")
+	requestTimeout := flags.Duration("request-timeout", 0, "Respond 503 to requests taking longer than this, except file downloads, range requests and uploads (0 to disable)")
+	gzipLevel := flags.Int("gzip-level", gzip.DefaultCompression, "Level of gzip compression, from 1 for the fastest to 9 for the smallest responses at more CPU each, or -1 for the default")
+	brotliLevel := flags.Int("brotli-level", brotli.DefaultCompression, "Level of brotli compression, from 0 for the fastest to 11 for the smallest responses at more CPU each")
+	compressRaw := flags.Bool("compress-raw", true, "Compress ?raw responses like the others, off to send the bytes exactly as stored")
+	noCompress := flags.Bool("no-compress", false, "Don't gzip or brotli compress text, HTML, CSS, JavaScript, JSON and SVG responses")
+	cacheControl := flags.String("cache-control", "", "Cache-Control for files, as a header value or max-age seconds")
+	cacheMaxAge := flags.Duration("cache-max-age", 0, "Let clients cache files this long without revalidating, e.g. 1h, as max-age (0 to leave it to -cache-control)")
+	noCache := flags.Bool("no-cache", false, "Make clients revalidate files on every use, so regenerated ones are never stale")
+	etag := flags.String("etag", "mtime", "Strong ETag of files: mtime from size and modification time, hash from the SHA-256 once computed, or off")
+	cacheControlExt := cacheControlFlags{}
+	flags.Var(cacheControlExt, "cache-control-ext", "Cache-Control for an extension as \".ext=value\", can be repeated")
+	debugEndpoints := flags.Bool("debug-endpoints", false, "Serve runtime stats as JSON at "+statsPath)
+	systemd := flags.Bool("systemd", false, "Require sockets from systemd socket activation instead of binding -port")
+	shareFile := flags.String("file", "", "Share only this file, under a random path")
+	once := flags.Bool("once", false, "With -file, stop after the first complete download")
+	expire := flags.Duration("expire", 0, "With -file, stop after this long, e.g. 10m")
+	gallery := flags.Bool("gallery", false, "Show listings as a gallery of images, videos and audio played inline by default, instead of with ?view=gallery")
+	title := flags.String("title", "{folder}{path}", "Title and header of listings, with {folder} replaced by the served folder's name and {path} by the listed one, empty for the path without a header")
+	dateFormat := flags.String("date-format", "2006-01-02 15:04", "Layout of the modification times of listings, in Go's reference time, or iso, rfc822 or relative, e.g. 3 hours ago")
+	dirsFirst := flags.Bool("dirs-first", true, "List folders before files whatever the sort column and order")
+	thumbnails := flags.Bool("thumbnails", true, "Show thumbnails of images, and of videos when ffmpeg is installed, in listings")
+	thumbConcurrency := flags.Int("thumb-concurrency", runtime.NumCPU(), "Thumbnails made at once at most, later ones waiting for a free slot")
+	mdns := flags.Bool("mdns", true, "Advertise the server on the LAN over mDNS as fylshr-<hostname>, except with -file")
+	qr := flags.Bool("qr", true, "Print a QR code of the LAN URL at startup")
+	auth := flags.String("auth", "", "Require HTTP Basic authentication as user:pass")
+	token := flags.String("token", "", "Require this secret as a bearer token or ?token=, alone or as an alternative to -auth")
+	pinFlag := flags.Bool("pin", false, "Print a 6-digit PIN at startup that browsers must enter, as an alternative to -auth and -token")
+	pinOnce := flags.Bool("pin-once", false, "With -pin, let the PIN pair a single browser")
+	useTLS := flags.Bool("tls", false, "Serve HTTPS, with a self-signed certificate unless -cert and -key are given")
+	certFile := flags.String("cert", "", "TLS certificate file (PEM), implies -tls")
+	keyFile := flags.String("key", "", "TLS private key file (PEM) for -cert")
+	useACME := flags.Bool("acme", false, "Get and renew certificates for -domain from Let's Encrypt, implies -tls and redirects HTTP on port 80 to HTTPS")
+	domains := flags.String("domain", "", "Comma separated domain names to get certificates for with -acme")
+	acmeCache := flags.String("acme-cache", "", "Directory to keep -acme certificates in (default the user cache directory)")
+	acmeEmail := flags.String("acme-email", "", "Contact email for the Let's Encrypt account of -acme, to be warned of expiring certificates")
+	minTLS := flags.String("min-tls", "1.2", "Lowest TLS version accepted: 1.0, 1.1, 1.2 or 1.3")
+	tlsCiphers := flags.String("tls-ciphers", "", "Comma separated cipher suites allowed up to TLS 1.2, by name like TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 (default Go's secure ones, TLS 1.3 always has its own)")
+	useHTTP3 := flags.Bool("http3", false, "Also serve HTTP/3 over QUIC on the same UDP ports, with -tls (experimental)")
+	upload := flags.Bool("upload", false, "Accept uploads: multipart POSTs to a directory, from the form on listings, and PUTs to a file name")
+	maxUploadSize := flags.String("max-upload-size", "", "Refuse uploaded files larger than this, e.g. 2GB")
+	allowedUploadExt := flags.String("allowed-upload-ext", "", "Comma separated globs or extensions, e.g. jpg,png, the only files uploads accept")
+	uploadQuota := flags.String("upload-quota", "", "Refuse uploads once the folder holds this much, e.g. 20GB")
+	receive := flags.Bool("receive", false, "Drop box: only show an upload page, saving files into -folder without listing or serving any of them")
+	manage := flags.Bool("manage", false, "Let clients delete, rename and move files and make folders from the listing and "+managePath+", needs -auth or -token")
+	paste := flags.Bool("paste", false, "Take text snippets at "+pastePath+", from its form or POSTed with curl, and serve them back under a short link")
+	useWebDAV := flags.Bool("webdav", false, "Also speak WebDAV so -folder can be mounted as a network drive, read-only unless -upload is given")
+	onDownload := flags.String("on-download", "", "Command to run when a file was downloaded whole, e.g. 'notify-send {path} {ip}', with {path}, {ip}, {size} and {event} replaced")
+	onUpload := flags.String("on-upload", "", "Command to run when an upload landed, with the placeholders of -on-download")
+	webhookURL := flags.String("webhook-url", "", "URL to POST a JSON event to when a file was downloaded whole or an upload landed")
+	logSinkSpec := flags.String("log-sink", "", "Also send every request as a JSON line to file:/path, tcp:host:port or udp:host:port, regardless of -silent")
+	logFormat := flags.String("log-format", "pretty", "Access log format: "+strings.Join(logFormats, ", "))
+	logFile := flags.String("log-file", "", "Append the access log to this file instead of printing it")
+	dryRun := flags.Bool("dry-run", false, "Validate the configuration and exit without serving")
+	noColor := flags.Bool("no-color", false, "Disable colors, which are also off when stdout isn't a terminal or NO_COLOR is set")
+	xsendfile := flags.String("xsendfile", "", "Let the proxy send files by replying with this header instead, e.g. X-Accel-Redirect or X-Sendfile")
+	xsendfilePrefix := flags.String("xsendfile-prefix", "", "Prepended to the file path in the -xsendfile header, e.g. an nginx internal location")
+	maintenance := flags.Bool("maintenance", false, "Start in maintenance mode, answering 503 to everything but "+healthPath+" and -metrics (toggle with SIGUSR1)")
+	maintenanceAllow := flags.String("maintenance-allow", "", "Comma separated IPs or CIDRs still served during maintenance")
+	noRedirectSlash := flags.Bool("no-redirect-slash", false, "Serve directories requested without a trailing slash instead of redirecting")
+	tui := flags.Bool("tui", false, "Show a live dashboard instead of the access log when stdout is a terminal")
+	noAttachment := flags.Bool("no-attachment", false, "Never force media to download, let the browser decide; same as -disposition inline")
+	disposition := flags.String("disposition", "auto", "Whether files download or open in the browser: "+strings.Join(dispositions, ", ")+"; auto downloads media and documents")
+	attachExt := flags.String("attach-ext", "", "Comma separated globs or extensions, e.g. *.pdf,iso, always downloaded")
+	inlineExt := flags.String("inline-ext", "", "Comma separated globs or extensions always opened in the browser, over -attach-ext")
+	imageNegotiation := flags.Bool("image-negotiation", false, "Serve photo.avif or photo.webp for photo.jpg to browsers that accept them")
+	quietPaths := flags.String("quiet-paths", "", "Comma separated path prefixes or * globs left out of the access log")
+	methods := flags.String("methods", "GET,HEAD", "Comma separated HTTP methods to accept, others get 405")
+	network := flags.String("network", "tcp", "Network to listen on: tcp (OS default), tcp4, tcp6 or dual for separate IPv4 and IPv6 sockets")
+	bufferSize := flags.String("buffer-size", "", "Buffer file responses in memory, e.g. 1MB per download, trading memory for fewer stalls on slow clients")
+	limitRate := flags.String("limit-rate", "", "Cap the download speed of each client per second, e.g. 2MB")
+	limitTotal := flags.String("limit-total", "", "Cap the download speed of the whole server per second, e.g. 10MB")
+	hideDotfiles := flags.Bool("hide-dotfiles", true, "Hide files and folders whose name starts with a dot, like .env and .git")
+	followSymlinks := flags.Bool("follow-symlinks", false, "Serve symlinks leading out of the served folders, which are otherwise hidden")
+	allowDotList := flags.String("allow-dot", ".well-known", "Comma separated dot folders or files at the top of -folder still served with -hide-dotfiles")
+	exclude := flags.String("exclude", "", "Comma separated patterns in .gitignore syntax to hide, e.g. *.log,node_modules/**")
+	gitignore := flags.Bool("gitignore", false, "Hide what .gitignore files list, like "+ignoreFile+" files always do")
+	maxFileSize := flags.String("max-file-size", "", "Refuse to serve files larger than this, e.g. 500MB, and hide them from listings")
+	var prefixMethods prefixMethodFlags
+	flags.Var(&prefixMethods, "prefix-methods", "Methods accepted under a path prefix as \"/prefix=GET,HEAD,PUT\", overriding -methods and those -upload, -manage and -webdav add, can be repeated")
+	configEndpoint := flags.Bool("config-endpoint", false, "Serve the effective flags, secrets redacted, as JSON at "+configPath)
+	allowList := flags.String("allow", "", "Comma separated IPs or CIDRs, e.g. 192.168.1.0/24, the only clients served")
+	denyList := flags.String("deny", "", "Comma separated IPs or CIDRs refused, even if in -allow")
+	maxRPS := flags.Float64("max-rps", 0, "Requests per second each client may make on average, 0 for no limit")
+	maxConns := flags.Int("max-conns", 0, "Open connections at most, later ones waiting for a free one, 0 for no limit")
+	maxConnsPerIP := flags.Int("max-conns-per-ip", 0, "Open connections each client IP may have, more being closed right away, 0 for no limit")
+	lanOnly := flags.Bool("lan-only", false, "Only listen on loopback and private addresses and refuse other clients")
+	rootPage := flags.String("root-page", "", "HTML file served at / instead of the folder's listing or index")
+	rootPageStyle := flags.Bool("root-page-style", false, "Append the listing style to -root-page")
+	theme := flags.String("theme", "dark", "Colors of the pages: dark, light, or auto to follow the browser")
+	customCSS := flags.String("css", "", "CSS file added to every page after the theme")
+	templateDir := flags.String("template-dir", "", "Folder with listing.html, paste.html, pin.html, receive.html or render.html replacing the embedded templates")
+	follow := flags.Bool("follow", false, "Stream files requested with ?follow or ?tail as they grow, like tail -f, as server-sent events to EventSource clients")
+	mimeList := mimeFlags{}
+	flags.Var(mimeList, "mime", "Content-Type for an extension as \".ext=type/subtype\", can be repeated")
+	mimeFileFlag := flags.String("mime-file", "", "TOML file with a [types] table of \".ext\" = \"type/subtype\" and an attachment list of types downloaded with -disposition auto, e.g. [\"video/*\"]")
+	defaultType := flags.String("default-type", "", "Content-Type of files without an extension, e.g. text/plain")
+	sniff := flags.Bool("sniff", false, "Detect the type of files without an extension from their first 512 bytes, instead of -default-type")
+	shutdownTimeout := flags.Duration("shutdown-timeout", 10*time.Second, "How long to wait for active requests on SIGINT or SIGTERM")
+	noLAN := flags.Bool("no-lan", false, "Only print loopback URLs in the banner")
+	iface := flags.String("interface", "", "Only print the addresses of this network interface in the banner and QR code, e.g. eth0")
+	advertiseIP := flags.String("advertise-ip", "", "Print this address in the banner and QR code instead of the interfaces' ones, e.g. the one a NAT forwards")
+	var overlay folderFlags
+	flags.Var(&overlay, "overlay", "Folder merged under -folder at the root, can be repeated; earlier folders take precedence")
+	inbox := flags.String("inbox", "", "Folder under -folder, protected by a "+tokenFile+", where files can be renamed (POST ?rename=) and deleted (DELETE)")
+	var rewrites []rewriteRule
+	flags.Var(rewriteFlags{rules: &rewrites}, "rewrite", "Serve paths matching a regexp from another as \"pattern -> replacement\" with $1 for groups, can be repeated; the first matching -rewrite or -redirect wins")
+	flags.Var(rewriteFlags{rules: &rewrites, redirect: true}, "redirect", "Like -rewrite but redirects, as \"pattern -> replacement [status]\" (default 301)")
+	indexLang := flags.String("index-lang", "", "Serve directories with the index.<lang>.html matching Accept-Language, falling back to this language")
+	profile := flags.Bool("profile", false, "Serve net/http/pprof under "+pprofPath)
+	profileAddr := flags.String("profile-addr", "127.0.0.1:6060", "Address of the -profile listener, or empty to use the file server's")
+	spa := flags.Bool("spa", false, "Serve /index.html for missing paths a browser navigates to or without an extension, for apps with client-side routing")
+	spaBundle := flags.Bool("spa-bundle", false, "Serve /index.html for missing paths without an extension, with no-cache, and cache hashed assets forever")
+	spaHashPattern := flags.String("spa-hash", defaultSPAHash, "Regexp matching the file names of hashed assets for -spa-bundle")
+	banner := flags.String("banner", "text", "Startup output: "+strings.Join(bannerModes, ", ")+"; json prints the addresses on one line")
+	sitemap := flags.String("sitemap", "", "Public URL of the site, to serve a generated "+sitemapPath+" of its HTML pages")
+	render := flags.Bool("render", false, "Show markdown rendered and source code highlighted, like ?render does, unless ?raw is given")
+	live := flags.Bool("live", false, "Watch the folder and reload open listings when files change, with a stream of the changes at "+eventsPath)
+	watch := flags.Bool("watch", false, "Watch the folder and drop the cached thumbnails, checksums, sitemap and ignore rules of files as they change, even if their size and time don't (implied by -live)")
+	serveMetricsFlag := flags.Bool("metrics", false, "Serve Prometheus metrics of requests, bytes, connections and durations at "+metricsPath)
+	serveAccessStatsFlag := flags.Bool("stats", false, "Serve a live page of downloads per file, clients, bytes sent over time and active transfers at "+accessStatsPath+", as JSON with ?format=json")
+	checksums := flags.Bool("checksums", false, "Show SHA-256 checksums in listings, send them as X-Checksum-SHA256 once computed and answer ?checksum=sha256 or md5")
+	digest := flags.String("digest", "", "Send whole file checksums, a comma separated list of sha-256 (Digest header) and md5 (Content-MD5)")
+	flags.String("config", "", "TOML file of flag settings, by default "+defaultConfigFile()+" if it exists; flags, then "+envPrefix+"* variables take precedence")
+	if err := flags.Parse(arguments); err != nil {
+		return Args{}, err
+	}
+
+	if settings {
+		if err := loadSettings(flags); err != nil {
+			return Args{}, fmt.Errorf("invalid settings: %w", err)
+		}
+	}
+
+	if _, ok := networkStacks[*network]; !ok {
+		return Args{}, fmt.Errorf("invalid -network %q, expected tcp, tcp4, tcp6 or dual", *network)
+	}
+
+	if *auth != "" {
+		if err := parseBasicAuth(*auth); err != nil {
+			return Args{}, fmt.Errorf("invalid -auth: %w", err)
+		}
+	}
+
+	minTLSVersion, ok := tlsVersions[*minTLS]
+	if !ok {
+		return Args{}, fmt.Errorf("invalid -min-tls %q, expected 1.0, 1.1, 1.2 or 1.3", *minTLS)
+	}
+	var acme *autocert.Manager
+	var domainNames []string
+	if *useACME {
+		if *domains == "" {
+			return Args{}, errors.New("-acme needs -domain")
+		}
+		if *certFile != "" {
+			return Args{}, errors.New("-acme and -cert are exclusive")
+		}
+		var err error
+		if domainNames, err = parseDomains(*domains); err != nil {
+			return Args{}, fmt.Errorf("invalid -domain: %w", err)
+		}
+		acme = newACMEManager(domainNames, *acmeCache, *acmeEmail)
+		if len(ports) == 0 && len(listens) == 0 {
+			ports = portFlags{"443"}
+		}
+	}
+	if *useHTTP3 && !*useTLS && *certFile == "" && acme == nil {
+		return Args{}, errors.New("-http3 needs -tls, -cert or -acme")
+	}
+
+	if !slices.Contains(bannerModes, *banner) {
+		return Args{}, fmt.Errorf("invalid -banner %q, expected one of: %s", *banner, strings.Join(bannerModes, ", "))
+	}
+
+	if !slices.Contains(themes, *theme) {
+		return Args{}, fmt.Errorf("invalid -theme %q, expected one of: %s", *theme, strings.Join(themes, ", "))
+	}
+	pages := newLook()
+	if err := pages.setTheme(*theme, *customCSS); err != nil {
+		return Args{}, fmt.Errorf("invalid -css: %w", err)
+	}
+	if *templateDir != "" {
+		if err := pages.loadTemplates(*templateDir); err != nil {
+			return Args{}, fmt.Errorf("invalid -template-dir: %w", err)
+		}
+	}
+
+	types, err := loadMimeTypes(*mimeFileFlag, mimeList)
+	if err != nil {
+		return Args{}, fmt.Errorf("invalid -mime-file: %w", err)
+	}
+
+	if !slices.Contains(etagModes, *etag) {
+		return Args{}, fmt.Errorf("invalid -etag %q, expected one of: %s", *etag, strings.Join(etagModes, ", "))
+	}
+	cacheFlags := 0
+	for _, set := range []bool{*cacheControl != "", *cacheMaxAge > 0, *noCache} {
+		if set {
+			cacheFlags++
+		}
+	}
+	if cacheFlags > 1 {
+		return Args{}, errors.New("-cache-control, -cache-max-age and -no-cache are exclusive")
+	}
+	if *cacheMaxAge > 0 {
+		*cacheControl = strconv.Itoa(int(cacheMaxAge.Seconds()))
+	}
+	if *noCache {
+		*cacheControl = "no-cache"
+	}
+
+	if !slices.Contains(logFormats, *logFormat) {
+		return Args{}, fmt.Errorf("invalid -log-format %q, expected one of: %s", *logFormat, strings.Join(logFormats, ", "))
+	}
+
+	allow, err := parsePrefixes(*maintenanceAllow)
+	if err != nil {
+		return Args{}, fmt.Errorf("invalid -maintenance-allow: %w", err)
+	}
+
+	if !slices.Contains(dispositions, *disposition) {
+		return Args{}, fmt.Errorf("invalid -disposition %q, expected one of: %s", *disposition, strings.Join(dispositions, ", "))
+	}
+	if *noAttachment {
+		*disposition = "inline"
+	}
+
+	attachPatterns, err := parseExtPatterns(*attachExt)
+	if err != nil {
+		return Args{}, fmt.Errorf("invalid -attach-ext: %w", err)
+	}
+
+	inlinePatterns, err := parseExtPatterns(*inlineExt)
+	if err != nil {
+		return Args{}, fmt.Errorf("invalid -inline-ext: %w", err)
+	}
+
+	formatDate, err := parseDateFormat(*dateFormat)
+	if err != nil {
+		return Args{}, fmt.Errorf("invalid -date-format: %w", err)
+	}
+
+	allowDot, err := parseDotNames(*allowDotList)
+	if err != nil {
+		return Args{}, fmt.Errorf("invalid -allow-dot: %w", err)
+	}
+
+	excludeRules, err := parseIgnoreRules(*exclude)
+	if err != nil {
+		return Args{}, fmt.Errorf("invalid -exclude: %w", err)
+	}
+
+	allowPrefixes, err := parsePrefixes(*allowList)
+	if err != nil {
+		return Args{}, fmt.Errorf("invalid -allow: %w", err)
+	}
+
+	denyPrefixes, err := parsePrefixes(*denyList)
+	if err != nil {
+		return Args{}, fmt.Errorf("invalid -deny: %w", err)
+	}
+
+	if *gzipLevel != gzip.DefaultCompression && (*gzipLevel < gzip.BestSpeed || *gzipLevel > gzip.BestCompression) {
+		return Args{}, fmt.Errorf("invalid -gzip-level: %d", *gzipLevel)
+	}
+	if *brotliLevel < brotli.BestSpeed || *brotliLevel > brotli.BestCompression {
+		return Args{}, fmt.Errorf("invalid -brotli-level: %d", *brotliLevel)
+	}
+	if *maxRPS < 0 {
+		return Args{}, fmt.Errorf("invalid -max-rps: %v", *maxRPS)
+	}
+	if *maxConns < 0 {
+		return Args{}, fmt.Errorf("invalid -max-conns: %d", *maxConns)
+	}
+	if *maxConnsPerIP < 0 {
+		return Args{}, fmt.Errorf("invalid -max-conns-per-ip: %d", *maxConnsPerIP)
+	}
+	if *thumbConcurrency < 1 {
+		return Args{}, fmt.Errorf("invalid -thumb-concurrency: %d", *thumbConcurrency)
+	}
+
+	quiet, err := parsePatterns(*quietPaths)
+	if err != nil {
+		return Args{}, fmt.Errorf("invalid -quiet-paths: %w", err)
+	}
+
+	allowed, err := parseMethods(*methods)
+	if err != nil {
+		return Args{}, fmt.Errorf("invalid -methods: %w", err)
+	}
+
+	maxSize, err := parseSize(*maxFileSize)
+	if err != nil {
+		return Args{}, fmt.Errorf("invalid -max-file-size: %w", err)
+	}
+
+	var limits uploadLimits
+	if limits.maxSize, err = parseSize(*maxUploadSize); err != nil {
+		return Args{}, fmt.Errorf("invalid -max-upload-size: %w", err)
+	}
+	if limits.exts, err = parseExtPatterns(*allowedUploadExt); err != nil {
+		return Args{}, fmt.Errorf("invalid -allowed-upload-ext: %w", err)
+	}
+	if limits.quota, err = parseSize(*uploadQuota); err != nil {
+		return Args{}, fmt.Errorf("invalid -upload-quota: %w", err)
+	}
+
+	rate, err := parseSize(*limitRate)
+	if err != nil {
+		return Args{}, fmt.Errorf("invalid -limit-rate: %w", err)
+	}
+
+	totalRate, err := parseSize(*limitTotal)
+	if err != nil {
+		return Args{}, fmt.Errorf("invalid -limit-total: %w", err)
+	}
+
+	bufSize, err := parseSize(*bufferSize)
+	if err == nil && bufSize > math.MaxInt32 {
+		err = errors.New("must be under 2 GiB")
+	}
+	if err != nil {
+		return Args{}, fmt.Errorf("invalid -buffer-size: %w", err)
+	}
+
+	digestAlgs, err := parseDigests(*digest)
+	if err != nil {
+		return Args{}, fmt.Errorf("invalid -digest: %w", err)
+	}
+
+	sitemapURL := ""
+	if *sitemap != "" {
+		if sitemapURL, err = parseSitemapURL(*sitemap); err != nil {
+			return Args{}, fmt.Errorf("invalid -sitemap: %w", err)
+		}
+	}
+
+	var spaHash *regexp.Regexp
+	if *spaBundle {
+		if spaHash, err = regexp.Compile(*spaHashPattern); err != nil {
+			return Args{}, fmt.Errorf("invalid -spa-hash: %w", err)
+		}
+	}
+
+	var logOut io.Writer
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return Args{}, fmt.Errorf("invalid -log-file: %w", err)
+		}
+		logOut = f
+	}
+
+	var sink *logSink
+	if *logSinkSpec != "" {
+		if sink, err = openLogSink(*logSinkSpec); err != nil {
+			return Args{}, fmt.Errorf("invalid -log-sink: %w", err)
+		}
+	}
+	servedBase := cleanBasePath(*basePath)
+	if *obscure {
+		prefix, err := obscurePrefix()
+		if err != nil {
+			return Args{}, err
+		}
+		servedBase += prefix
+	}
+
+	addrs, err := lanAddrs(*iface)
+	if err != nil && *iface != "" {
+		return Args{}, fmt.Errorf("invalid -interface: %w", err)
+	}
+	if *iface != "" && len(addrs) == 0 {
+		return Args{}, fmt.Errorf("invalid -interface: %s has no usable address", *iface)
+	}
+	var advertised netip.Addr
+	if *advertiseIP != "" {
+		if advertised, err = netip.ParseAddr(*advertiseIP); err != nil {
+			return Args{}, fmt.Errorf("invalid -advertise-ip: %w", err)
+		}
+		advertised = advertised.Unmap()
+	}
+
+	if *pinOnce && !*pinFlag {
+		return Args{}, errors.New("-pin-once needs -pin")
+	}
+	var pin *pinGate
+	if *pinFlag {
+		pin = newPinGate(*pinOnce)
+	}
+
+	transferHooks, err := newHooks(*onDownload, *onUpload, *webhookURL)
+	if err != nil {
+		return Args{}, err
+	}
+
+	var fileShare *share
+	if *shareFile != "" {
+		if fileShare, err = newShare(*shareFile, *once, *expire); err != nil {
+			return Args{}, fmt.Errorf("invalid -file: %w", err)
+		}
+	} else if *once || *expire != 0 {
+		return Args{}, errors.New("-once and -expire need -file")
+	}
+
+	if len(mounts) > 0 {
+		var combined error
+		flags.Visit(func(f *flag.Flag) {
+			if combined == nil && slices.Contains([]string{"folder", "overlay", "inbox", "root-page", "sitemap"}, f.Name) {
+				combined = fmt.Errorf("-mount replaces -folder and can't be combined with -%s", f.Name)
+			}
+		})
+		if combined != nil {
+			return Args{}, combined
+		}
+	}
+
+	if *receive && *useWebDAV {
+		return Args{}, errors.New("-receive can't be combined with -webdav")
+	}
+	if *manage && *receive {
+		return Args{}, errors.New("-receive can't be combined with -manage")
+	}
+	if *manage && *auth == "" && *token == "" {
+		return Args{}, errors.New("-manage needs -auth or -token, or anyone could delete the files")
+	}
+
+	var dash *dashboard
+	if *tui && isTerminal(os.Stdout) {
+		dash = newDashboard()
+	}
+
+	useColor := !*noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+
+	var prog *progress
+	if !*silent && dash == nil && isTerminal(os.Stdout) {
+		prog = newProgress(useColor)
+	}
+
+	if len(ports) == 0 && len(listens) == 0 {
+		ports = portFlags{"1080"}
+	}
+
+	maintenanceMode := new(atomic.Bool)
+	maintenanceMode.Store(*maintenance)
+
+	return Args{
+		ports:            ports,
+		listen:           listens,
+		folder:           *folder,
+		silent:           *silent,
+		headers:          headers,
+		favicon:          *favicon,
+		du:               *du,
+		basePath:         servedBase,
+		obscure:          *obscure,
+		noKeepAlive:      *noKeepAlive,
+		acmeWebroot:      *acmeWebroot,
+		debug:            *debug,
+		parseUA:          *parseUA,
+		requestTimeout:   *requestTimeout,
+		noCompress:       *noCompress,
+		gzipLevel:        *gzipLevel,
+		brotliLevel:      *brotliLevel,
+		compressRaw:      *compressRaw,
+		cacheControl:     cacheControlValue(*cacheControl),
+		etag:             *etag,
+		cacheControlExt:  cacheControlExt,
+		debugEndpoints:   *debugEndpoints,
+		systemd:          *systemd,
+		logFormat:        *logFormat,
+		logFile:          logOut,
+		dryRun:           *dryRun,
+		xsendfile:        *xsendfile,
+		xsendfilePrefix:  strings.TrimSuffix(*xsendfilePrefix, "/"),
+		maintenance:      maintenanceMode,
+		maintenanceAllow: allow,
+		noRedirectSlash:  *noRedirectSlash,
+		tui:              dash,
+		disposition:      *disposition,
+		attachExt:        attachPatterns,
+		inlineExt:        inlinePatterns,
+		imageNegotiation: *imageNegotiation,
+		quietPaths:       quiet,
+		methods:          allowed,
+		network:          *network,
+		maxFileSize:      maxSize,
+		prefixMethods:    prefixMethods,
+		configEndpoint:   *configEndpoint,
+		lanOnly:          *lanOnly,
+		rootPage:         *rootPage,
+		rootPageStyle:    *rootPageStyle,
+		follow:           *follow,
+		defaultType:      *defaultType,
+		sniff:            *sniff,
+		shutdownTimeout:  *shutdownTimeout,
+		noLAN:            *noLAN,
+		lanAddrs:         addrs,
+		advertiseIP:      advertised,
+		digest:           digestAlgs,
+		overlay:          overlay,
+		progress:         prog,
+		inbox:            cleanInbox(*inbox),
+		sitemap:          sitemapURL,
+		banner:           *banner,
+		spaHash:          spaHash,
+		profile:          *profile,
+		profileAddr:      *profileAddr,
+		indexLang:        *indexLang,
+		rewrites:         rewrites,
+		bufferSize:       int(bufSize),
+		logSink:          sink,
+		hooks:            transferHooks,
+		pin:              pin,
+		upload:           *upload || *receive,
+		uploadLimits:     limits,
+		qr:               *qr,
+		share:            fileShare,
+		auth:             *auth,
+		token:            *token,
+		tls:              *useTLS || *certFile != "" || acme != nil,
+		acme:             acme,
+		domains:          domainNames,
+		certFile:         *certFile,
+		keyFile:          *keyFile,
+		minTLS:           minTLSVersion,
+		tlsCiphers:       *tlsCiphers,
+		http3:            *useHTTP3,
+		webdav:           *useWebDAV,
+		limitRate:        rate,
+		limitTotal:       totalRate,
+		mdns:             *mdns,
+		thumbnails:       *thumbnails,
+		thumbSlots:       make(chan struct{}, *thumbConcurrency),
+		thumbCache:       &thumbCache{thumbs: map[thumbKey][]byte{}},
+		gallery:          *gallery,
+		dirsFirst:        *dirsFirst,
+		title:            *title,
+		dateFormat:       formatDate,
+		hideDotfiles:     *hideDotfiles,
+		allowDot:         allowDot,
+		followSymlinks:   *followSymlinks,
+		exclude:          excludeRules,
+		gitignore:        *gitignore,
+		allow:            allowPrefixes,
+		deny:             denyPrefixes,
+		maxRPS:           *maxRPS,
+		maxConns:         *maxConns,
+		maxConnsPerIP:    *maxConnsPerIP,
+		paste:            *paste,
+		receive:          *receive,
+		manage:           *manage,
+		mounts:           mounts,
+		checksums:        *checksums,
+		render:           *render,
+		spa:              *spa,
+		metrics:          *serveMetricsFlag,
+		stats:            *serveAccessStatsFlag,
+		live:             *live,
+		watch:            *watch || *live,
+		color:            useColor,
+		session:          newSession(),
+		requestMetrics:   newMetrics(),
+		sitemapCache:     &sitemapCache{},
+		look:             pages,
+		mimeTypes:        types,
+	}, nil
+}
+
+// portFlags collects -port values, given repeatedly or comma separated.
+type portFlags []string
+
+func (p *portFlags) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *portFlags) Set(value string) error {
+	for _, port := range strings.Split(value, ",") {
+		n, err := strconv.ParseUint(strings.TrimSpace(port), 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid port %q", port)
+		}
+		*p = append(*p, strconv.FormatUint(n, 10))
+	}
+	return nil
+}
+
+// listenFlags collects -listen addresses.
+type listenFlags []string
+
+func (l *listenFlags) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listenFlags) Set(value string) error {
+	if name, ok := strings.CutPrefix(value, "unix:"); ok {
+		if name == "" {
+			return errors.New("missing socket path after unix:")
+		}
+		*l = append(*l, value)
+		return nil
+	}
+	_, port, err := net.SplitHostPort(value)
+	if err != nil {
+		return err
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	*l = append(*l, value)
+	return nil
+}
+
+// folderFlags collects repeated folder flags in the order given.
+type folderFlags []string
+
+func (f *folderFlags) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *folderFlags) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// parsePatterns splits a comma separated list of path prefixes and globs,
+// rejecting malformed globs.
+func parsePatterns(list string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(list, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%q: %w", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// parseExtPatterns parses a comma separated list of globs like *.pdf, where a
+// plain pdf or .pdf stands for *.pdf. Patterns are lowercased.
+func parseExtPatterns(list string) ([]string, error) {
+	patterns, err := parsePatterns(strings.ToLower(list))
+	for i, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			patterns[i] = "*." + strings.TrimPrefix(pattern, ".")
+		}
+	}
+	return patterns, err
+}
+
+// matchesGlob reports whether name matches one of the glob patterns.
+func matchesGlob(patterns []string, name string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	})
+}
+
+// matchesAny reports whether name matches one of patterns, either as a glob
+// when it has a * or as a prefix otherwise.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if strings.Contains(pattern, "*") {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		} else if strings.HasPrefix(name, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSize parses sizes like 512, 10K, 2MB or 1.5GiB, with 1024 based units.
+// An empty string is 0.
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	number := strings.TrimRightFunc(s, func(c rune) bool { return !unicode.IsDigit(c) && c != '.' })
+	unit := strings.ToUpper(strings.TrimSpace(s[len(number):]))
+	unit = strings.TrimSuffix(strings.TrimSuffix(unit, "B"), "I")
+
+	exp := 0
+	if unit != "" {
+		exp = strings.Index("KMGTPE", unit) + 1
+		if len(unit) > 1 || exp == 0 {
+			return 0, fmt.Errorf("unknown unit in %q", s)
+		}
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	for range exp {
+		n *= 1024
+	}
+	return int64(n), nil
+}
+
+func formatSize(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,53 @@
+package fylshr
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// parseBasicAuth checks an -auth value of the form user:pass.
+func parseBasicAuth(s string) error {
+	user, pass, ok := strings.Cut(s, ":")
+	if !ok || user == "" || pass == "" {
+		return errors.New("expected user:pass")
+	}
+	return nil
+}
+
+// authorized reports whether r carries the -auth credentials or the -token
+// secret, as a bearer token or ?token=. Either one is enough.
+func authorized(r *http.Request, basic, token string) bool {
+	if basic != "" {
+		if user, pass, ok := r.BasicAuth(); ok && secureCompare(user+":"+pass, basic) {
+			return true
+		}
+	}
+
+	if token != "" {
+		given := r.URL.Query().Get("token")
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			given = strings.TrimSpace(bearer)
+		}
+		if given != "" && secureCompare(given, token) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requireAuth answers 401, asking browsers for a password when -auth is set.
+func requireAuth(w http.ResponseWriter, r *http.Request, basic string) {
+	if basic != "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="fylshr", charset="UTF-8"`)
+	} else {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="fylshr"`)
+	}
+	writeError(w, r, http.StatusUnauthorized, "401 unauthorized")
+}
+
+func secureCompare(given, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(want)) == 1
+}
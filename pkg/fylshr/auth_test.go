@@ -0,0 +1,64 @@
+package fylshr
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+)
+
+func basic(credentials string) string {
+	return "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+}
+
+func TestAuth(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+
+	tests := []struct {
+		name         string
+		flags        []string
+		path, header string
+		status       int
+		challenge    string
+	}{
+		{"open", nil, "/a.txt", "", http.StatusOK, ""},
+		{"basic missing", []string{"-auth", "me:secret"}, "/a.txt", "", http.StatusUnauthorized, `Basic realm="fylshr", charset="UTF-8"`},
+		{"basic wrong", []string{"-auth", "me:secret"}, "/a.txt", basic("me:guess"), http.StatusUnauthorized, `Basic realm="fylshr", charset="UTF-8"`},
+		{"basic wrong user", []string{"-auth", "me:secret"}, "/a.txt", basic("you:secret"), http.StatusUnauthorized, `Basic realm="fylshr", charset="UTF-8"`},
+		{"basic", []string{"-auth", "me:secret"}, "/a.txt", basic("me:secret"), http.StatusOK, ""},
+		{"basic listing", []string{"-auth", "me:secret"}, "/", "", http.StatusUnauthorized, `Basic realm="fylshr", charset="UTF-8"`},
+		{"token missing", []string{"-token", "s3cret"}, "/a.txt", "", http.StatusUnauthorized, `Bearer realm="fylshr"`},
+		{"token wrong", []string{"-token", "s3cret"}, "/a.txt?token=guess", "", http.StatusUnauthorized, `Bearer realm="fylshr"`},
+		{"token query", []string{"-token", "s3cret"}, "/a.txt?token=s3cret", "", http.StatusOK, ""},
+		{"bearer", []string{"-token", "s3cret"}, "/a.txt", "Authorization: Bearer s3cret", http.StatusOK, ""},
+		{"bearer wrong over query", []string{"-token", "s3cret"}, "/a.txt?token=s3cret", "Authorization: Bearer guess", http.StatusUnauthorized, `Bearer realm="fylshr"`},
+		{"either with basic", []string{"-auth", "me:secret", "-token", "s3cret"}, "/a.txt", basic("me:secret"), http.StatusOK, ""},
+		{"either with token", []string{"-auth", "me:secret", "-token", "s3cret"}, "/a.txt?token=s3cret", "", http.StatusOK, ""},
+		{"either missing", []string{"-auth", "me:secret", "-token", "s3cret"}, "/a.txt", "", http.StatusUnauthorized, `Basic realm="fylshr", charset="UTF-8"`},
+		{"health", []string{"-auth", "me:secret"}, healthPath, "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, dir, tt.flags...)
+			var headers []string
+			if tt.header != "" {
+				headers = append(headers, tt.header)
+			}
+			resp, body := do(t, srv, http.MethodGet, tt.path, nil, headers...)
+			if resp.StatusCode != tt.status || resp.Header.Get("WWW-Authenticate") != tt.challenge {
+				t.Errorf("GET %s = %d WWW-Authenticate %q, want %d %q", tt.path, resp.StatusCode, resp.Header.Get("WWW-Authenticate"), tt.status, tt.challenge)
+			}
+			if tt.status != http.StatusOK && body == "hello" {
+				t.Errorf("GET %s sent the file without credentials", tt.path)
+			}
+		})
+	}
+}
+
+func TestParseBasicAuth(t *testing.T) {
+	for value, ok := range map[string]bool{"me:secret": true, "me:pa:ss": true, "me": false, ":secret": false, "me:": false} {
+		if err := parseBasicAuth(value); (err == nil) != ok {
+			t.Errorf("parseBasicAuth(%q) = %v, want ok %v", value, err, ok)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package fylshr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var bannerModes = []string{"text", "json", "off"}
+
+func printBanner(args Args, listeners []net.Listener) {
+	switch args.banner {
+	case "off":
+		return
+	case "json":
+		printJSONBanner(listeners, args.tls, args.pin)
+		return
+	}
+
+	scheme := "http"
+	if args.tls {
+		scheme = "https"
+	}
+	urlPath := args.basePath
+	if args.share != nil {
+		urlPath += args.share.path
+	} else if args.obscure {
+		// Saves the redirect, and the secret is easier to spot.
+		urlPath += "/"
+	}
+	printed := map[int]bool{}
+	qrURL := ""
+	for _, l := range listeners {
+		addr, ok := l.Addr().(*net.TCPAddr)
+		if !ok {
+			colorPrintf(args.color, "\x1b[1m\x1b[38;5;159m%s:%s\n", l.Addr().Network(), l.Addr())
+			continue
+		}
+
+		port := strconv.Itoa(addr.Port)
+		if !addr.IP.IsUnspecified() {
+			u := fmt.Sprintf("%s://%s%s", scheme, hostPort(addr.AddrPort().Addr().Unmap(), port), urlPath)
+			if !args.noLAN || addr.IP.IsLoopback() {
+				colorPrintf(args.color, "\x1b[1m\x1b[38;5;158m%s\n", u)
+			}
+			if qrURL == "" && !addr.IP.IsLoopback() {
+				qrURL = u
+			}
+			continue
+		}
+
+		// -network dual binds each port twice.
+		if printed[addr.Port] {
+			continue
+		}
+		printed[addr.Port] = true
+
+		colorPrintf(args.color, "\x1b[1m\x1b[38;5;159m%s://localhost:%s%s\n", scheme, port, urlPath)
+		// A tcp listener on :: takes IPv4 too, unless -network says otherwise.
+		ipv4 := args.network == "dual" || addr.IP.To4() != nil || args.network != "tcp6"
+		ipv6 := args.network == "dual" || addr.IP.To4() == nil && args.network != "tcp4"
+		for _, ip := range bannerAddrs(args, ipv4, ipv6) {
+			u := fmt.Sprintf("%s://%s%s", scheme, hostPort(ip, port), urlPath)
+			if !args.noLAN {
+				colorPrintf(args.color, "\x1b[1m\x1b[38;5;158m%s\n", u)
+			}
+			if qrURL == "" {
+				qrURL = u
+			}
+		}
+	}
+
+	// A public name is what -acme is for, and what the certificate is valid for.
+	for i, domain := range args.domains {
+		u := fmt.Sprintf("https://%s%s", domain, urlPath)
+		if port := tcpPort(listeners); port != 443 {
+			u = fmt.Sprintf("https://%s:%d%s", domain, port, urlPath)
+		}
+		colorPrintf(args.color, "\x1b[1m\x1b[38;5;158m%s\n", u)
+		if i == 0 {
+			qrURL = u
+		}
+	}
+
+	// Phones on the LAN are what the code is for, and it's only noise in a log
+	// file.
+	if args.qr && !args.noLAN && qrURL != "" && isTerminal(os.Stdout) {
+		printQR(qrURL)
+	}
+
+	if stacks := networkStacks[args.network]; stacks != "" {
+		colorPrintf(args.color, "\x1b[1m\x1b[38;5;195m%s\n", stacks)
+	}
+	if args.http3 {
+		colorPrintf(args.color, "\x1b[1m\x1b[38;5;195mHTTP/3 on the same UDP ports\n")
+	}
+	if args.pin != nil {
+		colorPrintf(args.color, "\x1b[1m\x1b[38;5;195mPIN \x1b[38;5;225m%s\n", args.pin.code)
+	}
+
+	summary := diskSummary(args.folder, args.du)
+	if len(args.mounts) > 0 {
+		summary = ""
+		for _, m := range args.mounts {
+			summary += fmt.Sprintf("%s/ → %s", m.prefix, m.dir)
+			if disk := diskSummary(m.dir, args.du); disk != "" {
+				summary += ": " + disk
+			} else {
+				summary += "\n"
+			}
+		}
+	}
+	colorPrintf(
+		args.color,
+		"\x1b[1m\x1b[38;5;195m%s\x1b[38;5;225mCtrl-C\x1b[0m to exit\n",
+		summary,
+	)
+}
+
+// printJSONBanner prints the bound addresses on one line for scripts, port
+// being the first TCP one, which is handy with -port 0, and the -pin code.
+func printJSONBanner(listeners []net.Listener, useTLS bool, pin *pinGate) {
+	banner := struct {
+		Addrs []string `json:"addrs"`
+		Port  int      `json:"port"`
+		TLS   bool     `json:"tls"`
+		PIN   string   `json:"pin,omitempty"`
+	}{Addrs: []string{}, TLS: useTLS}
+	if pin != nil {
+		banner.PIN = pin.code
+	}
+	for _, l := range listeners {
+		banner.Addrs = append(banner.Addrs, l.Addr().String())
+		if addr, ok := l.Addr().(*net.TCPAddr); ok && banner.Port == 0 {
+			banner.Port = addr.Port
+		}
+	}
+
+	b, _ := json.Marshal(banner)
+	fmt.Println(string(b))
+}
+
+const duTimeout = 5 * time.Second
+
+// diskSummary describes the filesystem usage of folder and, when du is set, the
+// number and size of the files under it. Counts followed by + were cut short by
+// duTimeout.
+func diskSummary(folder string, du bool) string {
+	var summary []string
+	if du {
+		files, size, complete := folderSize(folder, duTimeout)
+		more := ""
+		if !complete {
+			more = "+"
+		}
+		summary = append(summary, fmt.Sprintf("Serving %d%s files (%s%s)", files, more, formatSize(size), more))
+	}
+
+	if used, free, err := diskSpace(folder); err == nil {
+		summary = append(summary, fmt.Sprintf("%s used / %s free", formatSize(used), formatSize(free)))
+	}
+
+	if len(summary) == 0 {
+		return ""
+	}
+
+	return strings.Join(summary, ", ") + "\n"
+}
+
+func folderSize(folder string, timeout time.Duration) (files int, size uint64, complete bool) {
+	deadline := time.Now().Add(timeout)
+	complete = true
+
+	filepath.WalkDir(folder, func(_ string, d os.DirEntry, err error) error {
+		if time.Now().After(deadline) {
+			complete = false
+			return filepath.SkipAll
+		}
+
+		if err != nil || d.IsDir() {
+			return nil
+		}
+
+		if info, err := d.Info(); err == nil {
+			files++
+			size += uint64(info.Size())
+		}
+
+		return nil
+	})
+
+	return files, size, complete
+}
@@ -0,0 +1,154 @@
+package fylshr
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// capture returns what f writes to file, os.Stdout or os.Stderr.
+func capture(t *testing.T, file **os.File, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := *file
+	*file = w
+	defer func() { *file = saved }()
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	f()
+	w.Close()
+	return <-out
+}
+
+// bannerListener listens on a random loopback port for the banner to print.
+func bannerListener(t *testing.T) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestBannerDiskSummary(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "sub/b.txt": "nested", "empty/": ""})
+
+	tests := []struct {
+		flags []string
+		want  string
+	}{
+		{[]string{"-du"}, `Serving 2 files \(11 B\), \S+ \S+ used / \S+ \S+ free\n`},
+		{nil, `^[^\n]*\n\S+ \S+ used / \S+ \S+ free\nCtrl-C to exit\n$`},
+	}
+	for _, tt := range tests {
+		args := testArgs(t, dir, tt.flags...)
+		args.banner = "text"
+		got := capture(t, &os.Stdout, func() { printBanner(args, []net.Listener{bannerListener(t)}) })
+		if !regexp.MustCompile(tt.want).MatchString(got) {
+			t.Errorf("%v banner = %q, want %s", tt.flags, got, tt.want)
+		}
+	}
+}
+
+func TestFolderSize(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "sub/b.txt": "nested", "sub/deeper/c.txt": strings.Repeat("x", 2048)})
+
+	if files, size, complete := folderSize(dir, duTimeout); files != 3 || size != 2059 || !complete {
+		t.Errorf("folderSize = %d, %d, %v, want 3, 2059, true", files, size, complete)
+	}
+	if files, _, complete := folderSize(dir, -1); files != 0 || complete {
+		t.Errorf("folderSize past its deadline = %d, %v, want 0, false", files, complete)
+	}
+	if got := diskSummary(dir, true); !strings.HasPrefix(got, "Serving 3 files (2.0 KiB), ") {
+		t.Errorf("diskSummary = %q", got)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{10 << 20, "10.0 MiB"},
+		{3 << 30, "3.0 GiB"},
+		{1 << 60, "1.0 EiB"},
+	}
+	for _, tt := range tests {
+		if got := formatSize(tt.n); got != tt.want {
+			t.Errorf("formatSize(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+// TestBannerNoLAN checks that -no-lan leaves only the loopback URLs in the
+// banner.
+func TestBannerNoLAN(t *testing.T) {
+	l, err := net.Listen("tcp4", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	tests := []struct {
+		flags []string
+		lan   bool
+	}{
+		{[]string{"-advertise-ip", "192.168.1.5"}, true},
+		{[]string{"-advertise-ip", "192.168.1.5", "-no-lan"}, false},
+	}
+	for _, tt := range tests {
+		args := testArgs(t, t.TempDir(), tt.flags...)
+		args.banner = "text"
+		got := capture(t, &os.Stdout, func() { printBanner(args, []net.Listener{l, bannerListener(t)}) })
+		if !strings.Contains(got, "http://localhost:"+port+"\n") || !strings.Contains(got, "http://127.0.0.1:") {
+			t.Errorf("%v banner = %q, want the loopback URLs", tt.flags, got)
+		}
+		if lan := strings.Contains(got, "http://192.168.1.5:"+port+"\n"); lan != tt.lan {
+			t.Errorf("%v banner = %q, want the LAN URL %v", tt.flags, got, tt.lan)
+		}
+	}
+}
+
+func TestBannerModes(t *testing.T) {
+	l := bannerListener(t)
+	port := l.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		banner string
+		tls    bool
+		want   string
+	}{
+		{"off", false, ""},
+		{"json", false, fmt.Sprintf(`{"addrs":["%s"],"port":%d,"tls":false}`+"\n", l.Addr(), port)},
+		{"json", true, fmt.Sprintf(`{"addrs":["%s"],"port":%d,"tls":true}`+"\n", l.Addr(), port)},
+		{"text", false, fmt.Sprintf("http://%s\n", l.Addr())},
+		{"text", true, fmt.Sprintf("https://%s\n", l.Addr())},
+	}
+	for _, tt := range tests {
+		args := testArgs(t, t.TempDir())
+		args.banner, args.tls = tt.banner, tt.tls
+		got := capture(t, &os.Stdout, func() { printBanner(args, []net.Listener{l}) })
+		if tt.banner == "text" && !strings.HasPrefix(got, tt.want) || tt.banner != "text" && got != tt.want {
+			t.Errorf("-banner %s -tls=%v = %q, want %q", tt.banner, tt.tls, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package fylshr
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestBasePathRedirects checks that every redirect lands under -base-path
+// once the browser resolves it against the URL it asked for.
+func TestBasePathRedirects(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "sub/b.txt": "nested"})
+
+	tests := []struct {
+		name   string
+		flags  []string
+		method string
+		path   string
+		body   string
+		header string
+		want   string
+	}{
+		{"prefix without slash", nil, http.MethodGet, "/share", "", "", "/share/"},
+		{"doubled slashes", nil, http.MethodGet, "/share//a.txt", "", "", "/share/a.txt"},
+		{"dot segments", nil, http.MethodGet, "/share/sub/../a.txt", "", "", "/share/a.txt"},
+		{"directory without slash", nil, http.MethodGet, "/share/sub", "", "", "/share/sub/"},
+		{"upload", []string{"-upload"}, http.MethodPut, "/share/sub/c.txt", "new", "", "/share/sub/c.txt"},
+		{"paste", []string{"-paste"}, http.MethodPost, "/share" + pastePath, "text=hi", "Content-Type: application/x-www-form-urlencoded", "/share" + pastePath + "/"},
+		{"redirect rule", []string{"-redirect", "^/old$ -> /a.txt"}, http.MethodGet, "/share/old", "", "", "/share/a.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, dir, append([]string{"-base-path", "/share"}, tt.flags...)...)
+			var headers []string
+			if tt.header != "" {
+				headers = append(headers, tt.header)
+			}
+			resp, _ := do(t, srv, tt.method, tt.path, strings.NewReader(tt.body), headers...)
+			location := resp.Header.Get("Location")
+			if location == "" {
+				t.Fatalf("%s %s = %d without a Location", tt.method, tt.path, resp.StatusCode)
+			}
+			target, err := resp.Request.URL.Parse(location)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(target.Path, tt.want) {
+				t.Errorf("%s %s = %d Location %q, want under %q", tt.method, tt.path, resp.StatusCode, location, tt.want)
+			}
+		})
+	}
+}
+
+// TestBasePathSegments checks that -base-path only matches whole path
+// segments.
+func TestBasePathSegments(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "ecret": "secret"})
+	srv := newTestServer(t, dir, "-base-path", "/share")
+
+	tests := []struct {
+		path     string
+		status   int
+		location string
+	}{
+		{"/share", http.StatusMovedPermanently, "/share/"},
+		{"/share/", http.StatusOK, ""},
+		{"/share/a.txt", http.StatusOK, ""},
+		{"/shareecret", http.StatusNotFound, ""},
+		{"/sharea.txt", http.StatusNotFound, ""},
+		{"/shar", http.StatusNotFound, ""},
+		{"/a.txt", http.StatusNotFound, ""},
+		{"/", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		resp, _ := do(t, srv, http.MethodGet, tt.path, nil)
+		if resp.StatusCode != tt.status || resp.Header.Get("Location") != tt.location {
+			t.Errorf("GET %s = %d Location %q, want %d %q", tt.path, resp.StatusCode, resp.Header.Get("Location"), tt.status, tt.location)
+		}
+	}
+}
+
+func TestBasePathMountRedirect(t *testing.T) {
+	dir := t.TempDir()
+	srv := newTestServer(t, "", "-base-path", "/share", "-mount", "/docs="+dir)
+	resp, _ := do(t, srv, http.MethodGet, "/share/docs", nil)
+	if location := resp.Header.Get("Location"); location != "/share/docs/" {
+		t.Errorf("GET /share/docs Location %q, want /share/docs/", location)
+	}
+}
+
+var absoluteLink = regexp.MustCompile(`(?:href|src|action|data-events|data-manage|data-endpoint)="(/[^"]*)"`)
+
+// TestBasePathLinks checks that the absolute links of generated pages start
+// with -base-path. data-dir isn't one, it's the folder scripts send to the
+// endpoints.
+func TestBasePathLinks(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "photo.png": "", "sub/b.txt": "nested"})
+	srv := newTestServer(t, dir, "-base-path", "/share", "-upload", "-live", "-manage", "-token", "s3cret", "-checksums")
+
+	for _, path := range []string{"/share/", "/share/sub/", "/share/?view=gallery", "/share" + searchPath + "?q=b"} {
+		resp, body := do(t, srv, http.MethodGet, path, nil, "Authorization: Bearer s3cret")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s = %d", path, resp.StatusCode)
+		}
+		for _, m := range absoluteLink.FindAllStringSubmatch(body, -1) {
+			if link, _ := url.PathUnescape(m[1]); !strings.HasPrefix(link, "/share/") {
+				t.Errorf("GET %s links to %s", path, m[0])
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package fylshr
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var etagModes = []string{"mtime", "hash", "off"}
+
+// cacheControlFor returns the Cache-Control value for a file: with
+// -spa-bundle, no-cache for index.html and immutable for hashed assets,
+// otherwise the -cache-control-ext entry of its extension or -cache-control.
+func (args Args) cacheControlFor(filename string) string {
+	if args.spaHash != nil {
+		if filename == "index.html" {
+			return "no-cache"
+		}
+		if args.spaHash.MatchString(filename) {
+			return immutableCacheControl
+		}
+	}
+	if value, ok := args.cacheControlExt[strings.ToLower(filepath.Ext(filename))]; ok {
+		return value
+	}
+	return args.cacheControl
+}
+
+// etagFor returns the strong ETag of the file name for -etag: its size and
+// modification time in nanoseconds, or with hash its SHA-256 once computed in
+// the background, or "" when off.
+func (args Args) etagFor(name string) string {
+	if args.etag == "off" {
+		return ""
+	}
+	info, err := os.Stat(name)
+	if err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+	if args.etag == "hash" {
+		if sum := cachedChecksum(name); sum != "" {
+			return `"sha256-` + sum + `"`
+		}
+	}
+	return fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+}
+
+// cacheControlFlags maps lowercase extensions, dot included, to a Cache-Control
+// value.
+type cacheControlFlags map[string]string
+
+func (c cacheControlFlags) String() string {
+	entries := make([]string, 0, len(c))
+	for ext, value := range c {
+		entries = append(entries, ext+"="+value)
+	}
+	slices.Sort(entries)
+	return strings.Join(entries, " ")
+}
+
+func (c cacheControlFlags) Set(value string) error {
+	ext, cacheControl, ok := strings.Cut(value, "=")
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if !ok || ext == "" || cacheControl == "" {
+		return fmt.Errorf("invalid cache control %q, expected \".ext=value\"", value)
+	}
+
+	if ext[0] != '.' {
+		ext = "." + ext
+	}
+	c[ext] = cacheControlValue(cacheControl)
+	return nil
+}
+
+// cacheControlValue expands a bare number of seconds into a max-age directive.
+func cacheControlValue(value string) string {
+	value = strings.TrimSpace(value)
+	if _, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return "max-age=" + value
+	}
+	return value
+}
@@ -0,0 +1,97 @@
+package fylshr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheControl(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "style.css": "p{}", "sub/": ""})
+
+	tests := []struct {
+		name  string
+		flags []string
+		path  string
+		want  string
+	}{
+		{"none", nil, "/a.txt", ""},
+		{"seconds", []string{"-cache-control", "3600"}, "/a.txt", "max-age=3600"},
+		{"value", []string{"-cache-control", "public, max-age=60"}, "/a.txt", "public, max-age=60"},
+		{"max age", []string{"-cache-max-age", "1h"}, "/a.txt", "max-age=3600"},
+		{"no cache", []string{"-no-cache"}, "/a.txt", "no-cache"},
+		{"extension", []string{"-cache-control", "60", "-cache-control-ext", ".css=max-age=86400"}, "/style.css", "max-age=86400"},
+		{"other extension", []string{"-cache-control", "60", "-cache-control-ext", ".css=max-age=86400"}, "/a.txt", "max-age=60"},
+		{"not found", []string{"-cache-control", "3600"}, "/missing.txt", ""},
+		{"listing", []string{"-cache-control", "3600"}, "/sub/", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, dir, tt.flags...)
+			if resp, _ := do(t, srv, http.MethodGet, tt.path, nil); resp.Header.Get("Cache-Control") != tt.want {
+				t.Errorf("GET %s Cache-Control %q, want %q", tt.path, resp.Header.Get("Cache-Control"), tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionalFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(dir, "a.txt"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("hello"))
+
+	for _, etag := range []string{"mtime", "hash", "off"} {
+		srv := newTestServer(t, dir, "-etag", etag)
+		resp, _ := do(t, srv, http.MethodGet, "/a.txt", nil)
+		validator := resp.Header.Get("ETag")
+		if etag == "hash" {
+			// The hash is computed in the background after the first request.
+			for deadline := time.Now().Add(5 * time.Second); validator != `"sha256-`+hex.EncodeToString(sum[:])+`"` && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+				resp, _ = do(t, srv, http.MethodGet, "/a.txt", nil)
+				validator = resp.Header.Get("ETag")
+			}
+		}
+		if (validator == "") != (etag == "off") {
+			t.Fatalf("-etag %s ETag %q", etag, validator)
+		}
+
+		tests := []struct {
+			name, header string
+			status       int
+		}{
+			{"unconditional", "", http.StatusOK},
+			{"since", "If-Modified-Since: " + modTime.Format(http.TimeFormat), http.StatusNotModified},
+			{"modified since", "If-Modified-Since: " + modTime.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK},
+		}
+		if validator != "" {
+			tests = append(tests, []struct {
+				name, header string
+				status       int
+			}{
+				{"none match", "If-None-Match: " + validator, http.StatusNotModified},
+				{"weak none match", "If-None-Match: W/" + validator, http.StatusNotModified},
+				{"other none match", `If-None-Match: "other"`, http.StatusOK},
+				{"match", "If-Match: " + validator, http.StatusOK},
+				{"other match", `If-Match: "other"`, http.StatusPreconditionFailed},
+			}...)
+		}
+		for _, tt := range tests {
+			var headers []string
+			if tt.header != "" {
+				headers = append(headers, tt.header)
+			}
+			if resp, _ := do(t, srv, http.MethodGet, "/a.txt", nil, headers...); resp.StatusCode != tt.status {
+				t.Errorf("-etag %s %s = %d, want %d", etag, tt.header, resp.StatusCode, tt.status)
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package fylshr
+
+import (
+	_ "embed"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+)
+
+// checksumAlgorithms maps the names taken by ?checksum= to those of -digest.
+var checksumAlgorithms = map[string]string{"sha256": "sha-256", "md5": "md5"}
+
+// checksumScript copies the checksums of a listing to the clipboard.
+//
+//go:embed checksum.js
+var checksumScript string
+
+var (
+	// hashing holds the files being hashed in the background.
+	hashing sync.Map
+	// hashSlots keeps listings of big files from reading them all at once.
+	hashSlots = make(chan struct{}, 2)
+)
+
+// cachedChecksum returns the hex SHA-256 of the file name if it's already
+// known, and otherwise starts computing it so a later request has it.
+func cachedChecksum(name string) string {
+	info, err := os.Stat(name)
+	if err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+	if sums := cachedDigests(name, info); sums["sha-256"] != nil {
+		return hex.EncodeToString(sums["sha-256"])
+	}
+
+	if _, busy := hashing.LoadOrStore(name, true); !busy {
+		go func() {
+			defer hashing.Delete(name)
+			hashSlots <- struct{}{}
+			defer func() { <-hashSlots }()
+			fileDigests(name, []string{"sha-256"})
+		}()
+	}
+	return ""
+}
+
+// serveChecksum answers ?checksum=sha256 or md5 for the file name, in the
+// format of sha256sum so the output can be checked with sha256sum -c, or as
+// JSON. It may take a while for a big file that wasn't hashed yet.
+func serveChecksum(w http.ResponseWriter, r *http.Request, name, alg string) {
+	digest, ok := checksumAlgorithms[alg]
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, "400 checksum must be sha256 or md5")
+		return
+	}
+
+	sums, err := fileDigests(name, []string{digest})
+	if err != nil {
+		writeListingError(w, r, err)
+		return
+	}
+	sum := hex.EncodeToString(sums[digest])
+
+	w.Header().Set("Cache-Control", "no-cache")
+	if prefersJSON(r) {
+		writeJSON(w, r, map[string]string{alg: sum})
+		return
+	}
+	body := sum + "  " + path.Base(r.URL.Path) + "\n"
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	writeBody(w, r, []byte(body))
+}
@@ -0,0 +1,23 @@
+// Copies the SHA-256 of a file in the listing when its link is clicked,
+// fetching it first if the server didn't have it yet.
+document.addEventListener("click", async e => {
+  const link = e.target.closest("a.checksum")
+  if (!link || !navigator.clipboard) return
+  e.preventDefault()
+
+  let sum = link.dataset.sum
+  if (!sum) {
+    link.textContent = "hashing…"
+    const res = await fetch(link.href, { headers: { Accept: "application/json" } })
+    sum = res.ok ? (await res.json()).sha256 : ""
+    if (!sum) {
+      link.textContent = "failed"
+      return
+    }
+    link.dataset.sum = sum
+    link.title = sum
+  }
+  await navigator.clipboard.writeText(sum)
+  link.textContent = "copied"
+  setTimeout(() => link.textContent = sum.slice(0, 8) + "…", 1500)
+})
@@ -0,0 +1,70 @@
+package fylshr
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChecksum(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"big.iso": "image bytes", "sec/" + tokenFile: "s3cret", "sec/f.txt": "private"})
+	sha := sha256.Sum256([]byte("image bytes"))
+	sum := hex.EncodeToString(sha[:])
+	md := md5.Sum([]byte("image bytes"))
+	srv := newTestServer(t, dir, "-checksums")
+
+	tests := []struct {
+		name, target, accept string
+		status               int
+		body                 string
+	}{
+		{"default", "/big.iso?checksum", "", http.StatusOK, sum + "  big.iso\n"},
+		{"sha256", "/big.iso?checksum=sha256", "", http.StatusOK, sum + "  big.iso\n"},
+		{"md5", "/big.iso?checksum=md5", "", http.StatusOK, hex.EncodeToString(md[:]) + "  big.iso\n"},
+		{"json", "/big.iso?checksum=sha256", "application/json", http.StatusOK, `{"sha256":"` + sum + `"}`},
+		{"other algorithm", "/big.iso?checksum=crc32", "", http.StatusBadRequest, ""},
+		{"missing", "/nope.iso?checksum", "", http.StatusNotFound, ""},
+		{"token dir", "/sec/f.txt?checksum", "", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, srv, http.MethodGet, tt.target, nil, "Accept: "+tt.accept)
+		if resp.StatusCode != tt.status || tt.body != "" && strings.TrimSpace(body) != strings.TrimSpace(tt.body) {
+			t.Errorf("%s: GET %s = %d %q, want %d %q", tt.name, tt.target, resp.StatusCode, body, tt.status, tt.body)
+		}
+	}
+
+	// The ?checksum above cached the hash for the file and the listing.
+	if resp, _ := do(t, srv, http.MethodGet, "/big.iso", nil); resp.Header.Get("X-Checksum-SHA256") != sum {
+		t.Errorf("GET /big.iso X-Checksum-SHA256 %q, want %s", resp.Header.Get("X-Checksum-SHA256"), sum)
+	}
+	if _, body := do(t, srv, http.MethodGet, "/", nil); !strings.Contains(body, sum) {
+		t.Errorf("GET / doesn't show the checksum of big.iso")
+	}
+	if resp, body := do(t, newTestServer(t, dir), http.MethodGet, "/big.iso?checksum", nil); body != "image bytes" || resp.Header.Get("X-Checksum-SHA256") != "" {
+		t.Errorf("GET /big.iso?checksum without -checksums = %q, want the file", body)
+	}
+}
+
+// TestChecksumBackground checks that a file never asked for its checksum gets
+// one computed after its first download.
+func TestChecksumBackground(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	sha := sha256.Sum256([]byte("hello"))
+	srv := newTestServer(t, dir, "-checksums")
+
+	if resp, _ := do(t, srv, http.MethodGet, "/a.txt", nil); resp.Header.Get("X-Checksum-SHA256") != "" {
+		t.Errorf("first GET has X-Checksum-SHA256 %q before it was computed", resp.Header.Get("X-Checksum-SHA256"))
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if resp, _ := do(t, srv, http.MethodGet, "/a.txt", nil); resp.Header.Get("X-Checksum-SHA256") == hex.EncodeToString(sha[:]) {
+			return
+		}
+	}
+	t.Errorf("X-Checksum-SHA256 never came")
+}
@@ -0,0 +1,209 @@
+package fylshr
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// minCompressSize leaves small responses alone, the encoding overhead being
+// worth more than the bytes saved.
+const minCompressSize = 1024
+
+// compressEncodings are the encodings fylshr compresses with, preferred first.
+var compressEncodings = []string{"br", "gzip"}
+
+// withCompress compresses the text-like responses of h with brotli at
+// brotliLevel or gzip at gzipLevel, whichever the client prefers in
+// Accept-Encoding, unless
+// -no-compress. Range requests, and ?raw ones unless compressRaw, get the
+// identity bytes.
+func withCompress(enabled bool, gzipLevel, brotliLevel int, compressRaw bool, h http.Handler) http.Handler {
+	if !enabled {
+		return h
+	}
+
+	// A gzip.Writer allocates over 800KB, they are reused between responses.
+	gzipWriters := &sync.Pool{New: func() any {
+		gz, _ := gzip.NewWriterLevel(io.Discard, gzipLevel)
+		return gz
+	}}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := ""
+		if r.Header.Get("Range") == "" && (compressRaw || !r.URL.Query().Has("raw")) {
+			encoding = acceptedEncoding(r.Header.Get("Accept-Encoding"))
+		}
+		cw := &compressWriter{ResponseWriter: w, r: r, encoding: encoding, brotliLevel: brotliLevel, gzipWriters: gzipWriters}
+		defer cw.close()
+		h.ServeHTTP(cw, r)
+	})
+}
+
+// acceptedEncoding returns the one of compressEncodings the client gives the
+// highest quality in the Accept-Encoding header, or "" for none.
+func acceptedEncoding(header string) string {
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		qualities[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range compressEncodings {
+		q, ok := qualities[encoding]
+		if !ok {
+			q = qualities["*"]
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressible tells whether responses of the content type are worth
+// compressing: text, JSON, JavaScript, XML and SVG, but not event streams,
+// which are flushed one event at a time.
+func compressible(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/x-javascript", "application/xml":
+		return true
+	}
+	return false
+}
+
+// compressWriter decides from the headers of a response whether to compress
+// it, and then encodes its body on the way out.
+type compressWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	encoding    string
+	brotliLevel int
+	encoder     io.WriteCloser
+	gzipWriters *sync.Pool
+	compressing bool
+	wroteHeader bool
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if !w.wroteHeader && status >= 200 {
+		w.wroteHeader = true
+		w.start(status)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// start compresses a full 200 response of a compressible type, short of a
+// body already encoded or a digest of its identity bytes. Whether compressed
+// or not, such a response varies with Accept-Encoding.
+func (w *compressWriter) start(status int) {
+	header := w.Header()
+	if !compressible(header.Get("Content-Type")) {
+		return
+	}
+	header.Add("Vary", "Accept-Encoding")
+	if w.encoding == "" || status != http.StatusOK || header.Get("Content-Encoding") != "" || header.Get("Digest") != "" {
+		return
+	}
+	if length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil && length < minCompressSize {
+		return
+	}
+
+	w.compressing = true
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	header.Del("Content-MD5")
+	header.Del("Accept-Ranges")
+	// The compressed bytes differ, but the content doesn't: a weak ETag still
+	// revalidates, while ranges on it are refused.
+	if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.compressing {
+		return w.ResponseWriter.Write(b)
+	}
+	if w.encoder == nil {
+		if w.r.Method == http.MethodHead {
+			return len(b), nil
+		}
+		if w.encoding == "br" {
+			w.encoder = brotli.NewWriterLevel(w.ResponseWriter, w.brotliLevel)
+		} else {
+			gz := w.gzipWriters.Get().(*gzip.Writer)
+			gz.Reset(w.ResponseWriter)
+			w.encoder = gz
+		}
+	}
+	return w.encoder.Write(b)
+}
+
+// ReadFrom copies responses left uncompressed straight to the underlying
+// writer, and the others through Write and the encoder.
+func (w *compressWriter) ReadFrom(src io.Reader) (int64, error) {
+	if w.wroteHeader && !w.compressing {
+		return io.Copy(w.ResponseWriter, src)
+	}
+	return io.Copy(struct{ io.Writer }{w}, src)
+}
+
+// Flush sends what the encoder holds so far, for the responses streamed in
+// parts.
+func (w *compressWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.encoder != nil {
+		if f, ok := w.encoder.(interface{ Flush() error }); ok {
+			f.Flush()
+		}
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *compressWriter) close() {
+	if w.encoder == nil {
+		return
+	}
+	w.encoder.Close()
+	if gz, ok := w.encoder.(*gzip.Writer); ok {
+		// Not to hold on to the response until the writer is reused.
+		gz.Reset(io.Discard)
+		w.gzipWriters.Put(gz)
+	}
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
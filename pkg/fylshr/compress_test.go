@@ -0,0 +1,292 @@
+package fylshr
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+// textBody returns n words of compressible but not trivial text.
+func textBody(seed int64, n int) string {
+	words := []string{"share", "files", "over", "the", "local", "network", "with", "one", "command", "fylshr"}
+	rng := rand.New(rand.NewSource(seed))
+	var b strings.Builder
+	for range n {
+		b.WriteString(words[rng.Intn(len(words))])
+		b.WriteString(fmt.Sprint(rng.Intn(100), " "))
+	}
+	return b.String()
+}
+
+// getGzip sends a GET of target accepting gzip to h.
+func getGzip(h http.Handler, target string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// gzipped returns the size of the gzip response of h to target and its
+// decoded body. It only reports errors, to be called from any goroutine.
+func gzipped(t *testing.T, h http.Handler, target string) (encoded int, decoded string) {
+	t.Helper()
+	w := getGzip(h, target)
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("GET %s Content-Encoding %q, want gzip", target, w.Header().Get("Content-Encoding"))
+		return 0, ""
+	}
+	encoded = w.Body.Len()
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Error(err)
+		return 0, ""
+	}
+	b, err := io.ReadAll(gz)
+	if err != nil {
+		t.Error(err)
+	}
+	return encoded, string(b)
+}
+
+func textHandler(body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, body)
+	})
+}
+
+func TestCompressLevel(t *testing.T) {
+	body := textBody(1, 20000)
+	sizes := map[int]int{}
+	for _, level := range []int{gzip.BestSpeed, gzip.DefaultCompression, gzip.BestCompression} {
+		h := withCompress(true, level, brotli.DefaultCompression, true, textHandler(body))
+		encoded, decoded := gzipped(t, h, "/")
+		if decoded != body {
+			t.Fatalf("level %d decodes to another body", level)
+		}
+		if want, _ := gzipSize(body, level); encoded != want {
+			t.Errorf("level %d sent %d bytes, want the %d of gzip at that level", level, encoded, want)
+		}
+		sizes[level] = encoded
+	}
+	if sizes[gzip.BestSpeed] <= sizes[gzip.BestCompression] {
+		t.Errorf("level 1 sent %d bytes, level 9 %d, want level 9 smaller", sizes[gzip.BestSpeed], sizes[gzip.BestCompression])
+	}
+}
+
+func gzipSize(body string, level int) (int, error) {
+	var b strings.Builder
+	gz, err := gzip.NewWriterLevel(&b, level)
+	if err != nil {
+		return 0, err
+	}
+	io.WriteString(gz, body)
+	gz.Close()
+	return b.Len(), nil
+}
+
+// TestCompressPool checks that responses compressed at the same time with
+// reused writers each get their own body.
+func TestCompressPool(t *testing.T) {
+	bodies := map[string]string{}
+	for i := range 20 {
+		bodies[fmt.Sprintf("/%d", i)] = textBody(int64(i), 2000)
+	}
+	h := withCompress(true, gzip.BestSpeed, brotli.DefaultCompression, true, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		textHandler(bodies[r.URL.Path]).ServeHTTP(w, r)
+	}))
+
+	var wg sync.WaitGroup
+	for range 5 {
+		for target, body := range bodies {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, decoded := gzipped(t, h, target); decoded != body {
+					t.Errorf("GET %s got the body of another response", target)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+func BenchmarkCompress(b *testing.B) {
+	body := textBody(1, 20000)
+	for _, level := range []int{gzip.BestSpeed, gzip.DefaultCompression, gzip.BestCompression} {
+		h := withCompress(true, level, brotli.DefaultCompression, true, textHandler(body))
+		b.Run(fmt.Sprint("level", level), func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				getGzip(h, "/")
+			}
+		})
+	}
+}
+
+func TestAcceptedEncoding(t *testing.T) {
+	tests := []struct {
+		header, want string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"br", "br"},
+		{"gzip, deflate, br", "br"},
+		{"gzip, deflate, br, zstd", "br"},
+		{"GZIP", "gzip"},
+		{"deflate", ""},
+		{"identity", ""},
+		{"gzip;q=0", ""},
+		{"gzip;q=0, br;q=1", "br"},
+		{"br;q=0.5, gzip;q=0.8", "gzip"},
+		{"br;q=0.8, gzip;q=0.8", "br"},
+		{"br; q=0.2, gzip; q=0.9", "gzip"},
+		{"*", "br"},
+		{"*;q=0", ""},
+		{"*, br;q=0", "gzip"},
+		{"gzip;q=0.5, *;q=0.1", "gzip"},
+		{"gzip;q=nope, br;q=0.1", "br"},
+		{"identity;q=1, *;q=0", ""},
+	}
+	for _, tt := range tests {
+		if got := acceptedEncoding(tt.header); got != tt.want {
+			t.Errorf("acceptedEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+// TestCompressBrotli checks that a client preferring br gets brotli at
+// -brotli-level, and one only accepting gzip still gets gzip.
+func TestCompressBrotli(t *testing.T) {
+	body := textBody(1, 20000)
+	h := withCompress(true, gzip.DefaultCompression, brotli.BestSpeed, true, textHandler(body))
+
+	tests := []struct {
+		accept, want string
+	}{
+		{"gzip, deflate, br", "br"},
+		{"br;q=1, gzip;q=0.5", "br"},
+		{"gzip", "gzip"},
+		{"br;q=0, gzip", "gzip"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", tt.accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got := w.Header().Get("Content-Encoding"); got != tt.want {
+			t.Errorf("Accept-Encoding %q got Content-Encoding %q, want %q", tt.accept, got, tt.want)
+			continue
+		}
+		var decoder io.Reader = brotli.NewReader(w.Body)
+		if tt.want == "gzip" {
+			gz, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoder = gz
+		}
+		if decoded, err := io.ReadAll(decoder); err != nil || string(decoded) != body {
+			t.Errorf("Accept-Encoding %q decodes to another body: %v", tt.accept, err)
+		}
+	}
+
+	var fastest strings.Builder
+	bw := brotli.NewWriterLevel(&fastest, brotli.BestSpeed)
+	io.WriteString(bw, body)
+	bw.Close()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "br")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Body.Len() != fastest.Len() {
+		t.Errorf("sent %d bytes of brotli, want the %d of level %d", w.Body.Len(), fastest.Len(), brotli.BestSpeed)
+	}
+}
+
+// TestCompressHandler checks which responses of the command are compressed.
+func TestCompressHandler(t *testing.T) {
+	dir := t.TempDir()
+	text := textBody(1, 2000)
+	writeFiles(t, dir, map[string]string{
+		"big.txt":   text,
+		"data.json": `{"text": "` + text + `"}`,
+		"small.txt": "hello",
+		"photo.png": "\x89PNG\r\n\x1a\n" + text,
+		"clip.mp4":  text,
+		"page.html": "<p>" + text,
+		"style.css": "p{}" + text,
+		"app.js":    "var a;" + text,
+		"image.svg": "<svg>" + text,
+	})
+
+	tests := []struct {
+		name    string
+		flags   []string
+		path    string
+		headers []string
+		want    string
+	}{
+		{"text", nil, "/big.txt", []string{"Accept-Encoding: gzip"}, "gzip"},
+		{"json", nil, "/data.json", []string{"Accept-Encoding: gzip"}, "gzip"},
+		{"html", nil, "/page.html", []string{"Accept-Encoding: gzip"}, "gzip"},
+		{"css", nil, "/style.css", []string{"Accept-Encoding: gzip"}, "gzip"},
+		{"js", nil, "/app.js", []string{"Accept-Encoding: gzip"}, "gzip"},
+		{"svg", nil, "/image.svg", []string{"Accept-Encoding: gzip"}, "gzip"},
+		{"listing", nil, "/", []string{"Accept-Encoding: br"}, "br"},
+		{"brotli", nil, "/big.txt", []string{"Accept-Encoding: gzip, br"}, "br"},
+		{"not accepted", nil, "/big.txt", nil, ""},
+		{"refused", nil, "/big.txt", []string{"Accept-Encoding: gzip;q=0"}, ""},
+		{"small", nil, "/small.txt", []string{"Accept-Encoding: gzip"}, ""},
+		{"image", nil, "/photo.png", []string{"Accept-Encoding: gzip"}, ""},
+		{"video", nil, "/clip.mp4", []string{"Accept-Encoding: gzip"}, ""},
+		{"range", nil, "/big.txt", []string{"Accept-Encoding: gzip", "Range: bytes=0-99"}, ""},
+		{"no-compress", []string{"-no-compress"}, "/big.txt", []string{"Accept-Encoding: gzip"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, dir, tt.flags...)
+			resp, body := do(t, srv, http.MethodGet, tt.path, nil, tt.headers...)
+			if got := resp.Header.Get("Content-Encoding"); got != tt.want {
+				t.Fatalf("GET %s Content-Encoding %q, want %q", tt.path, got, tt.want)
+			}
+			// net/http may still count a short compressed body itself.
+			if length := resp.Header.Get("Content-Length"); tt.want != "" && length != "" && length != strconv.Itoa(len(body)) {
+				t.Errorf("GET %s sent %d compressed bytes with Content-Length %s", tt.path, len(body), length)
+			}
+			if tt.want == "gzip" {
+				gz, err := gzip.NewReader(strings.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if decoded, _ := io.ReadAll(gz); !strings.Contains(string(decoded), text) {
+					t.Errorf("GET %s decodes to another body", tt.path)
+				}
+			}
+		})
+	}
+}
+
+// TestCompressRange checks that a range of a compressible file is cut from
+// its identity bytes.
+func TestCompressRange(t *testing.T) {
+	dir := t.TempDir()
+	text := textBody(1, 2000)
+	writeFiles(t, dir, map[string]string{"big.txt": text})
+	srv := newTestServer(t, dir)
+
+	resp, body := do(t, srv, http.MethodGet, "/big.txt", nil, "Accept-Encoding: gzip", "Range: bytes=10-19")
+	if resp.StatusCode != http.StatusPartialContent || body != text[10:20] || resp.Header.Get("Content-Length") != "10" {
+		t.Errorf("GET /big.txt bytes=10-19 = %d %q Content-Length %s, want 206 %q", resp.StatusCode, body, resp.Header.Get("Content-Length"), text[10:20])
+	}
+}
@@ -0,0 +1,95 @@
+package fylshr
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// envPrefix starts the environment variable of every flag, e.g.
+// FYLSHR_MAX_FILE_SIZE for -max-file-size.
+const envPrefix = "FYLSHR_"
+
+// defaultConfigFile returns ~/.config/fylshr/config.toml, or where the
+// platform keeps configuration.
+func defaultConfigFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "fylshr", "config.toml")
+}
+
+// loadSettings sets the flags missing from the command line from their
+// environment variables, then from the -config TOML file or, if it exists,
+// defaultConfigFile. Keys are flag names, and arrays set repeatable flags once
+// per element.
+func loadSettings(flags *flag.FlagSet) error {
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if err != nil || set[f.Name] || !ok {
+			return
+		}
+		if err = f.Value.Set(value); err != nil {
+			err = fmt.Errorf("%s: %w", envName(f.Name), err)
+		}
+		set[f.Name] = true
+	})
+	if err != nil {
+		return err
+	}
+
+	name, required := flags.Lookup("config").Value.String(), true
+	if name == "" {
+		name, required = defaultConfigFile(), false
+	}
+	if name == "" {
+		return nil
+	}
+
+	var settings map[string]any
+	if _, err := toml.DecodeFile(name, &settings); err != nil {
+		if !required && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	for key, value := range settings {
+		f := flags.Lookup(key)
+		if f == nil || key == "config" {
+			return fmt.Errorf("%s: unknown setting %q", name, key)
+		}
+		if set[key] {
+			continue
+		}
+
+		values, ok := value.([]any)
+		if !ok {
+			values = []any{value}
+		}
+		for _, v := range values {
+			if _, ok := v.(map[string]any); ok {
+				return fmt.Errorf("%s: %s must be a value, not a table", name, key)
+			}
+			if err := f.Value.Set(fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("%s: %s: %w", name, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
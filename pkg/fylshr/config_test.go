@@ -0,0 +1,80 @@
+package fylshr
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadSettings(t *testing.T) {
+	// No config file of the user's own on the way.
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	dir := t.TempDir()
+	config := func(toml string) string {
+		name := filepath.Join(dir, strings.ReplaceAll(t.Name(), "/", "_")+".toml")
+		if err := os.WriteFile(name, []byte(toml), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		env    map[string]string
+		toml   string
+		title  string
+		silent bool
+		ports  string
+		err    string
+	}{
+		{"defaults", nil, nil, "", "", false, "", ""},
+		{"env", nil, map[string]string{"FYLSHR_TITLE": "from env", "FYLSHR_SILENT": "true"}, "", "from env", true, "", ""},
+		{"flag over env", []string{"-title", "from flag"}, map[string]string{"FYLSHR_TITLE": "from env"}, "", "from flag", false, "", ""},
+		{"file", nil, nil, "title = \"from file\"\nsilent = true\n", "from file", true, "", ""},
+		{"env over file", nil, map[string]string{"FYLSHR_TITLE": "from env"}, `title = "from file"`, "from env", false, "", ""},
+		{"flag over file", []string{"-port", "9090"}, nil, "port = [80, 8080]", "", false, "9090", ""},
+		{"array", nil, nil, "port = [80, 8080]", "", false, "80,8080", ""},
+		{"number", nil, nil, "port = 8080", "", false, "8080", ""},
+		{"bad env", nil, map[string]string{"FYLSHR_SILENT": "maybe"}, "", "", false, "", "FYLSHR_SILENT"},
+		{"unknown key", nil, nil, `colour = "red"`, "", false, "", `unknown setting "colour"`},
+		{"table", nil, nil, "[title]\nx = 1", "", false, "", "must be a value"},
+		{"bad value", nil, nil, `port = "http"`, "", false, "", "port"},
+		{"missing file", []string{"-config", filepath.Join(dir, "missing.toml")}, nil, "", "", false, "", "missing.toml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			flags := flag.NewFlagSet("fylshr", flag.ContinueOnError)
+			flags.String("config", "", "")
+			title := flags.String("title", "", "")
+			silent := flags.Bool("silent", false, "")
+			var ports portFlags
+			flags.Var(&ports, "port", "")
+			args := tt.args
+			if tt.toml != "" {
+				args = append(args, "-config", config(tt.toml))
+			}
+			if err := flags.Parse(args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := loadSettings(flags)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("loadSettings = %v, want an error with %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil || *title != tt.title || *silent != tt.silent || ports.String() != tt.ports {
+				t.Errorf("loadSettings = %v, -title %q -silent=%v -port %q, want %q %v %q", err, *title, *silent, ports.String(), tt.title, tt.silent, tt.ports)
+			}
+		})
+	}
+}
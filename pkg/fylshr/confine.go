@@ -0,0 +1,67 @@
+package fylshr
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// insideDir reports whether the file name is the directory root or inside it,
+// both being clean absolute paths with their symlinks resolved.
+func insideDir(root, name string) bool {
+	rel, err := filepath.Rel(root, name)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// confined reports whether the file name still is in the directory root once
+// its symlinks are resolved. A name that doesn't exist yet is judged by its
+// nearest existing parent, where it would be created, but a dangling symlink
+// isn't, since writing to it creates its target wherever that is.
+func confined(root, name string) bool {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return false
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return false
+	}
+	name, err = filepath.Abs(name)
+	if err != nil {
+		return false
+	}
+
+	for {
+		resolved, err := filepath.EvalSymlinks(name)
+		if err == nil {
+			return insideDir(root, resolved)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return false
+		}
+		if _, err := os.Lstat(name); err == nil {
+			return false
+		}
+		parent := filepath.Dir(name)
+		if parent == name {
+			return false
+		}
+		name = parent
+	}
+}
+
+// escapes reports whether the URL path name leads, through a symlink, out of
+// every served folder. Without -follow-symlinks such files don't exist.
+func (args Args) escapes(name string) bool {
+	if args.followSymlinks {
+		return false
+	}
+	local := args.localPath(name)
+	for _, folder := range args.layers() {
+		if confined(folder, local) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package fylshr
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// symlinkTree makes a root folder with a file, symlinks inside and out of it
+// and a dangling one, next to an outside folder with a secret.
+func symlinkTree(t *testing.T) (root, outside string) {
+	t.Helper()
+	root, outside = t.TempDir(), t.TempDir()
+	writeFiles(t, root, map[string]string{"a.txt": "hello", "sub/b.txt": "nested"})
+	writeFiles(t, outside, map[string]string{"secret.txt": "secret"})
+	links := map[string]string{
+		"in":       "a.txt",
+		"sub/up":   "../a.txt",
+		"out":      filepath.Join(outside, "secret.txt"),
+		"outdir":   outside,
+		"dangling": filepath.Join(outside, "missing.txt"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Skipf("symlinks: %s", err)
+		}
+	}
+	return root, outside
+}
+
+func TestConfined(t *testing.T) {
+	root, _ := symlinkTree(t)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	relRoot, err := filepath.Rel(wd, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"a.txt", true},
+		{"sub/b.txt", true},
+		{"in", true},
+		{"sub/up", true},
+		{"new.txt", true},
+		{"sub/new/c.txt", true},
+		{"out", false},
+		{"outdir/secret.txt", false},
+		{"outdir/new.txt", false},
+		{"dangling", false},
+	}
+	for _, r := range []string{root, relRoot} {
+		for _, tt := range tests {
+			name := filepath.Join(r, filepath.FromSlash(tt.name))
+			if got := confined(r, name); got != tt.want {
+				t.Errorf("confined(%q, %q) = %v, want %v", r, name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestEscapes(t *testing.T) {
+	root, _ := symlinkTree(t)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	relRoot, err := filepath.Rel(wd, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path   string
+		status int
+		follow int
+	}{
+		{"/", http.StatusOK, http.StatusOK},
+		{"/a.txt", http.StatusOK, http.StatusOK},
+		{"/in", http.StatusOK, http.StatusOK},
+		{"/sub/up", http.StatusOK, http.StatusOK},
+		{"/out", http.StatusNotFound, http.StatusOK},
+		{"/outdir/secret.txt", http.StatusNotFound, http.StatusOK},
+		{"/dangling", http.StatusNotFound, http.StatusNotFound},
+	}
+	for _, folder := range []string{root, relRoot} {
+		srv := newTestServer(t, folder)
+		follow := newTestServer(t, folder, "-follow-symlinks")
+		for _, tt := range tests {
+			if resp, _ := do(t, srv, http.MethodGet, tt.path, nil); resp.StatusCode != tt.status {
+				t.Errorf("-folder %s: GET %s = %d, want %d", folder, tt.path, resp.StatusCode, tt.status)
+			}
+			if resp, _ := do(t, follow, http.MethodGet, tt.path, nil); resp.StatusCode != tt.follow {
+				t.Errorf("-folder %s -follow-symlinks: GET %s = %d, want %d", folder, tt.path, resp.StatusCode, tt.follow)
+			}
+		}
+	}
+}
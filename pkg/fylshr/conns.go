@@ -0,0 +1,133 @@
+package fylshr
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// readHeaderTimeout drops connections that never finish sending their
+	// request headers, which otherwise hold a file descriptor forever.
+	readHeaderTimeout = 10 * time.Second
+	// idleTimeout closes keep-alive connections no request came on for a while.
+	idleTimeout = 2 * time.Minute
+)
+
+// connLimiter counts the connections of every listener for -max-conns and
+// -max-conns-per-ip. Past -max-conns new connections wait in the listen
+// backlog until others close, while a client over -max-conns-per-ip is
+// disconnected right away. Unix socket clients have no IP and only count
+// against -max-conns.
+type connLimiter struct {
+	slots chan struct{}
+	perIP int
+
+	sync.Mutex
+	clients map[string]int
+}
+
+// limitConns returns listeners sharing total connections and perIP for each
+// client, 0 meaning no limit.
+func limitConns(listeners []net.Listener, total, perIP int) []net.Listener {
+	if total <= 0 && perIP <= 0 {
+		return listeners
+	}
+	limiter := &connLimiter{perIP: perIP, clients: map[string]int{}}
+	if total > 0 {
+		limiter.slots = make(chan struct{}, total)
+	}
+	limited := make([]net.Listener, len(listeners))
+	for i, l := range listeners {
+		limited[i] = &limitedListener{Listener: l, limiter: limiter, done: make(chan struct{})}
+	}
+	return limited
+}
+
+func (l *connLimiter) acquire(ip string) bool {
+	if l.perIP <= 0 || ip == "" {
+		return true
+	}
+	l.Lock()
+	defer l.Unlock()
+	if l.clients[ip] >= l.perIP {
+		return false
+	}
+	l.clients[ip]++
+	return true
+}
+
+func (l *connLimiter) release(ip string) {
+	if l.perIP > 0 && ip != "" {
+		l.Lock()
+		if l.clients[ip]--; l.clients[ip] <= 0 {
+			delete(l.clients, ip)
+		}
+		l.Unlock()
+	}
+	l.freeSlot()
+}
+
+func (l *connLimiter) freeSlot() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+type limitedListener struct {
+	net.Listener
+	limiter *connLimiter
+	done    chan struct{}
+	closed  sync.Once
+}
+
+func (l *limitedListener) Accept() (net.Conn, error) {
+	if l.limiter.slots != nil {
+		select {
+		case l.limiter.slots <- struct{}{}:
+		case <-l.done:
+			return nil, net.ErrClosed
+		}
+	}
+
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			l.limiter.freeSlot()
+			return nil, err
+		}
+		ip, _, err := net.SplitHostPort(c.RemoteAddr().String())
+		if err != nil {
+			ip = ""
+		}
+		if l.limiter.acquire(ip) {
+			return &limitedConn{Conn: c, release: func() { l.limiter.release(ip) }}, nil
+		}
+		c.Close()
+	}
+}
+
+func (l *limitedListener) Close() error {
+	l.closed.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// limitedConn gives its slots back on the first Close.
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+// ReadFrom hands copies to the ReadFrom of the *net.TCPConn underneath, which
+// net/http checks for when writing a file to the socket.
+func (c *limitedConn) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(c.Conn, src)
+}
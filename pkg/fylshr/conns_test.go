@@ -0,0 +1,122 @@
+package fylshr
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// acceptAll accepts the connections of l in the background.
+func acceptAll(l net.Listener) (chan net.Conn, chan error) {
+	conns, errs := make(chan net.Conn, 8), make(chan error, 1)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				errs <- err
+				return
+			}
+			conns <- c
+		}
+	}()
+	return conns, errs
+}
+
+// dial connects to l, until t is done.
+func dial(t *testing.T, l net.Listener) net.Conn {
+	t.Helper()
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// accepted returns the next connection accepted, or nil if none is within
+// wait.
+func accepted(conns chan net.Conn, wait time.Duration) net.Conn {
+	select {
+	case c := <-conns:
+		return c
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// TestLimitConns checks that -max-conns keeps connections waiting until one
+// closes, and that -max-conns-per-ip disconnects a client over its share.
+func TestLimitConns(t *testing.T) {
+	plain := []net.Listener{bannerListener(t)}
+	if got := limitConns(plain, 0, 0); got[0] != plain[0] {
+		t.Errorf("limitConns without limits wraps the listeners")
+	}
+
+	t.Run("max-conns", func(t *testing.T) {
+		l := limitConns([]net.Listener{bannerListener(t)}, 1, 0)[0]
+		conns, errs := acceptAll(l)
+		dial(t, l)
+		first := accepted(conns, time.Second)
+		if first == nil {
+			t.Fatal("-max-conns 1 doesn't accept a first connection")
+		}
+		dial(t, l)
+		if c := accepted(conns, 200*time.Millisecond); c != nil {
+			t.Fatal("-max-conns 1 accepts a second connection")
+		}
+		first.Close()
+		first.Close()
+		second := accepted(conns, time.Second)
+		if second == nil {
+			t.Fatal("-max-conns 1 doesn't accept a waiting connection once the first closed")
+		}
+		dial(t, l)
+		if c := accepted(conns, 200*time.Millisecond); c != nil {
+			t.Fatal("closing a connection twice frees two slots of -max-conns")
+		}
+		l.Close()
+		if err := <-errs; !errors.Is(err, net.ErrClosed) {
+			t.Errorf("Accept on a closed listener waiting for a slot = %v", err)
+		}
+		second.Close()
+	})
+
+	t.Run("max-conns-per-ip", func(t *testing.T) {
+		l := limitConns([]net.Listener{bannerListener(t)}, 0, 1)[0]
+		defer l.Close()
+		conns, _ := acceptAll(l)
+		dial(t, l)
+		first := accepted(conns, time.Second)
+		if first == nil {
+			t.Fatal("-max-conns-per-ip 1 doesn't accept a first connection")
+		}
+		over := dial(t, l)
+		over.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := over.Read(make([]byte, 1)); err != io.EOF {
+			t.Errorf("-max-conns-per-ip 1 second connection reads %v, want it closed", err)
+		}
+		first.Close()
+		dial(t, l)
+		if c := accepted(conns, time.Second); c == nil {
+			t.Errorf("-max-conns-per-ip 1 doesn't accept the client again once its connection closed")
+		} else {
+			c.Close()
+		}
+	})
+}
+
+func TestServerTimeouts(t *testing.T) {
+	srv := newServer(testArgs(t, t.TempDir()))
+	if srv.ReadHeaderTimeout != readHeaderTimeout || srv.IdleTimeout != idleTimeout {
+		t.Errorf("server timeouts are %s for headers and %s idle, want %s and %s", srv.ReadHeaderTimeout, srv.IdleTimeout, readHeaderTimeout, idleTimeout)
+	}
+
+	for _, flag := range []string{"-max-conns", "-max-conns-per-ip"} {
+		if out, err := mainCommand("-folder", t.TempDir(), flag, "-1", "-dry-run").CombinedOutput(); err == nil || !strings.Contains(string(out), "invalid "+flag) {
+			t.Errorf("%s -1 = %v %q, want it refused", flag, err, out)
+		}
+	}
+}
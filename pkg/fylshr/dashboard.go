@@ -0,0 +1,143 @@
+package fylshr
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type requestEvent struct {
+	time   time.Time
+	method string
+	path   string
+	status int
+	bytes  int64
+}
+
+const (
+	rateWindow      = 10
+	recentRequests  = 10
+	topPaths        = 5
+	maxTrackedPaths = 1000
+)
+
+// dashboard aggregates access log events for the -tui view.
+type dashboard struct {
+	mu       sync.Mutex
+	requests int
+	bytes    int64
+	paths    map[string]int
+	recent   []requestEvent
+	// buckets counts requests per second over the last rateWindow seconds,
+	// indexed by the unix second modulo rateWindow.
+	buckets [rateWindow]struct {
+		second int64
+		count  int
+	}
+}
+
+func newDashboard() *dashboard {
+	return &dashboard{paths: map[string]int{}}
+}
+
+func (d *dashboard) record(e requestEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.requests++
+	d.bytes += e.bytes
+
+	if _, ok := d.paths[e.path]; ok || len(d.paths) < maxTrackedPaths {
+		d.paths[e.path]++
+	}
+
+	d.recent = append(d.recent, e)
+	if len(d.recent) > recentRequests {
+		d.recent = d.recent[1:]
+	}
+
+	second := e.time.Unix()
+	bucket := &d.buckets[second%rateWindow]
+	if bucket.second != second {
+		bucket.second, bucket.count = second, 0
+	}
+	bucket.count++
+}
+
+// rate returns the average requests per second over the last rateWindow
+// seconds before now.
+func (d *dashboard) rate(now time.Time) float64 {
+	total := 0
+	for _, bucket := range d.buckets {
+		if age := now.Unix() - bucket.second; age >= 0 && age < rateWindow {
+			total += bucket.count
+		}
+	}
+	return float64(total) / rateWindow
+}
+
+type pathCount struct {
+	path  string
+	count int
+}
+
+func (d *dashboard) top(n int) []pathCount {
+	counts := make([]pathCount, 0, len(d.paths))
+	for path, count := range d.paths {
+		counts = append(counts, pathCount{path, count})
+	}
+
+	slices.SortFunc(counts, func(a, b pathCount) int {
+		return cmp.Or(cmp.Compare(b.count, a.count), strings.Compare(a.path, b.path))
+	})
+
+	return counts[:min(n, len(counts))]
+}
+
+func (d *dashboard) render(w io.Writer, now time.Time, folder string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(&b, "\x1b[1m\x1b[38;5;159mfylshr\x1b[0m serving %s for %s | \x1b[38;5;225mCtrl-C\x1b[0m to exit\n\n", folder, now.Sub(startTime).Round(time.Second))
+	fmt.Fprintf(&b, "\x1b[1m\x1b[38;5;228m%.1f\x1b[0m req/s  \x1b[1m\x1b[38;5;228m%d\x1b[0m requests  \x1b[1m\x1b[38;5;228m%s\x1b[0m served\n\n", d.rate(now), d.requests, formatSize(uint64(d.bytes)))
+
+	b.WriteString("\x1b[1m\x1b[38;5;158mTop paths\x1b[0m\n")
+	for _, p := range d.top(topPaths) {
+		fmt.Fprintf(&b, "%6d  %s\n", p.count, p.path)
+	}
+
+	b.WriteString("\n\x1b[1m\x1b[38;5;158mRecent requests\x1b[0m\n")
+	for i := len(d.recent) - 1; i >= 0; i-- {
+		e := d.recent[i]
+		fmt.Fprintf(&b, "%s %s%d\x1b[0m %-6s %s\n", e.time.Format("15:04:05"), statusColor(e.status), e.status, e.method, e.path)
+	}
+
+	io.WriteString(w, b.String())
+}
+
+// run redraws the dashboard every second on the alternate screen until stop
+// is closed, then restores the terminal and closes done.
+func (d *dashboard) run(folder string, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l")
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		d.render(os.Stdout, time.Now(), folder)
+		select {
+		case <-ticker.C:
+		case <-stop:
+			os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+			return
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package fylshr
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDashboard checks the totals, rate, top paths and recent requests of
+// the -tui view.
+func TestDashboard(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	d := newDashboard()
+	events := []requestEvent{
+		{now.Add(-20 * time.Second), http.MethodGet, "/old.txt", http.StatusOK, 100},
+		{now.Add(-9 * time.Second), http.MethodGet, "/a.txt", http.StatusOK, 5},
+		{now.Add(-5 * time.Second), http.MethodGet, "/b.txt", http.StatusOK, 10},
+		{now.Add(-time.Second), http.MethodGet, "/a.txt", http.StatusOK, 5},
+		{now, http.MethodHead, "/c.txt", http.StatusNotFound, 0},
+	}
+	for i := range 10 {
+		events = append(events, requestEvent{now, http.MethodGet, fmt.Sprintf("/n%d", i), http.StatusOK, 1})
+	}
+	for _, e := range events {
+		d.record(e)
+	}
+
+	if d.requests != 15 || d.bytes != 130 {
+		t.Errorf("dashboard counts %d requests of %d bytes, want 15 of 130", d.requests, d.bytes)
+	}
+	if rate := d.rate(now); rate != 1.4 {
+		t.Errorf("rate = %v, want the 14 requests of the last 10s", rate)
+	}
+	if top, want := d.top(3), []pathCount{{"/a.txt", 2}, {"/b.txt", 1}, {"/c.txt", 1}}; !slices.Equal(top, want) {
+		t.Errorf("top(3) = %v, want %v", top, want)
+	}
+	if len(d.recent) != recentRequests || d.recent[0].path != "/n0" {
+		t.Errorf("recent = %d requests from %s, want the last %d", len(d.recent), d.recent[0].path, recentRequests)
+	}
+
+	var b strings.Builder
+	d.render(&b, now, "/srv/public")
+	screen := ansiEscape.ReplaceAllString(b.String(), "")
+	for _, want := range []string{"fylshr serving /srv/public for ", "1.4 req/s  15 requests  130 B served\n", "Top paths\n     2  /a.txt\n     1  /b.txt\n", "Recent requests\n03:04:05 200 GET    /n9\n"} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("dashboard shows %q, want %q", screen, want)
+		}
+	}
+	if !strings.HasPrefix(b.String(), "\x1b[H\x1b[2J") {
+		t.Errorf("dashboard doesn't clear the screen first")
+	}
+
+	d = newDashboard()
+	for i := range maxTrackedPaths + 1 {
+		d.record(requestEvent{now, http.MethodGet, fmt.Sprint("/", i), http.StatusOK, 0})
+	}
+	d.record(requestEvent{now, http.MethodGet, "/0", http.StatusOK, 0})
+	if len(d.paths) != maxTrackedPaths || d.paths["/0"] != 2 {
+		t.Errorf("dashboard tracks %d paths, /0 %d times, want %d and 2", len(d.paths), d.paths["/0"], maxTrackedPaths)
+	}
+}
+
+// TestDashboardLog checks that requests go to the -tui dashboard instead of
+// the access log.
+func TestDashboardLog(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	args := testArgs(t, dir, "-silent=false")
+	args.tui = newDashboard()
+	h := newHandler(args)
+
+	tests := []struct {
+		method, path string
+		status       int
+		bytes        int64
+	}{
+		{http.MethodGet, "/a.txt", http.StatusOK, 5},
+		{http.MethodHead, "/a.txt", http.StatusOK, 0},
+		{http.MethodGet, "/missing.txt", http.StatusNotFound, 19},
+	}
+	for _, tt := range tests {
+		out := capture(t, &os.Stdout, func() { h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil)) })
+		e := args.tui.recent[len(args.tui.recent)-1]
+		if out != "" || e.method != tt.method || e.path != tt.path || e.status != tt.status || e.bytes != tt.bytes {
+			t.Errorf("-tui %s %s logs %q and records %+v, want %d of %d bytes", tt.method, tt.path, out, e, tt.status, tt.bytes)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package fylshr
+
+import (
+	"fmt"
+	"time"
+)
+
+// dateLayouts are the named presets of -date-format, besides relative.
+var dateLayouts = map[string]string{
+	"iso":    "2006-01-02T15:04:05Z07:00",
+	"rfc822": time.RFC822,
+}
+
+// parseDateFormat parses -date-format: a preset or a Go reference time layout,
+// which must format at least part of a time.
+func parseDateFormat(format string) (func(t time.Time) string, error) {
+	if format == "relative" {
+		return func(t time.Time) string { return relativeTime(t, time.Now()) }, nil
+	}
+	if layout, ok := dateLayouts[format]; ok {
+		format = layout
+	}
+	if sample := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC); sample.Format(format) == format {
+		return nil, fmt.Errorf("%q has nothing of the reference time 2006-01-02 15:04:05", format)
+	}
+	return func(t time.Time) string { return t.Format(format) }, nil
+}
+
+// relativeTime describes t from now, like "3 hours ago" or "in 2 days", in
+// the largest whole unit.
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	if d < 0 {
+		d = -d
+	}
+	if d < time.Minute {
+		return "just now"
+	}
+
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+	for _, u := range units {
+		if n := int(d / u.size); n > 0 {
+			s := fmt.Sprintf("%d %s", n, u.name)
+			if n > 1 {
+				s += "s"
+			}
+			if t.After(now) {
+				return "in " + s
+			}
+			return s + " ago"
+		}
+	}
+	return "just now"
+}
@@ -0,0 +1,80 @@
+package fylshr
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRelativeTime(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		ago  time.Duration
+		want string
+	}{
+		{0, "just now"},
+		{30 * time.Second, "just now"},
+		{time.Minute, "1 minute ago"},
+		{59 * time.Minute, "59 minutes ago"},
+		{3*time.Hour + 20*time.Minute, "3 hours ago"},
+		{24 * time.Hour, "1 day ago"},
+		{45 * 24 * time.Hour, "1 month ago"},
+		{800 * 24 * time.Hour, "2 years ago"},
+		{-2 * time.Hour, "in 2 hours"},
+	}
+	for _, tt := range tests {
+		if got := relativeTime(now.Add(-tt.ago), now); got != tt.want {
+			t.Errorf("relativeTime(now - %s) = %q, want %q", tt.ago, got, tt.want)
+		}
+	}
+}
+
+func TestParseDateFormat(t *testing.T) {
+	at := time.Date(2024, 5, 10, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		format, want string
+		ok           bool
+	}{
+		{"2006-01-02 15:04", "2024-05-10 12:30", true},
+		{"02/01/2006", "10/05/2024", true},
+		{"iso", "2024-05-10T12:30:00Z", true},
+		{"rfc822", "10 May 24 12:30 UTC", true},
+		{"yesterday", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		format, err := parseDateFormat(tt.format)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseDateFormat(%q) error %v, want ok %v", tt.format, err, tt.ok)
+			continue
+		}
+		if err == nil && format(at) != tt.want {
+			t.Errorf("parseDateFormat(%q) formats %q, want %q", tt.format, format(at), tt.want)
+		}
+	}
+}
+
+func TestListingDateFormat(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	at := time.Now().Add(-3 * time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "a.txt"), at, at); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format, want string
+	}{
+		{"02.01.2006", `<td class="time">` + at.Format("02.01.2006") + `</td>`},
+		{"relative", `<td class="time">3 hours ago</td>`},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, "-date-format", tt.format)
+		if _, body := do(t, srv, http.MethodGet, "/", nil); !strings.Contains(body, tt.want) {
+			t.Errorf("-date-format %q listing = %s, want %s", tt.format, body, tt.want)
+		}
+	}
+}
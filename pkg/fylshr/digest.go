@@ -0,0 +1,183 @@
+package fylshr
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var digestAlgorithms = []string{"sha-256", "md5"}
+
+// parseDigests parses the comma separated -digest algorithms.
+func parseDigests(s string) ([]string, error) {
+	var algs []string
+	for _, alg := range strings.Split(s, ",") {
+		alg = strings.ToLower(strings.TrimSpace(alg))
+		if alg == "" {
+			continue
+		}
+		if !slices.Contains(digestAlgorithms, alg) {
+			return nil, fmt.Errorf("unknown algorithm %q, expected %s", alg, strings.Join(digestAlgorithms, " or "))
+		}
+		if !slices.Contains(algs, alg) {
+			algs = append(algs, alg)
+		}
+	}
+	return algs, nil
+}
+
+const digestCacheSize = 1024
+
+type digestEntry struct {
+	modTime time.Time
+	size    int64
+	sums    map[string][]byte
+}
+
+var digestCache = struct {
+	sync.Mutex
+	entries map[string]digestEntry
+}{entries: map[string]digestEntry{}}
+
+// digestWriter sets the Digest and Content-MD5 headers of name when the
+// response is the whole file, so a range request gets them only when If-Range
+// made it fall back to a 200.
+type digestWriter struct {
+	http.ResponseWriter
+	name        string
+	algs        []string
+	wroteHeader bool
+}
+
+func (w *digestWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status == http.StatusOK {
+			w.setDigest()
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *digestWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *digestWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return io.Copy(w.ResponseWriter, src)
+}
+
+func (w *digestWriter) setDigest() {
+	sums, err := fileDigests(w.name, w.algs)
+	if err != nil {
+		return
+	}
+
+	for _, alg := range w.algs {
+		value := base64.StdEncoding.EncodeToString(sums[alg])
+		if alg == "md5" {
+			w.Header().Set("Content-MD5", value)
+		}
+		w.Header().Add("Digest", alg+"="+value)
+	}
+}
+
+// fileDigests hashes a regular file, remembering the sums until its size or
+// modification time changes. The cache is dropped when full.
+func fileDigests(name string, algs []string) (map[string][]byte, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", name)
+	}
+
+	if sums := cachedDigests(name, info); sums != nil && hasDigests(sums, algs) {
+		return sums, nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hashes := map[string]hash.Hash{}
+	var writers []io.Writer
+	for _, alg := range algs {
+		h := sha256.New()
+		if alg == "md5" {
+			h = md5.New()
+		}
+		hashes[alg] = h
+		writers = append(writers, h)
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return nil, err
+	}
+
+	sums := map[string][]byte{}
+	if cached := cachedDigests(name, info); cached != nil {
+		maps.Copy(sums, cached)
+	}
+	for alg, h := range hashes {
+		sums[alg] = h.Sum(nil)
+	}
+
+	digestCache.Lock()
+	defer digestCache.Unlock()
+	if len(digestCache.entries) >= digestCacheSize {
+		clear(digestCache.entries)
+	}
+	digestCache.entries[name] = digestEntry{modTime: info.ModTime(), size: info.Size(), sums: sums}
+	return sums, nil
+}
+
+// cachedDigests returns the sums of name remembered by fileDigests, if they
+// are still those of the file described by info.
+func cachedDigests(name string, info os.FileInfo) map[string][]byte {
+	digestCache.Lock()
+	entry, ok := digestCache.entries[name]
+	digestCache.Unlock()
+	if ok && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+		return entry.sums
+	}
+	return nil
+}
+
+// forgetDigests drops the sums of the file name and of those under it.
+func forgetDigests(name string) {
+	name = filepath.Clean(name)
+	digestCache.Lock()
+	defer digestCache.Unlock()
+	maps.DeleteFunc(digestCache.entries, func(entry string, _ digestEntry) bool {
+		return under(filepath.Clean(entry), name, filepath.Separator)
+	})
+}
+
+func hasDigests(sums map[string][]byte, algs []string) bool {
+	for _, alg := range algs {
+		if sums[alg] == nil {
+			return false
+		}
+	}
+	return true
+}
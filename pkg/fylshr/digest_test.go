@@ -0,0 +1,92 @@
+package fylshr
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDigest(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "sub/": ""})
+	sha := sha256.Sum256([]byte("hello"))
+	sum := md5.Sum([]byte("hello"))
+	shaDigest := "sha-256=" + base64.StdEncoding.EncodeToString(sha[:])
+	md5Digest := base64.StdEncoding.EncodeToString(sum[:])
+
+	tests := []struct {
+		digest  string
+		method  string
+		path    string
+		headers []string
+		status  int
+		want    []string
+		md5     string
+	}{
+		{"sha-256", http.MethodGet, "/a.txt", nil, http.StatusOK, []string{shaDigest}, ""},
+		{"md5", http.MethodGet, "/a.txt", nil, http.StatusOK, []string{"md5=" + md5Digest}, md5Digest},
+		{"SHA-256, md5,sha-256", http.MethodGet, "/a.txt", nil, http.StatusOK, []string{shaDigest, "md5=" + md5Digest}, md5Digest},
+		{"sha-256", http.MethodHead, "/a.txt", nil, http.StatusOK, []string{shaDigest}, ""},
+		{"sha-256", http.MethodGet, "/a.txt", []string{"Range: bytes=1-2"}, http.StatusPartialContent, nil, ""},
+		{"sha-256", http.MethodGet, "/a.txt", []string{"Range: bytes=1-2", `If-Range: "stale"`}, http.StatusOK, []string{shaDigest}, ""},
+		{"sha-256", http.MethodGet, "/a.txt", []string{"If-None-Match: *"}, http.StatusNotModified, nil, ""},
+		{"sha-256", http.MethodGet, "/sub/", nil, http.StatusOK, nil, ""},
+		{"sha-256", http.MethodGet, "/missing.txt", nil, http.StatusNotFound, nil, ""},
+		{"", http.MethodGet, "/a.txt", nil, http.StatusOK, nil, ""},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, "-digest", tt.digest)
+		resp, _ := do(t, srv, tt.method, tt.path, nil, tt.headers...)
+		if resp.StatusCode != tt.status || !slices.Equal(resp.Header.Values("Digest"), tt.want) || resp.Header.Get("Content-MD5") != tt.md5 {
+			t.Errorf("-digest %q %s %s %v = %d Digest %q Content-MD5 %q, want %d %q %q", tt.digest, tt.method, tt.path, tt.headers, resp.StatusCode, resp.Header.Values("Digest"), resp.Header.Get("Content-MD5"), tt.status, tt.want, tt.md5)
+		}
+	}
+}
+
+// TestDigestChanged checks that a file rewritten with the same size gets the
+// digest of its new content.
+func TestDigestChanged(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	srv := newTestServer(t, dir, "-digest", "md5")
+	do(t, srv, http.MethodGet, "/a.txt", nil)
+
+	name := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(name, []byte("world"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(name, later, later); err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum([]byte("world"))
+	if resp, _ := do(t, srv, http.MethodGet, "/a.txt", nil); resp.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Errorf("GET /a.txt after a change has Content-MD5 %q, want that of the new content", resp.Header.Get("Content-MD5"))
+	}
+}
+
+func TestParseDigests(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+		ok   bool
+	}{
+		{"", nil, true},
+		{"sha-256", []string{"sha-256"}, true},
+		{" MD5 , sha-256,, md5", []string{"md5", "sha-256"}, true},
+		{"sha256", nil, false},
+		{"sha-256,crc32", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := parseDigests(tt.in)
+		if (err == nil) != tt.ok || !slices.Equal(got, tt.want) {
+			t.Errorf("parseDigests(%q) = %q, %v, want %q, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
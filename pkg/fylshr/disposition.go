@@ -0,0 +1,22 @@
+package fylshr
+
+import "strings"
+
+var dispositions = []string{"auto", "attachment", "inline"}
+
+// attachment reports whether a file should download rather than open in the
+// browser: per -inline-ext, then -attach-ext, then -disposition, where auto
+// downloads media and documents.
+func (args Args) attachment(filename string) bool {
+	filename = strings.ToLower(filename)
+	switch {
+	case matchesGlob(args.inlineExt, filename):
+		return false
+	case matchesGlob(args.attachExt, filename):
+		return true
+	case args.disposition == "auto":
+		return args.mimeTypes.isMedia(filename)
+	default:
+		return args.disposition == "attachment"
+	}
+}
@@ -0,0 +1,50 @@
+package fylshr
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDisposition(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.txt":        "hello",
+		"photo.JPG":    "",
+		"doc.pdf":      "",
+		"disk.iso":     "",
+		"notes.md":     "",
+		`say "hi".png`: "",
+	})
+
+	tests := []struct {
+		flags []string
+		path  string
+		want  string
+	}{
+		{nil, "/a.txt", ""},
+		{nil, "/photo.JPG", `attachment; filename="photo.JPG"`},
+		{nil, "/doc.pdf", `attachment; filename="doc.pdf"`},
+		{nil, "/doc.pdf?inline", ""},
+		{nil, "/disk.iso", ""},
+		{nil, "/say%20%22hi%22.png", `attachment; filename="say \"hi\".png"`},
+		{[]string{"-disposition", "attachment"}, "/a.txt", `attachment; filename="a.txt"`},
+		{[]string{"-disposition", "attachment"}, "/a.txt?inline", ""},
+		{[]string{"-disposition", "inline"}, "/doc.pdf", ""},
+		{[]string{"-no-attachment"}, "/photo.JPG", ""},
+		{[]string{"-attach-ext", "iso,.MD"}, "/disk.iso", `attachment; filename="disk.iso"`},
+		{[]string{"-attach-ext", "iso,.MD"}, "/notes.md", `attachment; filename="notes.md"`},
+		{[]string{"-attach-ext", "*.txt"}, "/a.txt", `attachment; filename="a.txt"`},
+		{[]string{"-inline-ext", "pdf"}, "/doc.pdf", ""},
+		{[]string{"-inline-ext", "jpg"}, "/photo.JPG", ""},
+		{[]string{"-inline-ext", "pdf", "-attach-ext", "pdf"}, "/doc.pdf", ""},
+		{[]string{"-inline-ext", "pdf", "-disposition", "attachment"}, "/doc.pdf", ""},
+		{[]string{"-inline-ext", "pdf", "-disposition", "attachment"}, "/a.txt", `attachment; filename="a.txt"`},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, tt.flags...)
+		resp, _ := do(t, srv, http.MethodGet, tt.path, nil)
+		if got := resp.Header.Get("Content-Disposition"); resp.StatusCode != http.StatusOK || got != tt.want {
+			t.Errorf("%v GET %s = %d Content-Disposition %q, want %q", tt.flags, tt.path, resp.StatusCode, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package fylshr
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+// TestDryRun checks that -dry-run exits 0 for a valid configuration without
+// binding its port, and nonzero with the reason for an invalid one.
+func TestDryRun(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	// A port already in use, which only serving would fail on.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	tests := []struct {
+		flags []string
+		ok    bool
+		want  string
+	}{
+		{[]string{"-folder", dir, "-port", port}, true, "Configuration OK"},
+		{[]string{"-folder", dir, "-rewrite", "^/old/(.*) -> /new/$1", "-deny", "10.0.0.0/8"}, true, "Configuration OK"},
+		{[]string{"-folder", dir, "-rewrite", "^/old/(.* -> /new/$1"}, false, "-rewrite"},
+		{[]string{"-folder", dir, "-deny", "10.0.0.0/33"}, false, "-deny"},
+		{[]string{"-folder", dir + "/missing"}, false, "-folder"},
+		{[]string{"-folder", dir, "-cert", dir + "/missing.crt", "-key", dir + "/missing.key"}, false, "missing.crt"},
+	}
+	for _, tt := range tests {
+		out, err := mainCommand(append(tt.flags, "-dry-run", "-silent")...).CombinedOutput()
+		if (err == nil) != tt.ok || !strings.Contains(string(out), tt.want) {
+			t.Errorf("%v -dry-run = %v %q, want ok %v with %q", tt.flags, err, out, tt.ok, tt.want)
+		}
+	}
+}
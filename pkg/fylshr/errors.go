@@ -0,0 +1,159 @@
+package fylshr
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// writeError responds with msg as {"error":"...","status":N} to clients that
+// prefer JSON, and as plain text otherwise.
+func writeError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	if !prefersJSON(r) {
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	writeBody(w, r, errorJSON(status, msg))
+}
+
+func errorJSON(status int, msg string) []byte {
+	b, _ := json.Marshal(struct {
+		Error  string `json:"error"`
+		Status int    `json:"status"`
+	}{msg, status})
+	return append(b, '\n')
+}
+
+// prefersJSON reports whether the Accept header ranks application/json above
+// text/html.
+func prefersJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return false
+	}
+
+	jsonQ, htmlQ := acceptQuality(accept, "application/json"), acceptQuality(accept, "text/html")
+	return jsonQ > 0 && jsonQ > htmlQ
+}
+
+// acceptQuality returns the q-value an Accept header gives to mediaType, only
+// counting exact matches.
+func acceptQuality(accept, mediaType string) float64 {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(mediaRange, ";")
+		if !strings.EqualFold(strings.TrimSpace(name), mediaType) {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if key == "q" {
+				if v, err := strconv.ParseFloat(value, 64); err == nil {
+					q = v
+				}
+			}
+		}
+		return q
+	}
+	return 0
+}
+
+// withRecover turns panics in h into a 500 page with the style of look instead
+// of a dropped connection, logging them without showing the stack trace to the
+// client. Once the header is sent the connection is dropped anyway.
+func withRecover(look *look, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			log.Printf("panic serving %s %s: %v\n%s", r.Method, r.URL.Path, err, debug.Stack())
+			// It's too late for the page, so abort the connection rather than
+			// let the client take a short body for the whole response.
+			if tw.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+
+			if prefersJSON(r) {
+				writeError(tw, r, http.StatusInternalServerError, "500 internal server error")
+				return
+			}
+
+			tw.Header().Del("Content-Length")
+			tw.Header().Del("Content-Disposition")
+			tw.Header().Set("Content-Type", "text/html; charset=utf-8")
+			tw.WriteHeader(http.StatusInternalServerError)
+			writeBody(tw, r, []byte(internalErrorPage+look.style))
+		}()
+
+		h.ServeHTTP(tw, r)
+	})
+}
+
+const internalErrorPage = `<!doctype html>
+<meta name="viewport" content="width=device-width">
+<title>Internal server error</title>
+<pre>
+Something went wrong while serving this page.
+</pre>
+`
+
+// jsonErrorWriter turns the plain text errors written by http.FileServer into
+// JSON for clients that prefer it.
+type jsonErrorWriter struct {
+	http.ResponseWriter
+	r       *http.Request
+	status  int
+	message strings.Builder
+}
+
+func (w *jsonErrorWriter) WriteHeader(status int) {
+	if w.status == 0 && status >= 400 && prefersJSON(w.r) {
+		w.status = status
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *jsonErrorWriter) Write(b []byte) (int, error) {
+	if w.status != 0 {
+		return w.message.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *jsonErrorWriter) ReadFrom(src io.Reader) (int64, error) {
+	if w.status != 0 {
+		return io.Copy(&w.message, src)
+	}
+	return io.Copy(w.ResponseWriter, src)
+}
+
+// finish writes the JSON body of an intercepted error.
+func (w *jsonErrorWriter) finish() {
+	if w.status != 0 {
+		writeBody(w.ResponseWriter, w.r, errorJSON(w.status, strings.TrimSpace(w.message.String())))
+	}
+}
+
+func (w *jsonErrorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
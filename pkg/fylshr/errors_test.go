@@ -0,0 +1,139 @@
+package fylshr
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestErrorsJSON(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "sec/" + tokenFile: "s3cret"})
+	srv := newTestServer(t, dir)
+	form := url.Values{"dir": {"/"}, "path": {"x/\x01\"quoted\"é"}}
+
+	tests := []struct {
+		name, method, path, body string
+		headers                  []string
+		status                   int
+	}{
+		{"not found", http.MethodGet, "/missing.txt", "", nil, http.StatusNotFound},
+		{"method", http.MethodPut, "/a.txt", "", nil, http.StatusMethodNotAllowed},
+		{"token dir", http.MethodGet, "/sec/", "", nil, http.StatusForbidden},
+		{"odd characters", http.MethodPost, archivePath, form.Encode(), []string{"Content-Type: application/x-www-form-urlencoded"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, accept := range []string{"application/json", "text/html;q=0.5, application/json"} {
+				resp, body := do(t, srv, tt.method, tt.path, strings.NewReader(tt.body), append(tt.headers, "Accept: "+accept)...)
+				var got struct {
+					Error  string
+					Status int
+				}
+				if err := json.Unmarshal([]byte(body), &got); err != nil || resp.Header.Get("Content-Type") != "application/json" {
+					t.Fatalf("%s %s Accept %q = %s %q: %v, want JSON", tt.method, tt.path, accept, resp.Header.Get("Content-Type"), body, err)
+				}
+				if resp.StatusCode != tt.status || got.Status != tt.status || !strings.HasPrefix(got.Error, strconv.Itoa(tt.status)+" ") {
+					t.Errorf("%s %s = %d %+v, want %d", tt.method, tt.path, resp.StatusCode, got, tt.status)
+				}
+			}
+			if resp, body := do(t, srv, tt.method, tt.path, strings.NewReader(tt.body), append(tt.headers, "Accept: text/html,application/json;q=0.9")...); strings.HasPrefix(body, "{") || resp.StatusCode != tt.status {
+				t.Errorf("%s %s preferring HTML = %d %q, want plain text", tt.method, tt.path, resp.StatusCode, body)
+			}
+		})
+	}
+}
+
+func TestRecover(t *testing.T) {
+	saved := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(saved) })
+
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		accept      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"page", func(w http.ResponseWriter, r *http.Request) { panic("boom") }, "", http.StatusInternalServerError, "text/html; charset=utf-8", "<"},
+		{"json", func(w http.ResponseWriter, r *http.Request) { panic("boom") }, "application/json", http.StatusInternalServerError, "application/json", `"status":500`},
+		{"headers of the handler", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Disposition", "attachment")
+			w.Header().Set("Content-Length", "99")
+			panic("boom")
+		}, "", http.StatusInternalServerError, "text/html; charset=utf-8", "<"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			withRecover(newLook(), tt.handler).ServeHTTP(w, r)
+			if w.Code != tt.status || w.Header().Get("Content-Type") != tt.contentType || !strings.Contains(w.Body.String(), tt.body) {
+				t.Errorf("panic = %d %s %q, want %d %s %q", w.Code, w.Header().Get("Content-Type"), w.Body.String(), tt.status, tt.contentType, tt.body)
+			}
+			if w.Code == http.StatusInternalServerError && (w.Header().Get("Content-Disposition") != "" || w.Header().Get("Content-Length") == "99") {
+				t.Errorf("panic page kept the headers of the handler: %v", w.Header())
+			}
+		})
+	}
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("http.ErrAbortHandler recovered as %v, want it to reach the server", err)
+		}
+	}()
+	withRecover(newLook(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) })).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+// TestRecoverAfterHeader checks that a panic once the response started drops
+// the connection, so the client sees an error rather than a short body.
+func TestRecoverAfterHeader(t *testing.T) {
+	saved := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(saved) })
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"chunked", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "partial")
+			w.(http.Flusher).Flush()
+			panic("boom")
+		}},
+		{"with length", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "99")
+			io.WriteString(w, "partial")
+			panic("boom")
+		}},
+		{"header only", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			panic("boom")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(withRecover(newLook(), tt.handler))
+			defer srv.Close()
+			srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+
+			resp, err := http.Get(srv.URL)
+			if err != nil {
+				return
+			}
+			defer resp.Body.Close()
+			if body, err := io.ReadAll(resp.Body); err == nil {
+				t.Errorf("panic after the header = %d %q without an error", resp.StatusCode, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package fylshr
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	eventsPath = "/_events"
+	// maxWatchedDirs bounds the inotify watches of a big tree, directories
+	// past it don't send events.
+	maxWatchedDirs = 8192
+	// eventsDebounce groups the events of a burst, like a file copied in many
+	// writes, into one per file.
+	eventsDebounce  = 250 * time.Millisecond
+	eventsHeartbeat = 30 * time.Second
+)
+
+// liveScript reloads a listing when its directory changes.
+//
+//go:embed live.js
+var liveScript string
+
+// changeEvent is sent on /_events when the file Name in the directory Dir, a
+// URL path ending in a slash, is created, written, removed or renamed.
+type changeEvent struct {
+	Dir  string `json:"dir"`
+	Name string `json:"name"`
+	Op   string `json:"op"`
+}
+
+// eventHub passes the changes under the served folders to the clients of
+// /_events.
+type eventHub struct {
+	sync.Mutex
+	subscribers map[chan changeEvent]struct{}
+}
+
+// watchFolders watches every directory of the folders of args, except the
+// excluded ones, for the lifetime of the process. Every change drops what the
+// caches know of the file right away, the listings hear of it once debounced.
+func watchFolders(args Args) (*eventHub, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	hub := &eventHub{subscribers: map[chan changeEvent]struct{}{}}
+	folders := args.layers()
+
+	watched := 0
+	var watch func(dir string)
+	watch = func(dir string) {
+		filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return nil
+			}
+			if rel := urlPathIn(folders, name); rel == "" || rel != "/" && args.excluded(rel, true) {
+				return filepath.SkipDir
+			}
+			if watched >= maxWatchedDirs {
+				return filepath.SkipAll
+			}
+			if err := watcher.Add(name); err != nil {
+				// Past the inotify limit of the system nothing more can be
+				// watched, the rest keeps relying on sizes and times.
+				if errors.Is(err, syscall.ENOSPC) {
+					log.Printf("watching %s: too many directories for the system's limit", name)
+					return filepath.SkipAll
+				}
+				return nil
+			}
+			watched++
+			return nil
+		})
+	}
+	for _, folder := range folders {
+		watch(folder)
+	}
+	if watched >= maxWatchedDirs {
+		log.Printf("only watching the first %d directories of %s", maxWatchedDirs, args.folder)
+	}
+
+	go func() {
+		// Pending events keep their order, once each.
+		var pending []changeEvent
+		flush := time.NewTimer(eventsDebounce)
+		flush.Stop()
+		for {
+			select {
+			case event := <-watcher.Events:
+				op := ""
+				switch {
+				case event.Has(fsnotify.Create):
+					op = "create"
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						watch(event.Name)
+					}
+				case event.Has(fsnotify.Write):
+					op = "write"
+				case event.Has(fsnotify.Remove):
+					op = "remove"
+				case event.Has(fsnotify.Rename):
+					op = "rename"
+				default:
+					continue
+				}
+				rel := urlPathIn(folders, event.Name)
+				if rel == "" || rel == "/" {
+					continue
+				}
+				forgetFile(args, event.Name, rel)
+				dir := path.Dir(rel)
+				if dir != "/" {
+					dir += "/"
+				}
+				if len(pending) == 0 {
+					flush.Reset(eventsDebounce)
+				}
+				if change := (changeEvent{Dir: dir, Name: path.Base(rel), Op: op}); !slices.Contains(pending, change) {
+					pending = append(pending, change)
+				}
+			case <-flush.C:
+				for _, change := range pending {
+					hub.broadcast(change)
+				}
+				pending = pending[:0]
+			case err := <-watcher.Errors:
+				log.Printf("watching %s: %s", args.folder, err)
+			}
+		}
+	}()
+	return hub, nil
+}
+
+// forgetFile drops the cached thumbnails, checksums and ignore rules of the
+// file name, served at rel, and of everything under it for a directory. The
+// sitemap of args is rebuilt on the next request.
+func forgetFile(args Args, name, rel string) {
+	args.thumbCache.forget(rel)
+	forgetDigests(name)
+	forgetIgnoreFiles(name)
+	args.sitemapCache.forget()
+}
+
+// under reports whether name is dir or in it, for paths separated by sep.
+func under(name, dir string, sep byte) bool {
+	return name == dir || strings.HasPrefix(name, dir) && name[len(dir)] == sep
+}
+
+// urlPathIn returns the URL path of the file name in the first of folders it
+// is in, or "" if none.
+func urlPathIn(folders []string, name string) string {
+	for _, folder := range folders {
+		rel, err := filepath.Rel(folder, name)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return path.Clean("/" + filepath.ToSlash(rel))
+		}
+	}
+	return ""
+}
+
+func (h *eventHub) subscribe() chan changeEvent {
+	h.Lock()
+	defer h.Unlock()
+	events := make(chan changeEvent, 64)
+	h.subscribers[events] = struct{}{}
+	return events
+}
+
+func (h *eventHub) unsubscribe(events chan changeEvent) {
+	h.Lock()
+	defer h.Unlock()
+	delete(h.subscribers, events)
+}
+
+// broadcast drops the event for clients too slow to keep up, a missed reload
+// being better than a stuck watcher.
+func (h *eventHub) broadcast(event changeEvent) {
+	h.Lock()
+	defer h.Unlock()
+	for events := range h.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// serveEvents streams the changes as server-sent events, only those in the
+// directory ?dir= if given. visible leaves out what the client can't see, in
+// directories needing another token or excluded files.
+func serveEvents(w http.ResponseWriter, r *http.Request, hub *eventHub, visible func(event changeEvent) bool) {
+	dir := r.URL.Query().Get("dir")
+	events := hub.subscribe()
+	defer hub.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	rc := http.NewResponseController(w)
+	fmt.Fprint(w, "retry: 2000\n\n")
+	rc.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case event := <-events:
+			if dir != "" && event.Dir != dir || !visible(event) {
+				continue
+			}
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: change\ndata: %s\n\n", data)
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
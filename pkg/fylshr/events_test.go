@@ -0,0 +1,178 @@
+package fylshr
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openEvents subscribes to the /_events stream at url.
+func openEvents(t *testing.T, url string) *bufio.Reader {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET %s = %d Content-Type %q, want an event stream", url, resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	r := bufio.NewReader(resp.Body)
+	if line, err := r.ReadString('\n'); line != "retry: 2000\n" {
+		t.Fatalf("GET %s starts with %q, %v", url, line, err)
+	}
+	return r
+}
+
+// nextChange reads the next change event of an /_events stream.
+func nextChange(t *testing.T, r *bufio.Reader) changeEvent {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the next event: %v", err)
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			var event changeEvent
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				t.Fatal(err)
+			}
+			return event
+		}
+	}
+}
+
+// TestLive checks that -live streams the visible changes of a directory and
+// has listings subscribe to them.
+func TestLive(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "sub/": ""})
+	srv := newTestServer(t, dir, "-live", "-exclude", "*.log")
+
+	root := openEvents(t, srv.URL+eventsPath+"?dir=/")
+	sub := openEvents(t, srv.URL+eventsPath+"?dir=/sub/")
+	writeFiles(t, dir, map[string]string{"sub/b.txt": "nested", "app.log": "excluded"})
+	writeFiles(t, dir, map[string]string{"new.txt": "added"})
+
+	if got, want := nextChange(t, sub), (changeEvent{Dir: "/sub/", Name: "b.txt", Op: "create"}); got != want {
+		t.Errorf("?dir=/sub/ sends %+v first, want %+v", got, want)
+	}
+	if got, want := nextChange(t, root), (changeEvent{Dir: "/", Name: "new.txt", Op: "create"}); got != want {
+		t.Errorf("?dir=/ sends %+v first, want %+v", got, want)
+	}
+	if err := os.Remove(filepath.Join(dir, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if event := nextChange(t, root); event.Name == "a.txt" {
+			if event.Op != "remove" {
+				t.Errorf("removing a.txt sends %+v", event)
+			}
+			break
+		}
+	}
+
+	tests := []struct {
+		flags  []string
+		path   string
+		status int
+		want   string
+	}{
+		{[]string{"-live"}, "/", http.StatusOK, `data-events="/_events?dir=%2F"`},
+		{[]string{"-live"}, "/sub/", http.StatusOK, `data-events="/_events?dir=%2Fsub%2F"`},
+		{nil, "/", http.StatusOK, ""},
+		{nil, eventsPath, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, newTestServer(t, dir, tt.flags...), http.MethodGet, tt.path, nil)
+		if resp.StatusCode != tt.status || tt.want != "" && !strings.Contains(body, tt.want) || tt.want == "" && strings.Contains(body, "data-events") {
+			t.Errorf("%v GET %s = %d, want %d with %q", tt.flags, tt.path, resp.StatusCode, tt.status, tt.want)
+		}
+	}
+}
+
+// rewriteInPlace replaces the file name with data of the same size and keeps
+// its modification time, like a restore from a backup can.
+func rewriteInPlace(t *testing.T, name, data string) {
+	t.Helper()
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(data)) != info.Size() {
+		t.Fatalf("%s is %d bytes, can't replace it with %d", name, info.Size(), len(data))
+	}
+	if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestWatchCaches checks that -watch drops the cached checksum, thumbnail and
+// sitemap of a file that changed without its size or time changing, which
+// are all the caches go by otherwise.
+func TestWatchCaches(t *testing.T) {
+	black := image.NewGray(image.Rect(0, 0, 50, 40))
+	white := image.NewGray(black.Rect)
+	for i := range white.Pix {
+		white.Pix[i] = 0xff
+	}
+	// Uncompressed, so both are the same size.
+	enc := png.Encoder{CompressionLevel: png.NoCompression}
+	var blackPNG, whitePNG bytes.Buffer
+	enc.Encode(&blackPNG, black)
+	enc.Encode(&whitePNG, white)
+
+	for _, watch := range []bool{true, false} {
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{"a.txt": "hello", "b.png": blackPNG.String(), "index.html": ""})
+		srv := newTestServer(t, dir, "-checksums", "-thumbnails", "-sitemap", "https://example.com", "-watch="+strconv.FormatBool(watch))
+
+		get := func() (string, string, string) {
+			_, sum := do(t, srv, http.MethodGet, "/a.txt?checksum=sha256", nil)
+			_, thumb := do(t, srv, http.MethodGet, thumbPath+"/b.png", nil)
+			_, sitemap := do(t, srv, http.MethodGet, sitemapPath, nil)
+			return sum, thumb, sitemap
+		}
+		sum, thumb, sitemap := get()
+		rewriteInPlace(t, filepath.Join(dir, "a.txt"), "HELLO")
+		rewriteInPlace(t, filepath.Join(dir, "b.png"), whitePNG.String())
+		writeFiles(t, dir, map[string]string{"new.html": ""})
+
+		var gotSum, gotThumb, gotSitemap string
+		deadline := time.Now().Add(5 * time.Second)
+		if !watch {
+			deadline = time.Now().Add(300 * time.Millisecond)
+		}
+		for time.Now().Before(deadline) {
+			if gotSum, gotThumb, gotSitemap = get(); gotSum != sum && gotThumb != thumb && gotSitemap != sitemap {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if changed := gotSum != sum; changed != watch {
+			t.Errorf("-watch=%v checksum after a change = %q, was %q", watch, gotSum, sum)
+		}
+		if changed := gotThumb != thumb; changed != watch {
+			t.Errorf("-watch=%v thumbnail changed %v, want %v", watch, changed, watch)
+		}
+		if listed := strings.Contains(gotSitemap, "/new.html"); listed != watch {
+			t.Errorf("-watch=%v sitemap after a new page = %q", watch, gotSitemap)
+		}
+	}
+}
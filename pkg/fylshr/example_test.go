@@ -0,0 +1,37 @@
+package fylshr_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/stuff7/fylshr/pkg/fylshr"
+)
+
+func ExampleServer() {
+	dir, err := os.MkdirTemp("", "fylshr")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("shared"), 0o644)
+
+	s := &fylshr.Server{Folder: dir}
+	if err := s.Start(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	defer s.Shutdown()
+
+	resp, err := http.Get("http://" + s.Addr().String() + "/notes.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	fmt.Println(resp.StatusCode, string(body))
+	// Output: 200 shared
+}
@@ -0,0 +1,28 @@
+package fylshr
+
+import (
+	"bytes"
+	_ "embed"
+	"net/http"
+	"os"
+)
+
+//go:embed favicon.ico
+var favicon []byte
+
+// serveFavicon serves the -favicon file or the embedded icon, unless the served
+// folder has its own favicon.ico, in which case it returns false.
+func serveFavicon(w http.ResponseWriter, r *http.Request, args Args) bool {
+	if _, err := os.Stat(args.localPath("/favicon.ico")); err == nil {
+		return false
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=2592000")
+	if args.favicon != "" {
+		http.ServeFile(w, r, args.favicon)
+	} else {
+		http.ServeContent(w, r, "favicon.ico", startTime, bytes.NewReader(favicon))
+	}
+
+	return true
+}
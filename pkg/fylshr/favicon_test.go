@@ -0,0 +1,51 @@
+package fylshr
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFavicon(t *testing.T) {
+	custom := filepath.Join(t.TempDir(), "custom.ico")
+	if err := os.WriteFile(custom, []byte("custom icon"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		flags []string
+		path  string
+		want  string
+		cache bool
+	}{
+		{"embedded", nil, nil, "/favicon.ico", string(favicon), true},
+		{"-favicon", nil, []string{"-favicon", custom}, "/favicon.ico", "custom icon", true},
+		{"folder icon", map[string]string{"favicon.ico": "folder icon"}, nil, "/favicon.ico", "folder icon", false},
+		{"folder icon over -favicon", map[string]string{"favicon.ico": "folder icon"}, []string{"-favicon", custom}, "/favicon.ico", "folder icon", false},
+		{"behind base path", nil, []string{"-base-path", "/share"}, "/share/favicon.ico", string(favicon), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			srv := newTestServer(t, dir, tt.flags...)
+			resp, body := do(t, srv, http.MethodGet, tt.path, nil)
+			if resp.StatusCode != http.StatusOK || body != tt.want {
+				t.Errorf("GET %s = %d %q, want %q", tt.path, resp.StatusCode, body, tt.want)
+			}
+			if cached := resp.Header.Get("Cache-Control") == "public, max-age=2592000"; cached != tt.cache {
+				t.Errorf("GET %s Cache-Control %q, want the icon's %v", tt.path, resp.Header.Get("Cache-Control"), tt.cache)
+			}
+		})
+	}
+
+	args := testArgs(t, t.TempDir())
+	args.favicon = filepath.Join(t.TempDir(), "missing.ico")
+	if err := validate(args); err == nil || !strings.Contains(err.Error(), "-favicon") {
+		t.Errorf("validate with a missing -favicon = %v, want an error", err)
+	}
+}
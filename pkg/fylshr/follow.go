@@ -0,0 +1,198 @@
+package fylshr
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// followBackfill bounds how much of the existing file is sent before
+	// streaming what gets appended.
+	followBackfill = 64 << 10
+	followInterval = 500 * time.Millisecond
+)
+
+// serveFollow streams name like tail -f: the end of the file, or its last
+// lines with ?tail=N, then whatever is appended to it until the client goes
+// away. A truncated file is streamed again from the start, and a rotated one
+// is reopened. Browsers get a page that keeps scrolling, EventSource clients
+// an event per line.
+func serveFollow(w http.ResponseWriter, r *http.Request, look *look, name string) {
+	lines := -1
+	if value := cmp.Or(r.URL.Query().Get("tail"), r.URL.Query().Get("follow")); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			writeError(w, r, http.StatusBadRequest, "400 expected a number of lines")
+			return
+		}
+		lines = n
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, "404 page not found")
+		return
+	}
+	defer func() { f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		writeError(w, r, http.StatusNotFound, "404 page not found")
+		return
+	}
+
+	accept := r.Header.Get("Accept")
+	asEvents := acceptQuality(accept, "text/event-stream") > acceptQuality(accept, "text/html")
+	asHTML := !asEvents && acceptQuality(accept, "text/html") > 0
+	switch {
+	case asEvents:
+		w.Header().Set("Content-Type", "text/event-stream")
+	case asHTML:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	out := io.Writer(w)
+	var events *eventLines
+	switch {
+	case asEvents:
+		events = &eventLines{w: w}
+		out = events
+	case asHTML:
+		io.WriteString(w, followPage+look.style+"\n<pre>")
+		out = htmlEscaper{w}
+	}
+
+	offset := max(info.Size()-followBackfill, 0)
+	if lines >= 0 {
+		offset = tailOffset(f, info.Size(), lines)
+	}
+	rc := http.NewResponseController(w)
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+
+	for {
+		f.Seek(offset, io.SeekStart)
+		n, err := io.Copy(out, f)
+		offset += n
+		if err != nil {
+			return
+		}
+		rc.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		if current, err := os.Stat(name); err == nil && !os.SameFile(info, current) {
+			// Rotated, follow the new file from its start.
+			if reopened, err := os.Open(name); err == nil {
+				f.Close()
+				f, info, offset = reopened, current, 0
+				events.reset()
+			}
+		} else if info, err = f.Stat(); err == nil && info.Size() < offset {
+			offset = 0
+			events.reset()
+		}
+	}
+}
+
+// tailOffset returns where the last lines lines of f, size bytes long, start,
+// looking back no further than followBackfill.
+func tailOffset(f *os.File, size int64, lines int) int64 {
+	start := max(size-followBackfill, 0)
+	buf := make([]byte, size-start)
+	n, _ := f.ReadAt(buf, start)
+	buf = buf[:n]
+
+	// The final newline ends the last line rather than starting another.
+	end := len(buf)
+	if end > 0 && buf[end-1] == '\n' {
+		end--
+	}
+	if lines == 0 {
+		return start + int64(len(buf))
+	}
+	for i := end - 1; i >= 0; i-- {
+		if buf[i] == '\n' {
+			if lines--; lines == 0 {
+				return start + int64(i) + 1
+			}
+		}
+	}
+	return start
+}
+
+// eventLines sends each line written to it as a server-sent event, holding a
+// partial last line until the rest of it is appended. A line longer than
+// followBackfill is sent in pieces.
+type eventLines struct {
+	w       io.Writer
+	partial []byte
+}
+
+func (e *eventLines) Write(b []byte) (int, error) {
+	e.partial = append(e.partial, b...)
+	for {
+		i := bytes.IndexByte(e.partial, '\n')
+		if i < 0 && len(e.partial) < followBackfill {
+			return len(b), nil
+		}
+		if i < 0 {
+			i = len(e.partial)
+		}
+		line := bytes.TrimSuffix(e.partial[:i], []byte("\r"))
+		if _, err := fmt.Fprintf(e.w, "data: %s\n\n", line); err != nil {
+			return 0, err
+		}
+		e.partial = e.partial[min(i+1, len(e.partial)):]
+	}
+}
+
+// reset drops the partial line of a file that was truncated or replaced.
+func (e *eventLines) reset() {
+	if e != nil {
+		e.partial = nil
+	}
+}
+
+// htmlEscaper escapes text streamed into the <pre> of followPage.
+type htmlEscaper struct {
+	w io.Writer
+}
+
+func (e htmlEscaper) Write(b []byte) (int, error) {
+	if _, err := io.WriteString(e.w, html.EscapeString(string(b))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// followPage keeps the view scrolled to the bottom unless the reader scrolled
+// up.
+const followPage = `<!doctype html>
+<meta name="viewport" content="width=device-width">
+<script>
+  setInterval(() => {
+    const bottom = document.body.scrollHeight - innerHeight
+    if (bottom - scrollY < 200) scrollTo(0, bottom)
+  }, 250)
+</script>
+`
@@ -0,0 +1,157 @@
+package fylshr
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// follow opens a streamed GET of target and returns a function reading from
+// it until want arrives, returning what came up to it, failing after a few
+// seconds.
+func follow(t *testing.T, srv *httptest.Server, target string, headers ...string) (*http.Response, func(want string) string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range headers {
+		name, value, _ := strings.Cut(h, ":")
+		req.Header.Set(name, strings.TrimSpace(value))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	var got strings.Builder
+	return resp, func(want string) string {
+		t.Helper()
+		buf := make([]byte, 4096)
+		for !strings.Contains(got.String(), want) {
+			n, err := resp.Body.Read(buf)
+			got.Write(buf[:n])
+			if err != nil && !strings.Contains(got.String(), want) {
+				t.Fatalf("GET %s streamed %q, want %q: %v", target, got.String(), want, err)
+			}
+		}
+		end := strings.Index(got.String(), want) + len(want)
+		read, rest := got.String()[:end], got.String()[end:]
+		got.Reset()
+		got.WriteString(rest)
+		return read
+	}
+}
+
+func appendFile(t *testing.T, name, content string) {
+	t.Helper()
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestFollow checks that a client following a file gets what is appended,
+// and the new content of the file once truncated or rotated.
+func TestFollow(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"build.log": "step 1\n"})
+	name := filepath.Join(dir, "build.log")
+	srv := newTestServer(t, dir, "-follow", "-request-timeout", "1ns")
+
+	resp, expect := follow(t, srv, "/build.log?follow")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Fatalf("GET ?follow = %d %s, want 200 text", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	expect("step 1\n")
+	appendFile(t, name, "step 2\n")
+	expect("step 2\n")
+
+	if err := os.WriteFile(name, []byte("again\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expect("again\n")
+
+	rotated := filepath.Join(dir, "build.log.1")
+	if err := os.Rename(name, rotated); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte("rotated\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expect("rotated\n")
+}
+
+func TestFollowBackfill(t *testing.T) {
+	dir := t.TempDir()
+	old := strings.Repeat("o", followBackfill)
+	writeFiles(t, dir, map[string]string{"big.log": "first" + old + "last\n"})
+	srv := newTestServer(t, dir, "-follow")
+
+	_, expect := follow(t, srv, "/big.log?follow")
+	appendFile(t, filepath.Join(dir, "big.log"), "marker\n")
+	if got := expect("marker\n"); strings.Contains(got, "first") || !strings.HasSuffix(got, "last\nmarker\n") {
+		t.Errorf("?follow sent more than the last %d bytes", followBackfill)
+	}
+}
+
+func TestTail(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"app.log": "one\ntwo\nthree <b>\n"})
+	srv := newTestServer(t, dir, "-follow")
+
+	tests := []struct {
+		name, target, accept, contentType, want string
+	}{
+		{"last lines", "/app.log?tail=2", "", "text/plain; charset=utf-8", "two\nthree <b>\n"},
+		{"no lines", "/app.log?tail=0", "", "text/plain; charset=utf-8", ""},
+		{"more lines than the file", "/app.log?tail=10", "", "text/plain; charset=utf-8", "one\ntwo\nthree <b>\n"},
+		{"events", "/app.log?tail=2", "text/event-stream", "text/event-stream", "data: two\n\ndata: three <b>\n\n"},
+		{"page", "/app.log?tail=1", "text/html", "text/html; charset=utf-8", "<pre>three &lt;b&gt;\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, expect := follow(t, srv, tt.target, "Accept: "+tt.accept)
+			if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != tt.contentType {
+				t.Fatalf("GET %s = %d %s, want 200 %s", tt.target, resp.StatusCode, resp.Header.Get("Content-Type"), tt.contentType)
+			}
+			expect(tt.want)
+		})
+	}
+
+	for _, target := range []string{"/app.log?tail=x", "/app.log?tail=-1"} {
+		if resp, _ := do(t, srv, http.MethodGet, target, nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", target, resp.StatusCode)
+		}
+	}
+	if resp, _ := do(t, srv, http.MethodGet, "/missing.log?tail", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /missing.log?tail = %d, want 404", resp.StatusCode)
+	}
+	if resp, body := do(t, newTestServer(t, dir), http.MethodGet, "/app.log?tail=1", nil); body != "one\ntwo\nthree <b>\n" {
+		t.Errorf("GET /app.log?tail=1 without -follow = %d %q, want the file", resp.StatusCode, body)
+	}
+}
+
+func TestEventLines(t *testing.T) {
+	var b strings.Builder
+	events := &eventLines{w: &b}
+	for _, part := range []string{"a\nb", "c\r\n", "", "d"} {
+		io.WriteString(events, part)
+	}
+	if want := "data: a\n\ndata: bc\n\n"; b.String() != want {
+		t.Errorf("events %q, want %q holding the partial d", b.String(), want)
+	}
+}
@@ -0,0 +1,163 @@
+package fylshr
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+)
+
+// hiddenFS hides the files hide reports true for from the file server, both
+// when opened directly and in listings.
+type hiddenFS struct {
+	http.FileSystem
+	hide func(name string, info fs.FileInfo) bool
+}
+
+func (fsys hiddenFS) Open(name string) (http.File, error) {
+	f, err := fsys.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if name != "/" && fsys.hide(name, info) {
+		f.Close()
+		return nil, os.ErrNotExist
+	}
+
+	return hiddenDir{File: f, name: name, hide: fsys.hide}, nil
+}
+
+// hiddenDir leaves hidden files out of Readdir, which can then return fewer
+// than count entries before the end of the directory.
+type hiddenDir struct {
+	http.File
+	name string
+	hide func(name string, info fs.FileInfo) bool
+}
+
+func (d hiddenDir) Readdir(count int) ([]fs.FileInfo, error) {
+	infos, err := d.File.Readdir(count)
+	return slices.DeleteFunc(infos, func(info fs.FileInfo) bool {
+		return d.hide(path.Join(d.name, info.Name()), info)
+	}), err
+}
+
+// overlayFS merges layers into one tree. A name is served from the first layer
+// that has it, so a file shadows both files and directories of the same name
+// below it, and directories are only merged with directories.
+type overlayFS []http.FileSystem
+
+func (layers overlayFS) Open(name string) (http.File, error) {
+	var top http.File
+	var dirs []http.File
+	openErr := error(os.ErrNotExist)
+	for _, layer := range layers {
+		f, err := layer.Open(name)
+		if err != nil {
+			if top == nil && openErr == os.ErrNotExist && !errors.Is(err, fs.ErrNotExist) {
+				openErr = err
+			}
+			if hasFileAncestor(layer, name) {
+				break
+			}
+			continue
+		}
+
+		info, err := f.Stat()
+		if err != nil || (top != nil && !info.IsDir()) {
+			f.Close()
+			continue
+		}
+
+		if top == nil {
+			top = f
+			if !info.IsDir() {
+				return f, nil
+			}
+		} else {
+			dirs = append(dirs, f)
+		}
+	}
+
+	if top == nil {
+		return nil, openErr
+	}
+	if len(dirs) == 0 {
+		return top, nil
+	}
+	return &overlayDir{File: top, below: dirs}, nil
+}
+
+// hasFileAncestor reports whether a parent of name is a file in fsys, which
+// shadows name in the layers below.
+func hasFileAncestor(fsys http.FileSystem, name string) bool {
+	for dir := path.Dir(path.Clean("/" + name)); dir != "/"; dir = path.Dir(dir) {
+		f, err := fsys.Open(dir)
+		if err != nil {
+			continue
+		}
+		info, err := f.Stat()
+		f.Close()
+		return err == nil && !info.IsDir()
+	}
+	return false
+}
+
+// overlayDir lists the entries of a directory and the directories it covers,
+// keeping the first entry of each name.
+type overlayDir struct {
+	http.File
+	below   []http.File
+	entries []fs.FileInfo
+	read    bool
+}
+
+func (d *overlayDir) Readdir(count int) ([]fs.FileInfo, error) {
+	if !d.read {
+		d.read = true
+		seen := map[string]bool{}
+		for _, f := range append([]http.File{d.File}, d.below...) {
+			infos, err := f.Readdir(-1)
+			if err != nil {
+				return nil, err
+			}
+			for _, info := range infos {
+				if !seen[info.Name()] {
+					seen[info.Name()] = true
+					d.entries = append(d.entries, info)
+				}
+			}
+		}
+	}
+
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+func (d *overlayDir) Close() error {
+	err := d.File.Close()
+	for _, f := range d.below {
+		f.Close()
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+package fylshr
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// TestHead checks that HEAD answers the pages fylshr generates with the
+// headers of GET and no body.
+func TestHead(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"doc.md": "# Title", "main.go": "package main", "sub/b.txt": "nested"})
+	srv := newTestServer(t, dir)
+
+	tests := []struct {
+		path   string
+		length bool
+	}{
+		{"/", true},
+		{"/sub/", true},
+		{"/?format=json", true},
+		{"/?view=gallery", true},
+		{"/doc.md?render", true},
+		{"/main.go?render", true},
+		{"/sub/?zip", false},
+	}
+	for _, tt := range tests {
+		path := tt.path
+		get, body := do(t, srv, http.MethodGet, path, nil, "Accept-Encoding: identity")
+		head, headBody := do(t, srv, http.MethodHead, path, nil, "Accept-Encoding: identity")
+		if head.StatusCode != get.StatusCode || headBody != "" {
+			t.Errorf("HEAD %s = %d with %d bytes, want %d without a body", path, head.StatusCode, len(headBody), get.StatusCode)
+		}
+		for _, name := range []string{"Content-Type", "ETag", "Last-Modified", "Content-Disposition"} {
+			if got, want := head.Header.Get(name), get.Header.Get(name); got != want {
+				t.Errorf("HEAD %s %s %q, want %q like GET", path, name, got, want)
+			}
+		}
+		if length := head.Header.Get("Content-Length"); tt.length && length != strconv.Itoa(len(body)) || !tt.length && length != "" {
+			t.Errorf("HEAD %s Content-Length %q, want the %d bytes of GET: %v", path, length, len(body), tt.length)
+		}
+	}
+}
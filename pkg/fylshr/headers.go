@@ -0,0 +1,48 @@
+package fylshr
+
+import (
+	"fmt"
+	"strings"
+)
+
+type header struct {
+	name  string
+	value string
+}
+
+// headerFlags collects repeated -header flags. They are applied before the
+// file server runs, so any header it sets itself takes precedence.
+type headerFlags []header
+
+func (h *headerFlags) String() string {
+	entries := make([]string, len(*h))
+	for i, e := range *h {
+		entries[i] = e.name + ": " + e.value
+	}
+	return strings.Join(entries, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	name, val, ok := strings.Cut(value, ":")
+	name = strings.TrimSpace(name)
+	if !ok || !isToken(name) || strings.ContainsAny(val, "\r\n") {
+		return fmt.Errorf("invalid header %q, expected \"Name: Value\"", value)
+	}
+
+	*h = append(*h, header{name: name, value: strings.TrimSpace(val)})
+	return nil
+}
+
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, c := range s {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune("()<>@,;:\\\"/[]?={}", c) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,74 @@
+package fylshr
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHeaders(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "sub/": ""})
+	srv := newTestServer(t, dir,
+		"-header", "X-Frame-Options: DENY",
+		"-header", "Content-Security-Policy:default-src 'self'",
+		"-header", "X-Robots-Tag: noindex",
+		"-header", "X-Robots-Tag: none",
+	)
+
+	tests := []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodGet, "/a.txt", http.StatusOK},
+		{http.MethodHead, "/a.txt", http.StatusOK},
+		{http.MethodGet, "/", http.StatusOK},
+		{http.MethodGet, "/sub/", http.StatusOK},
+		{http.MethodGet, "/sub", http.StatusMovedPermanently},
+		{http.MethodGet, "/missing.txt", http.StatusNotFound},
+		{http.MethodPut, "/a.txt", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		resp, _ := do(t, srv, tt.method, tt.path, nil)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, resp.StatusCode, tt.status)
+		}
+		for name, want := range map[string]string{
+			"X-Frame-Options":         "DENY",
+			"Content-Security-Policy": "default-src 'self'",
+			"X-Robots-Tag":            "none",
+		} {
+			if got := resp.Header.Values(name); len(got) != 1 || got[0] != want {
+				t.Errorf("%s %s %s = %q, want %q", tt.method, tt.path, name, got, want)
+			}
+		}
+	}
+}
+
+func TestHeaderFlags(t *testing.T) {
+	tests := []struct {
+		in    string
+		name  string
+		value string
+		ok    bool
+	}{
+		{"X-Frame-Options: DENY", "X-Frame-Options", "DENY", true},
+		{"  X-Test  :  a: b  ", "X-Test", "a: b", true},
+		{"X-Empty:", "X-Empty", "", true},
+		{"X-Frame-Options", "", "", false},
+		{": DENY", "", "", false},
+		{"X Frame: DENY", "", "", false},
+		{"X-Test: a\r\nSet-Cookie: b", "", "", false},
+		{"X-Test: a\nb", "", "", false},
+	}
+	for _, tt := range tests {
+		var h headerFlags
+		err := h.Set(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("Set(%q) = %v, want ok %v", tt.in, err, tt.ok)
+			continue
+		}
+		if tt.ok && (h[0].name != tt.name || h[0].value != tt.value) {
+			t.Errorf("Set(%q) = %q: %q, want %q: %q", tt.in, h[0].name, h[0].value, tt.name, tt.value)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package fylshr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hookQueue is how many events can wait for slow hooks before new ones are
+// dropped, so transfers never block on them.
+const hookQueue = 256
+
+// hookTimeout bounds a command of -on-download or -on-upload and a POST to
+// -webhook-url.
+const hookTimeout = time.Minute
+
+// hookEvent is what -webhook-url receives as JSON when a download completes
+// or an upload lands, Path being the URL path of the file.
+type hookEvent struct {
+	Event      string  `json:"event"`
+	Path       string  `json:"path"`
+	Size       int64   `json:"size"`
+	IP         string  `json:"ip"`
+	DurationMs float64 `json:"durationMs"`
+	Time       string  `json:"time"`
+}
+
+// hooks run the commands of -on-download and -on-upload and post to
+// -webhook-url, one event at a time in the background.
+type hooks struct {
+	onDownload []string
+	onUpload   []string
+	webhook    string
+	events     chan hookEvent
+	// prefix is the -mount prefix of the files handler the hooks are for.
+	prefix string
+}
+
+// newHooks returns nil when no hook is set. The commands are split into
+// arguments before {path}, {ip}, {size} and {event} are replaced, and run
+// without a shell, so names with spaces or quotes don't need escaping.
+func newHooks(onDownload, onUpload, webhook string) (*hooks, error) {
+	if onDownload == "" && onUpload == "" && webhook == "" {
+		return nil, nil
+	}
+	if webhook != "" {
+		u, err := url.Parse(webhook)
+		if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("invalid -webhook-url %q, expected an http or https URL", webhook)
+		}
+	}
+	h := &hooks{
+		onDownload: strings.Fields(onDownload),
+		onUpload:   strings.Fields(onUpload),
+		webhook:    webhook,
+		events:     make(chan hookEvent, hookQueue),
+	}
+	go h.run()
+	return h, nil
+}
+
+// under returns the hooks of the files handler of a -mount at prefix.
+func (h *hooks) under(prefix string) *hooks {
+	if h == nil {
+		return nil
+	}
+	mounted := *h
+	mounted.prefix += prefix
+	return &mounted
+}
+
+// downloaded fires a download event once the file name of size was sent
+// whole, or up to its end for a range request resuming it.
+func (h *hooks) downloaded(w *statusWriter, r *http.Request, name string, size int64, start time.Time) {
+	complete := w.status == http.StatusOK && w.bytes == size
+	if w.status == http.StatusPartialContent {
+		// A range that ends the file completes a download resumed from
+		// "bytes first-last/size".
+		contentRange := w.Header().Get("Content-Range")
+		first, rest, _ := strings.Cut(strings.TrimPrefix(contentRange, "bytes "), "-")
+		last, _, _ := strings.Cut(rest, "/")
+		from, _ := strconv.ParseInt(first, 10, 64)
+		to, err := strconv.ParseInt(last, 10, 64)
+		complete = err == nil && to == size-1 && w.bytes == to-from+1
+	}
+	if complete {
+		h.fire("download", r, name, size, start)
+	}
+}
+
+// uploaded fires an upload event for the file name just saved in folder.
+func (h *hooks) uploaded(r *http.Request, folder, name string, start time.Time) {
+	info, err := os.Stat(filepath.Join(folder, filepath.FromSlash(name)))
+	if err != nil {
+		return
+	}
+	h.fire("upload", r, name, info.Size(), start)
+}
+
+func (h *hooks) fire(event string, r *http.Request, name string, size int64, start time.Time) {
+	e := hookEvent{
+		Event:      event,
+		Path:       h.prefix + name,
+		Size:       size,
+		IP:         clientIP(r),
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		Time:       time.Now().UTC().Format(time.RFC3339),
+	}
+	select {
+	case h.events <- e:
+	default:
+		log.Printf("hooks: too many events, dropping the %s of %s", event, e.Path)
+	}
+}
+
+func (h *hooks) run() {
+	client := &http.Client{Timeout: hookTimeout}
+	for e := range h.events {
+		command := h.onDownload
+		if e.Event == "upload" {
+			command = h.onUpload
+		}
+		if len(command) > 0 {
+			if err := runHook(command, e); err != nil {
+				log.Printf("-on-%s: %s", e.Event, err)
+			}
+		}
+
+		if h.webhook != "" {
+			body, _ := json.Marshal(e)
+			res, err := client.Post(h.webhook, "application/json", bytes.NewReader(body))
+			if err == nil {
+				res.Body.Close()
+				if res.StatusCode >= 300 {
+					err = fmt.Errorf("%s answered %s", h.webhook, res.Status)
+				}
+			}
+			if err != nil {
+				log.Printf("-webhook-url: %s", err)
+			}
+		}
+	}
+}
+
+// runHook runs command with the placeholders of its arguments replaced by e.
+func runHook(command []string, e hookEvent) error {
+	replacer := strings.NewReplacer(
+		"{path}", e.Path,
+		"{ip}", e.IP,
+		"{size}", strconv.FormatInt(e.Size, 10),
+		"{event}", e.Event,
+	)
+	args := make([]string, len(command))
+	for i, arg := range command {
+		args[i] = replacer.Replace(arg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	return cmd.Run()
+}
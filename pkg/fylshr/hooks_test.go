@@ -0,0 +1,148 @@
+package fylshr
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// webhookEvents returns a -webhook-url and the events posted to it.
+func webhookEvents(t *testing.T) (string, chan hookEvent) {
+	t.Helper()
+	events := make(chan hookEvent, hookQueue)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e hookEvent
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&e) != nil {
+			t.Errorf("-webhook-url got a %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		events <- e
+	}))
+	t.Cleanup(hook.Close)
+	return hook.URL, events
+}
+
+// nextHookEvent waits for the next event posted to the webhook.
+func nextHookEvent(t *testing.T, events chan hookEvent) hookEvent {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook event")
+		return hookEvent{}
+	}
+}
+
+// TestWebhook checks that -webhook-url gets an event for each download sent
+// up to the end of the file and each upload, and none for other responses.
+func TestWebhook(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "sub/": ""})
+	url, events := webhookEvents(t)
+	srv := newTestServer(t, dir, "-upload", "-webhook-url", url)
+
+	tests := []struct {
+		method, path, header string
+		body                 string
+		event, name          string
+		size                 int64
+	}{
+		{http.MethodGet, "/a.txt", "", "", "download", "/a.txt", 5},
+		{http.MethodHead, "/a.txt", "", "", "", "", 0},
+		{http.MethodGet, "/a.txt", "Range: bytes=0-1", "", "", "", 0},
+		{http.MethodGet, "/a.txt", "Range: bytes=2-4", "", "download", "/a.txt", 5},
+		{http.MethodGet, "/a.txt", "Range: bytes=0-1,3-4", "", "", "", 0},
+		{http.MethodGet, "/missing.txt", "", "", "", "", 0},
+		{http.MethodGet, "/sub/", "", "", "", "", 0},
+		{http.MethodPut, "/sub/up.txt", "", "uploaded", "upload", "/sub/up.txt", 8},
+		{http.MethodGet, "/sub/up.txt", "", "", "download", "/sub/up.txt", 8},
+	}
+	for _, tt := range tests {
+		headers := []string{"Accept-Encoding: identity"}
+		if tt.header != "" {
+			headers = append(headers, tt.header)
+		}
+		do(t, srv, tt.method, tt.path, strings.NewReader(tt.body), headers...)
+		if tt.event == "" {
+			continue
+		}
+		e := nextHookEvent(t, events)
+		at, err := time.Parse(time.RFC3339, e.Time)
+		if e.Event != tt.event || e.Path != tt.name || e.Size != tt.size || e.IP != "127.0.0.1" || e.DurationMs < 0 || err != nil || time.Since(at) > time.Minute {
+			t.Errorf("%s %s %s posts %+v, want a %s of %s of %d bytes", tt.method, tt.path, tt.header, e, tt.event, tt.name, tt.size)
+		}
+	}
+
+	srv = newTestServer(t, "", "-mount", "/files="+dir, "-webhook-url", url)
+	do(t, srv, http.MethodGet, "/files/a.txt", nil)
+	if e := nextHookEvent(t, events); e.Path != "/files/a.txt" {
+		t.Errorf("GET /files/a.txt of a -mount posts %+v, want its path under the mount", e)
+	}
+}
+
+func TestNewHooks(t *testing.T) {
+	tests := []struct {
+		onDownload, onUpload, webhook string
+		ok, none                      bool
+	}{
+		{"", "", "", true, true},
+		{"notify-send {path}", "", "", true, false},
+		{"", "", "https://hooks.example.com/fylshr", true, false},
+		{"", "", "ftp://hooks.example.com", false, false},
+		{"", "", "http://", false, false},
+		{"", "", "hooks.example.com", false, false},
+	}
+	for _, tt := range tests {
+		h, err := newHooks(tt.onDownload, tt.onUpload, tt.webhook)
+		if (err == nil) != tt.ok || tt.ok && (h == nil) != tt.none {
+			t.Errorf("newHooks(%q, %q, %q) = %v, %v, want ok %v", tt.onDownload, tt.onUpload, tt.webhook, h, err, tt.ok)
+		}
+	}
+}
+
+// TestHookCommands checks that -on-download and -on-upload run their command
+// with the placeholders replaced, each as a single argument.
+func TestHookCommands(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip(err)
+	}
+	out := filepath.Join(t.TempDir(), "args")
+	e := hookEvent{Event: "download", Path: "/my file.txt", Size: 5, IP: "192.0.2.1"}
+	if err := runHook([]string{sh, "-c", `printf '%s\n' "$@" > "$0"`, out, "{event}", "{path}", "{ip}", "{size}", "at {ip}"}, e); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(out); string(got) != "download\n/my file.txt\n192.0.2.1\n5\nat 192.0.2.1\n" {
+		t.Errorf("runHook gets the arguments %q", got)
+	}
+
+	touch, err := exec.LookPath("touch")
+	if err != nil {
+		t.Skip(err)
+	}
+	dir, done := t.TempDir(), t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	srv := newTestServer(t, dir, "-upload", "-on-download", touch+" "+done+"/{event}-{size}", "-on-upload", touch+" "+done+"/{event}-{size}")
+	do(t, srv, http.MethodGet, "/a.txt", nil)
+	do(t, srv, http.MethodPut, "/up.txt", strings.NewReader("uploaded"))
+	want := []string{"download-5", "upload-8"}
+	var got []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		entries, _ := os.ReadDir(done)
+		got = got[:0]
+		for _, entry := range entries {
+			got = append(got, entry.Name())
+		}
+		if slices.Equal(got, want) {
+			return
+		}
+	}
+	t.Errorf("-on-download and -on-upload ran for %v, want %v", got, want)
+}
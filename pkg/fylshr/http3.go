@@ -0,0 +1,51 @@
+package fylshr
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// serveHTTP3 also serves srv over QUIC with -http3, on the UDP port of each
+// TCP listener, and has srv advertise it with Alt-Svc so browsers switch on
+// their next request. Errors serving end up in errs like those of srv.
+func serveHTTP3(srv *http.Server, listeners []net.Listener, config *tls.Config, network string, errs chan<- error) (*http3.Server, error) {
+	h3 := &http3.Server{Handler: srv.Handler, TLSConfig: http3.ConfigureTLSConfig(config)}
+
+	var conns []net.PacketConn
+	for _, l := range listeners {
+		addr, ok := l.Addr().(*net.TCPAddr)
+		if !ok {
+			continue
+		}
+		// Pick the stacks of the TCP socket, which for -network dual is
+		// one of two sockets on the port.
+		udp := "udp"
+		switch {
+		case addr.IP.To4() != nil:
+			udp = "udp4"
+		case network == "tcp6" || network == "dual":
+			udp = "udp6"
+		}
+		conn, err := net.ListenUDP(udp, &net.UDPAddr{IP: addr.IP, Port: addr.Port, Zone: addr.Zone})
+		if err != nil {
+			for _, conn := range conns {
+				conn.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+
+	for _, conn := range conns {
+		go func() { errs <- h3.Serve(conn) }()
+	}
+	handler := srv.Handler
+	srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h3.SetQUICHeaders(w.Header())
+		handler.ServeHTTP(w, r)
+	})
+	return h3, nil
+}
@@ -0,0 +1,64 @@
+package fylshr
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestHTTP3(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	cert, err := selfSignedCert(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2", "http/1.1"}}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(testArgs(t, dir))
+	errs := make(chan error, 2)
+	h3, err := serveHTTP3(srv, []net.Listener{l}, config, "tcp", errs)
+	if err != nil {
+		l.Close()
+		t.Skip(err)
+	}
+	defer h3.Close()
+	go func() { errs <- srv.Serve(tls.NewListener(l, config)) }()
+	defer srv.Close()
+
+	base := "https://" + l.Addr().String()
+	client := &tls.Config{InsecureSkipVerify: true}
+	tests := []struct {
+		name      string
+		transport http.RoundTripper
+		proto     string
+	}{
+		{"tcp", &http.Transport{TLSClientConfig: client, ForceAttemptHTTP2: true}, "HTTP/2.0"},
+		{"quic", &http3.Transport{TLSClientConfig: client}, "HTTP/3.0"},
+	}
+	for _, tt := range tests {
+		resp, err := (&http.Client{Transport: tt.transport}).Get(base + "/a.txt")
+		if err != nil {
+			t.Fatalf("GET /a.txt over %s: %s", tt.name, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.Proto != tt.proto || string(body) != "hello" {
+			t.Errorf("GET /a.txt over %s = %s %q, want %s", tt.name, resp.Proto, body, tt.proto)
+		}
+		port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+		if altSvc := resp.Header.Get("Alt-Svc"); tt.name == "tcp" && !strings.Contains(altSvc, `h3=":`+port+`"`) {
+			t.Errorf("GET /a.txt over %s Alt-Svc %q, want h3 on port %s", tt.name, altSvc, port)
+		}
+	}
+}
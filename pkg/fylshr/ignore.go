@@ -0,0 +1,231 @@
+package fylshr
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ignoreFile lists paths to hide in its directory, in .gitignore syntax.
+const ignoreFile = ".fylshrignore"
+
+// ignoreRecheck is how long parsed ignore files are trusted before being
+// stat'ed again, since every entry of a listing looks them up.
+const ignoreRecheck = 2 * time.Second
+
+// ignoreCacheSize caps how many ignore files are kept parsed.
+const ignoreCacheSize = 1024
+
+// ignoreRule is a line of an ignore file or an -exclude pattern, matched
+// against paths relative to the directory it applies to.
+type ignoreRule struct {
+	segments []string
+	anchored bool
+	dirOnly  bool
+	negate   bool
+}
+
+// parseIgnoreRule parses a .gitignore line: !negates, a trailing / only
+// matches directories, a pattern with another / is relative to the base
+// directory instead of matching names at any depth, and ** matches any
+// number of directories. ok is false for blank lines and comments.
+func parseIgnoreRule(line string) (rule ignoreRule, ok bool, err error) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false, nil
+	}
+
+	line, rule.negate = strings.CutPrefix(line, "!")
+	line, rule.dirOnly = strings.CutSuffix(line, "/")
+	line, rule.anchored = strings.CutPrefix(line, "/")
+	rule.anchored = rule.anchored || strings.Contains(line, "/")
+	if line == "" {
+		return rule, false, nil
+	}
+
+	rule.segments = strings.Split(line, "/")
+	for _, segment := range rule.segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return rule, false, fmt.Errorf("%q: %w", line, err)
+		}
+	}
+	return rule, true, nil
+}
+
+// parseIgnoreRules parses a comma separated list of -exclude patterns.
+func parseIgnoreRules(list string) ([]ignoreRule, error) {
+	var rules []ignoreRule
+	for _, pattern := range strings.Split(list, ",") {
+		rule, ok, err := parseIgnoreRule(strings.TrimSpace(pattern))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+func (rule ignoreRule) match(rel string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+	if !rule.anchored {
+		parts = parts[len(parts)-1:]
+	}
+	return matchSegments(rule.segments, parts)
+}
+
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		for i := range len(parts) + 1 {
+			if matchSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], parts[0])
+	return ok && matchSegments(pattern[1:], parts[1:])
+}
+
+type ignoreEntry struct {
+	rules   []ignoreRule
+	modTime time.Time
+	checked time.Time
+}
+
+var (
+	ignoreCacheMu sync.Mutex
+	ignoreCache   = map[string]*ignoreEntry{}
+)
+
+// readIgnoreFile returns the rules of the ignore file at name, none if it
+// doesn't exist. Lines that don't parse are skipped, like git does.
+func readIgnoreFile(name string) []ignoreRule {
+	ignoreCacheMu.Lock()
+	defer ignoreCacheMu.Unlock()
+
+	entry := ignoreCache[name]
+	if entry != nil && time.Since(entry.checked) < ignoreRecheck {
+		return entry.rules
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		delete(ignoreCache, name)
+		return nil
+	}
+	if entry != nil && entry.modTime.Equal(info.ModTime()) {
+		entry.checked = time.Now()
+		return entry.rules
+	}
+
+	entry = &ignoreEntry{modTime: info.ModTime(), checked: time.Now()}
+	if f, err := os.Open(name); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if rule, ok, err := parseIgnoreRule(scanner.Text()); ok && err == nil {
+				entry.rules = append(entry.rules, rule)
+			}
+		}
+		f.Close()
+	}
+
+	if len(ignoreCache) >= ignoreCacheSize {
+		clear(ignoreCache)
+	}
+	ignoreCache[name] = entry
+	return entry.rules
+}
+
+// forgetIgnoreFiles drops the rules of the ignore file name, or of those
+// under it.
+func forgetIgnoreFiles(name string) {
+	name = filepath.Clean(name)
+	ignoreCacheMu.Lock()
+	defer ignoreCacheMu.Unlock()
+	maps.DeleteFunc(ignoreCache, func(entry string, _ *ignoreEntry) bool {
+		return under(filepath.Clean(entry), name, filepath.Separator)
+	})
+}
+
+// parseDotNames parses the comma separated names of -allow-dot, like
+// .well-known, each a single path segment starting with a dot.
+func parseDotNames(list string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.Trim(strings.TrimSpace(name), "/")
+		if name == "" {
+			continue
+		}
+		if !strings.HasPrefix(name, ".") || strings.Contains(name, "/") || name == "." || name == ".." {
+			return nil, fmt.Errorf("%q isn't a folder or file name starting with a dot", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// excluded reports whether name, or a directory it is in, is a dot file with
+// -hide-dotfiles, other than a first segment of -allow-dot, matches -exclude
+// or is listed by an ignore file above it.
+// The last matching rule wins, and ignore files deeper in the tree over the
+// ones above them and -exclude.
+func (args Args) excluded(name string, isDir bool) bool {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return false
+	}
+
+	ignoreFiles := []string{ignoreFile}
+	if args.gitignore {
+		ignoreFiles = append(ignoreFiles, ".gitignore")
+	}
+
+	segments := strings.Split(name[1:], "/")
+	for i, segment := range segments {
+		if segment == ignoreFile || args.hideDotfiles && strings.HasPrefix(segment, ".") && !(i == 0 && slices.Contains(args.allowDot, segment)) {
+			return true
+		}
+
+		p := "/" + strings.Join(segments[:i+1], "/")
+		dir := isDir || i < len(segments)-1
+		ignored := false
+		for _, rule := range args.exclude {
+			if rule.match(p[1:], dir) {
+				ignored = !rule.negate
+			}
+		}
+		for j := range i + 1 {
+			base := "/" + strings.Join(segments[:j], "/")
+			rel := strings.Join(segments[j:i+1], "/")
+			for _, file := range ignoreFiles {
+				for _, rule := range readIgnoreFile(args.localPath(path.Join(base, file))) {
+					if rule.match(rel, dir) {
+						ignored = !rule.negate
+					}
+				}
+			}
+		}
+		if ignored {
+			return true
+		}
+	}
+	return false
+}
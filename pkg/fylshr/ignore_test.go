@@ -0,0 +1,134 @@
+package fylshr
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAllowDot(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".well-known/security.txt": "Contact: me",
+		".well-known/.secret":      "hidden",
+		".git/config":              "[core]",
+		"sub/.well-known/a.txt":    "nested",
+		".env":                     "SECRET=1",
+	})
+
+	tests := []struct {
+		flags  []string
+		path   string
+		status int
+	}{
+		{nil, "/.well-known/security.txt", http.StatusOK},
+		{nil, "/.well-known/", http.StatusOK},
+		{nil, "/.well-known/.secret", http.StatusNotFound},
+		{nil, "/.git/config", http.StatusNotFound},
+		{nil, "/sub/.well-known/a.txt", http.StatusNotFound},
+		{nil, "/.env", http.StatusNotFound},
+		{[]string{"-allow-dot", ".well-known,.git"}, "/.git/config", http.StatusOK},
+		{[]string{"-allow-dot", ".git"}, "/.well-known/security.txt", http.StatusNotFound},
+		{[]string{"-allow-dot", ""}, "/.well-known/security.txt", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, tt.flags...)
+		if resp, _ := do(t, srv, http.MethodGet, tt.path, nil); resp.StatusCode != tt.status {
+			t.Errorf("%v GET %s = %d, want %d", tt.flags, tt.path, resp.StatusCode, tt.status)
+		}
+	}
+
+	_, body := do(t, newTestServer(t, dir), http.MethodGet, "/", nil)
+	if !strings.Contains(body, ".well-known/") || strings.Contains(body, ".git/") || strings.Contains(body, ".env") {
+		t.Errorf("GET / lists %q, want only .well-known of the dot files", body)
+	}
+}
+
+func TestParseDotNames(t *testing.T) {
+	tests := []struct {
+		list string
+		want string
+		ok   bool
+	}{
+		{".well-known", ".well-known", true},
+		{" .well-known/, /.git ", ".well-known .git", true},
+		{"", "", true},
+		{"well-known", "", false},
+		{".a/b", "", false},
+		{"..", "", false},
+	}
+	for _, tt := range tests {
+		names, err := parseDotNames(tt.list)
+		if got := strings.Join(names, " "); got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("parseDotNames(%q) = %q, %v, want %q", tt.list, got, err, tt.want)
+		}
+	}
+}
+
+// TestExclude checks that dot files, -exclude, ignore files and -gitignore
+// hide paths both from requests and from listings.
+func TestExclude(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.txt":                     "hello",
+		".env":                      "SECRET=1",
+		"app.log":                   "log",
+		"secret.txt":                "hidden",
+		ignoreFile:                  "secret*\n",
+		"sub/keep.log":              "kept",
+		"sub/" + ignoreFile:         "!keep.log\n",
+		"node_modules/pkg/index.js": "",
+		"build/out.bin":             "",
+		".gitignore":                "build/\n",
+	})
+	exclude := []string{"-exclude", "*.log,node_modules/**"}
+
+	tests := []struct {
+		flags  []string
+		path   string
+		status int
+	}{
+		{nil, "/a.txt", http.StatusOK},
+		{nil, "/.env", http.StatusNotFound},
+		{[]string{"-hide-dotfiles=false"}, "/.env", http.StatusOK},
+		{nil, "/secret.txt", http.StatusNotFound},
+		{nil, "/" + ignoreFile, http.StatusNotFound},
+		{[]string{"-hide-dotfiles=false"}, "/" + ignoreFile, http.StatusNotFound},
+		{nil, "/app.log", http.StatusOK},
+		{exclude, "/app.log", http.StatusNotFound},
+		{exclude, "/sub/keep.log", http.StatusOK},
+		{exclude, "/node_modules/pkg/index.js", http.StatusNotFound},
+		{exclude, "/node_modules/", http.StatusNotFound},
+		{nil, "/build/out.bin", http.StatusOK},
+		{[]string{"-gitignore"}, "/build/out.bin", http.StatusNotFound},
+		{[]string{"-gitignore"}, "/build/", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, tt.flags...)
+		if resp, _ := do(t, srv, http.MethodGet, tt.path, nil); resp.StatusCode != tt.status {
+			t.Errorf("%v GET %s = %d, want %d", tt.flags, tt.path, resp.StatusCode, tt.status)
+		}
+	}
+
+	srv := newTestServer(t, dir, append(exclude, "-gitignore")...)
+	listings := []struct {
+		path           string
+		listed, hidden []string
+	}{
+		{"/", []string{"a.txt", "sub/"}, []string{"node_modules/", "app.log", "secret.txt", "build/", ".env", ignoreFile}},
+		{"/sub/", []string{"keep.log"}, []string{ignoreFile}},
+	}
+	for _, tt := range listings {
+		_, body := do(t, srv, http.MethodGet, tt.path, nil)
+		for _, name := range tt.listed {
+			if !strings.Contains(body, `href="`+name+`"`) {
+				t.Errorf("GET %s doesn't list %s", tt.path, name)
+			}
+		}
+		for _, name := range tt.hidden {
+			if strings.Contains(body, `href="`+name+`"`) {
+				t.Errorf("GET %s lists the excluded %s", tt.path, name)
+			}
+		}
+	}
+}
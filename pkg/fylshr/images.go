@@ -0,0 +1,37 @@
+package fylshr
+
+import (
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+var negotiableImages = []string{".jpg", ".jpeg", ".png", ".gif"}
+
+// modernImages are tried in order of preference.
+var modernImages = []struct{ ext, mimeType string }{
+	{".avif", "image/avif"},
+	{".webp", "image/webp"},
+}
+
+// imageVariant returns the path of an AVIF or WebP sibling of the requested
+// image when the client accepts it, or name itself otherwise.
+func imageVariant(w http.ResponseWriter, r *http.Request, localPath func(string) string, name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if !slices.Contains(negotiableImages, ext) {
+		return name
+	}
+
+	w.Header().Add("Vary", "Accept")
+	accept := r.Header.Get("Accept")
+	base := strings.TrimSuffix(name, path.Ext(name))
+	for _, modern := range modernImages {
+		variant := base + modern.ext
+		if acceptQuality(accept, modern.mimeType) > 0 && isFile(localPath(variant)) {
+			return variant
+		}
+	}
+
+	return name
+}
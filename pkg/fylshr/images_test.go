@@ -0,0 +1,47 @@
+package fylshr
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestImageNegotiation(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"photo.jpg":  "jpeg",
+		"photo.webp": "webp",
+		"both.png":   "png",
+		"both.webp":  "webp",
+		"both.avif":  "avif",
+		"plain.jpg":  "jpeg",
+	})
+
+	tests := []struct {
+		flags        []string
+		path, accept string
+		body, ctype  string
+	}{
+		{[]string{"-image-negotiation"}, "/photo.jpg", "image/webp,*/*", "webp", "image/webp"},
+		{[]string{"-image-negotiation"}, "/photo.jpg", "image/png,*/*", "jpeg", "image/jpeg"},
+		{[]string{"-image-negotiation"}, "/photo.jpg", "image/webp;q=0", "jpeg", "image/jpeg"},
+		{[]string{"-image-negotiation"}, "/photo.jpg?raw", "image/webp", "jpeg", "image/jpeg"},
+		{[]string{"-image-negotiation"}, "/photo.webp", "image/png", "webp", "image/webp"},
+		{[]string{"-image-negotiation"}, "/plain.jpg", "image/avif,image/webp", "jpeg", "image/jpeg"},
+		{[]string{"-image-negotiation"}, "/both.png", "image/avif,image/webp", "avif", "image/avif"},
+		{[]string{"-image-negotiation"}, "/both.png", "image/webp", "webp", "image/webp"},
+		{nil, "/photo.jpg", "image/webp", "jpeg", "image/jpeg"},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, tt.flags...)
+		resp, body := do(t, srv, http.MethodGet, tt.path, nil, "Accept: "+tt.accept)
+		if resp.StatusCode != http.StatusOK || body != tt.body || resp.Header.Get("Content-Type") != tt.ctype {
+			t.Errorf("%v GET %s Accept %q = %d %q %s, want %q %s", tt.flags, tt.path, tt.accept, resp.StatusCode, body, resp.Header.Get("Content-Type"), tt.body, tt.ctype)
+		}
+		varies := slices.Contains(resp.Header.Values("Vary"), "Accept")
+		if want := tt.flags != nil && !strings.HasSuffix(tt.path, "?raw") && !strings.HasSuffix(tt.path, ".webp"); varies != want {
+			t.Errorf("%v GET %s Vary %q, want Accept %v", tt.flags, tt.path, resp.Header.Values("Vary"), want)
+		}
+	}
+}
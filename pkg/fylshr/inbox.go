@@ -0,0 +1,134 @@
+package fylshr
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// inboxMethods are accepted under -inbox on top of -methods.
+var inboxMethods = []string{http.MethodPost, http.MethodDelete}
+
+// checkInbox makes sure the -inbox folder exists and is protected by a token
+// file, since it's the only place clients can change.
+func checkInbox(folder, inbox string) error {
+	if inbox == "/" {
+		return errors.New("must be a folder under -folder, not the folder itself")
+	}
+	dir := filepath.Join(folder, filepath.FromSlash(inbox))
+	if err := checkDir(dir); err != nil {
+		return err
+	}
+	if _, ok := nearestTokens(folder, inbox+"/"); !ok {
+		return fmt.Errorf("%s has no %s, anyone could change it", dir, tokenFile)
+	}
+	return nil
+}
+
+// serveInbox renames (POST with ?rename=) or deletes (DELETE) a file in the
+// inbox. The token was already checked with the rest of the request, but is
+// required here even if the token file went away.
+func serveInbox(w http.ResponseWriter, r *http.Request, folder, inbox string) {
+	if _, ok := nearestTokens(folder, inbox+"/"); !ok {
+		writeError(w, r, http.StatusForbidden, "403 inbox is not protected by a token")
+		return
+	}
+
+	name, err := inboxPath(folder, inbox, r.URL.Path)
+	if err == nil {
+		_, err = os.Lstat(name)
+	}
+	if err != nil {
+		writeInboxError(w, r, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodDelete:
+		if err := os.Remove(name); err != nil {
+			writeInboxError(w, r, err)
+			return
+		}
+	case http.MethodPost:
+		dest := r.URL.Query().Get("rename")
+		if dest == "" {
+			writeError(w, r, http.StatusBadRequest, "400 missing rename")
+			return
+		}
+		if !strings.HasPrefix(dest, "/") {
+			dest = path.Join(path.Dir(path.Clean(r.URL.Path)), dest)
+		}
+
+		newName, err := inboxPath(folder, inbox, dest)
+		if err != nil {
+			writeInboxError(w, r, err)
+			return
+		}
+		if _, err := os.Lstat(newName); err == nil {
+			writeError(w, r, http.StatusConflict, "409 "+path.Clean(dest)+" already exists")
+			return
+		}
+		if err := os.Rename(name, newName); err != nil {
+			writeInboxError(w, r, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var errOutsideInbox = errors.New("outside the inbox")
+
+// inboxPath resolves the URL path name to a file strictly inside the inbox,
+// refusing the token file and anything reached through a symlink out of it.
+func inboxPath(folder, inbox, name string) (string, error) {
+	name = path.Clean("/" + name)
+	if !strings.HasPrefix(name, inbox+"/") || path.Base(name) == tokenFile {
+		return "", errOutsideInbox
+	}
+
+	root, err := filepath.EvalSymlinks(filepath.Join(folder, filepath.FromSlash(inbox)))
+	if err != nil {
+		return "", err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Join(folder, filepath.FromSlash(path.Dir(name))))
+	if err != nil {
+		return "", err
+	}
+	if !insideDir(root, dir) {
+		return "", errOutsideInbox
+	}
+
+	return filepath.Join(dir, path.Base(name)), nil
+}
+
+func writeInboxError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errOutsideInbox):
+		writeError(w, r, http.StatusForbidden, "403 outside the inbox")
+	case errors.Is(err, fs.ErrNotExist):
+		writeError(w, r, http.StatusNotFound, "404 page not found")
+	case errors.Is(err, fs.ErrPermission):
+		writeError(w, r, http.StatusForbidden, "403 forbidden")
+	default:
+		// Mostly removing a directory that isn't empty, or renaming a
+		// directory into itself.
+		if unwrapped := errors.Unwrap(err); unwrapped != nil {
+			err = unwrapped
+		}
+		writeError(w, r, http.StatusConflict, "409 "+err.Error())
+	}
+}
+
+// cleanInbox turns -inbox into a URL path without a trailing slash.
+func cleanInbox(inbox string) string {
+	if inbox == "" {
+		return ""
+	}
+	return path.Clean("/" + filepath.ToSlash(inbox))
+}
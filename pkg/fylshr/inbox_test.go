@@ -0,0 +1,97 @@
+package fylshr
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInbox(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		status  int
+		gone    string
+		created string
+	}{
+		{"delete", http.MethodDelete, "/in/a.txt?token=s3cret", http.StatusNoContent, "in/a.txt", ""},
+		{"delete without token", http.MethodDelete, "/in/a.txt", http.StatusForbidden, "", ""},
+		{"delete with wrong token", http.MethodDelete, "/in/a.txt?token=nope", http.StatusForbidden, "", ""},
+		{"delete in subfolder", http.MethodDelete, "/in/sub/c.txt?token=s3cret", http.StatusNoContent, "in/sub/c.txt", ""},
+		{"delete missing", http.MethodDelete, "/in/missing.txt?token=s3cret", http.StatusNotFound, "", ""},
+		{"delete folder", http.MethodDelete, "/in/sub?token=s3cret", http.StatusConflict, "", ""},
+		{"delete token file", http.MethodDelete, "/in/" + tokenFile + "?token=s3cret", http.StatusNotFound, "", ""},
+		{"delete outside", http.MethodDelete, "/a.txt?token=s3cret", http.StatusMethodNotAllowed, "", ""},
+		{"delete through symlink", http.MethodDelete, "/in/link/out.txt?token=s3cret", http.StatusNotFound, "", ""},
+		{"rename", http.MethodPost, "/in/a.txt?token=s3cret&rename=b.txt", http.StatusNoContent, "in/a.txt", "in/b.txt"},
+		{"rename into subfolder", http.MethodPost, "/in/a.txt?token=s3cret&rename=sub/b.txt", http.StatusNoContent, "in/a.txt", "in/sub/b.txt"},
+		{"rename absolute", http.MethodPost, "/in/sub/c.txt?token=s3cret&rename=/in/c.txt", http.StatusNoContent, "in/sub/c.txt", "in/c.txt"},
+		{"rename without token", http.MethodPost, "/in/a.txt?rename=b.txt", http.StatusForbidden, "", ""},
+		{"rename onto existing", http.MethodPost, "/in/a.txt?token=s3cret&rename=sub/c.txt", http.StatusConflict, "", ""},
+		{"rename out", http.MethodPost, "/in/a.txt?token=s3cret&rename=../b.txt", http.StatusForbidden, "", ""},
+		{"rename onto token file", http.MethodPost, "/in/a.txt?token=s3cret&rename=" + tokenFile, http.StatusForbidden, "", ""},
+		{"rename through symlink", http.MethodPost, "/in/a.txt?token=s3cret&rename=link/b.txt", http.StatusForbidden, "", ""},
+		{"rename into missing folder", http.MethodPost, "/in/a.txt?token=s3cret&rename=none/b.txt", http.StatusNotFound, "", ""},
+		{"empty rename", http.MethodPost, "/in/a.txt?token=s3cret&rename=", http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, outside := t.TempDir(), t.TempDir()
+			writeFiles(t, dir, map[string]string{
+				"a.txt":           "outside the inbox",
+				"in/" + tokenFile: "s3cret",
+				"in/a.txt":        "hello",
+				"in/sub/c.txt":    "nested",
+			})
+			writeFiles(t, outside, map[string]string{"out.txt": "out"})
+			if err := os.Symlink(outside, filepath.Join(dir, "in", "link")); err != nil {
+				t.Skip(err)
+			}
+			srv := newTestServer(t, dir, "-inbox", "in")
+
+			if resp, body := do(t, srv, tt.method, tt.path, nil); resp.StatusCode != tt.status {
+				t.Errorf("%s %s = %d %s, want %d", tt.method, tt.path, resp.StatusCode, body, tt.status)
+			}
+			for _, name := range []string{"a.txt", "in/" + tokenFile, "in/a.txt", "in/sub/c.txt"} {
+				_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+				if gone := os.IsNotExist(err); gone != (name == tt.gone) {
+					t.Errorf("%s %s: %s gone %v", tt.method, tt.path, name, gone)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(outside, "out.txt")); err != nil {
+				t.Errorf("%s %s removed a file outside the inbox", tt.method, tt.path)
+			}
+			if tt.created != "" {
+				if content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(tt.created))); err != nil || len(content) == 0 {
+					t.Errorf("%s %s: %s = %q, %v", tt.method, tt.path, tt.created, content, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckInbox(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"in/" + tokenFile: "s3cret", "sub/in/a.txt": "", "open/": ""})
+
+	tests := []struct {
+		inbox string
+		err   string
+	}{
+		{"in", ""},
+		{"/in/", ""},
+		{"sub/../in", ""},
+		{"/", "not the folder itself"},
+		{"open", "anyone could change it"},
+		{"missing", "no such file"},
+	}
+	for _, tt := range tests {
+		err := checkInbox(dir, cleanInbox(tt.inbox))
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("checkInbox(%q) = %v, want %q", tt.inbox, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package fylshr
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+)
+
+// forceListing reports whether the request asks for the directory listing
+// even if the directory has an index.html, with ?ls, ?index=off or ?format=json.
+func forceListing(r *http.Request) bool {
+	query := r.URL.Query()
+	return query.Has("ls") || query.Get("index") == "off" || query.Get("format") == "json"
+}
+
+// serveRootPage serves the -root-page file, read on every request so edits
+// show up without a restart, followed by the style of look withStyle.
+func serveRootPage(w http.ResponseWriter, r *http.Request, look *look, name string, withStyle bool) {
+	info, err := os.Stat(name)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "500 root page unavailable")
+		return
+	}
+
+	page, err := os.ReadFile(name)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "500 root page unavailable")
+		return
+	}
+
+	if withStyle {
+		page = append(page, look.style...)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeContent(w, r, "index.html", info.ModTime(), bytes.NewReader(page))
+}
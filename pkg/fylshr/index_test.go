@@ -0,0 +1,58 @@
+package fylshr
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestForceListing checks that ?ls, ?index=off and ?format=json list a folder
+// instead of serving its index or the -root-page.
+func TestForceListing(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"index.html":         "<p>root index</p>",
+		"a.txt":              "hello",
+		"sub/index.html":     "<p>sub index</p>",
+		"sub/b.txt":          "nested",
+		"lang/index.en.html": "<p>english</p>",
+		"lang/b.txt":         "nested",
+		"plain/b.txt":        "nested",
+	})
+	rootPage := filepath.Join(t.TempDir(), "root.html")
+	if err := os.WriteFile(rootPage, []byte("<p>root page</p>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		flags []string
+		path  string
+		want  string
+	}{
+		{nil, "/", "root index"},
+		{nil, "/?ls", `href="a.txt"`},
+		{nil, "/?ls=1", `href="a.txt"`},
+		{nil, "/?index=off", `href="a.txt"`},
+		{nil, "/?index=on", "root index"},
+		{nil, "/?format=json", `"href":"a.txt"`},
+		{nil, "/sub/", "sub index"},
+		{nil, "/sub/?ls", `href="b.txt"`},
+		{nil, "/sub/?sort=size&ls", `href="b.txt"`},
+		{nil, "/plain/", `href="b.txt"`},
+		{nil, "/plain/?ls", `href="b.txt"`},
+		{[]string{"-root-page", rootPage}, "/", "root page"},
+		{[]string{"-root-page", rootPage}, "/?ls", `href="a.txt"`},
+		{[]string{"-root-page", rootPage}, "/?format=json", `"href":"a.txt"`},
+		{[]string{"-index-lang", "en"}, "/lang/", "english"},
+		{[]string{"-index-lang", "en"}, "/lang/?index=off", `href="b.txt"`},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, tt.flags...)
+		resp, body := do(t, srv, http.MethodGet, tt.path, nil)
+		if resp.StatusCode != http.StatusOK || !strings.Contains(body, tt.want) {
+			t.Errorf("%v GET %s = %d %s, want %q", tt.flags, tt.path, resp.StatusCode, body, tt.want)
+		}
+	}
+}
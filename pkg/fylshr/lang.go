@@ -0,0 +1,84 @@
+package fylshr
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// localizedIndex picks the index.<lang>.html in dir that Accept-Language
+// prefers, or index.<fallback>.html when none is acceptable. found reports
+// whether dir has localized indexes at all, in which case the response
+// varies with the header even when name is empty.
+func localizedIndex(dir, acceptLanguage, fallback string) (name, lang string, found bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", false
+	}
+
+	best := 0.0
+	hasFallback := false
+	for _, entry := range entries {
+		l, ok := strings.CutPrefix(entry.Name(), "index.")
+		if l, ok = strings.CutSuffix(l, ".html"); !ok || l == "" || strings.Contains(l, ".") || entry.IsDir() {
+			continue
+		}
+		found = true
+		if strings.EqualFold(l, fallback) {
+			hasFallback = true
+		}
+		if q := languageQuality(acceptLanguage, l); q > best {
+			best, name, lang = q, entry.Name(), l
+		}
+	}
+
+	if name == "" && hasFallback {
+		name, lang = "index."+fallback+".html", fallback
+	}
+	if name != "" {
+		name = filepath.Join(dir, name)
+	}
+	return name, lang, found
+}
+
+// languageQuality returns the q-value an Accept-Language header gives to lang.
+// A range matches its subtags both ways, so fr accepts fr-CA and fr-CH accepts
+// fr, and * only counts when nothing else matched.
+func languageQuality(acceptLanguage, lang string) float64 {
+	match, wildcard := -1.0, 0.0
+	for _, languageRange := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(languageRange, ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if key == "q" {
+				if v, err := strconv.ParseFloat(value, 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		switch {
+		case tag == "*":
+			wildcard = q
+		case languageMatches(tag, lang) && q > match:
+			match = q
+		}
+	}
+
+	if match >= 0 {
+		return match
+	}
+	return wildcard
+}
+
+func languageMatches(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	return a == b || strings.HasPrefix(a, b+"-") || strings.HasPrefix(b, a+"-")
+}
@@ -0,0 +1,71 @@
+package fylshr
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestIndexLang(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"index.en.html":            "english",
+		"index.fr.html":            "français",
+		"index.pt-BR.html":         "português",
+		"plain/index.html":         "plain",
+		"nofallback/a.txt":         "a",
+		"nofallback/index.de.html": "deutsch",
+	})
+
+	tests := []struct {
+		path, accept string
+		status       int
+		body, lang   string
+	}{
+		{"/", "fr-CH, fr;q=0.9, en;q=0.8", http.StatusOK, "français", "fr"},
+		{"/", "en-US,en;q=0.9", http.StatusOK, "english", "en"},
+		{"/", "de, fr;q=0.5, en;q=0.7", http.StatusOK, "english", "en"},
+		{"/", "pt", http.StatusOK, "português", "pt-BR"},
+		{"/", "de", http.StatusOK, "english", "en"},
+		{"/", "", http.StatusOK, "english", "en"},
+		{"/", "fr;q=0, *;q=0.1", http.StatusOK, "english", "en"},
+		{"/nofallback/", "de", http.StatusOK, "deutsch", "de"},
+		{"/nofallback/", "fr", http.StatusOK, `href="a.txt"`, ""},
+		{"/plain/", "fr", http.StatusOK, "plain", ""},
+	}
+	srv := newTestServer(t, dir, "-index-lang", "en")
+	for _, tt := range tests {
+		resp, body := do(t, srv, http.MethodGet, tt.path, nil, "Accept-Language: "+tt.accept)
+		if resp.StatusCode != tt.status || !strings.Contains(body, tt.body) || resp.Header.Get("Content-Language") != tt.lang {
+			t.Errorf("GET %s Accept-Language %q = %d %q Content-Language %q, want %q %q", tt.path, tt.accept, resp.StatusCode, body, resp.Header.Get("Content-Language"), tt.body, tt.lang)
+		}
+		if varies := slices.Contains(resp.Header.Values("Vary"), "Accept-Language"); varies != (tt.path != "/plain/") {
+			t.Errorf("GET %s Vary %q", tt.path, resp.Header.Values("Vary"))
+		}
+	}
+}
+
+func TestLanguageQuality(t *testing.T) {
+	tests := []struct {
+		accept, lang string
+		want         float64
+	}{
+		{"fr", "fr", 1},
+		{"fr;q=0.5", "fr", 0.5},
+		{"fr-CA", "fr", 1},
+		{"fr", "fr-CA", 1},
+		{"FR", "fr", 1},
+		{"fr;q=0.2, fr-CA;q=0.8", "fr-CA", 0.8},
+		{"en, *;q=0.3", "de", 0.3},
+		{"*;q=0.3, de;q=0", "de", 0},
+		{"en", "de", 0},
+		{"", "de", 0},
+		{"fre", "fr", 0},
+	}
+	for _, tt := range tests {
+		if got := languageQuality(tt.accept, tt.lang); got != tt.want {
+			t.Errorf("languageQuality(%q, %q) = %v, want %v", tt.accept, tt.lang, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package fylshr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// quotaScanTimeout bounds the walk measuring the folder for -upload-quota. A
+// folder too big to measure in time counts what was seen.
+const quotaScanTimeout = 5 * time.Second
+
+var (
+	errUploadTooLarge = errors.New("upload too large")
+	errUploadType     = errors.New("file type not allowed")
+)
+
+// uploadLimits are what -max-upload-size, -allowed-upload-ext and
+// -upload-quota let into the folder, zero values leaving uploads unlimited.
+type uploadLimits struct {
+	maxSize int64
+	exts    []string
+	quota   int64
+}
+
+// uploadBudget is how many bytes an upload may still write, -1 for no limit,
+// and the error once it writes more.
+type uploadBudget struct {
+	left int64
+	over error
+}
+
+// admit checks an upload of size bytes, -1 if not known yet, named name into
+// folder, and returns the budget the body must stay within.
+func (l uploadLimits) admit(folder, name string, size int64) (uploadBudget, error) {
+	if err := l.admitType(name); err != nil {
+		return uploadBudget{}, err
+	}
+
+	budget := uploadBudget{left: -1}
+	if l.maxSize > 0 {
+		budget = uploadBudget{l.maxSize, fmt.Errorf("%w, files over %s are refused", errUploadTooLarge, formatSize(uint64(l.maxSize)))}
+	}
+	if l.quota > 0 {
+		_, used, _ := folderSize(folder, quotaScanTimeout)
+		if room := max(l.quota-int64(used), 0); budget.left < 0 || room < budget.left {
+			budget = uploadBudget{room, fmt.Errorf("%w, only %s is left of the %s quota", errUploadTooLarge, formatSize(uint64(room)), formatSize(uint64(l.quota)))}
+		}
+	}
+	if size >= 0 && budget.left >= 0 && size > budget.left {
+		return uploadBudget{}, budget.over
+	}
+	return budget, nil
+}
+
+// admitType checks that -allowed-upload-ext lets a file named name in.
+func (l uploadLimits) admitType(name string) error {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	if len(l.exts) > 0 && !matchesGlob(l.exts, strings.ToLower(name)) {
+		return fmt.Errorf("%w, only %s can be uploaded", errUploadType, l.extList())
+	}
+	return nil
+}
+
+// limit returns src failing with the budget's error past its bytes.
+func (b uploadBudget) limit(src io.Reader) io.Reader {
+	if b.left < 0 {
+		return src
+	}
+	return &budgetReader{src: src, uploadBudget: b}
+}
+
+type budgetReader struct {
+	src io.Reader
+	uploadBudget
+}
+
+// Read reads one byte past the budget to tell an upload ending right at it
+// from one going over.
+func (r *budgetReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > r.left+1 {
+		p = p[:r.left+1]
+	}
+	n, err := r.src.Read(p)
+	if int64(n) > r.left {
+		return int(r.left), r.over
+	}
+	r.left -= int64(n)
+	return n, err
+}
+
+// extList returns the -allowed-upload-ext patterns, plain extensions without
+// their *.
+func (l uploadLimits) extList() string {
+	exts := make([]string, len(l.exts))
+	for i, pattern := range l.exts {
+		exts[i] = strings.TrimPrefix(pattern, "*")
+	}
+	return strings.Join(exts, ", ")
+}
+
+// accept returns the accept attribute of upload forms, or "" when a pattern
+// isn't a plain extension a browser understands.
+func (l uploadLimits) accept() string {
+	exts := make([]string, len(l.exts))
+	for i, pattern := range l.exts {
+		ext := strings.TrimPrefix(pattern, "*")
+		if strings.ContainsAny(ext, "*?[") || !strings.HasPrefix(ext, ".") {
+			return ""
+		}
+		exts[i] = ext
+	}
+	return strings.Join(exts, ",")
+}
+
+// hint describes the limits next to upload forms.
+func (l uploadLimits) hint() string {
+	var hints []string
+	if l.maxSize > 0 {
+		hints = append(hints, "up to "+formatSize(uint64(l.maxSize))+" per file")
+	}
+	if len(l.exts) > 0 {
+		hints = append(hints, l.extList()+" only")
+	}
+	if l.quota > 0 {
+		hints = append(hints, formatSize(uint64(l.quota))+" in total")
+	}
+	return strings.Join(hints, ", ")
+}
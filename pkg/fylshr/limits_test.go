@@ -0,0 +1,65 @@
+package fylshr
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUploadLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		flags   []string
+		method  string
+		file    string
+		content string
+		status  int
+		message string
+	}{
+		{"under the size", []string{"-max-upload-size", "10B"}, http.MethodPut, "a.txt", "0123456789", http.StatusCreated, ""},
+		{"over the size", []string{"-max-upload-size", "10B"}, http.MethodPut, "a.txt", "0123456789a", http.StatusRequestEntityTooLarge, "files over 10 B are refused"},
+		{"form over the size", []string{"-max-upload-size", "10B"}, http.MethodPost, "a.txt", "0123456789a", http.StatusRequestEntityTooLarge, "files over 10 B are refused"},
+		{"allowed extension", []string{"-allowed-upload-ext", "jpg,png"}, http.MethodPut, "a.PNG", "png", http.StatusCreated, ""},
+		{"other extension", []string{"-allowed-upload-ext", "jpg,png"}, http.MethodPut, "a.exe", "exe", http.StatusUnsupportedMediaType, "only .jpg, .png can be uploaded"},
+		{"form other extension", []string{"-allowed-upload-ext", "jpg,png"}, http.MethodPost, "a.exe", "exe", http.StatusUnsupportedMediaType, "only .jpg, .png can be uploaded"},
+		{"glob", []string{"-allowed-upload-ext", "report-*.pdf"}, http.MethodPut, "report-1.pdf", "pdf", http.StatusCreated, ""},
+		{"under the quota", []string{"-upload-quota", "20B"}, http.MethodPut, "a.txt", "0123456789", http.StatusCreated, ""},
+		{"over the quota", []string{"-upload-quota", "20B"}, http.MethodPut, "a.txt", "0123456789a", http.StatusRequestEntityTooLarge, "only 10 B is left of the 20 B quota"},
+		{"quota under the size", []string{"-upload-quota", "20B", "-max-upload-size", "1KB"}, http.MethodPut, "a.txt", "0123456789a", http.StatusRequestEntityTooLarge, "quota"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"held.bin": "0123456789"})
+			srv := newTestServer(t, dir, append([]string{"-upload"}, tt.flags...)...)
+
+			var resp *http.Response
+			var body string
+			if tt.method == http.MethodPut {
+				resp, body = do(t, srv, tt.method, "/"+tt.file, strings.NewReader(tt.content))
+			} else {
+				form, contentType := multipartBody(t, map[string]string{tt.file: tt.content})
+				resp, body = do(t, srv, tt.method, "/", form, contentType)
+			}
+			if resp.StatusCode != tt.status || !strings.Contains(body, tt.message) {
+				t.Errorf("%s %s = %d %q, want %d %q", tt.method, tt.file, resp.StatusCode, body, tt.status, tt.message)
+			}
+			_, err := os.Stat(filepath.Join(dir, tt.file))
+			if saved := err == nil; saved != (tt.message == "") {
+				t.Errorf("%s %s saved %v, want %v", tt.method, tt.file, saved, tt.message == "")
+			}
+		})
+	}
+}
+
+func TestUploadLimitsHint(t *testing.T) {
+	srv := newTestServer(t, t.TempDir(), "-upload", "-max-upload-size", "2MB", "-allowed-upload-ext", "jpg,png", "-upload-quota", "1GB")
+	_, body := do(t, srv, http.MethodGet, "/", nil)
+	for _, want := range []string{`accept=".jpg,.png"`, "up to 2.0 MiB per file, .jpg, .png only, 1.0 GiB in total"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("GET / doesn't show %q", want)
+		}
+	}
+}
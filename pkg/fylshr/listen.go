@@ -0,0 +1,205 @@
+package fylshr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// listen adopts the sockets passed by systemd, or binds every -listen address
+// and -port otherwise.
+func listen(args Args) ([]net.Listener, error) {
+	listeners, err := systemdListeners()
+	if err != nil || listeners != nil {
+		return listeners, err
+	}
+
+	if args.systemd {
+		return nil, errors.New("-systemd is set but no sockets were passed by systemd")
+	}
+
+	for _, addr := range args.listen {
+		bind := listenAddr
+		if args.lanOnly {
+			bind = listenLANAddr
+		}
+		ls, err := bind(addr, args.network)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, ls...)
+	}
+
+	if args.lanOnly && len(args.ports) > 0 {
+		lan, err := listenLAN(args.ports, args.network)
+		return append(listeners, lan...), err
+	}
+
+	for _, port := range args.ports {
+		ls, err := listenAddr(":"+port, args.network)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, ls...)
+	}
+
+	return listeners, nil
+}
+
+// listenAddr binds a -listen address: unix:/path for a Unix socket, or
+// host:port. -network only applies without a host, which is every interface,
+// since a given host already picks its stack.
+func listenAddr(addr, network string) ([]net.Listener, error) {
+	if name, ok := strings.CutPrefix(addr, "unix:"); ok {
+		l, err := listenUnix(name)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{l}, nil
+	}
+
+	networks := []string{network}
+	if host, _, _ := net.SplitHostPort(addr); host != "" {
+		networks = []string{"tcp"}
+	} else if network == "dual" {
+		networks = []string{"tcp4", "tcp6"}
+	}
+
+	var listeners []net.Listener
+	for _, network := range networks {
+		l, err := net.Listen(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// listenUnix binds the socket name, replacing a stale one left by a process
+// that didn't exit cleanly but not one still accepting connections.
+func listenUnix(name string) (net.Listener, error) {
+	l, err := net.Listen("unix", name)
+	if err == nil || !errors.Is(err, syscall.EADDRINUSE) {
+		return l, err
+	}
+	if conn, dialErr := net.Dial("unix", name); dialErr == nil {
+		conn.Close()
+		return nil, err
+	}
+	if info, statErr := os.Lstat(name); statErr != nil || info.Mode().Type() != fs.ModeSocket {
+		return nil, err
+	}
+	os.Remove(name)
+	return net.Listen("unix", name)
+}
+
+// listenLANAddr binds a -listen address under -lan-only. A host of every
+// interface is narrowed to the loopback and private addresses like -port, and
+// any other host must only resolve to such addresses.
+func listenLANAddr(addr, network string) ([]net.Listener, error) {
+	if strings.HasPrefix(addr, "unix:") {
+		return listenAddr(addr, network)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		return listenLAN([]string{port}, network)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && ip.IsUnspecified() {
+		network = "tcp6"
+		if ip.Is4() {
+			network = "tcp4"
+		}
+		return listenLAN([]string{port}, network)
+	}
+
+	ips, err := net.DefaultResolver.LookupNetIP(context.Background(), "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if !isLANAddr(ip) {
+			return nil, fmt.Errorf("-lan-only: -listen %s is on %s, which isn't a loopback or private address", addr, ip)
+		}
+	}
+	return listenAddr(addr, network)
+}
+
+// isLANAddr reports whether ip is a loopback or private address, the ones
+// -lan-only listens on.
+func isLANAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsLoopback() || ip.IsPrivate()
+}
+
+// listenLAN binds every port on each loopback and private address instead of
+// all interfaces, so nothing listens on a public address.
+func listenLAN(ports []string, network string) ([]net.Listener, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+
+	var listeners []net.Listener
+	for _, port := range ports {
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+
+			ip, _ := netip.AddrFromSlice(ipnet.IP)
+			ip = ip.Unmap()
+			if !isLANAddr(ip) || ip.Is4() && network == "tcp6" || ip.Is6() && network == "tcp4" {
+				continue
+			}
+
+			l, err := net.Listen("tcp", net.JoinHostPort(ip.String(), port))
+			if err != nil {
+				return nil, err
+			}
+			listeners = append(listeners, l)
+		}
+	}
+
+	if len(listeners) == 0 {
+		return nil, errors.New("-lan-only: no loopback or private address to listen on")
+	}
+
+	return listeners, nil
+}
+
+// isLANClient reports whether r comes from a loopback, private or link-local
+// address, or a Unix socket, which only local processes can reach.
+func isLANClient(r *http.Request) bool {
+	if viaUnixSocket(r) {
+		return true
+	}
+	ip, err := netip.ParseAddr(clientIP(r))
+	if err != nil {
+		return false
+	}
+
+	ip = ip.Unmap()
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast()
+}
+
+// networkStacks describes each -network for the banner. Plain tcp is left to
+// the OS, which usually accepts both stacks on one socket.
+var networkStacks = map[string]string{
+	"tcp":  "",
+	"tcp4": "IPv4 only",
+	"tcp6": "IPv6 only",
+	"dual": "IPv4 and IPv6",
+}
@@ -0,0 +1,267 @@
+package fylshr
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPortFlags(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   []string
+		err    bool
+	}{
+		{[]string{"8080"}, []string{"8080"}, false},
+		{[]string{"80", "8080"}, []string{"80", "8080"}, false},
+		{[]string{"80, 8080", "9090"}, []string{"80", "8080", "9090"}, false},
+		{[]string{"080"}, []string{"80"}, false},
+		{[]string{"http"}, nil, true},
+		{[]string{"65536"}, nil, true},
+		{[]string{"80,"}, nil, true},
+	}
+	for _, tt := range tests {
+		var ports portFlags
+		var err error
+		for _, value := range tt.values {
+			if err = ports.Set(value); err != nil {
+				break
+			}
+		}
+		if (err != nil) != tt.err || !tt.err && !slices.Equal(ports, tt.want) {
+			t.Errorf("-port %q = %q, %v, want %q", tt.values, ports, err, tt.want)
+		}
+	}
+}
+
+// TestListenPorts checks that every -port is bound and serves the same
+// files, and that the banner lists each of them.
+func TestListenPorts(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	args := testArgs(t, dir, "-port", "0,0", "-network", "tcp4")
+	listeners, err := listen(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listeners) != 2 {
+		t.Fatalf("-port 0,0 listens on %d sockets, want 2", len(listeners))
+	}
+
+	srv := newServer(args)
+	t.Cleanup(func() { srv.Close() })
+	for _, l := range listeners {
+		go srv.Serve(l)
+	}
+
+	for _, l := range listeners {
+		url := "http://" + l.Addr().String() + "/a.txt"
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != "hello" {
+			t.Errorf("GET %s = %d %q, want 200 hello", url, resp.StatusCode, body)
+		}
+	}
+
+	args.banner = "text"
+	banner := capture(t, &os.Stdout, func() { printBanner(args, listeners) })
+	for _, l := range listeners {
+		if _, port, _ := net.SplitHostPort(l.Addr().String()); !strings.Contains(banner, ":"+port) {
+			t.Errorf("banner %q doesn't list port %s", banner, port)
+		}
+	}
+}
+
+// TestListenNetwork checks that -network picks the stacks the sockets of a
+// port without host listen on, and that the banner names them.
+func TestListenNetwork(t *testing.T) {
+	tests := []struct {
+		network, addr string
+		want          []string
+		banner        string
+	}{
+		{"tcp4", ":0", []string{"tcp4"}, "IPv4 only"},
+		{"tcp6", ":0", []string{"tcp6"}, "IPv6 only"},
+		{"dual", ":0", []string{"tcp4", "tcp6"}, "IPv4 and IPv6"},
+		{"tcp6", "127.0.0.1:0", []string{"tcp4"}, ""},
+	}
+	for _, tt := range tests {
+		listeners, err := listenAddr(tt.addr, tt.network)
+		if err != nil {
+			t.Logf("-network %s %s: %v", tt.network, tt.addr, err)
+			continue
+		}
+		var stacks []string
+		for _, l := range listeners {
+			defer l.Close()
+			stack := "tcp6"
+			if l.Addr().(*net.TCPAddr).IP.To4() != nil {
+				stack = "tcp4"
+			}
+			stacks = append(stacks, stack)
+		}
+		if !slices.Equal(stacks, tt.want) {
+			t.Errorf("-network %s %s listens on %v, want %v", tt.network, tt.addr, stacks, tt.want)
+		}
+
+		if tt.banner == "" {
+			continue
+		}
+		args := testArgs(t, t.TempDir(), "-network", tt.network)
+		args.banner = "text"
+		if banner := capture(t, &os.Stdout, func() { printBanner(args, listeners) }); !strings.Contains(banner, tt.banner) {
+			t.Errorf("-network %s banner %q, want %q", tt.network, banner, tt.banner)
+		}
+	}
+}
+
+func TestListenFlags(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   []string
+		err    bool
+	}{
+		{[]string{"127.0.0.1:8080"}, []string{"127.0.0.1:8080"}, false},
+		{[]string{"[::]:8080", "unix:/tmp/fylshr.sock"}, []string{"[::]:8080", "unix:/tmp/fylshr.sock"}, false},
+		{[]string{":0"}, []string{":0"}, false},
+		{[]string{"unix:"}, nil, true},
+		{[]string{"127.0.0.1"}, nil, true},
+		{[]string{"localhost:http"}, nil, true},
+		{[]string{"[::1]:65536"}, nil, true},
+	}
+	for _, tt := range tests {
+		var listens listenFlags
+		var err error
+		for _, value := range tt.values {
+			if err = listens.Set(value); err != nil {
+				break
+			}
+		}
+		if (err != nil) != tt.err || !tt.err && !slices.Equal(listens, tt.want) {
+			t.Errorf("-listen %q = %q, %v, want %q", tt.values, listens, err, tt.want)
+		}
+	}
+
+	args := parseTestArgs(t, "-silent", "-listen", "127.0.0.1:0")
+	if len(args.ports) != 0 {
+		t.Errorf("-listen also listens on -port %v", args.ports)
+	}
+}
+
+// TestListenLANAddr checks that -lan-only narrows a -listen of every interface to
+// the loopback and private addresses, and refuses a public host.
+func TestListenLANAddr(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "fylshr.sock")
+	tests := []struct {
+		addr, network string
+		err           bool
+	}{
+		{"127.0.0.1:0", "tcp", false},
+		{"localhost:0", "tcp", false},
+		{":0", "tcp", false},
+		{":0", "tcp4", false},
+		{"0.0.0.0:0", "tcp", false},
+		{"unix:" + sock, "tcp", false},
+		{"8.8.8.8:0", "tcp", true},
+		{"[2001:4860:4860::8888]:0", "tcp", true},
+		{"no-port", "tcp", true},
+	}
+	for _, tt := range tests {
+		listeners, err := listenLANAddr(tt.addr, tt.network)
+		for _, l := range listeners {
+			defer l.Close()
+		}
+		if (err != nil) != tt.err {
+			t.Errorf("-lan-only -listen %s = %v, %v, want error %v", tt.addr, listeners, err, tt.err)
+			continue
+		}
+		if !tt.err && len(listeners) == 0 {
+			t.Errorf("-lan-only -listen %s listens on nothing", tt.addr)
+		}
+		for _, l := range listeners {
+			addr, ok := l.Addr().(*net.TCPAddr)
+			if !ok {
+				continue
+			}
+			if ip := addr.AddrPort().Addr(); !isLANAddr(ip) || ip.IsUnspecified() || strings.HasPrefix(tt.addr, "0.0.0.0") && !ip.Unmap().Is4() {
+				t.Errorf("-lan-only -listen %s listens on %s", tt.addr, addr)
+			}
+		}
+	}
+
+	args := testArgs(t, t.TempDir(), "-lan-only", "-listen", "8.8.8.8:0")
+	if listeners, err := listen(args); err == nil {
+		t.Errorf("-lan-only -listen 8.8.8.8:0 listens on %v", listeners)
+	}
+}
+
+// TestListenUnix checks that a -listen unix: socket is served next to a TCP
+// address, that its clients pass the address rules, and that a stale socket
+// is replaced but not one in use.
+func TestListenUnix(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	sock := filepath.Join(t.TempDir(), "fylshr.sock")
+	args := testArgs(t, dir, "-listen", "unix:"+sock, "-listen", "127.0.0.1:0", "-lan-only", "-allow", "10.0.0.0/8")
+	listeners, err := listen(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listeners) != 2 || listeners[0].Addr().Network() != "unix" || listeners[1].Addr().Network() != "tcp" {
+		t.Fatalf("-listen unix: and a TCP address listen on %v", listeners)
+	}
+	srv := newServer(args)
+	t.Cleanup(func() { srv.Close() })
+	for _, l := range listeners {
+		go srv.Serve(l)
+	}
+
+	client := &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+	}}}
+	tests := []struct {
+		client *http.Client
+		url    string
+		status int
+	}{
+		{client, "http://fylshr/a.txt", http.StatusOK},
+		{http.DefaultClient, "http://" + listeners[1].Addr().String() + "/a.txt", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		resp, err := tt.client.Get(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.url, resp.StatusCode, tt.status)
+		}
+	}
+
+	if l, err := listenUnix(sock); err == nil {
+		l.Close()
+		t.Errorf("listenUnix replaced a socket in use")
+	}
+	stale := filepath.Join(t.TempDir(), "stale.sock")
+	l, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	if l, err := listenUnix(stale); err != nil {
+		t.Errorf("listenUnix of a stale socket: %v", err)
+	} else {
+		l.Close()
+	}
+}
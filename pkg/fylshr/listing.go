@@ -0,0 +1,612 @@
+package fylshr
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// uploadScript sends the files of the upload form, or dropped on the page,
+// through tusPath with a progress bar each.
+//
+//go:embed upload.js
+var uploadScript string
+
+type listingEntry struct {
+	Name  string
+	Href  string
+	Icon  string
+	Thumb string
+	// InlineHref plays or shows the entry in the page and ChecksumHref
+	// returns its SHA-256, both keeping the ?token= of Href.
+	InlineHref   string
+	ChecksumHref string
+	Media        string
+	IsDir        bool
+	Size         string
+	ModTime      string
+	// Checksum is the hex SHA-256 of a file, if already computed.
+	Checksum string
+
+	size     int64
+	modTime  time.Time
+	mimeType string
+}
+
+// listingJSONEntry is an entry of a listing requested as JSON.
+type listingJSONEntry struct {
+	Name    string    `json:"name"`
+	Href    string    `json:"href"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Type    string    `json:"type,omitempty"`
+	IsDir   bool      `json:"isDir"`
+	SHA256  string    `json:"sha256,omitempty"`
+}
+
+type listingColumn struct {
+	Label string
+	Href  string
+	Arrow string
+}
+
+// listingPage is a listing, or search results when Query is set. Upload is
+// the tus endpoint when the directory takes uploads, with the file types it
+// accepts and a hint of its limits, and Archive where the selected entries
+// are POSTed to download them. modTime is when the directory last changed,
+// and stream has the entries of a streamed listing instead of Entries.
+type listingPage struct {
+	Path       string
+	Title      string
+	Base       string
+	Parent     string
+	Columns    []listingColumn
+	Entries    []listingEntry
+	Media      []listingEntry
+	Upload     string
+	Accept     string
+	UploadHint string
+	ZipHref    string
+	TarHref    string
+	Archive    string
+	Manage     string
+	Paste      string
+	Checksums  bool
+	Events     string
+	View       listingColumn
+	Search     string
+	SearchIn   string
+	Query      string
+	Back       string
+	Token      string
+	Truncated  bool
+	Style      template.HTML
+	Script     template.HTML
+
+	modTime time.Time
+	stream  <-chan listingEntry
+}
+
+// Rows are the entries of the table: Entries, or those of a streamed listing
+// as they are read.
+func (page listingPage) Rows() any {
+	if page.stream != nil {
+		return page.stream
+	}
+	return page.Entries
+}
+
+const (
+	// listingChunk is how many entries are read at once, and how many a
+	// directory listed without ?sort can have before it's streamed.
+	listingChunk = 1000
+	// streamBuffer is how much of a streamed listing is sent at once.
+	streamBuffer = 32 << 10
+)
+
+// listingOptions are what serveListing shows besides the entries. A non-empty
+// base becomes the page's <base href>, thumbs links thumbnails under
+// -base-path, gallery makes ?view=gallery the default, dirsFirst lists
+// directories before files, title is -title with {path} left to replace,
+// formatDate formats modification times and checksum, with
+// -checksums, returns the cached SHA-256 of a file. events reloads the page
+// on changes with -live, manage adds the buttons of -manage and uploadLimits
+// are shown by the upload form. look and mimeTypes are those of the server.
+type listingOptions struct {
+	base         string
+	basePath     string
+	thumbs       bool
+	upload       bool
+	gallery      bool
+	dirsFirst    bool
+	title        string
+	formatDate   func(t time.Time) string
+	paste        bool
+	checksum     func(name string) string
+	events       bool
+	manage       bool
+	uploadLimits uploadLimits
+	look         *look
+	mimeTypes    mimeTypes
+}
+
+var listingSorts = []struct{ key, label string }{
+	{"name", "Name"},
+	{"size", "Size"},
+	{"time", "Modified"},
+}
+
+// hasIndex reports whether the directory name has an index.html that
+// http.FileServer would serve instead of a listing.
+func hasIndex(fsys http.FileSystem, name string) bool {
+	f, err := fsys.Open(path.Join(name, "index.html"))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	return err == nil && !info.IsDir()
+}
+
+// serveListing renders the directory name of fsys, sorted by the sort (name,
+// size or time) and order (asc or desc) query parameters, directories first
+// with -dirs-first. With ?view=gallery, images, videos and audio are shown in
+// a grid after the other entries, playing inline. With ?format=json or an
+// Accept header preferring JSON, the entries are sent as JSON instead. A
+// directory of more than listingChunk entries listed without ?sort is
+// streamed in directory order as it's read.
+func serveListing(w http.ResponseWriter, r *http.Request, fsys http.FileSystem, name string, opts listingOptions) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		writeListingError(w, r, err)
+		return
+	}
+	defer f.Close()
+
+	query := r.URL.Query()
+	// Only the embedded template is known to show streamed listings, not
+	// those of -template-dir.
+	canStream := !query.Has("sort") && !wantsJSONListing(r) && !galleryView(query, opts) && r.Method != http.MethodHead && opts.look.listing == listingTemplate
+	var infos []fs.FileInfo
+	stream := false
+	for !stream {
+		chunk, err := f.Readdir(listingChunk)
+		infos = append(infos, chunk...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "500 error reading directory")
+			return
+		}
+		stream = canStream && len(infos) > listingChunk
+	}
+	var modTime time.Time
+	if info, err := f.Stat(); err == nil {
+		modTime = info.ModTime()
+	}
+
+	newEntry := func(info fs.FileInfo) listingEntry {
+		e := newListingEntry(info, opts.mimeTypes)
+		if opts.thumbs && !e.IsDir && hasThumb(e.Name) {
+			e.Thumb = thumbsURL(opts.basePath, name) + e.Href
+		}
+		if opts.checksum != nil && !e.IsDir {
+			e.Checksum = opts.checksum(path.Join(name, e.Name))
+		}
+		return e
+	}
+
+	title := name
+	if name != "/" {
+		title += "/"
+	}
+	page := listingPage{
+		Path:     title,
+		Base:     opts.base,
+		ZipHref:  archiveHref(r, "zip"),
+		TarHref:  archiveHref(r, "tar.gz"),
+		Archive:  opts.basePath + archivePath,
+		Search:   opts.basePath + searchPath,
+		SearchIn: title,
+		modTime:  modTime,
+	}
+	if name != "/" {
+		page.Parent = "../"
+	}
+	if opts.paste {
+		page.Paste = opts.basePath + pastePath
+	}
+	if opts.upload {
+		page.Upload = opts.basePath + tusPath
+		page.Accept = opts.uploadLimits.accept()
+		page.UploadHint = opts.uploadLimits.hint()
+		page.Script = template.HTML("<script>" + uploadScript + "</script>")
+	}
+	if opts.events {
+		page.Events = opts.basePath + eventsPath + "?" + url.Values{"dir": {title}}.Encode()
+		page.Script += template.HTML("<script>" + liveScript + "</script>")
+	}
+	if opts.manage {
+		page.Manage = opts.basePath + managePath
+		page.Script += template.HTML("<script>" + manageScript + "</script>")
+	}
+	if opts.checksum != nil {
+		page.Checksums = true
+		page.Script += template.HTML("<script>" + checksumScript + "</script>")
+	}
+
+	if stream {
+		streamListing(w, r, page, f, infos, newEntry, opts)
+		return
+	}
+	entries := make([]listingEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, newEntry(info))
+	}
+	renderListing(w, r, page, entries, opts)
+}
+
+// renderListing sorts entries and sends them in page, or as JSON.
+func renderListing(w http.ResponseWriter, r *http.Request, page listingPage, entries []listingEntry, opts listingOptions) {
+	query := r.URL.Query()
+	sortKey := query.Get("sort")
+	if !slices.ContainsFunc(listingSorts, func(s struct{ key, label string }) bool { return s.key == sortKey }) {
+		sortKey = "name"
+	}
+	desc := query.Get("order") == "desc"
+	gallery := galleryView(query, opts)
+
+	slices.SortFunc(entries, func(a, b listingEntry) int {
+		if opts.dirsFirst && a.IsDir != b.IsDir {
+			if a.IsDir {
+				return -1
+			}
+			return 1
+		}
+
+		var c int
+		switch sortKey {
+		case "size":
+			c = cmp.Compare(a.size, b.size)
+		case "time":
+			c = a.modTime.Compare(b.modTime)
+		}
+		if c == 0 {
+			c = strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		}
+		if desc {
+			return -c
+		}
+		return c
+	})
+
+	token := page.keepToken(query)
+	for i, e := range entries {
+		entries[i] = opts.finishEntry(e, token)
+	}
+
+	// A listing changes with its directory and entries, the ETag of
+	// serveGenerated catches the rest, like checksums computed meanwhile.
+	modTime := page.modTime
+	for _, e := range entries {
+		if e.modTime.After(modTime) {
+			modTime = e.modTime
+		}
+	}
+
+	w.Header().Add("Vary", "Accept")
+	if wantsJSONListing(r) {
+		list := make([]listingJSONEntry, 0, len(entries))
+		for _, e := range entries {
+			list = append(list, listingJSONEntry{
+				Name:    strings.TrimSuffix(e.Name, "/"),
+				Href:    e.Href,
+				Size:    e.size,
+				ModTime: e.modTime.UTC(),
+				Type:    e.mimeType,
+				IsDir:   e.IsDir,
+				SHA256:  e.Checksum,
+			})
+		}
+		body := map[string]any{"path": page.Path, "entries": list}
+		if page.Query != "" {
+			body["query"], body["truncated"] = page.Query, page.Truncated
+		}
+		b, err := json.Marshal(body)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "500 "+err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		serveGenerated(w, r, modTime, append(b, '\n'))
+		return
+	}
+
+	page.Entries = entries
+	if gallery {
+		page.Entries = slices.DeleteFunc(slices.Clone(entries), func(e listingEntry) bool { return e.Media != "" })
+		page.Media = slices.DeleteFunc(entries, func(e listingEntry) bool { return e.Media == "" })
+	}
+	page.finish(query, sortKey, desc, gallery, opts)
+
+	var b bytes.Buffer
+	if err := opts.look.listing.Execute(&b, page); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "500 "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	serveGenerated(w, r, modTime, b.Bytes())
+}
+
+// streamListing sends page with the entries of infos, then the rest of the
+// directory f, as they are read. The page is flushed every streamBuffer bytes,
+// so the first rows show up before the directory is read whole.
+func streamListing(w http.ResponseWriter, r *http.Request, page listingPage, f http.File, infos []fs.FileInfo, newEntry func(info fs.FileInfo) listingEntry, opts listingOptions) {
+	query := r.URL.Query()
+	token := page.keepToken(query)
+	page.finish(query, "", false, false, opts)
+
+	rows := make(chan listingEntry, listingChunk)
+	page.stream = rows
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(rows)
+		for {
+			for _, info := range infos {
+				select {
+				case rows <- opts.finishEntry(newEntry(info), token):
+				case <-done:
+					return
+				}
+			}
+			var err error
+			if infos, err = f.Readdir(listingChunk); err != nil && len(infos) == 0 {
+				return
+			}
+		}
+	}()
+	defer wg.Wait()
+	defer close(done)
+
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	b := bufio.NewWriterSize(flushWriter{w}, streamBuffer)
+	if opts.look.listing.Execute(b, page) == nil {
+		b.Flush()
+	}
+}
+
+// flushWriter sends what's written to the client right away.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	http.NewResponseController(fw.w).Flush()
+	return n, err
+}
+
+// galleryView reports whether query asks for the gallery, or -gallery made it
+// the default.
+func galleryView(query url.Values, opts listingOptions) bool {
+	return query.Get("view") == "gallery" || opts.gallery && query.Get("view") != "list"
+}
+
+// keepToken makes the links of a token dir opened with ?token= keep it, so
+// following them doesn't need the token again, and returns it encoded for
+// the entries.
+func (page *listingPage) keepToken(query url.Values) string {
+	if page.Token = query.Get("token"); page.Token == "" {
+		return ""
+	}
+	token := url.Values{"token": {page.Token}}.Encode()
+	page.Parent = withQuery(page.Parent, token)
+	page.Back = withQuery(page.Back, token)
+	page.Archive = withQuery(page.Archive, token)
+	return token
+}
+
+// finishEntry formats the time of e and adds the encoded token to its links.
+func (opts listingOptions) finishEntry(e listingEntry, token string) listingEntry {
+	if opts.formatDate != nil {
+		e.ModTime = opts.formatDate(e.modTime)
+	}
+	e.InlineHref = withQuery(e.Href, "inline", token)
+	e.ChecksumHref = withQuery(e.Href, "checksum=sha256", token)
+	e.Href = withQuery(e.Href, token)
+	e.Thumb = withQuery(e.Thumb, token)
+	return e
+}
+
+// finish fills in the title, style and links of page, sorted by sortKey.
+func (page *listingPage) finish(query url.Values, sortKey string, desc, gallery bool, opts listingOptions) {
+	page.Title = strings.ReplaceAll(opts.title, "{path}", page.Path)
+	page.Style = template.HTML(opts.look.style)
+	view := url.Values{}
+	for key, values := range query {
+		view[key] = values
+	}
+	if gallery {
+		view.Set("view", "list")
+		page.View = listingColumn{Label: "List", Href: "?" + view.Encode()}
+	} else {
+		view.Set("view", "gallery")
+		page.View = listingColumn{Label: "Gallery", Href: "?" + view.Encode()}
+	}
+	for _, s := range listingSorts {
+		column := listingColumn{Label: s.label}
+		order := "asc"
+		if s.key == sortKey {
+			column.Arrow = "▲"
+			if !desc {
+				order = "desc"
+			} else {
+				column.Arrow = "▼"
+			}
+		}
+		query.Set("sort", s.key)
+		query.Set("order", order)
+		column.Href = "?" + query.Encode()
+		page.Columns = append(page.Columns, column)
+	}
+}
+
+// listingTitle returns -title with {folder} replaced by the name of the
+// served folder, leaving {path} to each listing.
+func (args Args) listingTitle() string {
+	folder, err := filepath.Abs(args.folder)
+	if err != nil {
+		folder = args.folder
+	}
+	return strings.ReplaceAll(args.title, "{folder}", filepath.Base(folder))
+}
+
+// withQuery appends the non-empty encoded params to href.
+func withQuery(href string, params ...string) string {
+	params = slices.DeleteFunc(params, func(p string) bool { return p == "" })
+	if len(params) == 0 || href == "" {
+		return href
+	}
+	return href + "?" + strings.Join(params, "&")
+}
+
+// wantsJSONListing reports whether r asks for a listing as JSON.
+func wantsJSONListing(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "json" || prefersJSON(r)
+}
+
+func newListingEntry(info fs.FileInfo, types mimeTypes) listingEntry {
+	e := listingEntry{
+		Name:    info.Name(),
+		IsDir:   info.IsDir(),
+		Size:    "-",
+		ModTime: info.ModTime().Format("2006-01-02 15:04"),
+		size:    info.Size(),
+		modTime: info.ModTime(),
+	}
+
+	href := e.Name
+	if e.IsDir {
+		e.Name += "/"
+		href += "/"
+		e.Icon = "📁"
+	} else {
+		e.Size = formatSize(uint64(info.Size()))
+		e.mimeType = types.typeOf(e.Name)
+		e.Icon = mimeIcon(e.mimeType)
+		if category, _, _ := strings.Cut(e.mimeType, "/"); category == "image" || category == "video" || category == "audio" {
+			e.Media = category
+		}
+	}
+	// Like http.FileServer, so a colon in the name isn't taken for a scheme.
+	e.Href = (&url.URL{Path: href}).String()
+	return e
+}
+
+func mimeIcon(mimeType string) string {
+	mediaType, _, _ := strings.Cut(mimeType, ";")
+	switch category, subtype, _ := strings.Cut(mediaType, "/"); {
+	case category == "image":
+		return "🖼"
+	case category == "video":
+		return "🎞"
+	case category == "audio":
+		return "🎵"
+	case subtype == "pdf":
+		return "📕"
+	case slices.Contains([]string{"zip", "gzip", "x-tar", "x-7z-compressed", "x-rar-compressed", "x-bzip2", "x-xz", "zstd"}, subtype):
+		return "📦"
+	case category == "text" || subtype == "json" || subtype == "xml" || subtype == "javascript":
+		return "📝"
+	default:
+		return "📄"
+	}
+}
+
+func writeListingError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		writeError(w, r, http.StatusNotFound, "404 page not found")
+	case errors.Is(err, fs.ErrPermission):
+		writeError(w, r, http.StatusForbidden, "403 Forbidden")
+	default:
+		writeError(w, r, http.StatusInternalServerError, "500 Internal Server Error")
+	}
+}
+
+var listingTemplate = template.Must(template.New("listing").Parse(`<!doctype html>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width">
+{{- with .Base}}
+<base href="{{.}}">
+{{- end}}
+<title>{{with .Query}}Search for {{.}} in {{end}}{{with .Title}}{{.}}{{else}}{{.Path}}{{end}}</title>
+{{- with .Title}}
+<h1>{{.}}</h1>
+{{- end}}
+{{- with .Search}}
+<form class="search" action="{{.}}"><input type="search" name="q" value="{{$.Query}}" placeholder="Search {{$.SearchIn}}"><input type="hidden" name="in" value="{{$.SearchIn}}">{{with $.Token}}<input type="hidden" name="token" value="{{.}}">{{end}}</form>
+{{- end}}
+<table class="listing"{{with .Events}} data-events="{{.}}"{{end}}{{with .Manage}} data-manage="{{.}}" data-dir="{{$.Path}}"{{end}}>
+<thead><tr>{{if .Archive}}<th></th>{{end}}<th></th>{{range .Columns}}<th><a href="{{.Href}}">{{.Label}}</a> {{.Arrow}}</th>{{end}}{{if .Checksums}}<th>SHA-256</th>{{end}}{{if .Manage}}<th></th>{{end}}</tr></thead>
+<tbody>
+{{- if .Parent}}
+<tr>{{if .Archive}}<td></td>{{end}}<td class="icon">↩</td><td><a href="{{.Parent}}">../</a></td><td></td><td></td></tr>
+{{- end}}
+{{- range .Rows}}
+<tr{{if $.Manage}} data-name="{{.Name}}"{{end}}>{{if $.Archive}}<td><input type="checkbox" name="path" value="{{.Name}}" form="archive"></td>{{end}}<td class="icon">{{if .Thumb}}<img class="thumb" src="{{.Thumb}}" alt="" loading="lazy" decoding="async">{{else}}{{.Icon}}{{end}}</td><td><a href="{{.Href}}">{{.Name}}</a></td><td class="size">{{.Size}}</td><td class="time">{{.ModTime}}</td>{{if $.Checksums}}<td>{{if not .IsDir}}<a class="checksum" href="{{.ChecksumHref}}" data-sum="{{.Checksum}}" title="{{.Checksum}}">{{with .Checksum}}{{slice . 0 8}}…{{else}}sha256{{end}}</a>{{end}}</td>{{end}}{{if $.Manage}}<td class="manage"><button data-manage="rename" title="Rename">✎</button><button data-manage="move" title="Move">⇥</button><button data-manage="delete" title="Delete">✕</button></td>{{end}}</tr>
+{{- end}}
+</tbody>
+</table>
+{{- with .Media}}
+<div class="gallery">
+{{- range $i, $e := .}}
+{{- if eq .Media "image"}}
+<a href="#media-{{$i}}"><img src="{{with .Thumb}}{{.}}{{else}}{{$e.InlineHref}}{{end}}" alt="{{.Name}}" title="{{.Name}}" loading="lazy" decoding="async"></a>
+<a class="lightbox" id="media-{{$i}}" href="#_"><img src="{{.InlineHref}}" alt="{{.Name}}" loading="lazy" decoding="async"></a>
+{{- else if eq .Media "video"}}
+<figure><video src="{{.InlineHref}}" controls preload="metadata"></video><figcaption><a href="{{.Href}}">{{.Name}}</a></figcaption></figure>
+{{- else}}
+<figure><audio src="{{.InlineHref}}" controls preload="none"></audio><figcaption><a href="{{.Href}}">{{.Name}}</a></figcaption></figure>
+{{- end}}
+{{- end}}
+</div>
+{{- end}}
+{{- if .Query}}
+<p class="actions">{{if .Truncated}}There are more matches, try a longer search. {{end}}<a href="{{.Back}}">Back to {{.SearchIn}}</a> · <a href="{{.View.Href}}">{{.View.Label}}</a></p>
+{{- else}}
+<p class="actions">{{with .ZipHref}}Download as <a href="{{.}}">zip</a> or <a href="{{$.TarHref}}">tar.gz</a> · {{end}}<a href="{{.View.Href}}">{{.View.Label}}</a>{{with .Paste}} · <a href="{{.}}">Paste text</a>{{end}}{{if .Manage}} · <button data-manage="mkdir">New folder</button>{{end}}</p>
+{{- end}}
+{{- with .Archive}}
+<form id="archive" class="actions" method="post" action="{{.}}"><input type="hidden" name="dir" value="{{$.Path}}"><button name="format" value="zip">Download selected as zip</button> <button name="format" value="tar.gz">or tar.gz</button></form>
+{{- end}}
+{{- with .Upload}}
+<form class="upload" method="post" enctype="multipart/form-data" data-endpoint="{{.}}" data-dir="{{$.Path}}">
+<input type="file" name="file" multiple required{{with $.Accept}} accept="{{.}}"{{end}}>
+<button>Upload</button> or drop files here{{with $.UploadHint}} ({{.}}){{end}}
+<ul class="progress"></ul>
+</form>
+{{- end}}
+{{.Style}}
+{{.Script}}
+`))
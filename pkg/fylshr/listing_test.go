@@ -0,0 +1,329 @@
+package fylshr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var entryLink = regexp.MustCompile(`(?:href|src)="([^"#]+)"`)
+
+// TestListingKeepsToken checks that the links of a token dir opened with
+// ?token= carry it and work.
+func TestListingKeepsToken(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"sec/" + tokenFile: "s3cret",
+		"sec/a.txt":        "hello",
+		"sec/photo.png":    "",
+		"sec/song.mp3":     "",
+		"sec/sub/b.txt":    "nested",
+	})
+	srv := newTestServer(t, dir, "-checksums", "-thumbnails")
+
+	for _, path := range []string{"/sec/?token=s3cret", "/sec/sub/?token=s3cret", "/sec/?token=s3cret&view=gallery"} {
+		resp, body := do(t, srv, http.MethodGet, path, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s = %d", path, resp.StatusCode)
+		}
+		links := entryLink.FindAllStringSubmatch(body, -1)
+		if len(links) == 0 {
+			t.Fatalf("GET %s has no links", path)
+		}
+		for _, m := range links {
+			link, err := resp.Request.URL.Parse(strings.ReplaceAll(m[1], "&amp;", "&"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if link.Query().Get("token") != "s3cret" {
+				t.Errorf("GET %s links to %s without the token", path, m[1])
+				continue
+			}
+			if resp, _ := do(t, srv, http.MethodGet, link.RequestURI(), nil); resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound {
+				t.Errorf("GET %s link %s = %d", path, m[1], resp.StatusCode)
+			}
+		}
+	}
+
+	resp, body := do(t, srv, http.MethodGet, "/sec/?token=s3cret&format=json", nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, `"href":"a.txt?`+url.Values{"token": {"s3cret"}}.Encode()+`"`) {
+		t.Errorf("GET /sec/ as JSON = %d %s, want hrefs with the token", resp.StatusCode, body)
+	}
+}
+
+func TestListingDirsFirst(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "12345", "c.txt": "1", "b/": "", "d/": ""})
+	for name, mtime := range map[string]int{"a.txt": 1, "b": 2, "c.txt": 3, "d": 4} {
+		at := time.Unix(int64(mtime)*3600, 0)
+		if err := os.Chtimes(filepath.Join(dir, name), at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		dirsFirst bool
+		query     string
+		want      string
+	}{
+		{true, "sort=name", "b d a.txt c.txt"},
+		{true, "sort=name&order=desc", "d b c.txt a.txt"},
+		{true, "sort=size&order=desc", "d b a.txt c.txt"},
+		{true, "sort=time", "b d a.txt c.txt"},
+		{true, "sort=time&order=desc", "d b c.txt a.txt"},
+		{false, "sort=name", "a.txt b c.txt d"},
+		{false, "sort=name&order=desc", "d c.txt b a.txt"},
+		{false, "sort=time", "a.txt b c.txt d"},
+		{false, "sort=time&order=desc", "d c.txt b a.txt"},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, "-dirs-first="+strconv.FormatBool(tt.dirsFirst))
+		_, body := do(t, srv, http.MethodGet, "/?format=json&"+tt.query, nil)
+		var listing struct {
+			Entries []struct{ Name string }
+		}
+		if err := json.Unmarshal([]byte(body), &listing); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range listing.Entries {
+			names = append(names, e.Name)
+		}
+		if got := strings.Join(names, " "); got != tt.want {
+			t.Errorf("-dirs-first=%v ?%s = %s, want %s", tt.dirsFirst, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestListingTitle(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "photos")
+	writeFiles(t, dir, map[string]string{"sub/a.txt": "hello"})
+
+	tests := []struct {
+		title, path string
+		want        string
+	}{
+		{"{folder}{path}", "/sub/", "<title>photos/sub/</title>\n<h1>photos/sub/</h1>"},
+		{"Files in {path}", "/sub/", "<title>Files in /sub/</title>\n<h1>Files in /sub/</h1>"},
+		{"My share", "/", "<title>My share</title>\n<h1>My share</h1>"},
+		{"", "/sub/", "<title>/sub/</title>"},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, "-title", tt.title)
+		if _, body := do(t, srv, http.MethodGet, tt.path, nil); !strings.Contains(body, tt.want) || tt.title == "" && strings.Contains(body, "<h1>") {
+			t.Errorf("-title %q GET %s = %s, want %q", tt.title, tt.path, body, tt.want)
+		}
+	}
+}
+
+// hugeDir creates a folder of n files, more than listingChunk so listings of
+// it are streamed, and a hidden one.
+func hugeDir(tb testing.TB, n int) string {
+	tb.Helper()
+	dir := tb.TempDir()
+	for i := range n {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%05d.txt", i)), nil, 0o644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("SECRET=1"), 0o644); err != nil {
+		tb.Fatal(err)
+	}
+	return dir
+}
+
+func TestListingStream(t *testing.T) {
+	const n = 2*listingChunk + 10
+	srv := newTestServer(t, hugeDir(t, n))
+
+	tests := []struct {
+		path     string
+		streamed bool
+	}{
+		{"/", true},
+		{"/?token=x", true},
+		{"/?sort=name", false},
+		{"/?view=gallery", false},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, srv, http.MethodGet, tt.path, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s = %d", tt.path, resp.StatusCode)
+		}
+		if streamed := resp.Header.Get("ETag") == ""; streamed != tt.streamed {
+			t.Errorf("GET %s streamed %v, want %v", tt.path, streamed, tt.streamed)
+		}
+		if rows := strings.Count(body, `<td class="size">`); rows != n {
+			t.Errorf("GET %s has %d rows, want %d", tt.path, rows, n)
+		}
+		if !strings.Contains(body, `href="f00042.txt`) || strings.Contains(body, ".env") || !strings.HasSuffix(strings.TrimSpace(body), "</style>") {
+			t.Errorf("GET %s isn't a whole listing of the files", tt.path)
+		}
+	}
+
+	if _, body := do(t, srv, http.MethodGet, "/?token=x", nil); !strings.Contains(body, `href="f00042.txt?token=x"`) {
+		t.Errorf("streamed listing links lose the token")
+	}
+}
+
+func BenchmarkListing(b *testing.B) {
+	srv := httptest.NewServer(newHandler(testArgs(b, hugeDir(b, 20*listingChunk))))
+	defer srv.Close()
+	for _, path := range []string{"/", "/?sort=name"} {
+		b.Run(path, func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				resp, err := http.Get(srv.URL + path)
+				if err != nil {
+					b.Fatal(err)
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+		})
+	}
+}
+
+func TestListingJSON(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "photo.png": "", "sub/b.txt": "nested", ".env": "SECRET=1"})
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(dir, "a.txt"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, dir, "-base-path", "/share")
+
+	for _, request := range []struct {
+		target, accept string
+	}{
+		{"/share/?format=json", ""},
+		{"/share/", "application/json"},
+		{"/share/?format=json", "text/html"},
+	} {
+		resp, body := do(t, srv, http.MethodGet, request.target, nil, "Accept: "+request.accept)
+		if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+			t.Fatalf("GET %s Accept %q = %d %s, want 200 JSON", request.target, request.accept, resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		var listing struct {
+			Path    string
+			Entries []listingJSONEntry
+		}
+		if err := json.Unmarshal([]byte(body), &listing); err != nil {
+			t.Fatalf("GET %s: %s in %s", request.target, err, body)
+		}
+		got := map[string]listingJSONEntry{}
+		for _, e := range listing.Entries {
+			got[e.Name] = e
+		}
+		want := map[string]listingJSONEntry{
+			"a.txt":     {Name: "a.txt", Href: "a.txt", Size: 5, ModTime: modTime, Type: "text/plain; charset=utf-8"},
+			"photo.png": {Name: "photo.png", Href: "photo.png", Type: "image/png"},
+			"sub":       {Name: "sub", Href: "sub/", IsDir: true},
+		}
+		if listing.Path != "/" || len(got) != len(want) {
+			t.Errorf("GET %s = %s, want the 3 entries of /", request.target, body)
+		}
+		for name, w := range want {
+			e := got[name]
+			if e.Href != w.Href || e.IsDir != w.IsDir || e.Type != w.Type || !w.IsDir && e.Size != w.Size || !w.ModTime.IsZero() && !e.ModTime.Equal(w.ModTime) {
+				t.Errorf("GET %s has %s %+v, want %+v", request.target, name, e, w)
+			}
+		}
+	}
+
+	if resp, body := do(t, srv, http.MethodGet, "/share/", nil, "Accept: text/html,application/json;q=0.9"); strings.HasPrefix(body, "{") {
+		t.Errorf("GET / preferring HTML = %d %s, want the page", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
+
+// TestLazyImages checks that no image of a listing or gallery loads before it
+// scrolls into view, or holds up the page while it's decoded.
+func TestLazyImages(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.png": "", "b.jpg": "", "c.txt": "hello"})
+	img := regexp.MustCompile(`<img [^>]*>`)
+
+	for _, path := range []string{"/", "/?view=gallery"} {
+		for _, flags := range [][]string{nil, {"-thumbnails"}} {
+			srv := newTestServer(t, dir, flags...)
+			_, body := do(t, srv, http.MethodGet, path, nil)
+			images := img.FindAllString(body, -1)
+			if len(flags) > 0 && len(images) == 0 || path != "/" && len(images) < 4 {
+				t.Errorf("%v GET %s has images %q", flags, path, images)
+			}
+			for _, tag := range images {
+				if !strings.Contains(tag, `loading="lazy"`) || !strings.Contains(tag, `decoding="async"`) {
+					t.Errorf("%v GET %s has %s, want it lazy and decoded asynchronously", flags, path, tag)
+				}
+			}
+		}
+	}
+}
+
+// TestGallery checks when listings are shown as a gallery, and that its
+// players get the media inline with ranges.
+func TestGallery(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"photo.png": "", "clip.mp4": "0123456789", "song.mp3": "", "notes.txt": "hello"})
+
+	tests := []struct {
+		flags   []string
+		path    string
+		gallery bool
+	}{
+		{nil, "/", false},
+		{nil, "/?view=gallery", true},
+		{[]string{"-gallery"}, "/", true},
+		{[]string{"-gallery"}, "/?view=list", false},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, tt.flags...)
+		_, body := do(t, srv, http.MethodGet, tt.path, nil)
+		if gallery := strings.Contains(body, `<div class="gallery">`); gallery != tt.gallery {
+			t.Errorf("%v GET %s shows a gallery %v, want %v", tt.flags, tt.path, gallery, tt.gallery)
+		}
+		if !tt.gallery {
+			continue
+		}
+		for _, want := range []string{`<video src="clip.mp4?inline"`, `<audio src="song.mp3?inline"`, `<a class="lightbox" id="media-`, `src="photo.png?inline"`} {
+			if !strings.Contains(body, want) {
+				t.Errorf("%v GET %s gallery has no %s", tt.flags, tt.path, want)
+			}
+		}
+		if gallery := body[strings.Index(body, `<div class="gallery">`):]; strings.Contains(gallery[:strings.Index(gallery, "</div>")], "notes.txt") {
+			t.Errorf("%v GET %s gallery shows notes.txt", tt.flags, tt.path)
+		}
+	}
+
+	srv := newTestServer(t, dir)
+	requests := []struct {
+		path, header string
+		status       int
+		attachment   bool
+	}{
+		{"/clip.mp4", "", http.StatusOK, true},
+		{"/clip.mp4?inline", "", http.StatusOK, false},
+		{"/clip.mp4?inline", "Range: bytes=2-5", http.StatusPartialContent, false},
+	}
+	for _, req := range requests {
+		var headers []string
+		if req.header != "" {
+			headers = append(headers, req.header)
+		}
+		resp, _ := do(t, srv, http.MethodGet, req.path, nil, headers...)
+		if attachment := strings.HasPrefix(resp.Header.Get("Content-Disposition"), "attachment"); resp.StatusCode != req.status || attachment != req.attachment {
+			t.Errorf("GET %s %s = %d Content-Disposition %q, want %d attachment %v", req.path, req.header, resp.StatusCode, resp.Header.Get("Content-Disposition"), req.status, req.attachment)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+// Reloads the listing when a file in its folder changes, once no upload from
+// this page is still running.
+(() => {
+  const table = document.querySelector("table.listing[data-events]")
+  if (!table || !window.EventSource) return
+
+  const url = new URL(table.dataset.events, location.href)
+  const token = new URLSearchParams(location.search).get("token")
+  if (token) url.searchParams.set("token", token)
+
+  let timer
+  const reload = () => {
+    clearTimeout(timer)
+    timer = setTimeout(() => {
+      if (document.querySelector(".upload .progress li:not(.done):not(.error)")) reload()
+      else location.reload()
+    }, 500)
+  }
+  new EventSource(url).addEventListener("change", reload)
+})()
@@ -0,0 +1,283 @@
+package fylshr
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// withDebug dumps every request and response header block to stderr. It
+// returns h untouched when disabled so it costs nothing on the normal path.
+func withDebug(enabled bool, h http.Handler) http.Handler {
+	if !enabled {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r)
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "> %s %s %s\n", r.Method, redactToken(r.RequestURI), r.Proto)
+		fmt.Fprintf(&b, "> Host: %s\n", r.Host)
+		writeHeaders(&b, "> ", r.Header)
+		status := cmp.Or(sw.status, http.StatusOK)
+		fmt.Fprintf(&b, "< %d %s\n", status, http.StatusText(status))
+		writeHeaders(&b, "< ", w.Header())
+		fmt.Fprintf(os.Stderr, "\x1b[2m%s\x1b[0m\n", b.String())
+	})
+}
+
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Token"}
+
+func writeHeaders(w io.Writer, prefix string, h http.Header) {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		for _, value := range h[name] {
+			if slices.Contains(redactedHeaders, name) {
+				value = "[redacted]"
+			} else if name == "Referer" || name == "Location" {
+				value = redactToken(value)
+			}
+			fmt.Fprintf(w, "%s%s: %s\n", prefix, name, value)
+		}
+	}
+}
+
+// statusWriter records the status code and body size written through it, and
+// why the request was blocked if it was.
+type statusWriter struct {
+	http.ResponseWriter
+	status   int
+	bytes    int64
+	transfer *transfer
+	blocked  string
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.wroteHeader(status)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// wroteHeader records the status, and the length of the response for its
+// progress line.
+func (w *statusWriter) wroteHeader(status int) {
+	w.status = status
+	if w.transfer != nil {
+		w.transfer.sized(w.Header())
+	}
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.wroteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	if w.transfer != nil {
+		w.transfer.bytes.Add(int64(n))
+	}
+	return n, err
+}
+
+// ReadFrom counts the bytes http.FileServer copies from a file, while still
+// letting the underlying writer's ReadFrom send them.
+func (w *statusWriter) ReadFrom(src io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.wroteHeader(http.StatusOK)
+	}
+	if w.transfer == nil {
+		n, err := io.Copy(w.ResponseWriter, src)
+		w.bytes += n
+		return n, err
+	}
+
+	// Copying in chunks lets the progress line move. Each chunk is an
+	// io.LimitedReader, which sendfile still accepts.
+	var total int64
+	for {
+		n, err := io.CopyN(w.ResponseWriter, src, progressChunk)
+		total += n
+		w.bytes += n
+		w.transfer.bytes.Add(n)
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func logRequest(w *statusWriter, r *http.Request, args Args, start time.Time) {
+	userAgent := r.Header.Get("User-Agent")
+	if args.parseUA && userAgent != "" {
+		userAgent = parseUserAgentCached(userAgent).String()
+	}
+
+	out := io.Writer(os.Stdout)
+	color := args.color
+	if args.logFile != nil {
+		out, color = args.logFile, false
+	} else if args.tui != nil {
+		args.tui.record(requestEvent{
+			time:   start,
+			method: r.Method,
+			path:   r.URL.Path,
+			status: cmp.Or(w.status, http.StatusOK),
+			bytes:  w.bytes,
+		})
+		return
+	} else if args.progress != nil {
+		args.progress.Lock()
+		defer args.progress.Unlock()
+		args.progress.clear()
+	}
+
+	switch args.logFormat {
+	case "clf", "combined":
+		fmt.Fprintln(out, commonLogLine(w, r, start, args.logFormat == "combined"))
+	case "json":
+		b, _ := json.Marshal(newAccessRecord(w, r, start))
+		out.Write(append(b, '\n'))
+	default:
+		blocked := ""
+		if w.blocked != "" {
+			blocked = " \x1b[38;5;203mblocked: " + w.blocked + "\x1b[0m"
+		}
+		colorFprintf(
+			out,
+			color,
+			"\x1b[1m\x1b[38;5;228m%s %s%d \x1b[38;5;195m%s\x1b[0m %s \x1b[2m%s %s\x1b[0m \x1b[38;5;225m%s\x1b[0m | \x1b[38;5;158m%s\x1b[0m%s\n",
+			r.Method,
+			statusColor(w.status),
+			cmp.Or(w.status, http.StatusOK),
+			r.Proto,
+			r.URL.Path,
+			formatSize(uint64(w.bytes)),
+			time.Since(start).Round(time.Microsecond),
+			r.RemoteAddr,
+			userAgent,
+			blocked,
+		)
+	}
+}
+
+func statusColor(status int) string {
+	switch {
+	case status >= 500:
+		return "\x1b[38;5;203m"
+	case status >= 400:
+		return "\x1b[38;5;221m"
+	case status >= 300:
+		return "\x1b[38;5;117m"
+	default:
+		return "\x1b[38;5;120m"
+	}
+}
+
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// colorPrintf prints like fmt.Printf, dropping the ANSI colors when color is
+// false.
+func colorPrintf(color bool, format string, a ...any) {
+	colorFprintf(os.Stdout, color, format, a...)
+}
+
+// colorFprintf is colorPrintf to w, in a single write so concurrent lines
+// don't interleave.
+func colorFprintf(w io.Writer, color bool, format string, a ...any) {
+	s := fmt.Sprintf(format, a...)
+	if !color {
+		s = ansiEscape.ReplaceAllString(s, "")
+	}
+	io.WriteString(w, s)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+var logFormats = []string{"pretty", "json", "clf", "combined"}
+
+// commonLogLine formats a request in the Common Log Format, with the referer
+// and user agent appended when combined is set.
+func commonLogLine(w *statusWriter, r *http.Request, t time.Time, combined bool) string {
+	size := "-"
+	if w.bytes > 0 {
+		size = strconv.FormatInt(w.bytes, 10)
+	}
+
+	line := fmt.Sprintf(
+		"%s - - [%s] %q %d %s",
+		clientIP(r),
+		t.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method+" "+redactToken(r.RequestURI)+" "+r.Proto,
+		cmp.Or(w.status, http.StatusOK),
+		size,
+	)
+	if combined {
+		line += fmt.Sprintf(" %q %q", cmp.Or(redactToken(r.Referer()), "-"), cmp.Or(r.UserAgent(), "-"))
+	}
+
+	return line
+}
+
+// redactToken returns the URL, request URI or query string u with the value
+// of its token parameters replaced, so the secret of -token and token
+// directories stays out of logs. The rest is left as sent.
+func redactToken(u string) string {
+	prefix, query, ok := strings.Cut(u, "?")
+	if !ok {
+		if strings.Contains(u, "/") {
+			return u
+		}
+		prefix, query = "", u
+	} else {
+		prefix += "?"
+	}
+	query, fragment, hasFragment := strings.Cut(query, "#")
+
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		key, _, _ := strings.Cut(param, "=")
+		if key, err := url.QueryUnescape(key); err == nil && key == "token" {
+			params[i] = "token=REDACTED"
+		}
+	}
+	u = prefix + strings.Join(params, "&")
+	if hasFragment {
+		u += "#" + fragment
+	}
+	return u
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
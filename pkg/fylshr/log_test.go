@@ -0,0 +1,246 @@
+package fylshr
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactToken(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"/a.txt", "/a.txt"},
+		{"/a.txt?token=s3cret", "/a.txt?token=REDACTED"},
+		{"/?sort=size&token=s3cret&order=desc", "/?sort=size&token=REDACTED&order=desc"},
+		{"/?token=a&token=b", "/?token=REDACTED&token=REDACTED"},
+		{"/?tok%65n=s3cret", "/?token=REDACTED"},
+		{"/?tokens=1&mytoken=2", "/?tokens=1&mytoken=2"},
+		{"token=s3cret&zip", "token=REDACTED&zip"},
+		{"", ""},
+		{"http://host/sub/?token=s3cret#top", "http://host/sub/?token=REDACTED#top"},
+	}
+	for _, tt := range tests {
+		if got := redactToken(tt.in); got != tt.want {
+			t.Errorf("redactToken(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLogsRedactToken(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/sec/a.txt?token=s3cret", nil)
+	r.Header.Set("Referer", "http://host/sec/?token=s3cret")
+	w := &statusWriter{ResponseWriter: httptest.NewRecorder(), status: http.StatusOK}
+
+	record := newAccessRecord(w, r, time.Now())
+	lines := map[string]string{
+		"combined":      commonLogLine(w, r, time.Now(), true),
+		"json query":    record.Query,
+		"json referer":  record.Referer,
+		"debug headers": func() string { var b strings.Builder; writeHeaders(&b, "> ", r.Header); return b.String() }(),
+	}
+	for name, line := range lines {
+		if strings.Contains(line, "s3cret") || !strings.Contains(line, "token=REDACTED") {
+			t.Errorf("%s log %q, want the token redacted", name, line)
+		}
+	}
+}
+
+func TestDebug(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "sub/": ""})
+	srv := newTestServer(t, dir, "-debug")
+
+	tests := []struct {
+		path    string
+		headers []string
+		want    []string
+	}{
+		{"/a.txt?token=s3cret", []string{"Authorization: Bearer s3cret", "X-Custom: yes"}, []string{
+			"> GET /a.txt?token=REDACTED HTTP/1.1\n> Host: 127.0.0.1:",
+			"> Authorization: [redacted]\n",
+			"> X-Custom: yes\n",
+			"< 200 OK\n",
+			"< Content-Type: text/plain; charset=utf-8\n",
+		}},
+		{"/missing.txt", []string{"Cookie: session=1"}, []string{"> Cookie: [redacted]\n", "< 404 Not Found\n"}},
+		{"/sub?token=s3cret", nil, []string{"< 301 Moved Permanently\n", "< Location: sub/?token=REDACTED\n"}},
+	}
+	for _, tt := range tests {
+		got := capture(t, &os.Stderr, func() { do(t, srv, http.MethodGet, tt.path, nil, tt.headers...) })
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("GET %s dumps %q, want %q", tt.path, got, want)
+			}
+		}
+		if strings.Contains(got, "s3cret") || strings.Contains(got, "session=1") {
+			t.Errorf("GET %s dumps a secret: %q", tt.path, got)
+		}
+	}
+
+	srv = newTestServer(t, dir)
+	if got := capture(t, &os.Stderr, func() { do(t, srv, http.MethodGet, "/a.txt", nil) }); got != "" {
+		t.Errorf("GET /a.txt without -debug dumps %q", got)
+	}
+}
+
+func TestCommonLogLine(t *testing.T) {
+	at := time.Date(2024, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*3600))
+	tests := []struct {
+		format, target string
+		headers        bool
+		status         int
+		bytes          int64
+		want           string
+	}{
+		{"clf", "/a.txt", true, http.StatusOK, 2326, `192.0.2.1 - - [10/Oct/2024:13:55:36 -0700] "GET /a.txt HTTP/1.1" 200 2326` + "\n"},
+		{"clf", "/missing.txt", true, http.StatusNotFound, 0, `192.0.2.1 - - [10/Oct/2024:13:55:36 -0700] "GET /missing.txt HTTP/1.1" 404 -` + "\n"},
+		{"combined", "/a.txt?token=s3cret", true, 0, 5, `192.0.2.1 - - [10/Oct/2024:13:55:36 -0700] "GET /a.txt?token=REDACTED HTTP/1.1" 200 5 "http://host/?token=REDACTED" "curl/8.0"` + "\n"},
+		{"combined", "/a.txt", false, 0, 5, `192.0.2.1 - - [10/Oct/2024:13:55:36 -0700] "GET /a.txt HTTP/1.1" 200 5 "-" "-"` + "\n"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		if tt.headers {
+			r.Header.Set("Referer", "http://host/?token=s3cret")
+			r.Header.Set("User-Agent", "curl/8.0")
+		}
+		w := &statusWriter{ResponseWriter: httptest.NewRecorder(), status: tt.status, bytes: tt.bytes}
+		var out strings.Builder
+		logRequest(w, r, Args{logFormat: tt.format, logFile: &out}, at)
+		if got := out.String(); got != tt.want {
+			t.Errorf("-log-format %s GET %s logs %q, want %q", tt.format, tt.target, got, tt.want)
+		}
+	}
+}
+
+// TestStatusColor checks that the status of a pretty log line has the color
+// of its class, and that -no-color leaves it plain.
+func TestStatusColor(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{0, "\x1b[38;5;120m200 "},
+		{http.StatusOK, "\x1b[38;5;120m200 "},
+		{http.StatusPartialContent, "\x1b[38;5;120m206 "},
+		{http.StatusNotModified, "\x1b[38;5;117m304 "},
+		{http.StatusNotFound, "\x1b[38;5;221m404 "},
+		{http.StatusTooManyRequests, "\x1b[38;5;221m429 "},
+		{http.StatusInternalServerError, "\x1b[38;5;203m500 "},
+		{http.StatusServiceUnavailable, "\x1b[38;5;203m503 "},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+		w := &statusWriter{ResponseWriter: httptest.NewRecorder(), status: tt.status}
+		if got := capture(t, &os.Stdout, func() { logRequest(w, r, Args{color: true}, time.Now()) }); !strings.Contains(got, "GET "+tt.want) {
+			t.Errorf("status %d logs %q, want %q", tt.status, got, tt.want)
+		}
+		if got := capture(t, &os.Stdout, func() { logRequest(w, r, Args{}, time.Now()) }); strings.Contains(got, "\x1b") {
+			t.Errorf("status %d without colors logs %q", tt.status, got)
+		}
+	}
+}
+
+func TestQuietPaths(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "health/ok.txt": "ok", "assets/app.js": "", "assets/app.css": ""})
+	h := newHandler(testArgs(t, dir, "-silent=false", "-quiet-paths", "/health/,/assets/*.js,/favicon.ico"))
+
+	tests := []struct {
+		path   string
+		logged bool
+	}{
+		{"/a.txt", true},
+		{"/health/ok.txt", false},
+		{"/health/missing.txt", false},
+		{"/healthy", true},
+		{"/assets/app.js", false},
+		{"/assets/app.css", true},
+		{"/favicon.ico", false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		got := capture(t, &os.Stdout, func() { h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil)) })
+		if logged := strings.Contains(got, " "+tt.path+" "); logged != tt.logged {
+			t.Errorf("-quiet-paths GET %s logs %q, want logged %v", tt.path, got, tt.logged)
+		}
+		if w.Code != http.StatusOK && w.Code != http.StatusNotFound {
+			t.Errorf("-quiet-paths GET %s = %d, want it served", tt.path, w.Code)
+		}
+	}
+}
+
+// TestLogRefused checks that requests refused before reaching the files are
+// logged with their status too.
+func TestLogRefused(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+
+	tests := []struct {
+		name   string
+		flags  []string
+		remote string
+		status int
+	}{
+		{"basic auth", []string{"-auth", "user:pass"}, "", http.StatusUnauthorized},
+		{"token", []string{"-token", "s3cret"}, "", http.StatusUnauthorized},
+		{"pin prompt", []string{"-pin"}, "", http.StatusForbidden},
+		{"lan only", []string{"-lan-only"}, "203.0.113.7:1234", http.StatusForbidden},
+		{"deny", []string{"-deny", "192.0.2.1"}, "", http.StatusForbidden},
+		{"maintenance", []string{"-maintenance"}, "", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHandler(testArgs(t, dir, append([]string{"-silent=false"}, tt.flags...)...))
+			r := httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+			if tt.remote != "" {
+				r.RemoteAddr = tt.remote
+			}
+			w := httptest.NewRecorder()
+			got := capture(t, &os.Stdout, func() { h.ServeHTTP(w, r) })
+			if w.Code != tt.status {
+				t.Fatalf("GET /a.txt = %d, want %d", w.Code, tt.status)
+			}
+			if want := fmt.Sprintf("GET %d HTTP/1.1 /a.txt ", tt.status); !strings.Contains(got, want) {
+				t.Errorf("GET /a.txt logs %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// TestLogFile checks that -log-file gets one uncolored line per request in
+// each -log-format.
+func TestLogFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+
+	tests := []struct {
+		format string
+		want   *regexp.Regexp
+	}{
+		{"pretty", regexp.MustCompile(`^GET 200 HTTP/1\.1 /a\.txt 5 B \S+ 192\.0\.2\.1:1234 \| curl/8\.0\n$`)},
+		{"json", regexp.MustCompile(`^\{"time":"[^"]+","method":"GET","path":"/a\.txt","query":"token=REDACTED","status":200,"bytes":5,"durationMs":[0-9.]+,"remote":"192\.0\.2\.1","proto":"HTTP/1\.1","userAgent":"curl/8\.0"\}\n$`)},
+		{"clf", regexp.MustCompile(`^192\.0\.2\.1 - - \[[^\]]+\] "GET /a\.txt\?token=REDACTED HTTP/1\.1" 200 5\n$`)},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(t.TempDir(), "access.log")
+		h := newHandler(testArgs(t, dir, "-silent=false", "-log-file", name, "-log-format", tt.format))
+		r := httptest.NewRequest(http.MethodGet, "/a.txt?token=s3cret", nil)
+		r.Header.Set("User-Agent", "curl/8.0")
+		stdout := capture(t, &os.Stdout, func() { h.ServeHTTP(httptest.NewRecorder(), r) })
+
+		got, err := os.ReadFile(name)
+		if err != nil || !tt.want.Match(got) {
+			t.Errorf("-log-format %s logs %q, %v, want %s", tt.format, got, err, tt.want)
+		}
+		if stdout != "" {
+			t.Errorf("-log-format %s with -log-file prints %q", tt.format, stdout)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package fylshr
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// logSinkQueue is how many records can wait for a slow sink before new ones
+// are dropped, so requests never block on it.
+const logSinkQueue = 1024
+
+const (
+	logSinkMinBackoff = 100 * time.Millisecond
+	logSinkMaxBackoff = 30 * time.Second
+)
+
+// logSink writes one JSON line per request to a file or a TCP or UDP endpoint.
+type logSink struct {
+	network string
+	addr    string
+	records chan []byte
+}
+
+type accessRecord struct {
+	Time       string  `json:"time"`
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	Query      string  `json:"query,omitempty"`
+	Status     int     `json:"status"`
+	Bytes      int64   `json:"bytes"`
+	DurationMs float64 `json:"durationMs"`
+	Remote     string  `json:"remote"`
+	Proto      string  `json:"proto"`
+	Referer    string  `json:"referer,omitempty"`
+	UserAgent  string  `json:"userAgent,omitempty"`
+	Blocked    string  `json:"blocked,omitempty"`
+}
+
+// openLogSink parses file:/path, tcp:host:port or udp:host:port. Files must
+// open right away; network sinks connect in the background and keep retrying.
+func openLogSink(spec string) (*logSink, error) {
+	network, addr, ok := strings.Cut(spec, ":")
+	if !ok || addr == "" {
+		return nil, fmt.Errorf("%q, expected file:/path, tcp:host:port or udp:host:port", spec)
+	}
+
+	var w io.WriteCloser
+	switch network {
+	case "file":
+		f, err := os.OpenFile(addr, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	case "tcp", "udp":
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown sink %q, expected file, tcp or udp", network)
+	}
+
+	sink := &logSink{network: network, addr: addr, records: make(chan []byte, logSinkQueue)}
+	go sink.run(w)
+	return sink, nil
+}
+
+// newAccessRecord describes a request that started at start and just ended.
+func newAccessRecord(w *statusWriter, r *http.Request, start time.Time) accessRecord {
+	return accessRecord{
+		Time:       start.UTC().Format(time.RFC3339Nano),
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Query:      redactToken(r.URL.RawQuery),
+		Status:     cmp.Or(w.status, http.StatusOK),
+		Bytes:      w.bytes,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		Remote:     clientIP(r),
+		Proto:      r.Proto,
+		Referer:    redactToken(r.Referer()),
+		UserAgent:  r.UserAgent(),
+		Blocked:    w.blocked,
+	}
+}
+
+func (s *logSink) record(w *statusWriter, r *http.Request, start time.Time) {
+	b, _ := json.Marshal(newAccessRecord(w, r, start))
+
+	select {
+	case s.records <- append(b, '\n'):
+	default:
+		logSinkDropped.Add(1)
+	}
+}
+
+// run writes the queued records, dropping them while the sink fails. A failed
+// network connection is redialed with exponential backoff.
+func (s *logSink) run(w io.WriteCloser) {
+	backoff, retry := logSinkMinBackoff, time.Time{}
+	for record := range s.records {
+		if w == nil {
+			if time.Now().Before(retry) {
+				logSinkDropped.Add(1)
+				continue
+			}
+
+			conn, err := net.DialTimeout(s.network, s.addr, 5*time.Second)
+			if err != nil {
+				if backoff == logSinkMinBackoff {
+					log.Printf("log sink: %s, retrying", err)
+				}
+				retry, backoff = time.Now().Add(backoff), min(2*backoff, logSinkMaxBackoff)
+				logSinkDropped.Add(1)
+				continue
+			}
+			w, backoff = conn, logSinkMinBackoff
+		}
+
+		if _, err := w.Write(record); err != nil {
+			logSinkDropped.Add(1)
+			if s.network != "file" {
+				log.Printf("log sink: %s, reconnecting", err)
+				w.Close()
+				w = nil
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package fylshr
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenLogSink(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		spec string
+		err  bool
+	}{
+		{"file:" + filepath.Join(dir, "access.jsonl"), false},
+		{"tcp:127.0.0.1:5170", false},
+		{"udp:[::1]:5170", false},
+		{"file:" + filepath.Join(dir, "missing", "access.jsonl"), true},
+		{"tcp:127.0.0.1", true},
+		{"http:localhost:80", true},
+		{"file:", true},
+		{"access.jsonl", true},
+	}
+	for _, tt := range tests {
+		if _, err := openLogSink(tt.spec); (err != nil) != tt.err {
+			t.Errorf("openLogSink(%q) = %v, want error %v", tt.spec, err, tt.err)
+		}
+	}
+}
+
+// readRecord returns the next JSON line that r buffers from conn, failing
+// after a few seconds.
+func readRecord(t *testing.T, conn net.Conn, r *bufio.Reader) accessRecord {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record accessRecord
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		t.Fatalf("%s in %q", err, line)
+	}
+	return record
+}
+
+func TestLogSink(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+
+	t.Run("tcp", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		srv := newTestServer(t, dir, "-log-sink", "tcp:"+l.Addr().String())
+
+		do(t, srv, http.MethodGet, "/a.txt?token=s3cret", nil, "User-Agent: curl/8.0")
+		conn, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		record := readRecord(t, conn, r)
+		if record.Method != http.MethodGet || record.Path != "/a.txt" || record.Query != "token=REDACTED" || record.Status != http.StatusOK || record.Bytes != 5 || record.UserAgent != "curl/8.0" {
+			t.Errorf("tcp sink got %+v", record)
+		}
+
+		do(t, srv, http.MethodGet, "/missing.txt", nil)
+		if record := readRecord(t, conn, r); record.Path != "/missing.txt" || record.Status != http.StatusNotFound {
+			t.Errorf("tcp sink got %+v, want the 404", record)
+		}
+	})
+
+	t.Run("udp", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		srv := newTestServer(t, dir, "-log-sink", "udp:"+conn.LocalAddr().String())
+
+		do(t, srv, http.MethodGet, "/a.txt", nil)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		b := make([]byte, 64<<10)
+		n, _, err := conn.ReadFrom(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var record accessRecord
+		if err := json.Unmarshal(b[:n], &record); err != nil || record.Path != "/a.txt" {
+			t.Errorf("udp sink got %q, %v", b[:n], err)
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		name := filepath.Join(t.TempDir(), "access.jsonl")
+		srv := newTestServer(t, dir, "-log-sink", "file:"+name)
+		do(t, srv, http.MethodGet, "/a.txt", nil)
+		do(t, srv, http.MethodGet, "/a.txt", nil)
+
+		var lines []string
+		for deadline := time.Now().Add(5 * time.Second); len(lines) < 2 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			b, _ := os.ReadFile(name)
+			lines = strings.Split(strings.TrimSpace(string(b)), "\n")
+		}
+		if len(lines) != 2 || !strings.Contains(lines[1], `"path":"/a.txt"`) {
+			t.Errorf("file sink = %q, want 2 records", lines)
+		}
+	})
+}
+
+// TestLogSinkDown checks that requests are still served, and the records
+// dropped, while the sink is unreachable.
+func TestLogSinkDown(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	srv := newTestServer(t, dir, "-log-sink", "tcp:"+addr)
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	before := logSinkDropped.Load()
+	for range 3 {
+		if resp, body := do(t, srv, http.MethodGet, "/a.txt", nil); resp.StatusCode != http.StatusOK || body != "hello" {
+			t.Errorf("GET /a.txt with the sink down = %d %q", resp.StatusCode, body)
+		}
+	}
+	for deadline := time.Now().Add(5 * time.Second); logSinkDropped.Load() < before+3 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if dropped := logSinkDropped.Load() - before; dropped < 3 {
+		t.Errorf("dropped %d records with the sink down, want 3", dropped)
+	}
+}
@@ -0,0 +1,626 @@
+package fylshr
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/webdav"
+)
+
+var startTime = time.Now()
+
+// Main runs the fylshr command: it parses the command line, serves until
+// SIGINT, SIGTERM or the end of a -file share, and exits on errors.
+func Main() {
+	args, err := parseArgs(flag.CommandLine, os.Args[1:], true)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := validate(args); err != nil {
+		log.Fatal(err)
+	}
+
+	for _, folder := range args.servedFolders() {
+		if args.share != nil {
+			break
+		}
+		for _, warning := range folderWarnings(folder, args) {
+			log.Println("warning:", warning)
+		}
+	}
+
+	if args.dryRun {
+		fmt.Println("Configuration OK")
+		return
+	}
+
+	handleMaintenanceSignal(args.maintenance)
+
+	listeners, err := listen(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	listeners = limitConns(listeners, args.maxConns, args.maxConnsPerIP)
+
+	var tlsConfig *tls.Config
+	if args.tls {
+		if tlsConfig, err = newTLSConfig(args); err != nil {
+			log.Fatal(err)
+		}
+		for i, l := range listeners {
+			listeners[i] = tls.NewListener(l, tlsConfig)
+		}
+	}
+
+	if args.acme != nil {
+		go serveACMEHTTP(args.acme, listeners)
+	}
+
+	// The random paths of -file and -obscure are secrets, so they aren't
+	// broadcast.
+	if args.mdns && args.share == nil && !args.obscure {
+		withdraw, err := advertise(args, listeners)
+		if err != nil {
+			log.Printf("mdns: %s", err)
+		} else {
+			defer withdraw()
+		}
+	}
+
+	if args.profile && args.profileAddr != "" {
+		addr, err := listenProfile(args.profileAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("pprof on http://%s%s", addr, pprofPath)
+	}
+
+	stopTUI, tuiDone := make(chan struct{}), make(chan struct{})
+	if args.tui != nil {
+		go args.tui.run(args.servedFolders()[0], stopTUI, tuiDone)
+	} else {
+		close(tuiDone)
+		printBanner(args, listeners)
+	}
+	if args.progress != nil {
+		go args.progress.run()
+	}
+	srv := newServer(args)
+
+	// Each listener may also have a QUIC socket.
+	errs := make(chan error, 2*len(listeners))
+	var h3 *http3.Server
+	if args.http3 {
+		if h3, err = serveHTTP3(srv, listeners, tlsConfig, args.network, errs); err != nil {
+			log.Fatalf("-http3: %s", err)
+		}
+	}
+	for _, l := range listeners {
+		go func() { errs <- srv.Serve(l) }()
+	}
+
+	// SIGTERM is what docker stop and systemd send.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	var reason string
+	select {
+	case err := <-errs:
+		close(stopTUI)
+		<-tuiDone
+		log.Fatal(err)
+	case sig := <-signals:
+		reason = "received " + sig.String()
+	case <-args.share.Done():
+		reason = "the link was used or expired"
+	}
+
+	// A second signal kills the process right away.
+	signal.Reset(os.Interrupt, syscall.SIGTERM)
+	close(stopTUI)
+	<-tuiDone
+	if args.progress != nil {
+		args.progress.Lock()
+		args.progress.clear()
+		args.progress.Unlock()
+	}
+	log.Printf("%s, shutting down", reason)
+	if active := args.session.active.Load(); active > 0 {
+		log.Printf("waiting up to %s for %d active requests", args.shutdownTimeout, active)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), args.shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("shutdown: %s, closing %d remaining requests", err, args.session.active.Load())
+		srv.Close()
+	}
+	if h3 != nil {
+		h3.Close()
+	}
+	printSummary(args, args.session)
+}
+
+// newServer returns the configured server without binding any address, so it
+// can be served on the listeners of main or wrapped by httptest.
+func newServer(args Args) *http.Server {
+	srv := &http.Server{Handler: newHandler(args), ReadHeaderTimeout: readHeaderTimeout, IdleTimeout: idleTimeout}
+	if args.metrics {
+		srv.ConnState = args.requestMetrics.connState
+	}
+	// Without keep-alive every request pays for a new connection, which is
+	// slower but useful when a proxy in front mishandles connection reuse.
+	srv.SetKeepAlivesEnabled(!args.noKeepAlive)
+	return srv
+}
+
+// newHandler builds the file server for args with all of its middleware.
+func newHandler(args Args) http.Handler {
+	files := newFilesHandler(args)
+	if len(args.mounts) > 0 {
+		files = newMountsHandler(args)
+	}
+	pprofHandler := pprofMux()
+	var limiter *requestLimiter
+	if args.maxRPS > 0 {
+		limiter = newRequestLimiter(args.maxRPS)
+	}
+	var handler http.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {
+		for _, h := range args.headers {
+			w.Header().Set(h.name, h.value)
+		}
+
+		requestsServed.Add(1)
+
+		// Logged before any check so refused requests show up too. The
+		// server's own endpoints set unlogged, and r is read once it's been
+		// rewritten.
+		unlogged := false
+		if args.logSink != nil {
+			sw := &statusWriter{ResponseWriter: w}
+			w = sw
+			defer func(start time.Time) {
+				if !unlogged {
+					args.logSink.record(sw, r, start)
+				}
+			}(time.Now())
+		}
+		var logged *statusWriter
+		if !args.silent {
+			logged = &statusWriter{ResponseWriter: w}
+			w = logged
+			defer func(start time.Time) {
+				if !unlogged && !matchesAny(args.quietPaths, r.URL.Path) {
+					logRequest(logged, r, args, start)
+				}
+			}(time.Now())
+		}
+
+		if args.lanOnly && !isLANClient(r) {
+			writeError(w, r, http.StatusForbidden, "403 only available on the local network")
+			return
+		}
+
+		if reason := blockReason(r, args.allow, args.deny); reason != "" {
+			serveBlocked(w, r, args, http.StatusForbidden, reason)
+			return
+		}
+		if limiter != nil && !limiter.allow(clientIP(r)) {
+			serveBlocked(w, r, args, http.StatusTooManyRequests, "over -max-rps")
+			return
+		}
+
+		if r.URL.Path == healthPath && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			unlogged = true
+			serveHealth(w, r)
+			return
+		}
+
+		// The ACME server can't log in.
+		isChallenge := args.acmeWebroot != "" && strings.HasPrefix(r.URL.Path, acmeChallengePath)
+		if (args.auth != "" || args.token != "" || args.pin != nil) && !isChallenge && !authorized(r, args.auth, args.token) && !(args.pin != nil && args.pin.paired(r)) {
+			switch {
+			case args.pin != nil && r.URL.Path == pinPath && r.Method == http.MethodPost:
+				args.pin.serve(w, r, args.basePath, args.look)
+			case args.pin != nil:
+				args.pin.prompt(w, r, args.look, http.StatusForbidden, args.basePath, r.URL.RequestURI(), "Enter the PIN shown where the server was started.")
+			default:
+				requireAuth(w, r, args.auth)
+			}
+			return
+		}
+
+		if methods := args.methodsFor(r.URL.Path); !slices.Contains(methods, r.Method) {
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			writeError(w, r, http.StatusMethodNotAllowed, "405 method not allowed")
+			return
+		}
+
+		if redirectCanonical(w, r, args.basePath) {
+			return
+		}
+
+		if len(args.rewrites) > 0 {
+			rewritten := rewrite(w, r, args.rewrites, args.basePath)
+			if rewritten == nil {
+				return
+			}
+			r = rewritten
+		}
+
+		url := r.URL.Path
+		if url == "/favicon.ico" && serveFavicon(w, r, args) {
+			unlogged = true
+			return
+		}
+
+		if args.metrics && url == metricsPath {
+			unlogged = true
+			serveMetrics(w, r, args.requestMetrics)
+			return
+		}
+
+		if args.stats && url == accessStatsPath {
+			unlogged = true
+			serveAccessStats(w, r, args.session, args.look)
+			return
+		}
+
+		if args.debugEndpoints && url == statsPath {
+			unlogged = true
+			serveStats(w, r)
+			return
+		}
+
+		if args.profile && args.profileAddr == "" && strings.HasPrefix(url, pprofPath) {
+			unlogged = true
+			pprofHandler.ServeHTTP(w, r)
+			return
+		}
+
+		if args.configEndpoint && url == configPath {
+			unlogged = true
+			w.Header().Set("Cache-Control", "no-store")
+			writeJSON(w, r, effectiveConfig())
+			return
+		}
+
+		if args.sitemap != "" && url == sitemapPath && !isFile(args.localPath(url)) {
+			unlogged = true
+			serveSitemap(w, r, args)
+			return
+		}
+
+		if inMaintenance(r, args.maintenance, args.maintenanceAllow) {
+			serveMaintenance(w, r, args.look)
+			return
+		}
+
+		if logged != nil && args.progress != nil && !matchesAny(args.quietPaths, url) {
+			logged.transfer = args.progress.start(url)
+			defer args.progress.done(logged.transfer)
+		}
+
+		if args.share != nil {
+			args.share.serve(w, r, args.mimeTypes)
+			return
+		}
+
+		if args.acmeWebroot != "" && strings.HasPrefix(url, acmeChallengePath) {
+			serveACMEChallenge(w, r, args.acmeWebroot, strings.TrimPrefix(url, acmeChallengePath))
+			return
+		}
+
+		files(w, r)
+	}
+
+	// The rewrites only happen inside withTimeout, so resolve them to tell
+	// which requests are downloads.
+	isServedFile := func(name string) bool { return args.isFile(rewrittenPath(args.rewrites, name)) }
+	return withDebug(args.debug, withBasePath(args.basePath, withSession(args.session, withMetrics(args.requestMetrics, args.metrics, args.upload, withThrottle(args.limitRate, args.limitTotal, withCompress(!args.noCompress, args.gzipLevel, args.brotliLevel, args.compressRaw, withTimeout(args.requestTimeout, isServedFile, withRecover(args.look, handler))))))))
+}
+
+// newFilesHandler serves the folder of args, once the request went through
+// the checks of newHandler.
+func newFilesHandler(args Args) http.HandlerFunc {
+	var layers overlayFS
+	for _, folder := range args.layers() {
+		layers = append(layers, http.Dir(folder))
+	}
+	root := hiddenFS{FileSystem: layers, hide: args.hidden}
+	fs := http.FileServer(root)
+	davLocks := webdav.NewMemLS()
+	pastes := newPasteStore()
+	var hub *eventHub
+	if args.watch && !args.receive {
+		watched, err := watchFolders(args)
+		if err != nil {
+			log.Printf("watching %s: %s", args.folder, err)
+		} else if args.live {
+			hub = watched
+		}
+	}
+	var checksum func(string) string
+	if args.checksums {
+		checksum = func(name string) string { return cachedChecksum(args.localPath(name)) }
+	}
+	title := args.listingTitle()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		url := r.URL.Path
+		if !args.tokenAllowed(r, url) {
+			writeError(w, r, http.StatusForbidden, "403 forbidden")
+			return
+		}
+
+		// Some features read files without going through root.
+		if args.excluded(url, isDirectory(args.localPath(url))) || args.escapes(url) {
+			writeError(w, r, http.StatusNotFound, "404 page not found")
+			return
+		}
+
+		if args.paste && hasPathPrefix(url, pastePath) {
+			pastes.serve(w, r, args.basePath, args.look)
+			return
+		}
+
+		if hub != nil && url == eventsPath {
+			serveEvents(w, r, hub, func(event changeEvent) bool {
+				name := path.Join(event.Dir, event.Name)
+				return args.tokenAllowed(r, event.Dir) && !args.excluded(name, isDirectory(args.localPath(name)))
+			})
+			return
+		}
+
+		if url == archivePath && !args.receive {
+			serveSelection(w, r, root, args.localPath, func(name string) bool { return args.tokenAllowed(r, name) })
+			return
+		}
+
+		if args.receive {
+			serveReceive(w, r, args)
+			return
+		}
+
+		if url == searchPath {
+			serveSearch(w, r, root, func(name string) bool { return args.tokenAllowed(r, name) }, listingOptions{
+				basePath:   args.basePath,
+				thumbs:     args.thumbnails,
+				gallery:    args.gallery,
+				dirsFirst:  args.dirsFirst,
+				title:      title,
+				formatDate: args.dateFormat,
+				look:       args.look,
+				mimeTypes:  args.mimeTypes,
+			})
+			return
+		}
+
+		if name, ok := strings.CutPrefix(url, thumbPath+"/"); ok && args.thumbnails {
+			if !args.tokenAllowed(r, "/"+name) {
+				writeError(w, r, http.StatusForbidden, "403 forbidden")
+				return
+			}
+			serveThumb(w, r, root, args.localPath, args.thumbCache, args.thumbSlots, "/"+name)
+			return
+		}
+
+		if args.inbox != "" && (r.Method == http.MethodDelete || r.Method == http.MethodPost && r.URL.Query().Has("rename")) && hasPathPrefix(url, args.inbox) {
+			serveInbox(w, r, args.folder, args.inbox)
+			return
+		}
+
+		if args.upload && hasPathPrefix(url, tusPath) {
+			serveTus(w, r, args.folder, args.basePath, args.uploadLimits, func(name string) bool {
+				return args.tokenAllowed(r, name) && !args.excluded(name, true)
+			}, args.landed(r))
+			return
+		}
+
+		if args.manage && (r.Method == http.MethodDelete || hasPathPrefix(url, managePath)) {
+			serveManage(w, r, args.folder, func(name string) bool {
+				isDir := isDirectory(args.localPath(name))
+				dir := name
+				if isDir {
+					dir += "/"
+				}
+				return args.tokenAllowed(r, dir) && !args.excluded(name, isDir)
+			})
+			return
+		}
+
+		if args.webdav && slices.Contains(davMethods(args.upload), r.Method) {
+			serveWebDAV(w, r, args, davLocks)
+			return
+		}
+
+		if args.upload && (r.Method == http.MethodPost || r.Method == http.MethodPut) {
+			serveUpload(w, r, args.folder, args.basePath, args.uploadLimits, func(name string) bool { return !args.excluded(name, false) }, args.landed(r))
+			return
+		}
+
+		if args.maxFileSize > 0 {
+			if info, err := os.Stat(args.localPath(url)); err == nil && !info.IsDir() && info.Size() > args.maxFileSize {
+				writeError(w, r, http.StatusForbidden, fmt.Sprintf("403 files over %s are not served", formatSize(uint64(args.maxFileSize))))
+				return
+			}
+		}
+
+		if url == "/" && args.rootPage != "" && !forceListing(r) {
+			serveRootPage(w, r, args.look, args.rootPage, args.rootPageStyle)
+			return
+		}
+
+		isDir := url[len(url)-1] == '/'
+		var base string
+		if !isDir && args.noRedirectSlash && isDirectory(args.localPath(url)) {
+			// The listing links are relative, so without the slash browsers
+			// would resolve them against the parent directory.
+			base = path.Base(url) + "/"
+
+			r = r.Clone(r.Context())
+			r.URL.Path += "/"
+			url, isDir = r.URL.Path, true
+			// The token of a directory is in it, so it's only found with the
+			// slash.
+			if !args.tokenAllowed(r, url) {
+				writeError(w, r, http.StatusForbidden, "403 forbidden")
+				return
+			}
+		}
+
+		if isDir && args.indexLang != "" && !forceListing(r) {
+			name, lang, found := localizedIndex(args.localPath(url), r.Header.Get("Accept-Language"), args.indexLang)
+			if found {
+				w.Header().Add("Vary", "Accept-Language")
+			}
+			if name != "" {
+				w.Header().Set("Content-Language", lang)
+				writeBaseHref(w, base)
+				serveRootPage(w, r, args.look, name, false)
+				return
+			}
+		}
+
+		if !isDir && args.follow && (r.URL.Query().Has("follow") || r.URL.Query().Has("tail")) {
+			serveFollow(w, r, args.look, args.localPath(url))
+			return
+		}
+
+		// ?raw asks for the bytes of the file as stored, whatever would
+		// transform or replace them.
+		raw := !isDir && r.URL.Query().Has("raw")
+
+		if !isDir && args.imageNegotiation && !raw {
+			if variant := imageVariant(w, r, args.localPath, url); variant != url {
+				r = r.Clone(r.Context())
+				r.URL.Path = variant
+				url = variant
+			}
+		}
+
+		if !isDir && args.spaRoute(r, url) && !isFile(args.localPath(url)) && !isDirectory(args.localPath(url)) {
+			serveSPAIndex(w, r, args.localPath("/index.html"))
+			return
+		}
+
+		if !isDir && args.checksums {
+			if r.URL.Query().Has("checksum") {
+				alg := cmp.Or(r.URL.Query().Get("checksum"), "sha256")
+				serveChecksum(w, r, args.localPath(url), alg)
+				return
+			}
+			// Big files are hashed in the background rather than delaying
+			// their first download.
+			if sum := cachedChecksum(args.localPath(url)); sum != "" {
+				w.Header().Set("X-Checksum-SHA256", sum)
+			}
+		}
+
+		if query := r.URL.Query(); !isDir && (args.render || query.Has("render")) && !raw {
+			if renderable(url, query.Has("render")) && serveRendered(w, r, args.look, args.localPath(url), url) {
+				return
+			}
+		}
+
+		if !isDir {
+			if args.hooks != nil && r.Method == http.MethodGet {
+				if info, err := os.Stat(args.localPath(url)); err == nil && info.Mode().IsRegular() {
+					sw := &statusWriter{ResponseWriter: w}
+					w = sw
+					defer args.hooks.downloaded(sw, r, path.Clean(url), info.Size(), time.Now())
+				}
+			}
+
+			filename := path.Base(url)
+			if contentType := args.mimeTypes.custom(filename); contentType != "" {
+				w.Header().Set("Content-Type", contentType)
+			}
+			if path.Ext(filename) == "" && (args.defaultType != "" || args.sniff) {
+				if contentType := extensionlessType(args.localPath(url), args.defaultType, args.sniff); contentType != "" {
+					w.Header().Set("Content-Type", contentType)
+				}
+			}
+
+			// The gallery plays media with ?inline.
+			if args.attachment(filename) && !r.URL.Query().Has("inline") {
+				filename := fmt.Sprintf("attachment; filename=%s", strconv.Quote(filename))
+				w.Header().Set("Content-Disposition", filename)
+			}
+
+			if etag := args.etagFor(args.localPath(url)); etag != "" {
+				w.Header().Set("ETag", etag)
+			}
+
+			if cacheControl := args.cacheControlFor(filename); cacheControl != "" {
+				w = &successHeaderWriter{ResponseWriter: w, name: "Cache-Control", value: cacheControl}
+			}
+
+			if len(args.digest) > 0 {
+				w = &digestWriter{ResponseWriter: w, name: args.localPath(url), algs: args.digest}
+			}
+
+			if name := path.Clean("/" + url); args.xsendfile != "" && isFile(args.localPath(name)) {
+				w.Header().Set(args.xsendfile, args.xsendfilePrefix+name)
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			// Ranges are mostly media seeking, where latency matters more.
+			if args.bufferSize > 0 && r.Header.Get("Range") == "" && !args.mimeTypes.isMedia(filename) {
+				bw := newBufferedWriter(w, args.bufferSize)
+				w = bw
+				defer bw.flush()
+			}
+		}
+
+		if isDir && args.spaHash != nil {
+			w = &successHeaderWriter{ResponseWriter: w, name: "Cache-Control", value: "no-cache"}
+		}
+
+		if format := archiveFormat(r); isDir && format != "" {
+			serveArchive(w, r, root, args.localPath, path.Clean(url), format, func(name string) bool { return args.tokenAllowed(r, name) })
+			return
+		}
+
+		if isDir && (forceListing(r) || !hasIndex(root, url)) {
+			serveListing(w, r, root, path.Clean(url), listingOptions{
+				base:         base,
+				basePath:     args.basePath,
+				thumbs:       args.thumbnails,
+				upload:       args.upload,
+				gallery:      args.gallery,
+				dirsFirst:    args.dirsFirst,
+				title:        title,
+				formatDate:   args.dateFormat,
+				paste:        args.paste,
+				checksum:     checksum,
+				events:       hub != nil,
+				manage:       args.manage,
+				uploadLimits: args.uploadLimits,
+				look:         args.look,
+				mimeTypes:    args.mimeTypes,
+			})
+			return
+		}
+
+		writeBaseHref(w, base)
+		ew := &jsonErrorWriter{ResponseWriter: w, r: r}
+		fs.ServeHTTP(ew, r)
+		ew.finish()
+	}
+}
@@ -0,0 +1,360 @@
+package fylshr
+
+import (
+	"cmp"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testArgs parses flags like the command does, serving folder, unless it's
+// empty for -mount, without printing anything.
+func testArgs(t testing.TB, folder string, flags ...string) Args {
+	t.Helper()
+	if folder != "" {
+		flags = append([]string{"-folder", folder}, flags...)
+	}
+	args := parseTestArgs(t, append([]string{"-silent", "-banner", "off"}, flags...)...)
+	args.tui, args.progress, args.color = nil, nil, false
+	if err := validate(args); err != nil {
+		t.Fatal(err)
+	}
+	return args
+}
+
+// parseTestArgs parses flags like the command line, without the settings of
+// the environment and config file.
+func parseTestArgs(t testing.TB, flags ...string) Args {
+	t.Helper()
+	args, err := parseArgs(flag.NewFlagSet("fylshr", flag.ContinueOnError), flags, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return args
+}
+
+// newTestServer serves folder with the handler of the command for flags.
+func newTestServer(t *testing.T, folder string, flags ...string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(newHandler(testArgs(t, folder, flags...)))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// writeFiles creates the files of a slash separated path to content map in
+// dir, and a folder for names ending with a slash.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for file, content := range files {
+		name := filepath.Join(dir, filepath.FromSlash(file))
+		if strings.HasSuffix(file, "/") {
+			if err := os.MkdirAll(name, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// do sends a request with the headers given as "Name: value" and returns the
+// response with its body read.
+func do(t *testing.T, srv *httptest.Server, method, target string, body io.Reader, headers ...string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+target, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range headers {
+		name, value, _ := strings.Cut(h, ":")
+		req.Header.Set(name, strings.TrimSpace(value))
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(b)
+}
+
+// mainCommand returns the fylshr command for flags, run by TestMainHelper in
+// a child process of the test binary.
+func mainCommand(flags ...string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestMainHelper$")
+	cmd.Env = append(os.Environ(), "FYLSHR_MAIN_HELPER="+strings.Join(flags, "\n"))
+	return cmd
+}
+
+// TestMainHelper is the fylshr command run by mainCommand.
+func TestMainHelper(t *testing.T) {
+	flags := os.Getenv("FYLSHR_MAIN_HELPER")
+	if flags == "" {
+		t.Skip("run by mainCommand")
+	}
+	os.Args = append([]string{"fylshr"}, strings.Split(flags, "\n")...)
+	flag.CommandLine = flag.NewFlagSet("fylshr", flag.ExitOnError)
+	Main()
+}
+
+func TestHandler(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.txt":     "hello",
+		"sub/b.txt": "nested",
+		".env":      "SECRET=1",
+	})
+	srv := newTestServer(t, dir)
+
+	tests := []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{http.MethodGet, "/a.txt", http.StatusOK, "hello"},
+		{http.MethodHead, "/a.txt", http.StatusOK, ""},
+		{http.MethodGet, "/sub/b.txt", http.StatusOK, "nested"},
+		{http.MethodGet, "/sub/", http.StatusOK, "b.txt"},
+		{http.MethodGet, "/sub", http.StatusMovedPermanently, ""},
+		{http.MethodGet, "/missing.txt", http.StatusNotFound, ""},
+		{http.MethodGet, "/.env", http.StatusNotFound, ""},
+		{http.MethodPut, "/a.txt", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, srv, tt.method, tt.path, nil)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, resp.StatusCode, tt.status)
+		}
+		if !strings.Contains(body, tt.body) {
+			t.Errorf("%s %s body %q, want it to contain %q", tt.method, tt.path, body, tt.body)
+		}
+		if strings.Contains(body, "SECRET") {
+			t.Errorf("%s %s shows the hidden .env", tt.method, tt.path)
+		}
+	}
+}
+
+func TestFolderWarnings(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		mode  os.FileMode
+		flags []string
+		want  string
+	}{
+		{"hidden dotfile", map[string]string{".env": "SECRET=1"}, 0, nil, ""},
+		{"shown dotfile", map[string]string{".env": "SECRET=1"}, 0, []string{"-hide-dotfiles=false"}, ".env, which will be served to anyone"},
+		{"shown dotfile with auth", map[string]string{".env": "SECRET=1"}, 0, []string{"-hide-dotfiles=false", "-token", "s3cret"}, ".env, which will be served\n"},
+		{"key", map[string]string{"server.key": "KEY"}, 0, nil, "server.key, which will be served to anyone"},
+		{"plain files", map[string]string{"a.txt": "hello", "notes.md": ""}, 0, nil, ""},
+		{"empty", nil, 0, nil, "is empty"},
+		{"world-readable", map[string]string{"a.txt": "hello"}, 0o755, nil, "is world-readable and no authentication is configured"},
+		{"world-readable with auth", map[string]string{"a.txt": "hello"}, 0o755, []string{"-auth", "user:pass"}, ""},
+		{"group-readable", map[string]string{"a.txt": "hello"}, 0o750, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			if err := os.Chmod(dir, cmp.Or(tt.mode, 0o700)); err != nil {
+				t.Fatal(err)
+			}
+			got := strings.Join(folderWarnings(dir, testArgs(t, dir, tt.flags...)), "\n") + "\n"
+			if tt.want == "" && got != "\n" || !strings.Contains(got, tt.want) {
+				t.Errorf("folderWarnings = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestValidateFolder checks that a -folder fylshr can't list is refused at
+// startup instead of failing every request.
+func TestValidateFolder(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "locked/b.txt": "secret"})
+	locked := filepath.Join(dir, "locked")
+	if err := os.Chmod(locked, 0o000); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(locked, 0o755) })
+
+	tests := []struct {
+		folder string
+		err    bool
+	}{
+		{dir, false},
+		{locked, true},
+		{filepath.Join(dir, "a.txt"), true},
+		{filepath.Join(dir, "missing"), true},
+	}
+	for _, tt := range tests {
+		if tt.folder == locked && readable(locked) {
+			t.Logf("skipping %s, permissions don't apply to this user", locked)
+			continue
+		}
+		args := testArgs(t, dir)
+		args.folder = tt.folder
+		if err := validate(args); (err != nil) != tt.err || err != nil && !strings.HasPrefix(err.Error(), "-folder: ") {
+			t.Errorf("validate -folder %s = %v, want error %v", tt.folder, err, tt.err)
+		}
+	}
+}
+
+// TestParseArgsErrors checks that invalid flags come back as errors, so a
+// program embedding the server isn't exited by them.
+func TestParseArgsErrors(t *testing.T) {
+	tests := []struct {
+		flags []string
+		want  string
+	}{
+		{[]string{"-network", "udp"}, `invalid -network "udp"`},
+		{[]string{"-max-upload-size", "lots"}, "invalid -max-upload-size: "},
+		{[]string{"-acme"}, "-acme needs -domain"},
+		{[]string{"-mount", "/a=" + t.TempDir(), "-folder", t.TempDir()}, "can't be combined with -folder"},
+		{[]string{"-no-such-flag"}, "not defined: -no-such-flag"},
+	}
+	for _, tt := range tests {
+		flags := flag.NewFlagSet("fylshr", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		if _, err := parseArgs(flags, tt.flags, false); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseArgs(%q) = %v, want an error with %q", tt.flags, err, tt.want)
+		}
+	}
+}
+
+// TestRequestTimeout checks that a timeout too short for anything only
+// answers 503 to the requests http.TimeoutHandler would buffer, once the paths
+// are rewritten.
+func TestRequestTimeout(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"big.bin": strings.Repeat("x", 1<<20), "notes.txt": "hello", "sub/": ""})
+	srv := newTestServer(t, dir, "-request-timeout", "1ns", "-rewrite", "^/download$ -> /big.bin", "-rewrite", "^/browse$ -> /sub/")
+
+	tests := []struct {
+		path, header string
+		status       int
+	}{
+		{"/big.bin", "", http.StatusOK},
+		{"/notes.txt", "", http.StatusOK},
+		{"/notes.txt", "Range: bytes=1-", http.StatusPartialContent},
+		{"/sub/", "", http.StatusServiceUnavailable},
+		{"/", "", http.StatusServiceUnavailable},
+		{"/download", "", http.StatusOK},
+		{"/browse", "", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		var headers []string
+		if tt.header != "" {
+			headers = append(headers, tt.header)
+		}
+		if resp, _ := do(t, srv, http.MethodGet, tt.path, nil, headers...); resp.StatusCode != tt.status {
+			t.Errorf("GET %s %s = %d, want %d", tt.path, tt.header, resp.StatusCode, tt.status)
+		}
+	}
+}
+
+func TestLANOnly(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	tests := []struct {
+		remote string
+		flags  []string
+		status int
+	}{
+		{"127.0.0.1:1234", []string{"-lan-only"}, http.StatusOK},
+		{"[::1]:1234", []string{"-lan-only"}, http.StatusOK},
+		{"192.168.1.5:1234", []string{"-lan-only"}, http.StatusOK},
+		{"10.1.2.3:1234", []string{"-lan-only"}, http.StatusOK},
+		{"172.16.0.9:1234", []string{"-lan-only"}, http.StatusOK},
+		{"[fd00::1]:1234", []string{"-lan-only"}, http.StatusOK},
+		{"[fe80::1]:1234", []string{"-lan-only"}, http.StatusOK},
+		{"[::ffff:192.168.1.5]:1234", []string{"-lan-only"}, http.StatusOK},
+		{"8.8.8.8:1234", []string{"-lan-only"}, http.StatusForbidden},
+		{"172.32.0.1:1234", []string{"-lan-only"}, http.StatusForbidden},
+		{"[2001:db8::1]:1234", []string{"-lan-only"}, http.StatusForbidden},
+		{"[::ffff:8.8.8.8]:1234", []string{"-lan-only"}, http.StatusForbidden},
+		{"8.8.8.8:1234", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		h := newHandler(testArgs(t, dir, tt.flags...))
+		r := httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+		r.RemoteAddr = tt.remote
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("GET /a.txt from %s with %v = %d, want %d", tt.remote, tt.flags, w.Code, tt.status)
+		}
+	}
+}
+
+func TestListenLAN(t *testing.T) {
+	listeners, err := listenLAN([]string{"0"}, "tcp4")
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, l := range listeners {
+		defer l.Close()
+		addr, err := netip.ParseAddrPort(l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ip := addr.Addr(); !ip.Is4() || !ip.IsLoopback() && !ip.IsPrivate() {
+			t.Errorf("-lan-only listens on %s", ip)
+		}
+	}
+}
+
+// TestKeepAlive checks that -no-keepalive closes the connection after each
+// request, while connections are reused by default.
+func TestKeepAlive(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	for _, noKeepAlive := range []bool{false, true} {
+		flags := []string{}
+		if noKeepAlive {
+			flags = append(flags, "-no-keepalive")
+		}
+		srv := httptest.NewUnstartedServer(nil)
+		srv.Config = newServer(testArgs(t, dir, flags...))
+		srv.Start()
+		defer srv.Close()
+
+		var reused []bool
+		for range 3 {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+"/a.txt", nil)
+			req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+				GotConn: func(info httptrace.GotConnInfo) { reused = append(reused, info.Reused) },
+			}))
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.Close != noKeepAlive {
+				t.Errorf("-no-keepalive=%v GET /a.txt closes %v", noKeepAlive, resp.Close)
+			}
+		}
+		if want := []bool{false, !noKeepAlive, !noKeepAlive}; !slices.Equal(reused, want) {
+			t.Errorf("-no-keepalive=%v reused connections %v, want %v", noKeepAlive, reused, want)
+		}
+	}
+}
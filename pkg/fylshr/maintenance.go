@@ -0,0 +1,87 @@
+package fylshr
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// healthPath answers 200 while the server runs, even during maintenance and
+// without credentials, for load balancers and service managers.
+const healthPath = "/_health"
+
+// inMaintenance reports whether r should get the maintenance page while
+// enabled. Clients in allow can still use the server.
+func inMaintenance(r *http.Request, enabled *atomic.Bool, allow []netip.Prefix) bool {
+	if !enabled.Load() {
+		return false
+	}
+
+	ip, err := netip.ParseAddr(clientIP(r))
+	if err != nil {
+		return true
+	}
+
+	for _, prefix := range allow {
+		if prefix.Contains(ip.Unmap()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func serveHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writeBody(w, r, []byte("ok\n"))
+}
+
+func serveMaintenance(w http.ResponseWriter, r *http.Request, look *look) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Retry-After", "300")
+	if prefersJSON(r) {
+		writeError(w, r, http.StatusServiceUnavailable, "down for maintenance")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	writeBody(w, r, []byte(maintenancePage+look.style))
+}
+
+// parsePrefixes parses a comma separated list of CIDRs or single addresses.
+func parsePrefixes(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+const maintenancePage = `<!doctype html>
+<meta name="viewport" content="width=device-width">
+<title>Maintenance</title>
+<pre>
+Down for maintenance, please come back in a few minutes.
+</pre>
+`
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package fylshr
+
+import "sync/atomic"
+
+// handleMaintenanceSignal is a no-op where SIGUSR1 doesn't exist.
+func handleMaintenanceSignal(*atomic.Bool) {}
@@ -0,0 +1,33 @@
+package fylshr
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMaintenance(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+
+	tests := []struct {
+		name   string
+		flags  []string
+		path   string
+		status int
+	}{
+		{"file", nil, "/a.txt", http.StatusServiceUnavailable},
+		{"listing", nil, "/", http.StatusServiceUnavailable},
+		{"health", nil, healthPath, http.StatusOK},
+		{"health with auth", []string{"-token", "s3cret"}, healthPath, http.StatusOK},
+		{"metrics", []string{"-metrics"}, metricsPath, http.StatusOK},
+		{"allowed client", []string{"-maintenance-allow", "127.0.0.1"}, "/a.txt", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, dir, append([]string{"-maintenance"}, tt.flags...)...)
+			if resp, _ := do(t, srv, http.MethodGet, tt.path, nil); resp.StatusCode != tt.status {
+				t.Errorf("GET %s = %d, want %d", tt.path, resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
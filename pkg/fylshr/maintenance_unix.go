@@ -0,0 +1,25 @@
+//go:build unix
+
+package fylshr
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// handleMaintenanceSignal toggles maintenance mode on every SIGUSR1.
+func handleMaintenanceSignal(maintenance *atomic.Bool) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+
+	go func() {
+		for range signals {
+			enabled := !maintenance.Load()
+			maintenance.Store(enabled)
+			log.Println("maintenance mode:", enabled)
+		}
+	}()
+}
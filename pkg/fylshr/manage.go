@@ -0,0 +1,160 @@
+package fylshr
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const managePath = "/_api"
+
+// maxManageBody bounds the JSON of a managePath call.
+const maxManageBody = 64 << 10
+
+// manageMethods are accepted everywhere with -manage, DELETE removing the file
+// and POST calling the API under managePath.
+var manageMethods = []string{http.MethodPost, http.MethodDelete}
+
+// manageScript adds the buttons of -manage to a listing.
+//
+//go:embed manage.js
+var manageScript string
+
+// manageRequest is the body of a managePath call, with URL paths: Path is
+// what to rename to Name, move into the directory To, or make.
+type manageRequest struct {
+	Path string `json:"path"`
+	Name string `json:"name"`
+	To   string `json:"to"`
+}
+
+// serveManage deletes the file or directory, with its contents, of a DELETE
+// request, or answers the POST calls rename, move and mkdir under managePath.
+// Only paths allowed accepts are touched, never replacing an existing file.
+func serveManage(w http.ResponseWriter, r *http.Request, folder string, allowed func(name string) bool) {
+	if r.Method == http.MethodDelete {
+		name := path.Clean("/" + r.URL.Path)
+		file, err := managedPath(folder, name)
+		if err == nil && !allowed(name) {
+			err = fs.ErrPermission
+		}
+		if err == nil {
+			_, err = os.Lstat(file)
+		}
+		if err == nil {
+			err = os.RemoveAll(file)
+		}
+		if err != nil {
+			writeManageError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, r, http.StatusMethodNotAllowed, "405 method not allowed")
+		return
+	}
+	var req manageRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxManageBody)).Decode(&req); err != nil || req.Path == "" {
+		writeError(w, r, http.StatusBadRequest, "400 expected a JSON body with a path")
+		return
+	}
+	name := path.Clean("/" + req.Path)
+
+	op := strings.TrimPrefix(r.URL.Path, managePath+"/")
+	dest := name
+	switch op {
+	case "mkdir":
+	case "rename":
+		if req.Name == "" || req.Name == "." || req.Name == ".." || strings.ContainsAny(req.Name, `/\`) {
+			writeError(w, r, http.StatusBadRequest, "400 name must be a file name")
+			return
+		}
+		dest = path.Join(path.Dir(name), req.Name)
+	case "move":
+		if req.To == "" {
+			writeError(w, r, http.StatusBadRequest, "400 missing to")
+			return
+		}
+		dest = path.Join("/"+req.To, path.Base(name))
+		if hasPathPrefix(dest, name) {
+			writeError(w, r, http.StatusConflict, "409 can't move "+name+" into itself")
+			return
+		}
+	default:
+		writeError(w, r, http.StatusNotFound, "404 page not found")
+		return
+	}
+	if !allowed(name) || !allowed(dest) {
+		writeError(w, r, http.StatusForbidden, "403 forbidden")
+		return
+	}
+
+	destFile, err := managedPath(folder, dest)
+	if err != nil {
+		writeManageError(w, r, err)
+		return
+	}
+	if op == "mkdir" {
+		err = os.Mkdir(destFile, 0o755)
+	} else {
+		var file string
+		file, err = managedPath(folder, name)
+		if err == nil {
+			_, err = os.Lstat(file)
+		}
+		if err == nil {
+			if _, statErr := os.Lstat(destFile); statErr == nil {
+				err = fs.ErrExist
+			}
+		}
+		if err == nil {
+			err = os.Rename(file, destFile)
+		}
+	}
+	if err != nil {
+		writeManageError(w, r, err)
+		return
+	}
+	writeJSON(w, r, map[string]string{"path": dest})
+}
+
+// managedPath resolves the URL path name to a file of folder other than the
+// folder itself, refusing token and ignore files and any directory reached
+// through a symlink out of folder. A symlink itself is changed, not followed.
+func managedPath(folder, name string) (string, error) {
+	name = path.Clean("/" + name)
+	if base := path.Base(name); name == "/" || base == tokenFile || base == ignoreFile {
+		return "", fs.ErrPermission
+	}
+	dir, err := uploadDir(folder, path.Dir(name))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, path.Base(name)), nil
+}
+
+func writeManageError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		writeError(w, r, http.StatusNotFound, "404 page not found")
+	case errors.Is(err, fs.ErrPermission):
+		writeError(w, r, http.StatusForbidden, "403 forbidden")
+	case errors.Is(err, fs.ErrExist):
+		writeError(w, r, http.StatusConflict, "409 already exists")
+	default:
+		if unwrapped := errors.Unwrap(err); unwrapped != nil {
+			err = unwrapped
+		}
+		writeError(w, r, http.StatusConflict, "409 "+err.Error())
+	}
+}
@@ -0,0 +1,55 @@
+// Renames, moves and deletes the entries of a listing, and makes folders,
+// through the API of -manage, reloading the page once done.
+(() => {
+  const table = document.querySelector("table.listing[data-manage]")
+  if (!table) return
+  const api = table.dataset.manage
+  const dir = table.dataset.dir
+  const token = new URLSearchParams(location.search).get("token")
+
+  const call = async (href, init) => {
+    const url = new URL(href, location.href)
+    if (token) url.searchParams.set("token", token)
+    const res = await fetch(url, init)
+    if (res.ok) location.reload()
+    else alert(await res.text())
+  }
+  const post = (op, body) => call(api + "/" + op, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(body),
+  })
+
+  document.addEventListener("click", e => {
+    const button = e.target.closest("button[data-manage]")
+    if (!button) return
+    e.preventDefault()
+
+    if (button.dataset.manage === "mkdir") {
+      const name = prompt("New folder in " + dir)
+      if (name) post("mkdir", { path: dir + name })
+      return
+    }
+
+    const row = button.closest("tr[data-name]")
+    const name = row.dataset.name.replace(/\/$/, "")
+    const path = dir + name
+    switch (button.dataset.manage) {
+      case "rename": {
+        const to = prompt("Rename " + name + " to", name)
+        if (to && to !== name) post("rename", { path, name: to })
+        break
+      }
+      case "move": {
+        const to = prompt("Move " + name + " into the folder", dir)
+        if (to && to !== dir) post("move", { path, to })
+        break
+      }
+      case "delete": {
+        const what = row.dataset.name.endsWith("/") ? name + " and everything in it" : name
+        if (confirm("Delete " + what + "?")) call(row.querySelector("td a").href, { method: "DELETE" })
+        break
+      }
+    }
+  })
+})()
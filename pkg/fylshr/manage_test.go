@@ -0,0 +1,88 @@
+package fylshr
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManage(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		status  int
+		exists  []string
+		missing []string
+	}{
+		{"delete", http.MethodDelete, "/a.txt", "", http.StatusNoContent, nil, []string{"a.txt"}},
+		{"delete folder", http.MethodDelete, "/sub", "", http.StatusNoContent, nil, []string{"sub/b.txt", "sub"}},
+		{"delete missing", http.MethodDelete, "/nope.txt", "", http.StatusNotFound, nil, nil},
+		{"delete root", http.MethodDelete, "/", "", http.StatusForbidden, []string{"a.txt"}, nil},
+		{"delete token file", http.MethodDelete, "/sec/" + tokenFile + "?token=s3cret", "", http.StatusNotFound, []string{"sec/" + tokenFile}, nil},
+		{"delete in token dir", http.MethodDelete, "/sec/f.txt", "", http.StatusForbidden, []string{"sec/f.txt"}, nil},
+		{"delete in token dir with token", http.MethodDelete, "/sec/f.txt?token=s3cret", "", http.StatusNoContent, nil, []string{"sec/f.txt"}},
+		{"delete excluded", http.MethodDelete, "/debug.log", "", http.StatusNotFound, []string{"debug.log"}, nil},
+		{"rename", http.MethodPost, managePath + "/rename", `{"path": "/a.txt", "name": "c.txt"}`, http.StatusOK, []string{"c.txt"}, []string{"a.txt"}},
+		{"rename onto an existing file", http.MethodPost, managePath + "/rename", `{"path": "/sub/b.txt", "name": "c.txt"}`, http.StatusConflict, []string{"sub/b.txt", "sub/c.txt"}, nil},
+		{"rename with a slash", http.MethodPost, managePath + "/rename", `{"path": "/a.txt", "name": "../c.txt"}`, http.StatusBadRequest, []string{"a.txt"}, nil},
+		{"rename to a dotfile", http.MethodPost, managePath + "/rename", `{"path": "/a.txt", "name": ".env"}`, http.StatusForbidden, []string{"a.txt"}, nil},
+		{"rename to excluded", http.MethodPost, managePath + "/rename", `{"path": "/a.txt", "name": "a.log"}`, http.StatusForbidden, []string{"a.txt"}, nil},
+		{"move", http.MethodPost, managePath + "/move", `{"path": "/a.txt", "to": "/sub"}`, http.StatusOK, []string{"sub/a.txt"}, []string{"a.txt"}},
+		{"move into itself", http.MethodPost, managePath + "/move", `{"path": "/sub", "to": "/sub/deeper"}`, http.StatusConflict, []string{"sub/b.txt"}, nil},
+		{"move into a token dir", http.MethodPost, managePath + "/move", `{"path": "/a.txt", "to": "/sec"}`, http.StatusForbidden, []string{"a.txt"}, []string{"sec/a.txt"}},
+		{"move out of a token dir", http.MethodPost, managePath + "/move", `{"path": "/sec/f.txt", "to": "/"}`, http.StatusForbidden, []string{"sec/f.txt"}, []string{"f.txt"}},
+		{"move to a missing folder", http.MethodPost, managePath + "/move", `{"path": "/a.txt", "to": "/nope"}`, http.StatusNotFound, []string{"a.txt"}, nil},
+		{"mkdir", http.MethodPost, managePath + "/mkdir", `{"path": "/new"}`, http.StatusOK, []string{"new"}, nil},
+		{"mkdir existing", http.MethodPost, managePath + "/mkdir", `{"path": "/sub"}`, http.StatusConflict, []string{"sub/b.txt"}, nil},
+		{"no path", http.MethodPost, managePath + "/mkdir", `{}`, http.StatusBadRequest, nil, nil},
+		{"not JSON", http.MethodPost, managePath + "/mkdir", `path=/new`, http.StatusBadRequest, nil, []string{"new"}},
+		{"unknown call", http.MethodPost, managePath + "/chmod", `{"path": "/a.txt"}`, http.StatusNotFound, nil, nil},
+		{"get", http.MethodGet, managePath + "/mkdir", "", http.StatusMethodNotAllowed, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{
+				"a.txt":            "hello",
+				"sub/b.txt":        "nested",
+				"sub/c.txt":        "taken",
+				"debug.log":        "log",
+				"sec/" + tokenFile: "s3cret",
+				"sec/f.txt":        "private",
+			})
+			srv := newTestServer(t, dir, "-manage", "-token", "admin", "-exclude", "*.log")
+			if resp, body := do(t, srv, tt.method, tt.path, strings.NewReader(tt.body), "Content-Type: application/json", "Authorization: Bearer admin"); resp.StatusCode != tt.status {
+				t.Errorf("%s %s %s = %d %s, want %d", tt.method, tt.path, tt.body, resp.StatusCode, body, tt.status)
+			}
+			for _, name := range tt.exists {
+				if _, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+					t.Errorf("%s is gone: %v", name, err)
+				}
+			}
+			for _, name := range tt.missing {
+				if _, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(name))); err == nil {
+					t.Errorf("%s still exists", name)
+				}
+			}
+		})
+	}
+}
+
+func TestManageNeedsAuth(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	srv := newTestServer(t, dir, "-manage", "-token", "admin")
+	if resp, _ := do(t, srv, http.MethodDelete, "/a.txt", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("DELETE without the token = %d, want 401", resp.StatusCode)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.txt")); err != nil {
+		t.Errorf("a.txt deleted without the token: %v", err)
+	}
+	if resp, _ := do(t, newTestServer(t, dir, "-token", "admin"), http.MethodDelete, "/a.txt", nil, "Authorization: Bearer admin"); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE without -manage = %d, want 405", resp.StatusCode)
+	}
+}
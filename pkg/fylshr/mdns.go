@@ -0,0 +1,45 @@
+package fylshr
+
+import (
+	"net"
+	"os"
+	"strings"
+
+	"github.com/grandcat/zeroconf"
+)
+
+// advertise announces the server on the LAN over mDNS as
+// fylshr-<hostname>, with the path to open in a TXT record as browsers and
+// avahi expect for _http._tcp. The returned function withdraws it.
+func advertise(args Args, listeners []net.Listener) (func(), error) {
+	port := 0
+	for _, l := range listeners {
+		if addr, ok := l.Addr().(*net.TCPAddr); ok {
+			port = addr.Port
+			break
+		}
+	}
+	if port == 0 {
+		return func() {}, nil
+	}
+
+	hostname, _ := os.Hostname()
+	service := "_http._tcp"
+	if args.tls {
+		service = "_https._tcp"
+	}
+
+	server, err := zeroconf.Register(mdnsInstance(hostname), service, "local.", port, []string{"path=" + args.basePath + "/"}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return server.Shutdown, nil
+}
+
+// mdnsInstance names the service after the first label of hostname.
+func mdnsInstance(hostname string) string {
+	if hostname == "" {
+		return "fylshr"
+	}
+	return "fylshr-" + strings.Split(hostname, ".")[0]
+}
@@ -0,0 +1,70 @@
+package fylshr
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/grandcat/zeroconf"
+)
+
+func TestMDNSInstance(t *testing.T) {
+	tests := []struct {
+		hostname, want string
+	}{
+		{"laptop", "fylshr-laptop"},
+		{"laptop.home.arpa", "fylshr-laptop"},
+		{"", "fylshr"},
+	}
+	for _, tt := range tests {
+		if got := mdnsInstance(tt.hostname); got != tt.want {
+			t.Errorf("mdnsInstance(%q) = %q, want %q", tt.hostname, got, tt.want)
+		}
+	}
+}
+
+// TestAdvertise checks that the server is announced with its port and path,
+// and that without a TCP listener there is nothing to announce.
+func TestAdvertise(t *testing.T) {
+	unix, err := net.Listen("unix", filepath.Join(t.TempDir(), "fylshr.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close()
+	withdraw, err := advertise(testArgs(t, t.TempDir()), []net.Listener{unix})
+	if err != nil || withdraw == nil {
+		t.Fatalf("advertise of a Unix socket = %v, want nothing to withdraw", err)
+	}
+	withdraw()
+
+	l := bannerListener(t)
+	withdraw, err = advertise(testArgs(t, t.TempDir(), "-base-path", "/share"), []net.Listener{unix, l})
+	if err != nil {
+		t.Skipf("no mDNS here: %v", err)
+	}
+	defer withdraw()
+
+	resolver, err := zeroconf.NewResolver()
+	if err != nil {
+		t.Skipf("no mDNS here: %v", err)
+	}
+	hostname, _ := os.Hostname()
+	entries := make(chan *zeroconf.ServiceEntry, 4)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := resolver.Lookup(ctx, mdnsInstance(hostname), "_http._tcp", "local.", entries); err != nil {
+		t.Skipf("no mDNS here: %v", err)
+	}
+	select {
+	case e := <-entries:
+		if e.Port != l.Addr().(*net.TCPAddr).Port || !slices.Contains(e.Text, "path=/share/") {
+			t.Errorf("mDNS announces port %d with %q, want %d and path=/share/", e.Port, e.Text, l.Addr().(*net.TCPAddr).Port)
+		}
+	case <-ctx.Done():
+		t.Skip("no mDNS answer here")
+	}
+}
@@ -0,0 +1,100 @@
+package fylshr
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// methodsFor returns the methods accepted under name: those of the longest
+// -prefix-methods prefix containing it, or -methods plus inboxMethods in the
+// inbox, uploadMethods with -upload, manageMethods with -manage and
+// davMethods with -webdav. A prefix's methods are all its folder gets, so it
+// can stay read-only next to the writable ones. The endpoints add tusMethods
+// under tusPath with -upload, pasteMethods under pastePath with -paste and
+// archiveMethods under archivePath.
+func (args Args) methodsFor(name string) []string {
+	methods, longest := args.methods, 0
+	for _, p := range args.prefixMethods {
+		if len(p.prefix) > longest && hasPathPrefix(name, p.prefix) {
+			methods, longest = p.methods, len(p.prefix)
+		}
+	}
+	add := func(more ...string) {
+		for _, m := range more {
+			if !slices.Contains(methods, m) {
+				methods = append(slices.Clip(methods), m)
+			}
+		}
+	}
+	// The rest is per folder.
+	_, name = args.mountFor(name)
+	if longest == 0 {
+		if args.inbox != "" && hasPathPrefix(name, args.inbox) {
+			add(inboxMethods...)
+		}
+		if args.upload {
+			add(uploadMethods...)
+		}
+		if args.manage {
+			add(manageMethods...)
+		}
+		if args.webdav {
+			add(davMethods(args.upload)...)
+		}
+	}
+	if args.upload && hasPathPrefix(name, tusPath) {
+		add(uploadMethods...)
+		add(tusMethods...)
+	}
+	if args.paste && hasPathPrefix(name, pastePath) {
+		add(pasteMethods...)
+	}
+	if name == archivePath && !args.receive {
+		add(archiveMethods...)
+	}
+	return methods
+}
+
+type prefixMethods struct {
+	prefix  string
+	methods []string
+}
+
+type prefixMethodFlags []prefixMethods
+
+func (p *prefixMethodFlags) String() string {
+	entries := make([]string, len(*p))
+	for i, e := range *p {
+		entries[i] = e.prefix + "=" + strings.Join(e.methods, ",")
+	}
+	return strings.Join(entries, " ")
+}
+
+func (p *prefixMethodFlags) Set(value string) error {
+	prefix, list, ok := strings.Cut(value, "=")
+	if !ok || !strings.HasPrefix(prefix, "/") {
+		return fmt.Errorf("invalid prefix methods %q, expected \"/prefix=GET,HEAD\"", value)
+	}
+
+	methods, err := parseMethods(list)
+	if err != nil {
+		return err
+	}
+
+	*p = append(*p, prefixMethods{prefix: path.Clean(prefix), methods: methods})
+	return nil
+}
+
+func parseMethods(list string) ([]string, error) {
+	var methods []string
+	for _, method := range strings.Split(list, ",") {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if !isToken(method) {
+			return nil, fmt.Errorf("%q is not a method", method)
+		}
+		methods = append(methods, method)
+	}
+	return methods, nil
+}
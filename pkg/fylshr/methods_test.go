@@ -0,0 +1,76 @@
+package fylshr
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMethods(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+
+	tests := []struct {
+		name   string
+		flags  []string
+		method string
+		status int
+		allow  string
+	}{
+		{"get", nil, http.MethodGet, http.StatusOK, ""},
+		{"head", nil, http.MethodHead, http.StatusOK, ""},
+		{"post", nil, http.MethodPost, http.StatusMethodNotAllowed, "GET, HEAD"},
+		{"put", nil, http.MethodPut, http.StatusMethodNotAllowed, "GET, HEAD"},
+		{"delete", nil, http.MethodDelete, http.StatusMethodNotAllowed, "GET, HEAD"},
+		{"options", nil, http.MethodOptions, http.StatusMethodNotAllowed, "GET, HEAD"},
+		{"made up", nil, "BREW", http.StatusMethodNotAllowed, "GET, HEAD"},
+		{"get only", []string{"-methods", "GET"}, http.MethodHead, http.StatusMethodNotAllowed, "GET"},
+		{"lower case list", []string{"-methods", "get,head,options"}, http.MethodOptions, http.StatusOK, ""},
+		{"upload adds its methods", []string{"-upload"}, http.MethodDelete, http.StatusMethodNotAllowed, "GET, HEAD, POST, PUT"},
+		{"manage adds its methods", []string{"-manage", "-token", "t"}, http.MethodPut, http.StatusMethodNotAllowed, "GET, HEAD, POST, DELETE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, dir, tt.flags...)
+			resp, _ := do(t, srv, tt.method, "/a.txt", strings.NewReader(""), "Authorization: Bearer t")
+			if resp.StatusCode != tt.status || resp.Header.Get("Allow") != tt.allow {
+				t.Errorf("%s /a.txt = %d Allow %q, want %d %q", tt.method, resp.StatusCode, resp.Header.Get("Allow"), tt.status, tt.allow)
+			}
+		})
+	}
+}
+
+func TestParseMethods(t *testing.T) {
+	for list, ok := range map[string]bool{"GET,HEAD": true, " get , put ": true, "GET,": false, "GET HEAD": false, "": false, "G:T": false} {
+		if _, err := parseMethods(list); (err == nil) != ok {
+			t.Errorf("parseMethods(%q) = %v, want ok %v", list, err, ok)
+		}
+	}
+}
+
+// TestPrefixMethods serves a read-only prefix next to a writable one.
+func TestPrefixMethods(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"public/a.txt": "hello", "inbox/": "", "other/": ""})
+	srv := newTestServer(t, dir, "-upload", "-prefix-methods", "/public=GET,HEAD", "-prefix-methods", "/inbox=GET,HEAD,PUT,POST")
+
+	tests := []struct {
+		method, path string
+		status       int
+		allow        string
+	}{
+		{http.MethodGet, "/public/a.txt", http.StatusOK, ""},
+		{http.MethodPut, "/public/new.txt", http.StatusMethodNotAllowed, "GET, HEAD"},
+		{http.MethodPost, "/public/", http.StatusMethodNotAllowed, "GET, HEAD"},
+		{http.MethodPut, "/publicity.txt", http.StatusCreated, ""},
+		{http.MethodPut, "/inbox/new.txt", http.StatusCreated, ""},
+		{http.MethodDelete, "/inbox/new.txt", http.StatusMethodNotAllowed, "GET, HEAD, PUT, POST"},
+		{http.MethodPut, "/other/new.txt", http.StatusCreated, ""},
+	}
+	for _, tt := range tests {
+		resp, _ := do(t, srv, tt.method, tt.path, strings.NewReader("new"))
+		if resp.StatusCode != tt.status || resp.Header.Get("Allow") != tt.allow {
+			t.Errorf("%s %s = %d Allow %q, want %d %q", tt.method, tt.path, resp.StatusCode, resp.Header.Get("Allow"), tt.status, tt.allow)
+		}
+	}
+}
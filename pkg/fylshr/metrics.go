@@ -0,0 +1,209 @@
+package fylshr
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const metricsPath = "/_metrics"
+
+// durationBuckets are the upper bounds in seconds of the request duration
+// histogram, up to the minutes a big download takes.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900}
+
+// sizeBuckets are the upper bounds in bytes of the body size histograms, from
+// 256B by powers of 4 up to 16GiB.
+var sizeBuckets = func() []float64 {
+	var buckets []float64
+	for size := 256.0; size <= 16<<30; size *= 4 {
+		buckets = append(buckets, size)
+	}
+	return buckets
+}()
+
+// metricMethods are counted under their name, others as OTHER so a client
+// can't add labels at will.
+var metricMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "PROPFIND", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK", "PROPPATCH"}
+
+type metricKey struct {
+	method string
+	code   int
+}
+
+// metrics are what /_metrics reports with -metrics.
+type metrics struct {
+	sync.Mutex
+	requests      map[metricKey]uint64
+	bytes         uint64
+	durations     histogram
+	responseSizes histogram
+	requestSizes  histogram
+	inFlight      atomic.Int64
+	connections   atomic.Int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:      map[metricKey]uint64{},
+		durations:     newHistogram(durationBuckets),
+		responseSizes: newHistogram(sizeBuckets),
+		requestSizes:  newHistogram(sizeBuckets),
+	}
+}
+
+// withMetrics records every request h serves in m, with -metrics, and the size
+// of their bodies but those of metricsPath. With uploads, the bodies of
+// requests are measured as they are read.
+func withMetrics(m *metrics, enabled, uploads bool, h http.Handler) http.Handler {
+	if !enabled {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.inFlight.Add(1)
+		defer m.inFlight.Add(-1)
+
+		start := time.Now()
+		scrape := r.URL.Path == metricsPath
+		var body *countingBody
+		if uploads && r.Body != nil && r.Body != http.NoBody {
+			body = &countingBody{ReadCloser: r.Body}
+			r.Body = body
+		}
+		sw := &statusWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r)
+		m.record(r.Method, cmp.Or(sw.status, http.StatusOK), sw.bytes, time.Since(start))
+		if !scrape {
+			m.recordSizes(sw.bytes, body)
+		}
+	})
+}
+
+// countingBody counts the bytes read of a request body.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (m *metrics) record(method string, code int, bytes int64, d time.Duration) {
+	if !slices.Contains(metricMethods, method) {
+		method = "OTHER"
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	m.requests[metricKey{method, code}]++
+	m.bytes += uint64(bytes)
+	m.durations.observe(d.Seconds())
+}
+
+// recordSizes records the size of a response body, and of the request body
+// unless nil.
+func (m *metrics) recordSizes(response int64, request *countingBody) {
+	m.Lock()
+	defer m.Unlock()
+	m.responseSizes.observe(float64(response))
+	if request != nil {
+		m.requestSizes.observe(float64(request.n))
+	}
+}
+
+// histogram counts observations under the upper bounds of its buckets.
+type histogram struct {
+	bounds  []float64
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(bounds []float64) histogram {
+	return histogram{bounds: bounds, buckets: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.count++
+	h.sum += v
+	if i, _ := slices.BinarySearch(h.bounds, v); i < len(h.bounds) {
+		h.buckets[i]++
+	}
+}
+
+// write writes the cumulative buckets, sum and count of h as name.
+func (h *histogram) write(b *strings.Builder, name string) {
+	var cumulative uint64
+	for i, le := range h.bounds {
+		cumulative += h.buckets[i]
+		fmt.Fprintf(b, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(le, 'f', -1, 64), cumulative)
+	}
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(b, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(b, "%s_count %d\n", name, h.count)
+}
+
+// connState counts the open connections of the server.
+func (m *metrics) connState(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		m.connections.Add(1)
+	case http.StateClosed, http.StateHijacked:
+		m.connections.Add(-1)
+	}
+}
+
+// serveMetrics answers the metrics in the Prometheus text format.
+func serveMetrics(w http.ResponseWriter, r *http.Request, m *metrics) {
+	var b strings.Builder
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	m.Lock()
+	metric("fylshr_requests_total", "counter", "Requests served, by method and status code.")
+	keys := make([]metricKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b metricKey) int {
+		return cmp.Or(strings.Compare(a.method, b.method), cmp.Compare(a.code, b.code))
+	})
+	for _, key := range keys {
+		fmt.Fprintf(&b, "fylshr_requests_total{method=%q,code=\"%d\"} %d\n", key.method, key.code, m.requests[key])
+	}
+
+	metric("fylshr_response_bytes_total", "counter", "Bytes of response bodies sent.")
+	fmt.Fprintf(&b, "fylshr_response_bytes_total %d\n", m.bytes)
+
+	metric("fylshr_request_duration_seconds", "histogram", "Time to serve requests, including the whole transfer.")
+	m.durations.write(&b, "fylshr_request_duration_seconds")
+	metric("fylshr_response_size_bytes", "histogram", "Sizes of response bodies, but those of the metrics.")
+	m.responseSizes.write(&b, "fylshr_response_size_bytes")
+	metric("fylshr_request_size_bytes", "histogram", "Sizes of request bodies read, with -upload.")
+	m.requestSizes.write(&b, "fylshr_request_size_bytes")
+	m.Unlock()
+
+	metric("fylshr_requests_in_flight", "gauge", "Requests being served.")
+	fmt.Fprintf(&b, "fylshr_requests_in_flight %d\n", m.inFlight.Load())
+	metric("fylshr_connections_open", "gauge", "Open client connections.")
+	fmt.Fprintf(&b, "fylshr_connections_open %d\n", m.connections.Load())
+	metric("fylshr_start_time_seconds", "gauge", "Start time of the server since the Unix epoch.")
+	fmt.Fprintf(&b, "fylshr_start_time_seconds %d\n", startTime.Unix())
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Length", strconv.Itoa(b.Len()))
+	writeBody(w, r, []byte(b.String()))
+}
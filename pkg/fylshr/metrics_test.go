@@ -0,0 +1,99 @@
+package fylshr
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestMetrics checks the counters and gauges /_metrics reports, and that it
+// is only served with -metrics to those allowed in.
+func TestMetrics(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Config = newServer(testArgs(t, dir, "-metrics"))
+	srv.Start()
+	defer srv.Close()
+
+	var sent int
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/a.txt"},
+		{http.MethodGet, "/a.txt"},
+		{http.MethodGet, "/missing.txt"},
+		{http.MethodHead, "/a.txt"},
+		{"BREW", "/a.txt"},
+	} {
+		_, body := do(t, srv, req.method, req.path, nil, "Accept-Encoding: identity")
+		sent += len(body)
+	}
+	resp, body := do(t, srv, http.MethodGet, metricsPath, nil)
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/plain; version=0.0.4; charset=utf-8" || resp.Header.Get("Cache-Control") != "no-store" {
+		t.Errorf("GET %s = %d Content-Type %q Cache-Control %q", metricsPath, resp.StatusCode, resp.Header.Get("Content-Type"), resp.Header.Get("Cache-Control"))
+	}
+	if strings.Contains(body, `method="BREW"`) {
+		t.Errorf("metrics label the unknown method BREW:\n%s", body)
+	}
+	for _, want := range []string{
+		`^# TYPE fylshr_requests_total counter$`,
+		`^fylshr_requests_total\{method="GET",code="200"\} 2$`,
+		`^fylshr_requests_total\{method="GET",code="404"\} 1$`,
+		`^fylshr_requests_total\{method="HEAD",code="200"\} 1$`,
+		`^fylshr_requests_total\{method="OTHER",code="405"\} 1$`,
+		fmt.Sprintf(`^fylshr_response_bytes_total %d$`, sent),
+		`^# TYPE fylshr_request_duration_seconds histogram$`,
+		`^fylshr_request_duration_seconds_bucket\{le="\+Inf"\} 5$`,
+		`^fylshr_request_duration_seconds_count 5$`,
+		`^fylshr_requests_in_flight 1$`,
+		`^fylshr_connections_open [1-9]$`,
+		`^fylshr_start_time_seconds [0-9]+$`,
+	} {
+		if !regexp.MustCompile("(?m)" + want).MatchString(body) {
+			t.Errorf("metrics lack %s:\n%s", want, body)
+		}
+	}
+
+	tests := []struct {
+		flags   []string
+		headers []string
+		status  int
+	}{
+		{nil, nil, http.StatusNotFound},
+		{[]string{"-metrics", "-token", "s3cret"}, nil, http.StatusUnauthorized},
+		{[]string{"-metrics", "-token", "s3cret"}, []string{"Authorization: Bearer s3cret"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if resp, _ := do(t, newTestServer(t, dir, tt.flags...), http.MethodGet, metricsPath, nil, tt.headers...); resp.StatusCode != tt.status {
+			t.Errorf("%v GET %s %v = %d, want %d", tt.flags, metricsPath, tt.headers, resp.StatusCode, tt.status)
+		}
+	}
+}
+
+func TestMetricsSizes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	srv := newTestServer(t, dir, "-metrics", "-upload")
+
+	do(t, srv, http.MethodGet, metricsPath, nil)
+	do(t, srv, http.MethodGet, "/a.txt", nil)
+	do(t, srv, http.MethodPut, "/up.txt", strings.NewReader(strings.Repeat("x", 2000)))
+	_, body := do(t, srv, http.MethodGet, metricsPath, nil)
+
+	for _, want := range []string{
+		`fylshr_response_size_bytes_bucket{le="256"} 2`,
+		`fylshr_response_size_bytes_count 2`,
+		`fylshr_request_size_bytes_bucket{le="1024"} 0`,
+		`fylshr_request_size_bytes_bucket{le="4096"} 1`,
+		`fylshr_request_size_bytes_bucket{le="+Inf"} 1`,
+		`fylshr_request_size_bytes_sum 2000`,
+		`fylshr_request_duration_seconds_count 3`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics lack %s:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package fylshr
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// mediaTypes are downloaded rather than opened with -disposition auto, and
+// exempt from -request-timeout and -buffer-size for being large. A type/*
+// pattern stands for all of its subtypes. The attachment list of -mime-file
+// replaces them for its server.
+var mediaTypes = []string{
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"video/mp4",
+	"video/mpeg",
+	"video/webm",
+	"video/quicktime",
+	"application/pdf",
+	"application/msword",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"application/vnd.ms-powerpoint",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	"application/vnd.ms-excel",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"audio/mpeg",
+	"audio/wav",
+	"audio/ogg",
+	"audio/midi",
+	"application/ogg",
+	"application/x-7z-compressed",
+	"application/zip",
+	"application/x-rar-compressed",
+	"application/x-tar",
+	"application/x-bzip2",
+	"application/x-gzip",
+	"application/x-zip-compressed",
+	"application/x-tar-gz",
+	"application/x-compressed-tar",
+}
+
+// mimeFile is the -mime-file TOML: Content-Types by extension, and the types
+// downloaded as attachments.
+type mimeFile struct {
+	Attachment []string          `toml:"attachment"`
+	Types      map[string]string `toml:"types"`
+}
+
+// mimeTypes are the Content-Types of a server's files: those of -mime-file
+// and -mime by extension, beating the mime package's, and media, the types
+// downloaded as attachments.
+type mimeTypes struct {
+	byExt map[string]string
+	media []string
+}
+
+// custom returns the type -mime-file or -mime gives to filename, from its
+// extension, or "" to leave it to the mime package.
+func (types mimeTypes) custom(filename string) string {
+	return types.byExt[strings.ToLower(filepath.Ext(filename))]
+}
+
+// typeOf returns the type of filename from its extension, "" when unknown.
+func (types mimeTypes) typeOf(filename string) string {
+	if mimeType := types.custom(filename); mimeType != "" {
+		return mimeType
+	}
+	return mime.TypeByExtension(filepath.Ext(filename))
+}
+
+// isMedia reports whether the type of filename, from its extension, is one of
+// the media types.
+func (types mimeTypes) isMedia(filename string) bool {
+	mediaType, _, _ := mime.ParseMediaType(types.typeOf(filename))
+	return mediaType != "" && slices.ContainsFunc(types.media, func(pattern string) bool {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		return pattern == mediaType || ok && strings.HasPrefix(mediaType, prefix)
+	})
+}
+
+// loadMimeTypes returns the types of the file name, if any, then those of
+// -mime so the command line wins, with mediaTypes unless the file lists its
+// own.
+func loadMimeTypes(name string, types mimeFlags) (mimeTypes, error) {
+	loaded := mimeTypes{byExt: map[string]string{}, media: mediaTypes}
+	if name != "" {
+		var file mimeFile
+		meta, err := toml.DecodeFile(name, &file)
+		if err != nil {
+			return loaded, err
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return loaded, fmt.Errorf("unknown setting %q", undecoded[0].String())
+		}
+		if meta.IsDefined("attachment") {
+			loaded.media = nil
+			for _, pattern := range file.Attachment {
+				if typ, subtype, ok := strings.Cut(pattern, "/"); !ok || typ == "" || subtype == "" {
+					return loaded, fmt.Errorf("invalid attachment type %q", pattern)
+				}
+				loaded.media = append(loaded.media, strings.ToLower(pattern))
+			}
+		}
+		for ext, mimeType := range file.Types {
+			if err := mimeFlags(loaded.byExt).Set(ext + "=" + mimeType); err != nil {
+				return loaded, err
+			}
+		}
+	}
+	for ext, mimeType := range types {
+		loaded.byExt[ext] = mimeType
+	}
+	return loaded, nil
+}
+
+// mimeFlags maps extensions to the Content-Type of -mime.
+type mimeFlags map[string]string
+
+func (m mimeFlags) String() string {
+	entries := make([]string, 0, len(m))
+	for ext, mimeType := range m {
+		entries = append(entries, ext+"="+mimeType)
+	}
+	slices.Sort(entries)
+	return strings.Join(entries, " ")
+}
+
+func (m mimeFlags) Set(value string) error {
+	ext, mimeType, ok := strings.Cut(value, "=")
+	ext, mimeType = strings.ToLower(strings.TrimSpace(ext)), strings.TrimSpace(mimeType)
+	if _, _, err := mime.ParseMediaType(mimeType); !ok || ext == "" || err != nil {
+		return fmt.Errorf("invalid type %q, expected \".ext=type/subtype\"", value)
+	}
+
+	if ext[0] != '.' {
+		ext = "." + ext
+	}
+	m[ext] = mimeType
+	return nil
+}
+
+// extensionlessType picks the Content-Type of a file without an extension:
+// sniffed from its first 512 bytes with sniff, or defaultType otherwise. It
+// returns "" to let the file server decide. None of these types are media,
+// so such files are never forced to download.
+func extensionlessType(name, defaultType string, sniff bool) string {
+	f, err := os.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+
+	if !sniff {
+		return defaultType
+	}
+
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	return http.DetectContentType(buf[:n])
+}
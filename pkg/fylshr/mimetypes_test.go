@@ -0,0 +1,77 @@
+package fylshr
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtensionlessType(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"README":    "Read me first",
+		"blob":      "\x00\x01\x02\x03",
+		"image":     "\x89PNG\r\n\x1a\nrest",
+		"a.json":    `{"a": 1}`,
+		"LICENSE/x": "",
+	})
+
+	tests := []struct {
+		flags      []string
+		path, want string
+	}{
+		{nil, "/README", "text/plain; charset=utf-8"},
+		{[]string{"-default-type", "text/markdown"}, "/README", "text/markdown"},
+		{[]string{"-default-type", "text/plain"}, "/blob", "text/plain"},
+		{[]string{"-default-type", "text/plain"}, "/a.json", "application/json"},
+		{[]string{"-default-type", "text/plain"}, "/LICENSE/", "text/html; charset=utf-8"},
+		{[]string{"-sniff"}, "/README", "text/plain; charset=utf-8"},
+		{[]string{"-sniff"}, "/blob", "application/octet-stream"},
+		{[]string{"-sniff"}, "/image", "image/png"},
+		{[]string{"-sniff", "-default-type", "text/markdown"}, "/README", "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, tt.flags...)
+		resp, _ := do(t, srv, http.MethodGet, tt.path, nil)
+		if got := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || got != tt.want {
+			t.Errorf("%v GET %s = %d %s, want %s", tt.flags, tt.path, resp.StatusCode, got, tt.want)
+		}
+		if disposition := resp.Header.Get("Content-Disposition"); tt.path == "/README" && disposition != "" {
+			t.Errorf("%v GET %s Content-Disposition %q, want it inline", tt.flags, tt.path, disposition)
+		}
+	}
+}
+
+// TestMimeTypes checks that -mime and -mime-file set the types and
+// attachments of their own server only.
+func TestMimeTypes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.foo":      "hello",
+		"a.pdf":      "%PDF-1.4",
+		"text.toml":  "attachment = [\"text/*\"]\n[types]\n\".foo\" = \"text/x-foo\"\n",
+		"empty.toml": "attachment = []\n",
+	})
+
+	tests := []struct {
+		flags      []string
+		path, want string
+		attached   bool
+	}{
+		{[]string{"-mime", ".foo=video/mp4"}, "/a.foo", "video/mp4", true},
+		{[]string{"-mime", "FOO=video/mp4"}, "/a.foo", "video/mp4", true},
+		{nil, "/a.foo", "text/plain; charset=utf-8", false},
+		{[]string{"-mime-file", filepath.Join(dir, "text.toml")}, "/a.foo", "text/x-foo", true},
+		{[]string{"-mime-file", filepath.Join(dir, "text.toml"), "-mime", ".foo=text/x-other"}, "/a.foo", "text/x-other", true},
+		{[]string{"-mime-file", filepath.Join(dir, "empty.toml")}, "/a.pdf", "application/pdf", false},
+		{nil, "/a.pdf", "application/pdf", true},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, tt.flags...)
+		resp, _ := do(t, srv, http.MethodGet, tt.path, nil)
+		got, attached := resp.Header.Get("Content-Type"), resp.Header.Get("Content-Disposition") != ""
+		if resp.StatusCode != http.StatusOK || got != tt.want || attached != tt.attached {
+			t.Errorf("%v GET %s = %d %s, attachment %v, want %s, attachment %v", tt.flags, tt.path, resp.StatusCode, got, attached, tt.want, tt.attached)
+		}
+	}
+}
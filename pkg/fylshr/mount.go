@@ -0,0 +1,122 @@
+package fylshr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// mount serves the folder dir under the URL path prefix, which has no
+// trailing slash.
+type mount struct {
+	prefix string
+	dir    string
+}
+
+// mountFlags collects repeated -mount /prefix=folder flags.
+type mountFlags []mount
+
+func (m *mountFlags) String() string {
+	var s []string
+	for _, mount := range *m {
+		s = append(s, mount.prefix+"="+mount.dir)
+	}
+	return strings.Join(s, ",")
+}
+
+func (m *mountFlags) Set(value string) error {
+	prefix, dir, ok := strings.Cut(value, "=")
+	if !ok || dir == "" {
+		return errors.New("expected /prefix=folder")
+	}
+	prefix = cleanBasePath(prefix)
+	if prefix == "" {
+		return errors.New("the prefix can't be /, it's the index of the mounts")
+	}
+	for _, other := range *m {
+		if hasPathPrefix(prefix, other.prefix) || hasPathPrefix(other.prefix, prefix) {
+			return fmt.Errorf("%s overlaps %s", prefix, other.prefix)
+		}
+	}
+	*m = append(*m, mount{prefix, dir})
+	return nil
+}
+
+// mountFor returns the mount serving name and the path of name in it, or nil
+// when no mount does.
+func (args Args) mountFor(name string) (*mount, string) {
+	for i, m := range args.mounts {
+		if hasPathPrefix(name, m.prefix) {
+			return &args.mounts[i], "/" + strings.TrimPrefix(strings.TrimPrefix(name, m.prefix), "/")
+		}
+	}
+	return nil, name
+}
+
+// servedFolders returns the folders on disk being served: those of -mount, or
+// -folder and -overlay.
+func (args Args) servedFolders() []string {
+	if len(args.mounts) == 0 {
+		return args.layers()
+	}
+	var folders []string
+	for _, m := range args.mounts {
+		folders = append(folders, m.dir)
+	}
+	return folders
+}
+
+// newMountsHandler serves each -mount like -folder under its prefix, and an
+// index of the mounts on /.
+func newMountsHandler(args Args) http.HandlerFunc {
+	handlers := make([]http.Handler, len(args.mounts))
+	for i, m := range args.mounts {
+		mountArgs := args
+		mountArgs.folder, mountArgs.basePath, mountArgs.mounts = m.dir, args.basePath+m.prefix, nil
+		mountArgs.hooks = args.hooks.under(m.prefix)
+		handlers[i] = http.StripPrefix(m.prefix, newFilesHandler(mountArgs))
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		for i, m := range args.mounts {
+			if r.URL.Path == m.prefix {
+				target := args.basePath + m.prefix + "/"
+				if r.URL.RawQuery != "" {
+					target += "?" + r.URL.RawQuery
+				}
+				http.Redirect(w, r, target, http.StatusMovedPermanently)
+				return
+			}
+			if hasPathPrefix(r.URL.Path, m.prefix) {
+				handlers[i].ServeHTTP(w, r)
+				return
+			}
+		}
+
+		if r.URL.Path != "/" {
+			writeError(w, r, http.StatusNotFound, "404 page not found")
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, r, http.StatusMethodNotAllowed, "405 method not allowed")
+			return
+		}
+
+		var entries []listingEntry
+		for _, m := range args.mounts {
+			info, err := os.Stat(m.dir)
+			if err != nil {
+				continue
+			}
+			e := newListingEntry(info, args.mimeTypes)
+			e.Name = strings.TrimPrefix(m.prefix, "/") + "/"
+			e.Href = (&url.URL{Path: e.Name}).String()
+			entries = append(entries, e)
+		}
+		renderListing(w, r, listingPage{Path: "/"}, entries, listingOptions{basePath: args.basePath, look: args.look})
+	}
+}
@@ -0,0 +1,76 @@
+package fylshr
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMounts(t *testing.T) {
+	photos, docs := t.TempDir(), t.TempDir()
+	writeFiles(t, photos, map[string]string{"a.jpg": "photo", "sec/" + tokenFile: "s3cret", "sec/b.jpg": "secret photo"})
+	writeFiles(t, docs, map[string]string{"notes.txt": "notes", "sub/c.txt": "nested"})
+
+	tests := []struct {
+		basePath string
+		method   string
+		path     string
+		status   int
+		body     string
+		location string
+	}{
+		{"", http.MethodGet, "/photos/a.jpg", http.StatusOK, "photo", ""},
+		{"", http.MethodGet, "/work/docs/notes.txt", http.StatusOK, "notes", ""},
+		{"", http.MethodGet, "/work/docs/sub/c.txt", http.StatusOK, "nested", ""},
+		{"", http.MethodGet, "/work/docs/sub/", http.StatusOK, `href="c.txt"`, ""},
+		{"", http.MethodGet, "/photos", http.StatusMovedPermanently, "", "/photos/"},
+		{"", http.MethodGet, "/photos?sort=size", http.StatusMovedPermanently, "", "/photos/?sort=size"},
+		{"", http.MethodGet, "/photos/sec/b.jpg", http.StatusForbidden, "", ""},
+		{"", http.MethodGet, "/photos/sec/b.jpg?token=s3cret", http.StatusOK, "secret photo", ""},
+		{"", http.MethodGet, "/photosx/a.jpg", http.StatusNotFound, "", ""},
+		{"", http.MethodGet, "/work/", http.StatusNotFound, "", ""},
+		{"", http.MethodGet, "/a.jpg", http.StatusNotFound, "", ""},
+		{"", http.MethodGet, "/", http.StatusOK, `href="photos/"`, ""},
+		{"", http.MethodGet, "/", http.StatusOK, `href="work/docs/"`, ""},
+		{"", http.MethodPost, "/", http.StatusMethodNotAllowed, "", ""},
+		{"/share", http.MethodGet, "/share/photos/a.jpg", http.StatusOK, "photo", ""},
+		{"/share", http.MethodGet, "/share/photos", http.StatusMovedPermanently, "", "/share/photos/"},
+		{"/share", http.MethodGet, "/share/", http.StatusOK, `href="work/docs/"`, ""},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, "", "-mount", "/photos="+photos, "-mount", "/work/docs="+docs, "-base-path", tt.basePath)
+		resp, body := do(t, srv, tt.method, tt.path, nil)
+		if resp.StatusCode != tt.status || !strings.Contains(body, tt.body) || resp.Header.Get("Location") != tt.location {
+			t.Errorf("%s %s = %d %q Location %q, want %d %q %q", tt.method, tt.path, resp.StatusCode, body, resp.Header.Get("Location"), tt.status, tt.body, tt.location)
+		}
+	}
+}
+
+func TestMountFlags(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   string
+		ok     bool
+	}{
+		{[]string{"/photos=/srv/photos"}, "/photos=/srv/photos", true},
+		{[]string{"photos/=/srv/photos", "/docs=/srv/docs"}, "/photos=/srv/photos,/docs=/srv/docs", true},
+		{[]string{"/photos=/a", "/photo=/b"}, "/photos=/a,/photo=/b", true},
+		{[]string{"/=/srv"}, "", false},
+		{[]string{"/photos"}, "", false},
+		{[]string{"/photos="}, "", false},
+		{[]string{"/photos=/a", "/photos/2024=/b"}, "", false},
+		{[]string{"/photos/2024=/b", "/photos=/a"}, "", false},
+	}
+	for _, tt := range tests {
+		var m mountFlags
+		var err error
+		for _, v := range tt.values {
+			if err = m.Set(v); err != nil {
+				break
+			}
+		}
+		if (err == nil) != tt.ok || tt.ok && m.String() != tt.want {
+			t.Errorf("-mount %v = %s, %v, want %s, ok %v", tt.values, m.String(), err, tt.want, tt.ok)
+		}
+	}
+}
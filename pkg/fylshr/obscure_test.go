@@ -0,0 +1,56 @@
+package fylshr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestObscure(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "sub/b.txt": "nested"})
+
+	for _, basePath := range []string{"", "/share"} {
+		args := testArgs(t, dir, "-obscure", "-base-path", basePath)
+		secret, ok := strings.CutPrefix(args.basePath, basePath+"/s/")
+		if !ok || !regexp.MustCompile(`^[`+pasteAlphabet+`]{10}$`).MatchString(secret) {
+			t.Fatalf("-obscure -base-path %q serves under %q, want %s/s/<secret>", basePath, args.basePath, basePath)
+		}
+		srv := httptest.NewServer(newHandler(args))
+		defer srv.Close()
+
+		prefix, wrong := args.basePath, "a"+secret[1:]
+		if secret[0] == 'a' {
+			wrong = "b" + secret[1:]
+		}
+		tests := []struct {
+			path     string
+			status   int
+			body     string
+			location string
+		}{
+			{prefix + "/a.txt", http.StatusOK, "hello", ""},
+			{prefix + "/sub/b.txt", http.StatusOK, "nested", ""},
+			{prefix + "/", http.StatusOK, `href="a.txt"`, ""},
+			{prefix, http.StatusMovedPermanently, "", prefix + "/"},
+			{"/a.txt", http.StatusNotFound, "", ""},
+			{basePath + "/a.txt", http.StatusNotFound, "", ""},
+			{basePath + "/s/", http.StatusNotFound, "", ""},
+			{basePath + "/s/" + wrong + "/a.txt", http.StatusNotFound, "", ""},
+			{basePath + "/s/" + secret[:9] + "/a.txt", http.StatusNotFound, "", ""},
+			{"/", http.StatusNotFound, "", ""},
+		}
+		for _, tt := range tests {
+			resp, body := do(t, srv, http.MethodGet, tt.path, nil)
+			if resp.StatusCode != tt.status || !strings.Contains(body, tt.body) || resp.Header.Get("Location") != tt.location {
+				t.Errorf("GET %s = %d %q Location %q, want %d %q %q", tt.path, resp.StatusCode, body, resp.Header.Get("Location"), tt.status, tt.body, tt.location)
+			}
+		}
+	}
+
+	if a, b := testArgs(t, dir, "-obscure"), testArgs(t, dir, "-obscure"); a.basePath == b.basePath {
+		t.Errorf("-obscure served both runs under %s", a.basePath)
+	}
+}
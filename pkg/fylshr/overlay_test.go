@@ -0,0 +1,102 @@
+package fylshr
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOverlay(t *testing.T) {
+	top, lower := t.TempDir(), t.TempDir()
+	writeFiles(t, top, map[string]string{
+		"a.txt":         "top a",
+		"top.txt":       "top only",
+		"docs/t.txt":    "top doc",
+		"shadow":        "top file",
+		"dir/x.txt":     "top dir",
+		"sec/open.txt":  "top sec",
+		"nested/i.html": "top nested",
+	})
+	writeFiles(t, lower, map[string]string{
+		"a.txt":            "lower a",
+		"lower.txt":        "lower only",
+		"docs/l.txt":       "lower doc",
+		"docs/t.txt":       "lower doc t",
+		"shadow/s.txt":     "shadowed",
+		"dir":              "lower file",
+		"sec/" + tokenFile: "s3cret",
+		".env":             "SECRET=1",
+	})
+	srv := newTestServer(t, top, "-overlay", lower)
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/a.txt", http.StatusOK, "top a"},
+		{"/top.txt", http.StatusOK, "top only"},
+		{"/lower.txt", http.StatusOK, "lower only"},
+		{"/docs/t.txt", http.StatusOK, "top doc"},
+		{"/docs/l.txt", http.StatusOK, "lower doc"},
+		{"/shadow", http.StatusOK, "top file"},
+		{"/shadow/s.txt", http.StatusNotFound, ""},
+		{"/dir/x.txt", http.StatusOK, "top dir"},
+		{"/sec/open.txt", http.StatusForbidden, ""},
+		{"/sec/open.txt?token=s3cret", http.StatusOK, "top sec"},
+		{"/.env", http.StatusNotFound, ""},
+		{"/missing.txt", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, srv, http.MethodGet, tt.path, nil)
+		if resp.StatusCode != tt.status || tt.body != "" && body != tt.body {
+			t.Errorf("GET %s = %d %q, want %d %q", tt.path, resp.StatusCode, body, tt.status, tt.body)
+		}
+	}
+
+	listings := map[string][]string{
+		"/":      {"a.txt", "dir", "docs", "lower.txt", "nested", "sec", "shadow", "top.txt"},
+		"/docs/": {"l.txt", "t.txt"},
+		"/dir/":  {"x.txt"},
+	}
+	for path, want := range listings {
+		_, body := do(t, srv, http.MethodGet, path+"?format=json", nil)
+		var listing struct {
+			Entries []struct{ Name string }
+		}
+		if err := json.Unmarshal([]byte(body), &listing); err != nil {
+			t.Fatalf("GET %s: %s in %s", path, err, body)
+		}
+		var names []string
+		for _, e := range listing.Entries {
+			names = append(names, e.Name)
+		}
+		slices.Sort(names)
+		if !slices.Equal(names, want) {
+			t.Errorf("GET %s lists %v, want %v", path, names, want)
+		}
+	}
+}
+
+func TestOverlayPrecedence(t *testing.T) {
+	first, second, third := t.TempDir(), t.TempDir(), t.TempDir()
+	writeFiles(t, first, map[string]string{"one.txt": "first"})
+	writeFiles(t, second, map[string]string{"a.txt": "second", "two.txt": "second"})
+	writeFiles(t, third, map[string]string{"a.txt": "third", "two.txt": "third", "three.txt": "third"})
+	srv := newTestServer(t, first, "-overlay", second, "-overlay", third)
+
+	for path, want := range map[string]string{"/one.txt": "first", "/a.txt": "second", "/two.txt": "second", "/three.txt": "third"} {
+		if resp, body := do(t, srv, http.MethodGet, path, nil); resp.StatusCode != http.StatusOK || body != want {
+			t.Errorf("GET %s = %d %q, want %q", path, resp.StatusCode, body, want)
+		}
+	}
+
+	args := testArgs(t, first)
+	args.overlay = folderFlags{filepath.Join(first, "missing")}
+	if err := validate(args); err == nil || !strings.Contains(err.Error(), "-overlay") {
+		t.Errorf("validate with a missing -overlay = %v, want an error", err)
+	}
+}
@@ -0,0 +1,258 @@
+package fylshr
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	pastePath = "/_paste"
+	// maxPasteSize is the most text a paste can hold.
+	maxPasteSize = 1 << 20
+	// maxPastes is how many pastes are kept in memory, the oldest make room
+	// for new ones.
+	maxPastes = 1024
+	// pasteIDLength is the length of paste IDs, from pasteAlphabet.
+	pasteIDLength = 6
+	// pasteAlphabet leaves out letters easily mistaken for one another when a
+	// link is read out or typed.
+	pasteAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// pasteExpiries are offered by the form on /_paste.
+var pasteExpiries = []struct{ Value, Label string }{
+	{"", "Never"},
+	{"10m", "10 minutes"},
+	{"1h", "1 hour"},
+	{"24h", "1 day"},
+	{"168h", "1 week"},
+}
+
+// pasteMethods are accepted under pastePath with -paste.
+var pasteMethods = []string{http.MethodPost}
+
+type paste struct {
+	text     []byte
+	markdown bool
+	created  time.Time
+	// expires is zero for pastes kept until the server stops.
+	expires time.Time
+}
+
+// pasteStore keeps the text posted to /_paste in memory.
+type pasteStore struct {
+	sync.Mutex
+	pastes map[string]*paste
+}
+
+func newPasteStore() *pasteStore {
+	return &pasteStore{pastes: map[string]*paste{}}
+}
+
+func (s *pasteStore) add(p *paste) string {
+	s.Lock()
+	defer s.Unlock()
+
+	if len(s.pastes) >= maxPastes {
+		oldest := ""
+		for id, q := range s.pastes {
+			if q.expired() {
+				delete(s.pastes, id)
+			} else if oldest == "" || q.created.Before(s.pastes[oldest].created) {
+				oldest = id
+			}
+		}
+		if len(s.pastes) >= maxPastes {
+			delete(s.pastes, oldest)
+		}
+	}
+
+	for {
+		b := make([]byte, pasteIDLength)
+		rand.Read(b)
+		for i := range b {
+			b[i] = pasteAlphabet[int(b[i])%len(pasteAlphabet)]
+		}
+		if id := string(b); s.pastes[id] == nil {
+			s.pastes[id] = p
+			return id
+		}
+	}
+}
+
+func (s *pasteStore) get(id string) *paste {
+	s.Lock()
+	defer s.Unlock()
+
+	p := s.pastes[id]
+	if p != nil && p.expired() {
+		delete(s.pastes, id)
+		return nil
+	}
+	return p
+}
+
+func (p *paste) expired() bool {
+	return !p.expires.IsZero() && time.Now().After(p.expires)
+}
+
+// serve answers the paste form on pastePath, creates pastes POSTed to it and
+// serves them under it as plain text, or rendered when posted as markdown
+// unless ?raw is given.
+//
+// A POST is either the form, with text, expires and format fields, or the
+// text itself as with curl --data-binary @file, taking expires and format
+// from the query. expires is a duration like 1h, format is text or markdown.
+func (s *pasteStore) serve(w http.ResponseWriter, r *http.Request, basePath string, look *look) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, pastePath), "/")
+	if id == "" {
+		if r.Method == http.MethodPost {
+			s.create(w, r, basePath)
+			return
+		}
+		var page strings.Builder
+		look.paste.Execute(&page, struct {
+			Expiries []struct{ Value, Label string }
+			Style    template.HTML
+		}{pasteExpiries, template.HTML(look.style)})
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(page.Len()))
+		writeBody(w, r, []byte(page.String()))
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "405 POST to "+pastePath+" to create a paste")
+		return
+	}
+	p := s.get(id)
+	if p == nil {
+		writeError(w, r, http.StatusNotFound, "404 unknown or expired paste")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	if p.markdown && !r.URL.Query().Has("raw") {
+		serveMarkdown(w, r, look, "Paste "+id, p.text)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Length", strconv.Itoa(len(p.text)))
+	writeBody(w, r, p.text)
+}
+
+func (s *pasteStore) create(w http.ResponseWriter, r *http.Request, basePath string) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxPasteSize+64<<10)
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		writePasteError(w, r, err)
+		return
+	}
+
+	// curl -d sends text as a form too, which is only taken for the form
+	// when it has the text field.
+	query := r.URL.Query()
+	text, isForm := string(b), false
+	switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+	case "multipart/form-data":
+		r.Body = io.NopCloser(bytes.NewReader(b))
+		if err := r.ParseMultipartForm(maxPasteSize); err != nil {
+			writePasteError(w, r, err)
+			return
+		}
+		query, isForm = r.PostForm, true
+	case "application/x-www-form-urlencoded":
+		if values, err := url.ParseQuery(text); err == nil && values.Has("text") {
+			query, isForm = values, true
+		}
+	}
+	if isForm {
+		text = query.Get("text")
+	}
+	expires, format := query.Get("expires"), query.Get("format")
+
+	if strings.TrimSpace(text) == "" {
+		writeError(w, r, http.StatusBadRequest, "400 nothing to paste")
+		return
+	}
+	if len(text) > maxPasteSize {
+		writeError(w, r, http.StatusRequestEntityTooLarge, "413 pastes are limited to "+formatSize(maxPasteSize))
+		return
+	}
+	if format != "" && format != "text" && format != "markdown" {
+		writeError(w, r, http.StatusBadRequest, "400 format must be text or markdown")
+		return
+	}
+
+	p := &paste{text: []byte(text), markdown: format == "markdown", created: time.Now()}
+	if expires != "" {
+		d, err := time.ParseDuration(expires)
+		if err != nil || d <= 0 {
+			writeError(w, r, http.StatusBadRequest, "400 expires must be a duration like 1h")
+			return
+		}
+		p.expires = p.created.Add(d)
+	}
+	id := s.add(p)
+
+	location := (&url.URL{Path: basePath + pastePath + "/" + id}).EscapedPath()
+	if isForm && !prefersJSON(r) {
+		http.Redirect(w, r, location, http.StatusSeeOther)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	link := scheme + "://" + r.Host + location
+	w.Header().Set("Location", location)
+	if prefersJSON(r) {
+		body := map[string]any{"url": link}
+		if !p.expires.IsZero() {
+			body["expires"] = p.expires.UTC()
+		}
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, r, body)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, link+"\n")
+}
+
+func writePasteError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, r, http.StatusRequestEntityTooLarge, "413 pastes are limited to "+formatSize(maxPasteSize))
+		return
+	}
+	writeError(w, r, http.StatusBadRequest, "400 "+err.Error())
+}
+
+var pasteTemplate = template.Must(template.New("paste").Parse(`<!doctype html>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width">
+<title>Paste</title>
+<form class="paste" method="post">
+<textarea name="text" rows="20" required autofocus></textarea>
+<p>
+<select name="format"><option value="text">Plain text</option><option value="markdown">Markdown</option></select>
+<select name="expires">{{range .Expiries}}<option value="{{.Value}}">{{.Label}}</option>{{end}}</select>
+<button>Paste</button>
+</p>
+</form>
+{{.Style}}
+`))
@@ -0,0 +1,109 @@
+package fylshr
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPaste(t *testing.T) {
+	form := "Content-Type: application/x-www-form-urlencoded"
+	tests := []struct {
+		name, target, body string
+		headers            []string
+		status             int
+		// get is what the paste then serves, unless empty.
+		get string
+	}{
+		{"text", pastePath, "echo hi\n", nil, http.StatusCreated, "echo hi\n"},
+		{"curl -d", pastePath, "a=b&c", []string{form}, http.StatusCreated, "a=b&c"},
+		{"form", pastePath, url.Values{"text": {"from the form"}, "format": {"text"}}.Encode(), []string{form}, http.StatusSeeOther, "from the form"},
+		{"form as JSON", pastePath, url.Values{"text": {"from the form"}}.Encode(), []string{form, "Accept: application/json"}, http.StatusCreated, "from the form"},
+		{"markdown", pastePath + "?format=markdown", "# Title", nil, http.StatusCreated, "<h1"},
+		{"expiring", pastePath + "?expires=1h", "soon gone", nil, http.StatusCreated, "soon gone"},
+		{"empty", pastePath, " \n", nil, http.StatusBadRequest, ""},
+		{"other format", pastePath + "?format=html", "<b>", nil, http.StatusBadRequest, ""},
+		{"bad expiry", pastePath + "?expires=tomorrow", "text", nil, http.StatusBadRequest, ""},
+		{"negative expiry", pastePath + "?expires=-1h", "text", nil, http.StatusBadRequest, ""},
+		{"too large", pastePath, strings.Repeat("x", maxPasteSize+1), nil, http.StatusRequestEntityTooLarge, ""},
+		{"to a paste", pastePath + "/abcdef", "text", nil, http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, t.TempDir(), "-paste")
+			resp, body := do(t, srv, http.MethodPost, tt.target, strings.NewReader(tt.body), tt.headers...)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("POST %s = %d %s, want %d", tt.target, resp.StatusCode, body, tt.status)
+			}
+			if tt.get == "" {
+				return
+			}
+			location := resp.Header.Get("Location")
+			if !strings.HasPrefix(location, pastePath+"/") {
+				t.Fatalf("POST %s Location %q, want a paste", tt.target, location)
+			}
+			if resp.StatusCode == http.StatusCreated && !strings.Contains(body, location) {
+				t.Errorf("POST %s answered %q, want the link to %s", tt.target, body, location)
+			}
+			if _, got := do(t, srv, http.MethodGet, location, nil); !strings.Contains(got, tt.get) {
+				t.Errorf("GET %s = %q, want %q", location, got, tt.get)
+			}
+		})
+	}
+}
+
+func TestPasteRaw(t *testing.T) {
+	srv := newTestServer(t, t.TempDir(), "-paste")
+	resp, body := do(t, srv, http.MethodPost, pastePath+"?format=markdown&expires=10m", strings.NewReader("# Title <b>"), "Accept: application/json")
+	var created struct {
+		URL     string
+		Expires time.Time
+	}
+	if err := json.Unmarshal([]byte(body), &created); err != nil || resp.StatusCode != http.StatusCreated || time.Until(created.Expires) > 10*time.Minute || time.Until(created.Expires) < 9*time.Minute {
+		t.Fatalf("POST = %d %s, %v, want the JSON of a paste expiring in 10m", resp.StatusCode, body, err)
+	}
+
+	resp, got := do(t, srv, http.MethodGet, resp.Header.Get("Location")+"?raw", nil)
+	if got != "# Title <b>" || resp.Header.Get("Content-Type") != "text/plain; charset=utf-8" || resp.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("GET ?raw = %q %s, want the markdown as plain text", got, resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestPasteForm(t *testing.T) {
+	srv := newTestServer(t, t.TempDir(), "-paste")
+	if _, body := do(t, srv, http.MethodGet, pastePath, nil); !strings.Contains(body, `<textarea name="text"`) {
+		t.Errorf("GET %s = %q, want the form", pastePath, body)
+	}
+	if resp, _ := do(t, srv, http.MethodGet, pastePath+"/zzzzzz", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET of an unknown paste = %d, want 404", resp.StatusCode)
+	}
+	if resp, _ := do(t, newTestServer(t, t.TempDir()), http.MethodPost, pastePath, bytes.NewReader([]byte("text"))); resp.StatusCode == http.StatusCreated {
+		t.Errorf("POST %s without -paste = %d", pastePath, resp.StatusCode)
+	}
+}
+
+func TestPasteStore(t *testing.T) {
+	s := newPasteStore()
+	expired := s.add(&paste{text: []byte("old"), created: time.Now().Add(-time.Hour), expires: time.Now().Add(-time.Minute)})
+	kept := s.add(&paste{text: []byte("kept"), created: time.Now()})
+	if s.get(expired) != nil || s.get(kept) == nil {
+		t.Errorf("store returned the expired paste or lost the other")
+	}
+
+	first := kept
+	for range maxPastes {
+		s.add(&paste{text: []byte("new"), created: time.Now()})
+	}
+	if len(s.pastes) != maxPastes || s.get(first) != nil {
+		t.Errorf("store holds %d pastes with the oldest %v, want %d without it", len(s.pastes), s.get(first) != nil, maxPastes)
+	}
+	for id := range s.pastes {
+		if len(id) != pasteIDLength || strings.Trim(id, pasteAlphabet) != "" {
+			t.Errorf("paste ID %q, want %d of %s", id, pasteIDLength, pasteAlphabet)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package fylshr
+
+import (
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// cleanBasePath turns "files", "/files/" and "/files" into "/files", and "/"
+// into "" so the prefix can be concatenated with request paths.
+func cleanBasePath(basePath string) string {
+	if basePath == "" {
+		return ""
+	}
+
+	basePath = path.Clean("/" + basePath)
+	if basePath == "/" {
+		return ""
+	}
+
+	return basePath
+}
+
+// redirectCanonical redirects paths with doubled slashes or dot segments to
+// their clean form, keeping the trailing slash that marks a directory.
+func redirectCanonical(w http.ResponseWriter, r *http.Request, basePath string) bool {
+	clean := path.Clean("/" + r.URL.Path)
+	if strings.HasSuffix(r.URL.Path, "/") && clean != "/" {
+		clean += "/"
+	}
+
+	if clean == r.URL.Path {
+		return false
+	}
+
+	target := url.URL{Path: basePath + clean, RawQuery: r.URL.RawQuery}
+	http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+	return true
+}
+
+// hasPathPrefix reports whether name is prefix or inside it, matching whole
+// path segments only.
+func hasPathPrefix(name, prefix string) bool {
+	if prefix == "/" {
+		return true
+	}
+	return name == prefix || strings.HasPrefix(name, prefix+"/")
+}
+
+func isDirectory(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && info.IsDir()
+}
+
+func isFile(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// writeBaseHref starts an HTML page with a <base> tag when base isn't empty.
+// It goes before the page itself, which is fine for browsers.
+func writeBaseHref(w http.ResponseWriter, base string) {
+	if base != "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, `<base href="`+html.EscapeString(base)+`">`)
+	}
+}
+
+// withBasePath strips basePath from incoming requests. The file server only
+// generates relative links and redirects, so listings keep working under the
+// prefix.
+func withBasePath(basePath string, h http.Handler) http.Handler {
+	if basePath == "" {
+		return h
+	}
+
+	stripped := http.StripPrefix(basePath, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == basePath {
+			http.Redirect(w, r, basePath+"/", http.StatusMovedPermanently)
+			return
+		}
+		// StripPrefix would take /files off /filesecret too.
+		if !strings.HasPrefix(r.URL.Path, basePath+"/") {
+			writeError(w, r, http.StatusNotFound, "404 page not found")
+			return
+		}
+
+		stripped.ServeHTTP(w, r)
+	})
+}
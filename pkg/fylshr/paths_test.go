@@ -0,0 +1,67 @@
+package fylshr
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalPaths(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "sub/b.txt": "nested"})
+	srv := newTestServer(t, dir)
+
+	tests := []struct {
+		path     string
+		status   int
+		location string
+	}{
+		{"/a.txt", http.StatusOK, ""},
+		{"//a.txt", http.StatusMovedPermanently, "/a.txt"},
+		{"/sub//b.txt", http.StatusMovedPermanently, "/sub/b.txt"},
+		{"/sub///", http.StatusMovedPermanently, "/sub/"},
+		{"/./a.txt", http.StatusMovedPermanently, "/a.txt"},
+		{"/sub/./b.txt", http.StatusMovedPermanently, "/sub/b.txt"},
+		{"/sub/../a.txt", http.StatusMovedPermanently, "/a.txt"},
+		{"/sub/../../a.txt", http.StatusMovedPermanently, "/a.txt"},
+		{"//sub//b.txt?raw&x=1", http.StatusMovedPermanently, "/sub/b.txt?raw&x=1"},
+		{"/sub/", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		resp, _ := do(t, srv, http.MethodGet, tt.path, nil)
+		if resp.StatusCode != tt.status || resp.Header.Get("Location") != tt.location {
+			t.Errorf("GET %s = %d Location %q, want %d %q", tt.path, resp.StatusCode, resp.Header.Get("Location"), tt.status, tt.location)
+		}
+	}
+}
+
+func TestNoRedirectSlash(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"sub/b.txt": "nested", "site/index.html": "<p>home"})
+
+	tests := []struct {
+		name     string
+		flags    []string
+		path     string
+		status   int
+		location string
+		body     string
+	}{
+		{"redirect", nil, "/sub", http.StatusMovedPermanently, "sub/", ""},
+		{"redirect keeps the query", nil, "/sub?sort=size", http.StatusMovedPermanently, "sub/?sort=size", ""},
+		{"listing", []string{"-no-redirect-slash"}, "/sub", http.StatusOK, "", `<base href="sub/">`},
+		{"listing links", []string{"-no-redirect-slash"}, "/sub", http.StatusOK, "", `href="b.txt"`},
+		{"index", []string{"-no-redirect-slash"}, "/site", http.StatusOK, "", `<base href="site/"><p>home`},
+		{"file", []string{"-no-redirect-slash"}, "/sub/b.txt", http.StatusOK, "", "nested"},
+		{"missing", []string{"-no-redirect-slash"}, "/nope", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, dir, tt.flags...)
+			resp, body := do(t, srv, http.MethodGet, tt.path, nil)
+			if resp.StatusCode != tt.status || resp.Header.Get("Location") != tt.location || !strings.Contains(body, tt.body) {
+				t.Errorf("GET %s = %d Location %q %q, want %d %q %q", tt.path, resp.StatusCode, resp.Header.Get("Location"), body, tt.status, tt.location, tt.body)
+			}
+		})
+	}
+}
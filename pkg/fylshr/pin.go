@@ -0,0 +1,166 @@
+package fylshr
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	pinPath   = "/_pin"
+	pinCookie = "fylshr_pin"
+	// pinSessionAge is how long a paired browser stays in, the cookie being
+	// worthless after a restart anyway.
+	pinSessionAge = 24 * time.Hour
+	// pinMaxFailures wrong codes from a client lock it out for pinLockout, so
+	// the million codes can't be tried in a reasonable time.
+	pinMaxFailures = 5
+	pinLockout     = time.Minute
+)
+
+// pinGate lets in the browsers whose visitor typed the code printed at
+// startup, with a cookie signed by a key that only lives as long as the
+// process. With once, the code works a single time.
+type pinGate struct {
+	code string
+	key  []byte
+	once bool
+
+	sync.Mutex
+	used     bool
+	failures map[string]pinFailures
+}
+
+type pinFailures struct {
+	count int
+	last  time.Time
+}
+
+func newPinGate(once bool) *pinGate {
+	n, _ := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	key := make([]byte, 32)
+	rand.Read(key)
+	return &pinGate{code: fmt.Sprintf("%06d", n), key: key, once: once, failures: map[string]pinFailures{}}
+}
+
+// paired reports whether r carries a session cookie the gate signed, still
+// valid.
+func (g *pinGate) paired(r *http.Request) bool {
+	cookie, err := r.Cookie(pinCookie)
+	if err != nil {
+		return false
+	}
+	expiry, sig, ok := strings.Cut(cookie.Value, ".")
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if !ok || err != nil || time.Now().Unix() > unix {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(g.sign(expiry)))
+}
+
+func (g *pinGate) sign(value string) string {
+	mac := hmac.New(sha256.New, g.key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// check reports whether code is the PIN, spending it with once, and counts
+// the failures of ip. locked is true while ip is locked out.
+func (g *pinGate) check(ip, code string) (ok, locked bool) {
+	g.Lock()
+	defer g.Unlock()
+	f := g.failures[ip]
+	if f.count >= pinMaxFailures && time.Since(f.last) < pinLockout {
+		return false, true
+	}
+	if g.used || !secureCompare(code, g.code) {
+		if time.Since(f.last) >= pinLockout {
+			f.count = 0
+		}
+		g.failures[ip] = pinFailures{f.count + 1, time.Now()}
+		return false, false
+	}
+	delete(g.failures, ip)
+	for other, f := range g.failures {
+		if time.Since(f.last) >= pinLockout {
+			delete(g.failures, other)
+		}
+	}
+	g.used = g.once
+	return true, false
+}
+
+// serve answers the PIN form posted to pinPath, setting the session cookie and
+// going back to the page asked for when the code is right.
+func (g *pinGate) serve(w http.ResponseWriter, r *http.Request, basePath string, look *look) {
+	next := r.PostFormValue("next")
+	// Only a path of this server, not //host.
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, `/\`) {
+		next = "/"
+	}
+
+	ok, locked := g.check(clientIP(r), r.PostFormValue("pin"))
+	switch {
+	case locked:
+		w.Header().Set("Retry-After", strconv.Itoa(int(pinLockout.Seconds())))
+		g.prompt(w, r, look, http.StatusTooManyRequests, basePath, next, "Too many wrong codes, try again in a minute.")
+	case !ok:
+		g.prompt(w, r, look, http.StatusForbidden, basePath, next, "Wrong code.")
+	default:
+		expiry := strconv.FormatInt(time.Now().Add(pinSessionAge).Unix(), 10)
+		http.SetCookie(w, &http.Cookie{
+			Name:     pinCookie,
+			Value:    expiry + "." + g.sign(expiry),
+			Path:     basePath + "/",
+			MaxAge:   int(pinSessionAge.Seconds()),
+			Secure:   r.TLS != nil,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, basePath+next, http.StatusSeeOther)
+	}
+}
+
+// prompt answers the PIN entry page to browsers, and a plain error to other
+// clients.
+func (g *pinGate) prompt(w http.ResponseWriter, r *http.Request, look *look, status int, basePath, next, message string) {
+	if acceptQuality(r.Header.Get("Accept"), "text/html") == 0 {
+		writeError(w, r, status, strconv.Itoa(status)+" "+message)
+		return
+	}
+
+	var page strings.Builder
+	look.pin.Execute(&page, struct {
+		Action  string
+		Next    string
+		Message string
+		Style   template.HTML
+	}{basePath + pinPath, next, message, template.HTML(look.style)})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Length", strconv.Itoa(page.Len()))
+	w.WriteHeader(status)
+	writeBody(w, r, []byte(page.String()))
+}
+
+var pinTemplate = template.Must(template.New("pin").Parse(`<!doctype html>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width">
+<title>Enter the PIN</title>
+<form class="actions" method="post" action="{{.Action}}">
+<p>{{.Message}}</p>
+<input name="pin" inputmode="numeric" pattern="[0-9]{6}" maxlength="6" autocomplete="one-time-code" autofocus required>
+<input type="hidden" name="next" value="{{.Next}}">
+<button>Enter</button>
+</form>
+{{.Style}}
+`))
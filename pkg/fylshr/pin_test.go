@@ -0,0 +1,120 @@
+package fylshr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newPinServer serves folder with -pin and flags, returning the code too.
+func newPinServer(t *testing.T, folder string, flags ...string) (*httptest.Server, string) {
+	t.Helper()
+	args := testArgs(t, folder, append([]string{"-pin"}, flags...)...)
+	srv := httptest.NewServer(newHandler(args))
+	t.Cleanup(srv.Close)
+	return srv, args.pin.code
+}
+
+// enterPin posts code to the PIN form, asking to go to next.
+func enterPin(t *testing.T, srv *httptest.Server, code, next string) (*http.Response, string) {
+	t.Helper()
+	form := url.Values{"pin": {code}, "next": {next}}
+	return do(t, srv, http.MethodPost, pinPath, strings.NewReader(form.Encode()), "Content-Type: application/x-www-form-urlencoded", "Accept: text/html")
+}
+
+func TestPin(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+
+	srv, code := newPinServer(t, dir)
+	resp, body := do(t, srv, http.MethodGet, "/a.txt", nil, "Accept: text/html")
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(body, `name="pin"`) || !strings.Contains(body, `value="/a.txt"`) {
+		t.Fatalf("GET /a.txt = %d %q, want 403 with the PIN form", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodGet, "/a.txt", nil); resp.StatusCode != http.StatusForbidden || strings.Contains(body, "<form") {
+		t.Errorf("GET /a.txt without Accept = %d %q, want a plain 403", resp.StatusCode, body)
+	}
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	if resp, body := enterPin(t, srv, wrong, "/a.txt"); resp.StatusCode != http.StatusForbidden || !strings.Contains(body, "Wrong code.") {
+		t.Errorf("wrong PIN = %d %q, want 403", resp.StatusCode, body)
+	}
+
+	resp, _ = enterPin(t, srv, code, "/a.txt")
+	cookies := resp.Cookies()
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/a.txt" || len(cookies) != 1 || cookies[0].Name != pinCookie || !cookies[0].HttpOnly {
+		t.Fatalf("PIN = %d Location %q cookies %v, want 303 to /a.txt with an HttpOnly %s", resp.StatusCode, resp.Header.Get("Location"), cookies, pinCookie)
+	}
+
+	expiry, _, _ := strings.Cut(cookies[0].Value, ".")
+	past := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	tests := []struct {
+		name, cookie string
+		status       int
+	}{
+		{"paired", cookies[0].Value, http.StatusOK},
+		{"forged", expiry + ".00", http.StatusForbidden},
+		{"longer", strconv.FormatInt(time.Now().Add(1000*time.Hour).Unix(), 10) + "." + strings.SplitN(cookies[0].Value, ".", 2)[1], http.StatusForbidden},
+		{"expired", past + "." + strings.SplitN(cookies[0].Value, ".", 2)[1], http.StatusForbidden},
+		{"garbage", "nope", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if resp, _ := do(t, srv, http.MethodGet, "/a.txt", nil, "Cookie: "+pinCookie+"="+tt.cookie); resp.StatusCode != tt.status {
+			t.Errorf("GET /a.txt with a %s cookie = %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+	}
+
+	other, _ := newPinServer(t, dir)
+	if resp, _ := do(t, other, http.MethodGet, "/a.txt", nil, "Cookie: "+pinCookie+"="+cookies[0].Value); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET /a.txt from another server with the cookie = %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestPinNext(t *testing.T) {
+	srv, code := newPinServer(t, t.TempDir(), "-base-path", "/share")
+	for next, want := range map[string]string{
+		"/sub/?sort=size": "/share/sub/?sort=size",
+		"//evil.example":  "/share/",
+		`/\evil.example`:  "/share/",
+		"https://evil":    "/share/",
+		"":                "/share/",
+	} {
+		form := url.Values{"pin": {code}, "next": {next}}
+		resp, _ := do(t, srv, http.MethodPost, "/share"+pinPath, strings.NewReader(form.Encode()), "Content-Type: application/x-www-form-urlencoded")
+		if location := resp.Header.Get("Location"); resp.StatusCode != http.StatusSeeOther || location != want {
+			t.Errorf("PIN with next %q = %d Location %q, want 303 %q", next, resp.StatusCode, location, want)
+		}
+	}
+}
+
+func TestPinOnce(t *testing.T) {
+	srv, code := newPinServer(t, t.TempDir(), "-pin-once")
+	if resp, _ := enterPin(t, srv, code, "/"); resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("first PIN = %d, want 303", resp.StatusCode)
+	}
+	if resp, _ := enterPin(t, srv, code, "/"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("second PIN with -pin-once = %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestPinLockout(t *testing.T) {
+	srv, code := newPinServer(t, t.TempDir())
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	for range pinMaxFailures {
+		enterPin(t, srv, wrong, "/")
+	}
+	resp, _ := enterPin(t, srv, code, "/")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("right PIN after %d wrong ones = %d Retry-After %q, want 429", pinMaxFailures, resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package fylshr
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+// checkPrivate returns an error unless info, from Lstat, is a directory. File
+// modes don't tell who else can use it here.
+func checkPrivate(name string, info fs.FileInfo) error {
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", name)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package fylshr
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// checkPrivate returns an error unless info, from Lstat, is a directory of
+// the current user that nobody else can use.
+func checkPrivate(name string, info fs.FileInfo) error {
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", name)
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("%s belongs to another user", name)
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return fmt.Errorf("%s is open to other users, mode %o", name, info.Mode().Perm())
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package fylshr
+
+import (
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+const pprofPath = "/debug/pprof/"
+
+func pprofMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc(pprofPath, pprof.Index)
+	mux.HandleFunc(pprofPath+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(pprofPath+"profile", pprof.Profile)
+	mux.HandleFunc(pprofPath+"symbol", pprof.Symbol)
+	mux.HandleFunc(pprofPath+"trace", pprof.Trace)
+	return mux
+}
+
+// listenProfile serves pprof on its own address, so it can stay on loopback
+// while the files are shared on the network.
+func listenProfile(addr string) (net.Addr, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	go http.Serve(l, pprofMux())
+	return l.Addr(), nil
+}
@@ -0,0 +1,55 @@
+package fylshr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+
+	tests := []struct {
+		flags  []string
+		target string
+		status int
+	}{
+		{[]string{"-profile", "-profile-addr", ""}, pprofPath, http.StatusOK},
+		{[]string{"-profile", "-profile-addr", ""}, pprofPath + "cmdline", http.StatusOK},
+		{[]string{"-profile", "-profile-addr", "", "-token", "s3cret"}, pprofPath, http.StatusUnauthorized},
+		{[]string{"-profile", "-profile-addr", "", "-token", "s3cret"}, pprofPath + "?token=s3cret", http.StatusOK},
+		{[]string{"-profile"}, pprofPath, http.StatusNotFound},
+		{nil, pprofPath, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		h := newHandler(testArgs(t, dir, append(tt.flags, "-silent=false")...))
+		w := httptest.NewRecorder()
+		logged := capture(t, &os.Stdout, func() { h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil)) })
+		if w.Code != tt.status {
+			t.Errorf("%v GET %s = %d, want %d", tt.flags, tt.target, w.Code, tt.status)
+		}
+		if w.Code == http.StatusOK && logged != "" {
+			t.Errorf("%v GET %s logs %q", tt.flags, tt.target, logged)
+		}
+	}
+}
+
+// TestListenProfile checks that -profile-addr serves pprof on its own
+// listener.
+func TestListenProfile(t *testing.T) {
+	addr, err := listenProfile("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get("http://" + addr.String() + pprofPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("GET %s on -profile-addr = %d %s, want the pprof index", pprofPath, resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
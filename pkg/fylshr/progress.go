@@ -0,0 +1,182 @@
+package fylshr
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressDelay keeps quick responses from flashing on the status lines.
+const progressDelay = time.Second
+
+// progressChunk is how much of a file is sent between progress updates.
+const progressChunk = 4 << 20
+
+// progressLines is how many transfers are shown at once, the others being
+// counted on the last line.
+const progressLines = 5
+
+// stallAfter is how long a transfer goes without sending anything before it's
+// shown as stalled.
+const stallAfter = 5 * time.Second
+
+type transfer struct {
+	name  string
+	start time.Time
+	bytes atomic.Int64
+	// total is the length of the response, or -1 if unknown, and offset
+	// where it starts in the file for a range request.
+	total  atomic.Int64
+	offset atomic.Int64
+
+	// The rate of the last second, kept by progress.run.
+	sampled     int64
+	sampledAt   time.Time
+	rate        float64
+	lastSending time.Time
+}
+
+// sized records the length of the response from its headers, once they're
+// written.
+func (t *transfer) sized(h http.Header) {
+	total, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+	if err != nil {
+		total = -1
+	}
+	t.total.Store(total)
+	// Content-Range is "bytes first-last/size" for a single range.
+	if first, _, ok := strings.Cut(strings.TrimPrefix(h.Get("Content-Range"), "bytes "), "-"); ok {
+		if offset, err := strconv.ParseInt(first, 10, 64); err == nil {
+			t.offset.Store(offset)
+		}
+	}
+}
+
+// progress tracks in-flight responses and keeps status lines with their
+// progress and transfer rate below the request log.
+type progress struct {
+	sync.Mutex
+	active map[*transfer]struct{}
+	color  bool
+	// drawn is how many status lines are on the terminal.
+	drawn int
+}
+
+func newProgress(color bool) *progress {
+	return &progress{active: map[*transfer]struct{}{}, color: color}
+}
+
+func (p *progress) start(name string) *transfer {
+	t := &transfer{name: name, start: time.Now()}
+	t.total.Store(-1)
+	p.Lock()
+	p.active[t] = struct{}{}
+	p.Unlock()
+	return t
+}
+
+func (p *progress) done(t *transfer) {
+	p.Lock()
+	delete(p.active, t)
+	p.Unlock()
+}
+
+// slow returns the transfers running for longer than progressDelay, oldest
+// first.
+func (p *progress) slow(now time.Time) []*transfer {
+	p.Lock()
+	defer p.Unlock()
+
+	var transfers []*transfer
+	for t := range p.active {
+		if now.Sub(t.start) >= progressDelay {
+			transfers = append(transfers, t)
+		}
+	}
+	slices.SortFunc(transfers, func(a, b *transfer) int { return a.start.Compare(b.start) })
+	return transfers
+}
+
+// clear erases the status lines; callers hold the lock so the next log line
+// isn't drawn over.
+func (p *progress) clear() {
+	if p.drawn > 0 {
+		fmt.Print("\r\x1b[K" + strings.Repeat("\x1b[A\x1b[K", p.drawn-1))
+		p.drawn = 0
+	}
+}
+
+func (p *progress) run() {
+	for now := range time.Tick(500 * time.Millisecond) {
+		transfers := p.slow(now)
+		for _, t := range transfers {
+			t.sample(now)
+		}
+
+		p.Lock()
+		p.clear()
+		var lines []string
+		for i, t := range transfers {
+			if i == progressLines-1 && len(transfers) > progressLines {
+				lines = append(lines, fmt.Sprintf("+%d more", len(transfers)-i))
+				break
+			}
+			lines = append(lines, t.line(now))
+		}
+		if len(lines) > 0 {
+			colorPrintf(p.color, "%s", strings.Join(lines, "\n"))
+			p.drawn = len(lines)
+		}
+		p.Unlock()
+	}
+}
+
+// sample updates the rate of t over the last second, so a transfer slowing
+// down shows it rather than its average since the start.
+func (t *transfer) sample(now time.Time) {
+	n := t.bytes.Load()
+	if t.sampledAt.IsZero() {
+		t.sampled, t.sampledAt, t.lastSending = 0, t.start, t.start
+	}
+	if n != t.sampled {
+		t.lastSending = now
+	}
+	if elapsed := now.Sub(t.sampledAt); elapsed >= time.Second {
+		t.rate = float64(n-t.sampled) / elapsed.Seconds()
+		t.sampled, t.sampledAt = n, now
+	}
+}
+
+// line shows t as its name, the bytes sent out of the total with the
+// percentage and time left when the length is known, and the rate.
+func (t *transfer) line(now time.Time) string {
+	name := t.name
+	if len(name) > 40 {
+		name = "…" + name[len(name)-39:]
+	}
+	n, total := t.bytes.Load(), t.total.Load()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\x1b[38;5;195m%s\x1b[0m %s", name, formatSize(uint64(n)))
+	if total > 0 {
+		fmt.Fprintf(&b, " / %s (%d%%)", formatSize(uint64(total)), n*100/total)
+	}
+	if offset := t.offset.Load(); offset > 0 {
+		fmt.Fprintf(&b, " from %s", formatSize(uint64(offset)))
+	}
+	switch {
+	case now.Sub(t.lastSending) >= stallAfter:
+		fmt.Fprintf(&b, ", stalled for %s", now.Sub(t.lastSending).Round(time.Second))
+	case t.rate > 0:
+		fmt.Fprintf(&b, " at %s/s", formatSize(uint64(t.rate)))
+		if total > n {
+			fmt.Fprintf(&b, ", %s left", time.Duration(float64(total-n)/t.rate*float64(time.Second)).Round(time.Second))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,165 @@
+package fylshr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressSlow(t *testing.T) {
+	p := newProgress(false)
+	now := time.Now()
+	old, older, quick := p.start("/old"), p.start("/older"), p.start("/quick")
+	old.start, older.start = now.Add(-2*progressDelay), now.Add(-3*progressDelay)
+	quick.start = now
+
+	got := p.slow(now)
+	if len(got) != 2 || got[0] != older || got[1] != old {
+		t.Errorf("slow = %v, want /older then /old", got)
+	}
+	p.done(older)
+	if got := p.slow(now); len(got) != 1 || got[0] != old {
+		t.Errorf("slow after done = %v, want /old", got)
+	}
+}
+
+func TestTransferSized(t *testing.T) {
+	tests := []struct {
+		headers       http.Header
+		total, offset int64
+	}{
+		{http.Header{"Content-Length": {"1024"}}, 1024, 0},
+		{http.Header{}, -1, 0},
+		{http.Header{"Content-Length": {"100"}, "Content-Range": {"bytes 500-599/1000"}}, 100, 500},
+		{http.Header{"Content-Range": {"bytes */1000"}}, -1, 0},
+	}
+	for _, tt := range tests {
+		var tr transfer
+		tr.sized(tt.headers)
+		if total, offset := tr.total.Load(), tr.offset.Load(); total != tt.total || offset != tt.offset {
+			t.Errorf("sized(%v) = %d from %d, want %d from %d", tt.headers, total, offset, tt.total, tt.offset)
+		}
+	}
+}
+
+func TestTransferLine(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name          string
+		total, offset int64
+		sent          []int64
+		after         time.Duration
+		want          string
+	}{
+		{"/big.iso", 4 << 20, 0, []int64{1 << 20, 2 << 20}, 2 * time.Second, "/big.iso 2.0 MiB / 4.0 MiB (50%) at 1.0 MiB/s, 2s left"},
+		{"/stream", -1, 0, []int64{1024, 3072}, 2 * time.Second, "/stream 3.0 KiB at 2.0 KiB/s"},
+		{"/part.bin", 1 << 20, 512 << 10, []int64{0, 0}, 6 * time.Second, "/part.bin 0 B / 1.0 MiB (0%) from 512.0 KiB, stalled for 6s"},
+		{"/" + strings.Repeat("dir/", 15) + "file.iso", -1, 0, []int64{0}, time.Second, "…ir/dir/dir/dir/dir/dir/dir/dir/file.iso 0 B"},
+	}
+	for _, tt := range tests {
+		tr := &transfer{name: tt.name, start: start}
+		tr.total.Store(tt.total)
+		tr.offset.Store(tt.offset)
+		now := start
+		for i, n := range tt.sent {
+			now = start.Add(tt.after * time.Duration(i+1) / time.Duration(len(tt.sent)))
+			tr.bytes.Store(n)
+			tr.sample(now)
+		}
+		got := ansiEscape.ReplaceAllString(tr.line(now), "")
+		if got != tt.want {
+			t.Errorf("%s line = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestProgressRequests checks that the handler tracks each response while
+// it's sent and forgets it when it's done.
+func TestProgressRequests(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	args := testArgs(t, dir, "-silent=false")
+	args.progress = newProgress(false)
+	h := newHandler(args)
+
+	var tracked int
+	w := httptest.NewRecorder()
+	capture(t, &os.Stdout, func() {
+		h.ServeHTTP(trackingWriter{w, func() { tracked = len(args.progress.active) }}, httptest.NewRequest(http.MethodGet, "/a.txt", nil))
+	})
+	if w.Code != http.StatusOK || tracked != 1 || len(args.progress.active) != 0 {
+		t.Errorf("GET /a.txt = %d tracking %d transfers, %d after, want 1 then 0", w.Code, tracked, len(args.progress.active))
+	}
+}
+
+// TestProgressRange checks that a transfer knows the length and offset of
+// the range it sends.
+func TestProgressRange(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	args := testArgs(t, dir, "-silent=false")
+	args.progress = newProgress(false)
+	h := newHandler(args)
+
+	tests := []struct {
+		header        string
+		total, offset int64
+	}{
+		{"", 5, 0},
+		{"bytes=2-4", 3, 2},
+		{"bytes=-1", 1, 4},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+		if tt.header != "" {
+			r.Header.Set("Range", tt.header)
+		}
+		var total, offset int64
+		capture(t, &os.Stdout, func() {
+			h.ServeHTTP(trackingWriter{httptest.NewRecorder(), func() {
+				for tr := range args.progress.active {
+					total, offset = tr.total.Load(), tr.offset.Load()
+				}
+			}}, r)
+		})
+		if total != tt.total || offset != tt.offset {
+			t.Errorf("GET /a.txt Range %q tracks %d from %d, want %d from %d", tt.header, total, offset, tt.total, tt.offset)
+		}
+	}
+}
+
+// TestProgressLines checks that clear erases every status line drawn, and
+// that there are none when stdout isn't a terminal or with -silent.
+func TestProgressLines(t *testing.T) {
+	for drawn, want := range []string{"", "\r\x1b[K", "\r\x1b[K\x1b[A\x1b[K", "\r\x1b[K\x1b[A\x1b[K\x1b[A\x1b[K"} {
+		p := newProgress(false)
+		p.drawn = drawn
+		if got := capture(t, &os.Stdout, p.clear); got != want || p.drawn != 0 {
+			t.Errorf("clear of %d lines prints %q, want %q", drawn, got, want)
+		}
+	}
+
+	for _, flags := range [][]string{{"-silent=false"}, {"-silent"}} {
+		var args Args
+		capture(t, &os.Stdout, func() {
+			args = parseTestArgs(t, append([]string{"-folder", t.TempDir(), "-banner", "off"}, flags...)...)
+		})
+		if args.progress != nil {
+			t.Errorf("%v without a terminal shows progress", flags)
+		}
+	}
+}
+
+// trackingWriter calls f when the response is written.
+type trackingWriter struct {
+	http.ResponseWriter
+	f func()
+}
+
+func (w trackingWriter) Write(b []byte) (int, error) {
+	w.f()
+	return w.ResponseWriter.Write(b)
+}
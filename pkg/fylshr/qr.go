@@ -0,0 +1,45 @@
+package fylshr
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// qrString draws content as a QR code with half block characters, two
+// modules per character row. Light modules are drawn, so it scans on the
+// usual dark terminal background.
+func qrString(content string) (string, error) {
+	code, err := qrcode.New(content, qrcode.Low)
+	if err != nil {
+		return "", err
+	}
+
+	bitmap := code.Bitmap()
+	var b strings.Builder
+	for y := 0; y < len(bitmap); y += 2 {
+		for x := range bitmap[y] {
+			top := !bitmap[y][x]
+			bottom := y+1 < len(bitmap) && !bitmap[y+1][x]
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+func printQR(url string) {
+	if s, err := qrString(url); err == nil {
+		fmt.Print(s)
+	}
+}
@@ -0,0 +1,63 @@
+package fylshr
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// TestQRString checks that a QR code is drawn two modules per line, light
+// modules filled, and that content too long for one is refused.
+func TestQRString(t *testing.T) {
+	tests := []string{"http://192.168.1.5:1080", "https://files.example.com/s/" + strings.Repeat("x", 200)}
+	for _, content := range tests {
+		got, err := qrString(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, _ := qrcode.New(content, qrcode.Low)
+		bitmap := code.Bitmap()
+		lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+		if len(lines) != (len(bitmap)+1)/2 {
+			t.Errorf("QR code of %q has %d lines, want %d", content, len(lines), (len(bitmap)+1)/2)
+		}
+		for i, line := range lines {
+			if utf8.RuneCountInString(line) != len(bitmap) {
+				t.Errorf("QR code of %q line %d is %d wide, want %d", content, i, utf8.RuneCountInString(line), len(bitmap))
+			}
+			for x, c := range []rune(line) {
+				top, bottom := !bitmap[2*i][x], 2*i+1 < len(bitmap) && !bitmap[2*i+1][x]
+				if want := map[[2]bool]rune{{true, true}: '█', {true, false}: '▀', {false, true}: '▄', {false, false}: ' '}[[2]bool{top, bottom}]; c != want {
+					t.Fatalf("QR code of %q line %d column %d = %q, want %q", content, i, x, c, want)
+				}
+			}
+		}
+		if lines[0] != strings.Repeat("█", len(bitmap)) {
+			t.Errorf("QR code of %q doesn't start with its light quiet zone", content)
+		}
+	}
+
+	if _, err := qrString(strings.Repeat("x", 3000)); err == nil {
+		t.Errorf("qrString of 3000 bytes draws a code")
+	}
+}
+
+// TestBannerQR checks that the banner has no QR code when stdout isn't a
+// terminal, like a log file.
+func TestBannerQR(t *testing.T) {
+	l, err := net.Listen("tcp4", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	args := testArgs(t, t.TempDir(), "-qr", "-advertise-ip", "192.168.1.5")
+	args.banner = "text"
+	got := capture(t, &os.Stdout, func() { printBanner(args, []net.Listener{l}) })
+	if !strings.Contains(got, "http://192.168.1.5:") || strings.ContainsAny(got, "█▀▄") {
+		t.Errorf("banner without a terminal = %q, want the LAN URL without a QR code", got)
+	}
+}
@@ -0,0 +1,109 @@
+package fylshr
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestResumeDownload checks that open-ended ranges resume a download through
+// every middleware that wraps the file server.
+func TestResumeDownload(t *testing.T) {
+	dir := t.TempDir()
+	content := textBody(2, 2000)
+	writeFiles(t, dir, map[string]string{"big.txt": content, "empty.txt": ""})
+
+	flagSets := map[string][]string{
+		"plain":    nil,
+		"wrapped":  {"-metrics", "-limit-rate", "100MB", "-request-timeout", "1ns", "-digest", "sha-256"},
+		"base":     {"-base-path", "/share"},
+		"no etags": {"-etag", "off", "-no-compress"},
+	}
+	tests := []struct {
+		name, path, rng string
+		status          int
+		body            string
+		contentRange    string
+	}{
+		{"resume", "/big.txt", "bytes=100-", http.StatusPartialContent, content[100:], "bytes 100-" + strconv.Itoa(len(content)-1) + "/" + strconv.Itoa(len(content))},
+		{"last byte", "/big.txt", "bytes=" + strconv.Itoa(len(content)-1) + "-", http.StatusPartialContent, content[len(content)-1:], ""},
+		{"suffix", "/big.txt", "bytes=-10", http.StatusPartialContent, content[len(content)-10:], ""},
+		{"at the end", "/big.txt", "bytes=" + strconv.Itoa(len(content)) + "-", http.StatusRequestedRangeNotSatisfiable, "", "bytes */" + strconv.Itoa(len(content))},
+		{"past the end", "/big.txt", "bytes=999999999-", http.StatusRequestedRangeNotSatisfiable, "", ""},
+		// An empty file has no range to send, it is sent whole.
+		{"empty file", "/empty.txt", "bytes=0-", http.StatusOK, "", ""},
+		{"from zero", "/big.txt", "bytes=0-", http.StatusPartialContent, content, ""},
+	}
+	for flagsName, flags := range flagSets {
+		srv := newTestServer(t, dir, flags...)
+		prefix := ""
+		if flagsName == "base" {
+			prefix = "/share"
+		}
+		for _, tt := range tests {
+			t.Run(flagsName+"/"+tt.name, func(t *testing.T) {
+				resp, body := do(t, srv, http.MethodGet, prefix+tt.path, nil, "Range: "+tt.rng, "Accept-Encoding: gzip, br")
+				if resp.StatusCode != tt.status {
+					t.Fatalf("GET %s %s = %d, want %d", tt.path, tt.rng, resp.StatusCode, tt.status)
+				}
+				if tt.status == http.StatusPartialContent && body != tt.body {
+					t.Errorf("GET %s %s sent %d bytes, want %d", tt.path, tt.rng, len(body), len(tt.body))
+				}
+				if tt.contentRange != "" && resp.Header.Get("Content-Range") != tt.contentRange {
+					t.Errorf("GET %s %s Content-Range %q, want %q", tt.path, tt.rng, resp.Header.Get("Content-Range"), tt.contentRange)
+				}
+				if resp.Header.Get("Content-Encoding") != "" {
+					t.Errorf("GET %s %s compressed a range", tt.path, tt.rng)
+				}
+			})
+		}
+	}
+}
+
+// TestIfRange checks that a range is only served while its If-Range still
+// matches the file, with either validator, and the full file otherwise.
+func TestIfRange(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello world"})
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(dir, "a.txt"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, etag := range []string{"mtime", "hash"} {
+		srv := newTestServer(t, dir, "-etag", etag, "-digest", "sha-256")
+		resp, _ := do(t, srv, http.MethodGet, "/a.txt", nil)
+		validator := resp.Header.Get("ETag")
+		if !strings.HasPrefix(validator, `"`) {
+			t.Fatalf("-etag %s ETag %q, want a strong one", etag, validator)
+		}
+
+		tests := []struct {
+			name, ifRange string
+			status        int
+			body          string
+		}{
+			{"etag", validator, http.StatusPartialContent, "world"},
+			{"other etag", `"other"`, http.StatusOK, "hello world"},
+			{"weak etag", "W/" + validator, http.StatusOK, "hello world"},
+			{"date", modTime.Format(http.TimeFormat), http.StatusPartialContent, "world"},
+			{"earlier date", modTime.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK, "hello world"},
+			{"later date", modTime.Add(time.Hour).Format(http.TimeFormat), http.StatusOK, "hello world"},
+		}
+		for _, tt := range tests {
+			t.Run(etag+"/"+tt.name, func(t *testing.T) {
+				resp, body := do(t, srv, http.MethodGet, "/a.txt", nil, "Range: bytes=6-", "If-Range: "+tt.ifRange)
+				if resp.StatusCode != tt.status || body != tt.body {
+					t.Errorf("If-Range %s = %d %q, want %d %q", tt.ifRange, resp.StatusCode, body, tt.status, tt.body)
+				}
+				if digest := resp.Header.Get("Digest"); (resp.StatusCode == http.StatusOK) != (digest != "") {
+					t.Errorf("If-Range %s = %d with Digest %q, want one only for the full file", tt.ifRange, resp.StatusCode, digest)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package fylshr
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRaw(t *testing.T) {
+	dir := t.TempDir()
+	markdown := "# Title\n\n" + strings.Repeat("Some *text*. ", 200)
+	source := "package main\n\nfunc main() {}\n" + strings.Repeat("// comment\n", 200)
+	writeFiles(t, dir, map[string]string{"doc.md": markdown, "main.go": source, "photo.jpg": "jpeg", "photo.webp": "webp"})
+
+	tests := []struct {
+		name     string
+		flags    []string
+		path     string
+		headers  []string
+		body     string
+		encoding string
+	}{
+		{"markdown", []string{"-render"}, "/doc.md?raw", nil, markdown, ""},
+		{"markdown asked to render", nil, "/doc.md?render&raw", nil, markdown, ""},
+		{"source", []string{"-render"}, "/main.go?raw=1", nil, source, ""},
+		{"image variant", []string{"-image-negotiation"}, "/photo.jpg?raw", []string{"Accept: image/webp"}, "jpeg", ""},
+		{"compressed", []string{"-render"}, "/doc.md?raw", []string{"Accept-Encoding: gzip"}, "", "gzip"},
+		{"not compressed", []string{"-render", "-compress-raw=false"}, "/doc.md?raw", []string{"Accept-Encoding: gzip"}, markdown, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, dir, tt.flags...)
+			resp, body := do(t, srv, http.MethodGet, tt.path, nil, tt.headers...)
+			if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != tt.encoding {
+				t.Fatalf("GET %s = %d Content-Encoding %q, want 200 %q", tt.path, resp.StatusCode, resp.Header.Get("Content-Encoding"), tt.encoding)
+			}
+			if tt.body != "" && body != tt.body {
+				t.Errorf("GET %s = %q, want the file as stored", tt.path, body)
+			}
+			if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+				t.Errorf("GET %s Content-Type %s, want the file's own", tt.path, resp.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package fylshr
+
+import (
+	"html/template"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// serveReceive answers everything under -receive: an upload page on / and the
+// uploads to it, which all go straight into -folder. Nothing in the folder can
+// be listed or downloaded, so senders don't see each other's files.
+func serveReceive(w http.ResponseWriter, r *http.Request, args Args) {
+	url := path.Clean(r.URL.Path)
+	switch {
+	case hasPathPrefix(url, tusPath):
+		serveTus(w, r, args.folder, args.basePath, args.uploadLimits, func(name string) bool { return path.Clean(name) == "/" }, args.landed(r))
+	case r.Method == http.MethodPost && url == "/",
+		r.Method == http.MethodPut && path.Dir(url) == "/" && !strings.HasSuffix(r.URL.Path, "/"):
+		serveUpload(w, r, args.folder, args.basePath, args.uploadLimits, func(name string) bool { return !args.excluded(name, false) }, args.landed(r))
+	case r.Method == http.MethodPost || r.Method == http.MethodPut:
+		writeError(w, r, http.StatusForbidden, "403 uploads go to /")
+	case url == "/":
+		var page strings.Builder
+		args.look.receive.Execute(&page, struct {
+			Upload     string
+			Accept     string
+			UploadHint string
+			Style      template.HTML
+			Script     template.HTML
+		}{args.basePath + tusPath, args.uploadLimits.accept(), args.uploadLimits.hint(), template.HTML(args.look.style), template.HTML("<script>" + uploadScript + "</script>")})
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Length", strconv.Itoa(page.Len()))
+		writeBody(w, r, []byte(page.String()))
+	default:
+		writeError(w, r, http.StatusNotFound, "404 page not found")
+	}
+}
+
+var receiveTemplate = template.Must(template.New("receive").Parse(`<!doctype html>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width">
+<title>Send files</title>
+<form class="upload" method="post" enctype="multipart/form-data" data-endpoint="{{.Upload}}" data-dir="/">
+<input type="file" name="file" multiple required{{with .Accept}} accept="{{.}}"{{end}}>
+<button>Send</button> or drop files here{{with .UploadHint}} ({{.}}){{end}}
+<ul class="progress"></ul>
+</form>
+{{.Style}}
+{{.Script}}
+`))
@@ -0,0 +1,86 @@
+package fylshr
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReceive(t *testing.T) {
+	useTusDir(t)
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		form    bool
+		headers []string
+		status  int
+		saved   string
+	}{
+		{"page", http.MethodGet, "/", false, nil, http.StatusOK, ""},
+		{"post", http.MethodPost, "/", true, nil, http.StatusSeeOther, "up.txt"},
+		{"put", http.MethodPut, "/up.txt", false, nil, http.StatusCreated, "up.txt"},
+		{"put existing", http.MethodPut, "/a.txt", false, nil, http.StatusCreated, "a (1).txt"},
+		{"tus", http.MethodPost, tusPath, false, []string{"Tus-Resumable: " + tusVersion, "Upload-Length: 0", tusMetadata("filename", "up.txt")}, http.StatusCreated, ""},
+		{"tus into a folder", http.MethodPost, tusPath, false, []string{"Tus-Resumable: " + tusVersion, "Upload-Length: 0", tusMetadata("filename", "up.txt", "dir", "/sub")}, http.StatusForbidden, ""},
+		{"post to folder", http.MethodPost, "/sub/", true, nil, http.StatusForbidden, ""},
+		{"put into folder", http.MethodPut, "/sub/up.txt", false, nil, http.StatusForbidden, ""},
+		{"put a folder", http.MethodPut, "/up/", false, nil, http.StatusForbidden, ""},
+		{"download", http.MethodGet, "/a.txt", false, nil, http.StatusNotFound, ""},
+		{"listing", http.MethodGet, "/sub/", false, nil, http.StatusNotFound, ""},
+		{"json listing", http.MethodGet, "/?format=json", false, []string{"Accept: application/json"}, http.StatusOK, ""},
+		{"archive", http.MethodGet, archivePath + "?file=a.txt", false, nil, http.StatusNotFound, ""},
+		{"search", http.MethodGet, searchPath + "?q=a", false, nil, http.StatusNotFound, ""},
+		{"delete", http.MethodDelete, "/a.txt", false, nil, http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"a.txt": "old", "sub/b.txt": "nested"})
+			srv := newTestServer(t, dir, "-receive")
+
+			var body []byte
+			headers := tt.headers
+			if tt.form {
+				form, contentType := multipartBody(t, map[string]string{"up.txt": "uploaded"})
+				body, headers = form.Bytes(), append(headers, contentType)
+			} else if tt.method == http.MethodPut {
+				body = []byte("uploaded")
+			}
+			resp, got := do(t, srv, tt.method, tt.path, bytes.NewReader(body), headers...)
+			if resp.StatusCode != tt.status {
+				t.Errorf("%s %s = %d %s, want %d", tt.method, tt.path, resp.StatusCode, got, tt.status)
+			}
+			if strings.Contains(got, "a.txt") || strings.Contains(got, "b.txt") || strings.Contains(got, "nested") {
+				t.Errorf("%s %s shows the folder: %s", tt.method, tt.path, got)
+			}
+			if tt.saved != "" {
+				if _, err := os.Stat(filepath.Join(dir, tt.saved)); err != nil {
+					t.Errorf("%s %s didn't save %s: %v", tt.method, tt.path, tt.saved, err)
+				}
+			}
+			if content, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(content) != "old" {
+				t.Errorf("%s %s replaced a.txt with %q", tt.method, tt.path, content)
+			}
+		})
+	}
+}
+
+func TestReceivePage(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "old"})
+	srv := newTestServer(t, dir, "-receive", "-base-path", "/drop", "-allowed-upload-ext", "jpg")
+
+	resp, body := do(t, srv, http.MethodGet, "/drop/", nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Cache-Control") != "no-store" {
+		t.Fatalf("GET /drop/ = %d Cache-Control %q, want 200 no-store", resp.StatusCode, resp.Header.Get("Cache-Control"))
+	}
+	for _, want := range []string{`data-endpoint="/drop` + tusPath + `"`, `accept=".jpg"`, `method="post"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("GET /drop/ = %s, want %q", body, want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package fylshr
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// maxRenderSize is the largest file rendered, bigger ones are sent as is.
+const maxRenderSize = 2 << 20
+
+// markdown renders GitHub flavored markdown, leaving out raw HTML so a
+// document can't run scripts on the server's origin.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+var sourceFormatter = chromahtml.New(chromahtml.WithLineNumbers(true), chromahtml.WithLinkableLineNumbers(true, "L"), chromahtml.TabWidth(4))
+
+// markdownExts are rendered as markdown, other text files with a known
+// language get syntax highlighting.
+var markdownExts = []string{".md", ".markdown"}
+
+// renderable reports whether the file name can be rendered. With -render it's
+// asked for every file, so pages a browser shows as they are, HTML and SVG,
+// are left alone unless ?render asks for their source explicitly.
+func renderable(name string, explicit bool) bool {
+	ext := strings.ToLower(path.Ext(name))
+	if slices.Contains(markdownExts, ext) {
+		return true
+	}
+	if !explicit && (ext == ".html" || ext == ".htm" || ext == ".svg" || ext == ".xhtml") {
+		return false
+	}
+	lexer := lexers.Match(path.Base(name))
+	return lexer != nil && lexer.Config().Name != "plaintext"
+}
+
+// serveRendered answers the file name, at urlPath, as rendered markdown or
+// highlighted source. It reports false without writing anything when the
+// file is too big or not text, to be served as is.
+func serveRendered(w http.ResponseWriter, r *http.Request, look *look, name, urlPath string) bool {
+	info, err := os.Stat(name)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > maxRenderSize {
+		return false
+	}
+	src, err := os.ReadFile(name)
+	if err != nil || !utf8.Valid(src) {
+		return false
+	}
+
+	var body bytes.Buffer
+	class := "markdown"
+	if slices.Contains(markdownExts, strings.ToLower(path.Ext(urlPath))) {
+		if err := markdown.Convert(src, &body); err != nil {
+			return false
+		}
+	} else {
+		class = "source"
+		lexer := chroma.Coalesce(lexers.Match(path.Base(urlPath)))
+		tokens, err := lexer.Tokenise(nil, string(src))
+		if err != nil || sourceFormatter.Format(&body, look.source, tokens) != nil {
+			return false
+		}
+	}
+
+	raw := (&url.URL{Path: path.Base(urlPath)}).String() + "?raw"
+	page := renderPage(look, path.Base(urlPath), class, raw, body.String())
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	serveGenerated(w, r, info.ModTime(), page)
+	return true
+}
+
+// serveMarkdown answers src rendered as an HTML page titled title.
+func serveMarkdown(w http.ResponseWriter, r *http.Request, look *look, title string, src []byte) {
+	var body bytes.Buffer
+	if err := markdown.Convert(src, &body); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "500 "+err.Error())
+		return
+	}
+
+	page := renderPage(look, title, "markdown", "", body.String())
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(page)))
+	writeBody(w, r, page)
+}
+
+// renderPage wraps rendered HTML in a page with a link to the raw file, if
+// raw isn't empty.
+func renderPage(look *look, title, class, raw, body string) []byte {
+	var page bytes.Buffer
+	look.render.Execute(&page, struct {
+		Title string
+		Class string
+		Raw   string
+		Body  template.HTML
+		Style template.HTML
+	}{title, class, raw, template.HTML(body), template.HTML(look.style)})
+	return page.Bytes()
+}
+
+var renderTemplate = template.Must(template.New("render").Parse(`<!doctype html>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width">
+<title>{{.Title}}</title>
+{{- with .Raw}}
+<p class="actions"><a href="./">Back to the folder</a> · <a href="{{.}}">Raw</a></p>
+{{- end}}
+<article class="{{.Class}}">
+{{.Body}}
+</article>
+{{.Style}}
+`))
@@ -0,0 +1,108 @@
+package fylshr
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestConditionalGenerated checks that rendered files and listings answer 304
+// to the validators they sent until what they show changes.
+func TestConditionalGenerated(t *testing.T) {
+	tests := []struct {
+		name, path, changed string
+	}{
+		{"markdown", "/doc.md?render", "Changed"},
+		{"source", "/main.go?render", "changed"},
+		{"listing", "/", "doc.md"},
+		{"json listing", "/?format=json", "doc.md"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"doc.md": "# Title", "main.go": "package main"})
+			old := time.Now().Add(-time.Hour).Truncate(time.Second)
+			for _, name := range []string{"doc.md", "main.go", "."} {
+				if err := os.Chtimes(filepath.Join(dir, name), old, old); err != nil {
+					t.Fatal(err)
+				}
+			}
+			srv := newTestServer(t, dir)
+
+			resp, _ := do(t, srv, http.MethodGet, tt.path, nil)
+			modified, etag := resp.Header.Get("Last-Modified"), resp.Header.Get("ETag")
+			if resp.StatusCode != http.StatusOK || modified != old.UTC().Format(http.TimeFormat) || etag == "" {
+				t.Fatalf("GET %s = %d Last-Modified %q ETag %q, want 200 with validators", tt.path, resp.StatusCode, modified, etag)
+			}
+			for _, header := range []string{"If-Modified-Since: " + modified, "If-None-Match: " + etag} {
+				if resp, body := do(t, srv, http.MethodGet, tt.path, nil, header); resp.StatusCode != http.StatusNotModified || body != "" {
+					t.Errorf("GET %s %s = %d, want 304", tt.path, header, resp.StatusCode)
+				}
+			}
+
+			writeFiles(t, dir, map[string]string{"doc.md": "# Changed", "main.go": "package changed"})
+			for _, header := range []string{"If-Modified-Since: " + modified, "If-None-Match: " + etag} {
+				if resp, body := do(t, srv, http.MethodGet, tt.path, nil, header); resp.StatusCode != http.StatusOK || !strings.Contains(body, tt.changed) {
+					t.Errorf("GET %s %s after a change = %d, want 200 with the change", tt.path, header, resp.StatusCode)
+				}
+			}
+		})
+	}
+}
+
+// TestRender checks which files ?render and -render show as rendered
+// markdown or highlighted source, and that the others are sent as is.
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	doc := "# Title\n\n<script>alert(1)</script>\n\n| a | b |\n|---|---|\n| 1 | 2 |\n"
+	writeFiles(t, dir, map[string]string{
+		"doc.md":    doc,
+		"main.go":   "package main\n",
+		"page.html": "<p>hi</p>",
+		"notes.txt": "plain",
+		"bin.md":    "\xff\xfe",
+		"big.md":    strings.Repeat("x", maxRenderSize+1),
+	})
+
+	tests := []struct {
+		flags []string
+		path  string
+		want  []string
+	}{
+		{nil, "/doc.md", nil},
+		{nil, "/doc.md?render", []string{`<article class="markdown">`, "<h1>Title</h1>", "<table>", `<a href="doc.md?raw">Raw</a>`}},
+		{[]string{"-render"}, "/doc.md", []string{"<h1>Title</h1>"}},
+		{[]string{"-render"}, "/doc.md?raw", nil},
+		{[]string{"-render"}, "/main.go", []string{`<article class="source">`, `id="L1"`, `<a style="outline:none;text-decoration:none;color:inherit" href="#L1">1</a>`, ">package</span>"}},
+		{[]string{"-render"}, "/page.html", nil},
+		{nil, "/page.html?render", []string{`<article class="source">`, "&lt;"}},
+		{[]string{"-render"}, "/notes.txt", nil},
+		{[]string{"-render"}, "/bin.md", nil},
+		{[]string{"-render"}, "/big.md", nil},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, tt.flags...)
+		resp, body := do(t, srv, http.MethodGet, tt.path, nil)
+		rendered := strings.HasPrefix(body, "<!doctype html>")
+		if resp.StatusCode != http.StatusOK || rendered != (tt.want != nil) {
+			t.Errorf("%v GET %s = %d rendered %v, want 200 rendered %v", tt.flags, tt.path, resp.StatusCode, rendered, tt.want != nil)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("%v GET %s has no %s", tt.flags, tt.path, want)
+			}
+		}
+		if rendered && strings.Contains(body, "<script>alert") {
+			t.Errorf("%v GET %s keeps the raw HTML of the markdown", tt.flags, tt.path)
+		}
+		if name := strings.SplitN(tt.path[1:], "?", 2)[0]; !rendered {
+			if src, _ := os.ReadFile(filepath.Join(dir, name)); body != string(src) {
+				t.Errorf("%v GET %s = %q, want the file as is", tt.flags, tt.path, body)
+			}
+		}
+	}
+}
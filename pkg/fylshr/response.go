@@ -0,0 +1,159 @@
+package fylshr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// bufferedWriter collects the response body in two large buffers, one being
+// filled while a goroutine sends the other, so the file is read in big chunks
+// and done with at most a buffer after the socket, instead of at its pace.
+// Lacking ReadFrom, it gives up sendfile.
+type bufferedWriter struct {
+	http.ResponseWriter
+	buf  []byte
+	full chan []byte
+	free chan []byte
+	done chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func newBufferedWriter(w http.ResponseWriter, size int) *bufferedWriter {
+	bw := &bufferedWriter{
+		ResponseWriter: w,
+		buf:            make([]byte, 0, size),
+		full:           make(chan []byte, 1),
+		free:           make(chan []byte, 2),
+		done:           make(chan struct{}),
+	}
+	bw.free <- make([]byte, 0, size)
+	go bw.send()
+	return bw
+}
+
+// send writes the full buffers to the connection, skipping them once it
+// failed, and gives them back to be filled again.
+func (w *bufferedWriter) send() {
+	defer close(w.done)
+	for buf := range w.full {
+		if w.failed() == nil {
+			if _, err := w.ResponseWriter.Write(buf); err != nil {
+				w.mu.Lock()
+				w.err = err
+				w.mu.Unlock()
+			}
+		}
+		w.free <- buf[:0]
+	}
+}
+
+func (w *bufferedWriter) failed() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		if err := w.failed(); err != nil {
+			return written, err
+		}
+		n := min(len(b), cap(w.buf)-len(w.buf))
+		w.buf = append(w.buf, b[:n]...)
+		written += n
+		b = b[n:]
+		if len(w.buf) == cap(w.buf) {
+			w.full <- w.buf
+			w.buf = <-w.free
+		}
+	}
+	return written, nil
+}
+
+// flush sends what's left and waits for the connection to take it all, as
+// the response can't be written once the handler returns.
+func (w *bufferedWriter) flush() {
+	if len(w.buf) > 0 {
+		w.full <- w.buf
+	}
+	close(w.full)
+	<-w.done
+}
+
+// successHeaderWriter sets a header only if the response turns out to be
+// successful, so errors and redirects aren't cached.
+type successHeaderWriter struct {
+	http.ResponseWriter
+	name        string
+	value       string
+	wroteHeader bool
+}
+
+func (w *successHeaderWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status < 300 || status == http.StatusNotModified {
+			w.Header().Set(w.name, w.value)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *successHeaderWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *successHeaderWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return io.Copy(w.ResponseWriter, src)
+}
+
+func (w *successHeaderWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// writeBody writes a body generated by fylshr itself. HEAD requests only get
+// the headers, which already describe the body.
+func writeBody(w http.ResponseWriter, r *http.Request, body []byte) {
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// serveGenerated answers body, made by fylshr from content last modified at
+// modTime, with Last-Modified and a weak ETag of body, so conditional requests
+// get a 304 like the files sent as they are.
+func serveGenerated(w http.ResponseWriter, r *http.Request, modTime time.Time, body []byte) {
+	sum := sha256.Sum256(body)
+	w.Header().Set("ETag", fmt.Sprintf(`W/"%x"`, sum[:16]))
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(body))
+}
+
+// writeJSON responds with v encoded as JSON, including its Content-Length.
+func writeJSON(w http.ResponseWriter, r *http.Request, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	body = append(body, '\n')
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	writeBody(w, r, body)
+}
@@ -0,0 +1,124 @@
+package fylshr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingWriter counts the writes that reach the connection, and whether
+// its ReadFrom, which sendfile goes through, was used.
+type countingWriter struct {
+	*httptest.ResponseRecorder
+	writes   int
+	readFrom bool
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.writes++
+	return w.ResponseRecorder.Write(b)
+}
+
+func (w *countingWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.readFrom = true
+	return io.Copy(w.ResponseRecorder, src)
+}
+
+// TestBufferSize checks that -buffer-size sends whole files in as few writes
+// as it holds, except ranges and media which keep sendfile, and that nothing
+// is lost.
+func TestBufferSize(t *testing.T) {
+	content := strings.Repeat("0123456789abcdef", 16<<10)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"big.bin": content, "movie.mp4": content})
+
+	tests := []struct {
+		flags     []string
+		path, rng string
+		status    int
+		buffered  bool
+		writes    int
+	}{
+		{[]string{"-buffer-size", "1MB"}, "/big.bin", "", http.StatusOK, true, 1},
+		{[]string{"-buffer-size", "128KB"}, "/big.bin", "", http.StatusOK, true, 2},
+		{nil, "/big.bin", "", http.StatusOK, false, 0},
+		{[]string{"-buffer-size", "1MB"}, "/big.bin", "bytes=0-", http.StatusPartialContent, false, 0},
+		{[]string{"-buffer-size", "1MB"}, "/movie.mp4", "", http.StatusOK, false, 0},
+	}
+	for _, tt := range tests {
+		h := newHandler(testArgs(t, dir, tt.flags...))
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.rng != "" {
+			r.Header.Set("Range", tt.rng)
+		}
+		w := &countingWriter{ResponseRecorder: httptest.NewRecorder()}
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status || w.Body.String() != content {
+			t.Errorf("%v GET %s Range %q = %d with %d bytes, want %d with the file", tt.flags, tt.path, tt.rng, w.Code, w.Body.Len(), tt.status)
+		}
+		if tt.buffered && (w.writes != tt.writes || w.readFrom) || !tt.buffered && !w.readFrom {
+			t.Errorf("%v GET %s Range %q sent %d writes, ReadFrom %v, want buffered %v in %d", tt.flags, tt.path, tt.rng, w.writes, w.readFrom, tt.buffered, tt.writes)
+		}
+	}
+}
+
+// slowWriter is a connection that takes perKB to send each KiB.
+type slowWriter struct {
+	http.ResponseWriter
+	perKB time.Duration
+	err   error
+}
+
+func (w *slowWriter) Write(b []byte) (int, error) {
+	time.Sleep(w.perKB * time.Duration(len(b)) / 1024)
+	if w.err != nil {
+		return 0, w.err
+	}
+	return len(b), nil
+}
+
+// TestBufferedWriterError checks that the file stops being read once the
+// connection failed.
+func TestBufferedWriterError(t *testing.T) {
+	content := strings.Repeat("x", 1<<20)
+	bw := newBufferedWriter(&slowWriter{ResponseWriter: httptest.NewRecorder(), err: errors.New("connection reset")}, 64<<10)
+	n, err := io.Copy(bw, strings.NewReader(content))
+	bw.flush()
+	if err == nil || n >= int64(len(content)) {
+		t.Errorf("copy to a failed connection = %d bytes, %v, want it to stop with an error", n, err)
+	}
+}
+
+// BenchmarkBufferSize measures how long serving a file to a slow client holds
+// the file and the goroutine reading it, held-ms/op, against how long the
+// response takes, total-ms/op.
+func BenchmarkBufferSize(b *testing.B) {
+	content := strings.NewReader(strings.Repeat("0123456789abcdef", 64<<10))
+	for _, size := range []int{0, 256 << 10, 1 << 20} {
+		b.Run(fmt.Sprint("buffer", size), func(b *testing.B) {
+			var held, total time.Duration
+			for range b.N {
+				start := time.Now()
+				var w http.ResponseWriter = &slowWriter{ResponseWriter: httptest.NewRecorder(), perKB: 30 * time.Microsecond}
+				var bw *bufferedWriter
+				if size > 0 {
+					bw = newBufferedWriter(w, size)
+					w = bw
+				}
+				http.ServeContent(w, httptest.NewRequest(http.MethodGet, "/big.bin", nil), "big.bin", time.Time{}, content)
+				held += time.Since(start)
+				if bw != nil {
+					bw.flush()
+				}
+				total += time.Since(start)
+			}
+			b.ReportMetric(float64(held.Milliseconds())/float64(b.N), "held-ms/op")
+			b.ReportMetric(float64(total.Milliseconds())/float64(b.N), "total-ms/op")
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package fylshr
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// rewriteRule maps paths matching pattern to replacement, internally when
+// status is 0 or with a redirect of that status otherwise.
+type rewriteRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+	status      int
+}
+
+// rewriteFlags adds -rewrite and -redirect values to one list, so the rules
+// keep their command line order whichever flag they came from.
+type rewriteFlags struct {
+	rules    *[]rewriteRule
+	redirect bool
+}
+
+func (f rewriteFlags) String() string {
+	if f.rules == nil {
+		return ""
+	}
+	var entries []string
+	for _, rule := range *f.rules {
+		if (rule.status != 0) == f.redirect {
+			entries = append(entries, rule.pattern.String()+" -> "+rule.replacement)
+		}
+	}
+	return strings.Join(entries, " ")
+}
+
+func (f rewriteFlags) Set(value string) error {
+	pattern, replacement, ok := strings.Cut(value, "->")
+	pattern, replacement = strings.TrimSpace(pattern), strings.TrimSpace(replacement)
+	if !ok || pattern == "" || replacement == "" {
+		return fmt.Errorf("invalid rule %q, expected \"pattern -> replacement\"", value)
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+
+	rule := rewriteRule{pattern: re, replacement: replacement}
+	if f.redirect {
+		rule.status = http.StatusMovedPermanently
+		if target, code, ok := strings.Cut(replacement, " "); ok {
+			status, err := strconv.Atoi(strings.TrimSpace(code))
+			if err != nil || status < 300 || status > 399 {
+				return fmt.Errorf("invalid redirect status %q", code)
+			}
+			rule.replacement, rule.status = target, status
+		}
+	}
+
+	*f.rules = append(*f.rules, rule)
+	return nil
+}
+
+// rewrite applies the first rule matching the request path. Internal rewrites
+// return the request to serve instead, redirects are answered and r is nil.
+func rewrite(w http.ResponseWriter, r *http.Request, rules []rewriteRule, basePath string) *http.Request {
+	for _, rule := range rules {
+		if !rule.pattern.MatchString(r.URL.Path) {
+			continue
+		}
+
+		target := rule.pattern.ReplaceAllString(r.URL.Path, rule.replacement)
+		if rule.status == 0 {
+			r = r.Clone(r.Context())
+			r.URL.Path, r.URL.RawPath = target, ""
+			return r
+		}
+
+		if strings.HasPrefix(target, "/") {
+			target = basePath + target
+		}
+		if r.URL.RawQuery != "" && !strings.Contains(target, "?") {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, rule.status)
+		return nil
+	}
+	return r
+}
+
+// rewrittenPath returns the path name is served as after the internal
+// rewrites of rules, for the middleware that runs before them.
+func rewrittenPath(rules []rewriteRule, name string) string {
+	for _, rule := range rules {
+		if !rule.pattern.MatchString(name) {
+			continue
+		}
+		if rule.status == 0 {
+			return rule.pattern.ReplaceAllString(name, rule.replacement)
+		}
+		return name
+	}
+	return name
+}
@@ -0,0 +1,63 @@
+package fylshr
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRewrite(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"new/a.txt": "new a", "old/b.txt": "old b", "c.txt": "c"})
+
+	tests := []struct {
+		flags    []string
+		path     string
+		status   int
+		body     string
+		location string
+	}{
+		{[]string{"-rewrite", "^/old/(.*)$ -> /new/$1"}, "/old/a.txt", http.StatusOK, "new a", ""},
+		{[]string{"-rewrite", "^/old/(.*)$ -> /new/$1"}, "/old/b.txt", http.StatusNotFound, "", ""},
+		{[]string{"-rewrite", "^/old/(.*)$ -> /new/$1"}, "/c.txt", http.StatusOK, "c", ""},
+		{[]string{"-rewrite", `^/(\w+)\.text$ -> /$1.txt`}, "/c.text", http.StatusOK, "c", ""},
+		{[]string{"-redirect", "^/old/(.*)$ -> /new/$1"}, "/old/a.txt", http.StatusMovedPermanently, "", "/new/a.txt"},
+		{[]string{"-redirect", "^/old/(.*)$ -> /new/$1 302"}, "/old/a.txt?x=1", http.StatusFound, "", "/new/a.txt?x=1"},
+		{[]string{"-redirect", "^/old/(.*)$ -> /new/$1?y=2 307"}, "/old/a.txt?x=1", http.StatusTemporaryRedirect, "", "/new/a.txt?y=2"},
+		{[]string{"-redirect", "^/go$ -> https://example.com/"}, "/go", http.StatusMovedPermanently, "", "https://example.com/"},
+		{[]string{"-redirect", "^/old/a.txt$ -> /c.txt", "-rewrite", "^/old/(.*)$ -> /new/$1"}, "/old/a.txt", http.StatusMovedPermanently, "", "/c.txt"},
+		{[]string{"-rewrite", "^/old/(.*)$ -> /new/$1", "-redirect", "^/old/a.txt$ -> /c.txt"}, "/old/a.txt", http.StatusOK, "new a", ""},
+		{[]string{"-rewrite", "^/old/(.*)$ -> /new/$1", "-rewrite", "^/new/a.txt$ -> /c.txt"}, "/old/a.txt", http.StatusOK, "new a", ""},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, tt.flags...)
+		resp, body := do(t, srv, http.MethodGet, tt.path, nil)
+		if resp.StatusCode != tt.status || tt.body != "" && body != tt.body || resp.Header.Get("Location") != tt.location {
+			t.Errorf("%v GET %s = %d %q Location %q, want %d %q %q", tt.flags, tt.path, resp.StatusCode, body, resp.Header.Get("Location"), tt.status, tt.body, tt.location)
+		}
+	}
+}
+
+func TestRewriteFlags(t *testing.T) {
+	tests := []struct {
+		value    string
+		redirect bool
+		status   int
+		err      bool
+	}{
+		{"^/a$ -> /b", false, 0, false},
+		{"^/a$ -> /b", true, http.StatusMovedPermanently, false},
+		{"^/a$ -> /b 308", true, http.StatusPermanentRedirect, false},
+		{"^/a$ -> /b 200", true, 0, true},
+		{"^/a$ -> /b soon", true, 0, true},
+		{"^/a$ /b", false, 0, true},
+		{" -> /b", false, 0, true},
+		{"^/(a$ -> /b", false, 0, true},
+	}
+	for _, tt := range tests {
+		var rules []rewriteRule
+		err := rewriteFlags{rules: &rules, redirect: tt.redirect}.Set(tt.value)
+		if (err != nil) != tt.err || err == nil && (len(rules) != 1 || rules[0].status != tt.status) {
+			t.Errorf("Set(%q) redirect %v = %v, %v, want status %d", tt.value, tt.redirect, rules, err, tt.status)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package fylshr
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	searchPath = "/_search"
+	// maxSearchResults keeps a vague search of a big tree from taking long.
+	maxSearchResults = 500
+)
+
+// serveSearch lists the files and directories of fsys under ?in= whose name
+// contains ?q=, ignoring case. Directories allowed rejects are skipped.
+func serveSearch(w http.ResponseWriter, r *http.Request, fsys http.FileSystem, allowed func(name string) bool, opts listingOptions) {
+	query := r.URL.Query()
+	q := strings.ToLower(strings.TrimSpace(query.Get("q")))
+	in := path.Clean("/" + query.Get("in"))
+	if q == "" {
+		writeError(w, r, http.StatusBadRequest, "400 missing ?q=")
+		return
+	}
+	if !allowed(strings.TrimSuffix(in, "/") + "/") {
+		writeError(w, r, http.StatusForbidden, "403 forbidden")
+		return
+	}
+
+	title := in
+	if in != "/" {
+		title += "/"
+	}
+	page := listingPage{
+		Path:     title,
+		Search:   opts.basePath + searchPath,
+		SearchIn: title,
+		Query:    query.Get("q"),
+		Back:     (&url.URL{Path: opts.basePath + title}).EscapedPath(),
+	}
+
+	var entries []listingEntry
+	dirs := []string{in}
+	for len(dirs) > 0 && r.Context().Err() == nil {
+		dir := dirs[len(dirs)-1]
+		dirs = dirs[:len(dirs)-1]
+
+		f, err := fsys.Open(dir)
+		if err != nil {
+			continue
+		}
+		infos, _ := f.Readdir(-1)
+		f.Close()
+
+		for _, info := range infos {
+			name := path.Join(dir, info.Name())
+			if info.IsDir() {
+				if !allowed(name + "/") {
+					continue
+				}
+				dirs = append(dirs, name)
+			}
+			if !strings.Contains(strings.ToLower(info.Name()), q) {
+				continue
+			}
+			if len(entries) == maxSearchResults {
+				page.Truncated = true
+				dirs = nil
+				break
+			}
+
+			e := newListingEntry(info, opts.mimeTypes)
+			rel := strings.TrimPrefix(name, title)
+			e.Href = (&url.URL{Path: opts.basePath + name}).EscapedPath()
+			if info.IsDir() {
+				rel += "/"
+				e.Href += "/"
+			}
+			if opts.thumbs && !e.IsDir && hasThumb(e.Name) {
+				e.Thumb = thumbsURL(opts.basePath, dir) + (&url.URL{Path: info.Name()}).EscapedPath()
+			}
+			e.Name = rel
+			entries = append(entries, e)
+		}
+	}
+
+	renderListing(w, r, page, entries, opts)
+}
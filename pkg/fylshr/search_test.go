@@ -0,0 +1,101 @@
+package fylshr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// searchNames returns the links of the JSON results of a search, without the
+// ?token= they keep, and whether they were truncated.
+func searchNames(t *testing.T, body string) ([]string, bool) {
+	t.Helper()
+	var results struct {
+		Entries   []listingJSONEntry
+		Truncated bool
+	}
+	if err := json.Unmarshal([]byte(body), &results); err != nil {
+		t.Fatalf("%s in %s", err, body)
+	}
+	var names []string
+	for _, e := range results.Entries {
+		href, _, _ := strings.Cut(e.Href, "?")
+		names = append(names, href)
+	}
+	slices.Sort(names)
+	return names, results.Truncated
+}
+
+func TestSearch(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"Report.txt":           "",
+		"docs/report-2024.pdf": "",
+		"docs/reports/":        "",
+		"docs/notes.md":        "",
+		".hidden/report.txt":   "",
+		"logs/report.log":      "",
+		"sec/" + tokenFile:     "s3cret",
+		"sec/report.txt":       "",
+	})
+	srv := newTestServer(t, dir, "-exclude", "*.log")
+
+	tests := []struct {
+		name, target string
+		status       int
+		want         []string
+	}{
+		{"everywhere", searchPath + "?q=report", http.StatusOK, []string{"/Report.txt", "/docs/report-2024.pdf", "/docs/reports/"}},
+		{"ignores case", searchPath + "?q=REPORT", http.StatusOK, []string{"/Report.txt", "/docs/report-2024.pdf", "/docs/reports/"}},
+		{"in a folder", searchPath + "?q=report&in=/docs", http.StatusOK, []string{"/docs/report-2024.pdf", "/docs/reports/"}},
+		{"with a token", searchPath + "?q=report&token=s3cret", http.StatusOK, []string{"/Report.txt", "/docs/report-2024.pdf", "/docs/reports/", "/sec/report.txt"}},
+		{"nothing", searchPath + "?q=missing", http.StatusOK, nil},
+		{"no query", searchPath + "?q=%20", http.StatusBadRequest, nil},
+		{"in a token dir", searchPath + "?q=report&in=/sec", http.StatusForbidden, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, srv, http.MethodGet, tt.target, nil, "Accept: application/json")
+			if resp.StatusCode != tt.status {
+				t.Fatalf("GET %s = %d %s, want %d", tt.target, resp.StatusCode, body, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if names, _ := searchNames(t, body); !slices.Equal(names, tt.want) {
+				t.Errorf("GET %s found %q, want %q", tt.target, names, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchPage(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"docs/report.pdf": ""})
+	srv := newTestServer(t, dir)
+
+	if _, body := do(t, srv, http.MethodGet, "/docs/", nil); !strings.Contains(body, `action="`+searchPath+`"`) || !strings.Contains(body, `name="in" value="/docs/"`) {
+		t.Errorf("GET /docs/ has no search box for /docs/: %s", body)
+	}
+	if _, body := do(t, srv, http.MethodGet, searchPath+"?q=rep&in=/docs", nil); !strings.Contains(body, `href="/docs/report.pdf"`) {
+		t.Errorf("GET %s?q=rep doesn't link to the result: %s", searchPath, body)
+	}
+}
+
+func TestSearchTruncated(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{}
+	for i := range maxSearchResults + 1 {
+		files[fmt.Sprintf("match-%d.txt", i)] = ""
+	}
+	writeFiles(t, dir, files)
+	srv := newTestServer(t, dir)
+
+	_, body := do(t, srv, http.MethodGet, searchPath+"?q=match", nil, "Accept: application/json")
+	if names, truncated := searchNames(t, body); len(names) != maxSearchResults || !truncated {
+		t.Errorf("search of %d matches = %d truncated %v, want %d truncated", maxSearchResults+1, len(names), truncated, maxSearchResults)
+	}
+}
@@ -0,0 +1,142 @@
+// Package fylshr is the fylshr file server, for programs that want to share a
+// folder without running the fylshr command. Main is the command itself.
+package fylshr
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Server shares Folder over HTTP. Set the options before Start; the other
+// features of the command are only available through Main. Servers keep their
+// state to themselves, so a program can run several.
+type Server struct {
+	// Folder is the directory served, required.
+	Folder string
+	// Port is the TCP port listened on, on all interfaces. 0 picks a free
+	// one, see Addr.
+	Port int
+	// Auth requires HTTP Basic authentication as "user:pass".
+	Auth string
+	// Token requires a bearer token or ?token=, alone or as an alternative to
+	// Auth.
+	Token string
+	// Upload accepts multipart POSTs to directories and PUTs to file names.
+	Upload bool
+	// Logger gets a line per request. Requests aren't logged when it is nil.
+	Logger *log.Logger
+	// ShutdownTimeout is how long Shutdown waits for active requests, 10
+	// seconds when 0.
+	ShutdownTimeout time.Duration
+
+	srv      *http.Server
+	listener net.Listener
+	stop     sync.Once
+	stopErr  error
+	stopped  chan struct{}
+}
+
+// Start listens on Port and serves in the background until ctx is done or
+// Shutdown is called.
+func (s *Server) Start(ctx context.Context) error {
+	if s.srv != nil {
+		return errors.New("fylshr: server already started")
+	}
+	if s.Auth != "" {
+		if err := parseBasicAuth(s.Auth); err != nil {
+			return fmt.Errorf("fylshr: Auth: %w", err)
+		}
+	}
+
+	args, err := s.args()
+	if err != nil {
+		return fmt.Errorf("fylshr: %w", err)
+	}
+	if err := validate(args); err != nil {
+		return fmt.Errorf("fylshr: %w", err)
+	}
+
+	l, err := net.Listen("tcp", ":"+strconv.Itoa(s.Port))
+	if err != nil {
+		return err
+	}
+
+	s.srv, s.listener, s.stopped = newServer(args), l, make(chan struct{})
+	go s.srv.Serve(l)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Shutdown()
+		case <-s.stopped:
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address listened on, once started.
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Shutdown stops accepting connections and waits up to ShutdownTimeout for
+// active requests before closing them.
+func (s *Server) Shutdown() error {
+	if s.srv == nil {
+		return errors.New("fylshr: server not started")
+	}
+
+	s.stop.Do(func() {
+		defer close(s.stopped)
+		ctx, cancel := context.WithTimeout(context.Background(), cmp.Or(s.ShutdownTimeout, 10*time.Second))
+		defer cancel()
+		if s.stopErr = s.srv.Shutdown(ctx); s.stopErr != nil {
+			s.srv.Close()
+		}
+	})
+	return s.stopErr
+}
+
+// args maps the options to the command's flags, leaving the rest at the
+// defaults the command has without any flag. The environment and config file
+// of the command are left out, they belong to the program embedding it.
+func (s *Server) args() (Args, error) {
+	args, err := parseArgs(flag.NewFlagSet("fylshr", flag.ContinueOnError), nil, false)
+	if err != nil {
+		return args, err
+	}
+	args.folder = s.Folder
+	args.silent = s.Logger == nil
+	args.upload = s.Upload
+	args.auth = s.Auth
+	args.token = s.Token
+	args.banner = "off"
+	// The terminal, if any, is the embedding program's.
+	args.tui, args.progress, args.color = nil, nil, false
+	if s.Logger != nil {
+		args.logFile = loggerWriter{s.Logger}
+	}
+	return args, nil
+}
+
+// loggerWriter writes access log lines through a log.Logger, so they get its
+// prefix and flags.
+type loggerWriter struct {
+	*log.Logger
+}
+
+func (w loggerWriter) Write(b []byte) (int, error) {
+	w.Print(string(b))
+	return len(b), nil
+}
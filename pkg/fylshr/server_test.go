@@ -0,0 +1,129 @@
+package fylshr
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerArgsDefaults(t *testing.T) {
+	cli := parseTestArgs(t)
+	args, err := (&Server{Folder: "shared"}).args()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"folder", args.folder, "shared"},
+		{"thumbnails", args.thumbnails, cli.thumbnails},
+		{"etag", args.etag, cli.etag},
+		{"disposition", args.disposition, cli.disposition},
+		{"hideDotfiles", args.hideDotfiles, cli.hideDotfiles},
+		{"noCompress", args.noCompress, cli.noCompress},
+		{"mdns", args.mdns, cli.mdns},
+		{"silent", args.silent, true},
+		{"banner", args.banner, "off"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+	if !slices.Equal(args.methods, cli.methods) {
+		t.Errorf("methods = %v, want %v", args.methods, cli.methods)
+	}
+	if cli.etag != "mtime" || !cli.thumbnails {
+		t.Errorf("command defaults changed: etag %q, thumbnails %v", cli.etag, cli.thumbnails)
+	}
+}
+
+func TestServerStart(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{Folder: dir}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown()
+
+	resp, err := http.Get("http://" + s.Addr().String() + "/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "hello" {
+		t.Errorf("GET /a.txt = %d %q, want 200 \"hello\"", resp.StatusCode, body)
+	}
+	if etag := resp.Header.Get("ETag"); etag == "" {
+		t.Error("no ETag with the default -etag mtime")
+	}
+}
+
+// TestServerState checks that two servers of the same process keep their own
+// sessions, metrics, maintenance mode, sitemap and thumbnails.
+func TestServerState(t *testing.T) {
+	// Same size and time, so only the folder tells the thumbnails apart.
+	black := image.NewGray(image.Rect(0, 0, 50, 40))
+	white := image.NewGray(black.Rect)
+	for i := range white.Pix {
+		white.Pix[i] = 0xff
+	}
+	enc := png.Encoder{CompressionLevel: png.NoCompression}
+	modTime := time.Now().Add(-time.Hour)
+
+	var args [2]Args
+	var handlers [2]http.Handler
+	for i, img := range []image.Image{black, white} {
+		var b bytes.Buffer
+		enc.Encode(&b, img)
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{"b.png": b.String(), []string{"first.html", "second.html"}[i]: ""})
+		if err := os.Chtimes(filepath.Join(dir, "b.png"), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		args[i] = testArgs(t, dir, "-metrics", "-stats", "-thumbnails", "-sitemap", "https://example.com")
+		handlers[i] = newHandler(args[i])
+	}
+	get := func(i int, path string) (int, string) {
+		w := httptest.NewRecorder()
+		handlers[i].ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	_, firstThumb := get(0, thumbPath+"/b.png")
+	if _, thumb := get(1, thumbPath+"/b.png"); thumb == firstThumb {
+		t.Errorf("the second server serves the thumbnail of the first one's b.png")
+	}
+	_, firstSitemap := get(0, sitemapPath)
+	if _, sitemap := get(1, sitemapPath); !strings.Contains(firstSitemap, "first.html") || !strings.Contains(sitemap, "second.html") || strings.Contains(sitemap, "first.html") {
+		t.Errorf("sitemaps = %q and %q, want each with its own page", firstSitemap, sitemap)
+	}
+	if a, b := args[0].session.summary().Requests, args[1].session.summary().Requests; a != 2 || b != 2 {
+		t.Errorf("sessions counted %d and %d requests, want 2 each", a, b)
+	}
+	if args[0].requestMetrics == args[1].requestMetrics {
+		t.Errorf("both servers record their -metrics together")
+	}
+
+	args[0].maintenance.Store(true)
+	if code, _ := get(1, "/b.png"); code != http.StatusOK {
+		t.Errorf("GET /b.png of the second server = %d during the first one's maintenance, want 200", code)
+	}
+}
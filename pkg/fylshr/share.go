@@ -0,0 +1,127 @@
+package fylshr
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// share serves a single file under a random path for -file, optionally
+// until it's downloaded once or -expire passes.
+type share struct {
+	file     string
+	path     string
+	once     bool
+	expires  time.Time
+	consumed atomic.Bool
+	done     chan struct{}
+	stop     sync.Once
+}
+
+// obscureLength is the length of the secret of -obscure, from pasteAlphabet
+// so it can be typed from the banner, and about 50 bits.
+const obscureLength = 10
+
+// obscurePrefix returns the random /s/<secret> prefix everything is served
+// under with -obscure.
+func obscurePrefix() (string, error) {
+	b := make([]byte, obscureLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = pasteAlphabet[int(b[i])%len(pasteAlphabet)]
+	}
+	return "/s/" + string(b), nil
+}
+
+func newShare(file string, once bool, expire time.Duration) (*share, error) {
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+
+	s := &share{
+		file: file,
+		path: "/d/" + hex.EncodeToString(token) + "/" + filepath.Base(file),
+		once: once,
+		done: make(chan struct{}),
+	}
+	if expire > 0 {
+		s.expires = time.Now().Add(expire)
+		time.AfterFunc(expire, s.end)
+	}
+	return s, nil
+}
+
+// Done is closed once the link is used up or expired. It's nil, so never
+// ready, without -file.
+func (s *share) Done() <-chan struct{} {
+	if s == nil {
+		return nil
+	}
+	return s.done
+}
+
+func (s *share) end() {
+	s.stop.Do(func() { close(s.done) })
+}
+
+func (s *share) serve(w http.ResponseWriter, r *http.Request, types mimeTypes) {
+	if r.URL.Path != s.path {
+		writeError(w, r, http.StatusNotFound, "404 page not found")
+		return
+	}
+	if s.consumed.Load() || (!s.expires.IsZero() && time.Now().After(s.expires)) {
+		writeError(w, r, http.StatusGone, "410 this link has expired")
+		return
+	}
+	// A GET claims the link before serving so two downloads can't race, and
+	// gives it back if it turns out not to be a complete one.
+	claimed := s.once && r.Method == http.MethodGet
+	if claimed && !s.consumed.CompareAndSwap(false, true) {
+		writeError(w, r, http.StatusGone, "410 this link has expired")
+		return
+	}
+	complete := false
+	defer func() {
+		if !claimed {
+			return
+		}
+		if complete {
+			s.end()
+		} else {
+			s.consumed.Store(false)
+		}
+	}()
+
+	f, err := os.Open(s.file)
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, "404 page not found")
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "500 "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": info.Name()}))
+	if contentType := types.custom(info.Name()); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	sw := &statusWriter{ResponseWriter: w}
+	http.ServeContent(sw, r, info.Name(), info.ModTime(), f)
+
+	// Only a complete download uses up the link, not a HEAD or a partial
+	// range, but a range of the whole file is as good as a 200.
+	complete = (sw.status == http.StatusOK || sw.status == http.StatusPartialContent) && sw.bytes >= info.Size()
+}
@@ -0,0 +1,192 @@
+package fylshr
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestShare checks that a -once link survives HEAD and ranges, is used up by
+// a complete download, and ends the share.
+func TestShare(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"report.pdf": "%PDF-1.7 report", "other.txt": "other"})
+	args := testArgs(t, "", "-file", filepath.Join(dir, "report.pdf"), "-once")
+	if !regexp.MustCompile(`^/d/[0-9a-f]{16}/report\.pdf$`).MatchString(args.share.path) {
+		t.Fatalf("-file path = %s", args.share.path)
+	}
+	srv := httptest.NewServer(newHandler(args))
+	defer srv.Close()
+
+	tests := []struct {
+		method, path, header string
+		status               int
+		done                 bool
+	}{
+		{http.MethodGet, "/", "", http.StatusNotFound, false},
+		{http.MethodGet, "/other.txt", "", http.StatusNotFound, false},
+		{http.MethodGet, "/d/0000000000000000/report.pdf", "", http.StatusNotFound, false},
+		{http.MethodHead, args.share.path, "", http.StatusOK, false},
+		{http.MethodGet, args.share.path, "Range: bytes=0-3", http.StatusPartialContent, false},
+		{http.MethodGet, args.share.path, "", http.StatusOK, true},
+		{http.MethodGet, args.share.path, "", http.StatusGone, true},
+	}
+	for _, tt := range tests {
+		var headers []string
+		if tt.header != "" {
+			headers = append(headers, tt.header)
+		}
+		resp, body := do(t, srv, tt.method, tt.path, nil, headers...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s %s = %d, want %d", tt.method, tt.path, tt.header, resp.StatusCode, tt.status)
+		}
+		if tt.status == http.StatusOK && tt.method == http.MethodGet && (body != "%PDF-1.7 report" || resp.Header.Get("Content-Disposition") != `attachment; filename=report.pdf`) {
+			t.Errorf("GET %s = %q %s, want the file as an attachment", tt.path, body, resp.Header.Get("Content-Disposition"))
+		}
+		select {
+		case <-args.share.Done():
+			if !tt.done {
+				t.Errorf("%s %s %s ended the share", tt.method, tt.path, tt.header)
+			}
+		default:
+			if tt.done {
+				t.Errorf("%s %s %s didn't end the share", tt.method, tt.path, tt.header)
+			}
+		}
+	}
+}
+
+// TestShareOnceRange checks that a range of the whole file uses up a -once
+// link like a plain download, and a part of it doesn't.
+func TestShareOnceRange(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "0123456789"})
+
+	tests := []struct {
+		header string
+		status int
+		done   bool
+	}{
+		{"Range: bytes=0-", http.StatusPartialContent, true},
+		{"Range: bytes=-10", http.StatusPartialContent, true},
+		{"Range: bytes=0-9", http.StatusPartialContent, true},
+		{"Range: bytes=0-4,5-", http.StatusPartialContent, true},
+		{"Range: bytes=1-", http.StatusPartialContent, false},
+		{"Range: bytes=0-8", http.StatusPartialContent, false},
+	}
+	for _, tt := range tests {
+		args := testArgs(t, "", "-file", filepath.Join(dir, "a.txt"), "-once")
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, args.share.path, nil)
+		r.Header.Set("Range", strings.TrimPrefix(tt.header, "Range: "))
+		newHandler(args).ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.header, w.Code, tt.status)
+		}
+		select {
+		case <-args.share.Done():
+			if !tt.done {
+				t.Errorf("GET %s ended the share", tt.header)
+			}
+		default:
+			if tt.done {
+				t.Errorf("GET %s didn't end the share", tt.header)
+			}
+		}
+	}
+}
+
+// failingWriter is a ResponseWriter whose connection drops on the first
+// write of the body.
+type failingWriter struct{ *httptest.ResponseRecorder }
+
+func (w failingWriter) Write([]byte) (int, error) { return 0, errors.New("connection reset") }
+
+// TestShareOnceConcurrent checks that a -once link can't be downloaded twice
+// at the same time, and is given back if the download fails.
+func TestShareOnceConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	// Big enough not to fit in the socket buffers, so the first download is
+	// still going while the second one is made.
+	data := make([]byte, 32<<20)
+	rand.Read(data)
+	if err := os.WriteFile(filepath.Join(dir, "big.bin"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	args := testArgs(t, "", "-file", filepath.Join(dir, "big.bin"), "-once")
+	h := newHandler(args)
+
+	failed := failingWriter{httptest.NewRecorder()}
+	h.ServeHTTP(failed, httptest.NewRequest(http.MethodGet, args.share.path, nil))
+	select {
+	case <-args.share.Done():
+		t.Fatal("a failed download ended the share")
+	default:
+	}
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	first, err := http.Get(srv.URL + args.share.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Body.Close()
+	if first.StatusCode != http.StatusOK {
+		t.Fatalf("first GET = %d, want 200", first.StatusCode)
+	}
+
+	resp, _ := do(t, srv, http.MethodGet, args.share.path, nil)
+	if resp.StatusCode != http.StatusGone {
+		t.Errorf("GET during the first download = %d, want 410", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(first.Body)
+	if err != nil || !bytes.Equal(body, data) {
+		t.Fatalf("first GET = %d bytes, %v, want the whole file", len(body), err)
+	}
+	select {
+	case <-args.share.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first download didn't end the share")
+	}
+	resp, _ = do(t, srv, http.MethodGet, args.share.path, nil)
+	if resp.StatusCode != http.StatusGone {
+		t.Errorf("GET after the first download = %d, want 410", resp.StatusCode)
+	}
+}
+
+// TestShareExpire checks that a link without -once can be downloaded again
+// until -expire ends the share.
+func TestShareExpire(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+
+	args := testArgs(t, "", "-file", filepath.Join(dir, "a.txt"), "-expire", "50ms")
+	h := newHandler(args)
+	for range 2 {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, args.share.path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s before -expire = %d, want 200", args.share.path, w.Code)
+		}
+	}
+	select {
+	case <-args.share.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("-expire didn't end the share")
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, args.share.path, nil))
+	if w.Code != http.StatusGone {
+		t.Errorf("GET %s after -expire = %d, want 410", args.share.path, w.Code)
+	}
+}
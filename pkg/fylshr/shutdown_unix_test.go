@@ -0,0 +1,61 @@
+//go:build unix
+
+package fylshr
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestShutdown checks that SIGINT and SIGTERM, what docker stop sends, shut
+// the server down gracefully and say which signal did.
+func TestShutdown(t *testing.T) {
+	for _, sig := range []syscall.Signal{syscall.SIGINT, syscall.SIGTERM} {
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+		socket := filepath.Join(t.TempDir(), "fylshr.sock")
+
+		var stderr bytes.Buffer
+		cmd := mainCommand("-folder", dir, "-listen", "unix:"+socket, "-silent", "-banner", "off", "-shutdown-timeout", "2s")
+		cmd.Stderr = &stderr
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+
+		client := &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return new(net.Dialer).DialContext(ctx, "unix", socket)
+		}}}
+		var resp *http.Response
+		var err error
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if resp, err = client.Get("http://fylshr/a.txt"); err == nil {
+				resp.Body.Close()
+				break
+			}
+		}
+		if err != nil {
+			cmd.Process.Kill()
+			t.Fatalf("GET /a.txt: %v, %s", err, stderr.String())
+		}
+
+		cmd.Process.Signal(sig)
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		select {
+		case err := <-done:
+			if want := "received " + sig.String() + ", shutting down"; err != nil || !strings.Contains(stderr.String(), want) {
+				t.Errorf("%s exits with %v %q, want %q", sig, err, stderr.String(), want)
+			}
+		case <-time.After(5 * time.Second):
+			cmd.Process.Kill()
+			t.Errorf("%s didn't shut the server down", sig)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package fylshr
+
+import (
+	"encoding/xml"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sitemapPath = "/sitemap.xml"
+
+// sitemapTTL bounds how stale the cached sitemap gets without -watch, which
+// drops it as soon as files change.
+const sitemapTTL = time.Minute
+
+// sitemapCache is the last sitemap built by a server.
+type sitemapCache struct {
+	sync.Mutex
+	xml   []byte
+	built time.Time
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// parseSitemapURL checks the public URL the sitemap entries are relative to.
+func parseSitemapURL(s string) (string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("expected an absolute http or https URL")
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+func serveSitemap(w http.ResponseWriter, r *http.Request, args Args) {
+	cache := args.sitemapCache
+	cache.Lock()
+	if cache.xml == nil || time.Since(cache.built) > sitemapTTL {
+		cache.xml = buildSitemap(args)
+		cache.built = time.Now()
+	}
+	body := cache.xml
+	cache.Unlock()
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	writeBody(w, r, body)
+}
+
+// forget drops the cached sitemap, so the next request rebuilds it.
+func (c *sitemapCache) forget() {
+	c.Lock()
+	defer c.Unlock()
+	c.xml = nil
+}
+
+// buildSitemap lists the HTML pages of every layer that would be served,
+// leaving out dot files, hidden files and folders protected by a token.
+func buildSitemap(args Args) []byte {
+	pages := map[string]time.Time{}
+	for _, folder := range args.layers() {
+		filepath.WalkDir(folder, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if name != folder && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				if _, err := os.Stat(filepath.Join(name, tokenFile)); err == nil {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !strings.EqualFold(filepath.Ext(name), ".html") {
+				return nil
+			}
+
+			rel, err := filepath.Rel(folder, name)
+			if err != nil {
+				return nil
+			}
+			page := "/" + filepath.ToSlash(rel)
+			info, err := d.Info()
+			if err != nil || args.hidden(page, info) {
+				return nil
+			}
+			if _, seen := pages[page]; seen || args.localPath(page) != name {
+				return nil
+			}
+			pages[page] = info.ModTime()
+			return nil
+		})
+	}
+
+	set := sitemapURLSet{Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	for page, modTime := range pages {
+		if path.Base(page) == "index.html" {
+			page = strings.TrimSuffix(page, "index.html")
+		}
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:     args.sitemap + (&url.URL{Path: args.basePath + page}).EscapedPath(),
+			LastMod: modTime.UTC().Format(time.RFC3339),
+		})
+	}
+	slices.SortFunc(set.URLs, func(a, b sitemapURL) int { return strings.Compare(a.Loc, b.Loc) })
+
+	b, _ := xml.MarshalIndent(set, "", "  ")
+	return append([]byte(xml.Header), append(b, '\n')...)
+}
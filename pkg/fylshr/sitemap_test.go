@@ -0,0 +1,111 @@
+package fylshr
+
+import (
+	"encoding/xml"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSitemap(t *testing.T) {
+	dir, lower := t.TempDir(), t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"index.html":          "",
+		"about.html":          "",
+		"My Page.HTML":        "",
+		"notes.txt":           "",
+		"blog/index.html":     "",
+		"blog/post.html":      "",
+		".drafts/wip.html":    "",
+		".hidden.html":        "",
+		"sec/" + tokenFile:    "s3cret",
+		"sec/private.html":    "",
+		"debug.log/page.html": "",
+	})
+	writeFiles(t, lower, map[string]string{"about.html": "shadowed", "extra.html": ""})
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("", 3600))
+	if err := os.Chtimes(filepath.Join(dir, "about.html"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		flags []string
+		path  string
+		want  []string
+	}{
+		{[]string{"-exclude", "*.log"}, "/sitemap.xml", []string{
+			"https://example.com/",
+			"https://example.com/My%20Page.HTML",
+			"https://example.com/about.html",
+			"https://example.com/blog/",
+			"https://example.com/blog/post.html",
+			"https://example.com/extra.html",
+		}},
+		{[]string{"-base-path", "/site", "-exclude", "*.log,blog"}, "/site/sitemap.xml", []string{
+			"https://example.com/site/",
+			"https://example.com/site/My%20Page.HTML",
+			"https://example.com/site/about.html",
+			"https://example.com/site/extra.html",
+		}},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, append([]string{"-sitemap", "https://example.com/", "-overlay", lower}, tt.flags...)...)
+		resp, body := do(t, srv, http.MethodGet, tt.path, nil)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/xml; charset=utf-8" {
+			t.Fatalf("GET %s = %d %s", tt.path, resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		var set sitemapURLSet
+		if err := xml.Unmarshal([]byte(body), &set); err != nil {
+			t.Fatalf("GET %s: %s in %s", tt.path, err, body)
+		}
+		var locs []string
+		for _, u := range set.URLs {
+			locs = append(locs, u.Loc)
+			if u.Loc == tt.want[2] && u.LastMod != "2024-01-02T02:04:05Z" {
+				t.Errorf("GET %s: %s lastmod %s, want it in UTC", tt.path, u.Loc, u.LastMod)
+			}
+		}
+		if !slices.Equal(locs, tt.want) {
+			t.Errorf("%v GET %s = %q, want %q", tt.flags, tt.path, locs, tt.want)
+		}
+	}
+}
+
+// TestSitemapFile checks that a sitemap.xml of the folder is served instead of
+// the generated one.
+func TestSitemapFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"sitemap.xml": "<urlset>mine</urlset>", "index.html": ""})
+	srv := newTestServer(t, dir, "-sitemap", "https://example.com")
+	if _, body := do(t, srv, http.MethodGet, "/sitemap.xml", nil); body != "<urlset>mine</urlset>" {
+		t.Errorf("GET /sitemap.xml = %s, want the folder's", body)
+	}
+
+	srv = newTestServer(t, dir)
+	if _, body := do(t, srv, http.MethodGet, "/sitemap.xml", nil); body != "<urlset>mine</urlset>" {
+		t.Errorf("GET /sitemap.xml without -sitemap = %s, want the folder's", body)
+	}
+}
+
+func TestParseSitemapURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"https://example.com/", "https://example.com", true},
+		{"http://example.com/site/", "http://example.com/site", true},
+		{"example.com", "", false},
+		{"ftp://example.com", "", false},
+		{"https:///path", "", false},
+		{"://bad", "", false},
+	}
+	for _, tt := range tests {
+		got, err := parseSitemapURL(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseSitemapURL(%q) = %q, %v, want %q, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package fylshr
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMaxFileSize(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"small.txt":   "hello",
+		"edge.bin":    strings.Repeat("x", 1024),
+		"big.bin":     strings.Repeat("x", 1025),
+		"sub/big.bin": strings.Repeat("x", 4096),
+	})
+	srv := newTestServer(t, dir, "-max-file-size", "1KB", "-webdav")
+
+	tests := []struct {
+		method, path string
+		headers      []string
+		status       int
+		want         string
+		notWant      string
+	}{
+		{http.MethodGet, "/small.txt", nil, http.StatusOK, "hello", ""},
+		{http.MethodGet, "/edge.bin", nil, http.StatusOK, "xxx", ""},
+		{http.MethodGet, "/big.bin", nil, http.StatusForbidden, "files over 1.0 KiB are not served", "xxx"},
+		{http.MethodHead, "/big.bin", nil, http.StatusForbidden, "", ""},
+		{http.MethodGet, "/big.bin", []string{"Range: bytes=0-9"}, http.StatusForbidden, "", "xxx"},
+		{http.MethodGet, "/sub/big.bin", nil, http.StatusForbidden, "", "xxx"},
+		{http.MethodGet, "/", nil, http.StatusOK, `href="edge.bin"`, "big.bin"},
+		{http.MethodGet, "/sub/", nil, http.StatusOK, "", "big.bin"},
+		{http.MethodGet, "/?format=json", nil, http.StatusOK, `"small.txt"`, "big.bin"},
+		{"PROPFIND", "/", []string{"Depth: 1"}, http.StatusMultiStatus, "small.txt", "big.bin"},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, srv, tt.method, tt.path, nil, tt.headers...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s %v = %d, want %d", tt.method, tt.path, tt.headers, resp.StatusCode, tt.status)
+		}
+		if !strings.Contains(body, tt.want) || tt.notWant != "" && strings.Contains(body, tt.notWant) {
+			t.Errorf("%s %s %v = %s, want %q without %q", tt.method, tt.path, tt.headers, body, tt.want, tt.notWant)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		ok   bool
+	}{
+		{"", 0, true},
+		{"512", 512, true},
+		{"10K", 10 << 10, true},
+		{"10 kb", 10 << 10, true},
+		{"2MB", 2 << 20, true},
+		{"1.5GiB", 3 << 29, true},
+		{"1T", 1 << 40, true},
+		{"0", 0, true},
+		{"10X", 0, false},
+		{"10KBB", 0, false},
+		{"MB", 0, false},
+		{"-5", 0, false},
+		{"1.2.3K", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package fylshr
+
+import (
+	"net/http"
+	"os"
+	"path"
+)
+
+// defaultSPAHash matches names like app.3f2a9c1e.js, as bundlers emit them.
+const defaultSPAHash = `[.-][0-9a-f]{8,}\.[0-9a-z]+$`
+
+// immutableCacheControl is for files whose name changes with their content.
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// spaRoute reports whether a request for the missing url is for a route of
+// the app rather than a file, with -spa or -spa-bundle: it has no extension
+// or, with -spa, asks for a page. Routes can have dots, as in /users/j.doe,
+// while a missing script or image of the app still gets a 404.
+func (args Args) spaRoute(r *http.Request, url string) bool {
+	if !args.spa && args.spaHash == nil {
+		return false
+	}
+	return path.Ext(url) == "" || args.spa && acceptQuality(r.Header.Get("Accept"), "text/html") > 0
+}
+
+// serveSPAIndex answers a client-side route with the app's index, which must
+// never be cached or users would keep asking for assets of an old build.
+func serveSPAIndex(w http.ResponseWriter, r *http.Request, name string) {
+	f, err := os.Open(name)
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, "404 page not found")
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		writeError(w, r, http.StatusNotFound, "404 page not found")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeContent(w, r, "index.html", info.ModTime(), f)
+}
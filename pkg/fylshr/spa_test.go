@@ -0,0 +1,103 @@
+package fylshr
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSPA(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"index.html":       "<p>app</p>",
+		"app.3f2a9c1e.js":  "js",
+		"about/index.html": "<p>about</p>",
+		"about/team.txt":   "team",
+		"docs/":            "",
+	})
+	const page = "Accept: text/html,application/xhtml+xml;q=0.9,*/*;q=0.8"
+
+	tests := []struct {
+		flag   string
+		path   string
+		accept string
+		status int
+		body   string
+	}{
+		{"-spa", "/users/42", "", http.StatusOK, "<p>app</p>"},
+		{"-spa", "/users/j.doe", page, http.StatusOK, "<p>app</p>"},
+		{"-spa", "/users/j.doe", "", http.StatusNotFound, ""},
+		{"-spa", "/missing.js", "Accept: */*", http.StatusNotFound, ""},
+		{"-spa", "/missing.png", "Accept: image/avif,image/webp", http.StatusNotFound, ""},
+		{"-spa", "/missing.png", "Accept: text/html;q=0", http.StatusNotFound, ""},
+		{"-spa", "/app.3f2a9c1e.js", "", http.StatusOK, "js"},
+		{"-spa", "/about/team.txt", page, http.StatusOK, "team"},
+		{"-spa", "/about/", page, http.StatusOK, "<p>about</p>"},
+		{"-spa", "/docs", page, http.StatusMovedPermanently, ""},
+		{"-spa-bundle", "/users/42", "", http.StatusOK, "<p>app</p>"},
+		{"-spa-bundle", "/users/j.doe", page, http.StatusNotFound, ""},
+		{"-spa=false", "/users/42", page, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, tt.flag)
+		var headers []string
+		if tt.accept != "" {
+			headers = append(headers, tt.accept)
+		}
+		resp, body := do(t, srv, http.MethodGet, tt.path, nil, headers...)
+		if resp.StatusCode != tt.status || tt.body != "" && body != tt.body {
+			t.Errorf("%s GET %s %s = %d %q, want %d %q", tt.flag, tt.path, tt.accept, resp.StatusCode, body, tt.status, tt.body)
+		}
+		if tt.body == "<p>app</p>" && resp.Header.Get("Cache-Control") != "no-cache" {
+			t.Errorf("%s GET %s Cache-Control %q, want no-cache", tt.flag, tt.path, resp.Header.Get("Cache-Control"))
+		}
+	}
+}
+
+// TestSPAWithoutIndex checks that routes are 404 rather than 500 when the app
+// has no index.html.
+func TestSPAWithoutIndex(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "index.html/": ""})
+	srv := newTestServer(t, dir, "-spa")
+	if resp, _ := do(t, srv, http.MethodGet, "/users/42", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /users/42 = %d, want 404", resp.StatusCode)
+	}
+}
+
+// TestSPABundleCache checks that -spa-bundle caches hashed assets for good and
+// revalidates the pages that link to them.
+func TestSPABundleCache(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"index.html":          "<p>app</p>",
+		"app.3f2a9c1e.js":     "js",
+		"vendor-0123abcd.css": "css",
+		"app-1234.css":        "css",
+		"logo.png":            "",
+		"about/index.html":    "<p>about</p>",
+	})
+
+	tests := []struct {
+		flags []string
+		path  string
+		want  string
+	}{
+		{[]string{"-spa-bundle"}, "/app.3f2a9c1e.js", immutableCacheControl},
+		{[]string{"-spa-bundle"}, "/vendor-0123abcd.css", immutableCacheControl},
+		{[]string{"-spa-bundle"}, "/app-1234.css", ""},
+		{[]string{"-spa-bundle"}, "/logo.png", ""},
+		{[]string{"-spa-bundle"}, "/", "no-cache"},
+		{[]string{"-spa-bundle"}, "/about/", "no-cache"},
+		{[]string{"-spa-bundle", "-cache-control", "max-age=60"}, "/logo.png", "max-age=60"},
+		{[]string{"-spa-bundle", "-spa-hash", `-[0-9]{4}\.css$`}, "/app-1234.css", immutableCacheControl},
+		{[]string{"-spa-bundle", "-spa-hash", `-[0-9]{4}\.css$`}, "/app.3f2a9c1e.js", ""},
+		{[]string{"-spa"}, "/app.3f2a9c1e.js", ""},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, tt.flags...)
+		resp, _ := do(t, srv, http.MethodGet, tt.path, nil)
+		if got := resp.Header.Get("Cache-Control"); resp.StatusCode >= 400 || got != tt.want {
+			t.Errorf("%v GET %s = %d Cache-Control %q, want %q", tt.flags, tt.path, resp.StatusCode, got, tt.want)
+		}
+	}
+}
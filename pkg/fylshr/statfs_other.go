@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package fylshr
+
+import "errors"
+
+func diskSpace(path string) (used, free uint64, err error) {
+	return 0, 0, errors.New("disk usage is not supported on this platform")
+}
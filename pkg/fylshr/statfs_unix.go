@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd
+
+package fylshr
+
+import "syscall"
+
+func diskSpace(path string) (used, free uint64, err error) {
+	var st syscall.Statfs_t
+	if err = syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+
+	bsize := uint64(st.Bsize)
+	return uint64(st.Blocks-st.Bfree) * bsize, uint64(st.Bavail) * bsize, nil
+}
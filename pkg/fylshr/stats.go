@@ -0,0 +1,62 @@
+package fylshr
+
+import (
+	"flag"
+	"net/http"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	statsPath  = "/.debug/stats"
+	configPath = "/.config"
+)
+
+var requestsServed atomic.Uint64
+
+// logSinkDropped counts the records -log-sink couldn't deliver.
+var logSinkDropped atomic.Uint64
+
+func serveStats(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, r, map[string]any{
+		"uptime":         time.Since(startTime).Round(time.Second).String(),
+		"goroutines":     runtime.NumGoroutine(),
+		"requests":       requestsServed.Load(),
+		"logSinkDropped": logSinkDropped.Load(),
+		"memory": map[string]uint64{
+			"alloc":      mem.Alloc,
+			"totalAlloc": mem.TotalAlloc,
+			"sys":        mem.Sys,
+			"heapInuse":  mem.HeapInuse,
+			"numGC":      uint64(mem.NumGC),
+		},
+		"config": effectiveConfig(),
+	})
+}
+
+var secretFlagWords = []string{"password", "token", "secret", "auth", "key"}
+
+// effectiveConfig returns the value of every flag, with the ones that may hold
+// credentials redacted.
+func effectiveConfig() map[string]string {
+	config := map[string]string{}
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		name := strings.ToLower(f.Name)
+		isSecret := slices.ContainsFunc(secretFlagWords, func(word string) bool {
+			return strings.Contains(name, word)
+		})
+		if value != "" && isSecret {
+			value = "[redacted]"
+		}
+		config[f.Name] = value
+	})
+	return config
+}
@@ -0,0 +1,151 @@
+package fylshr
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// useCommandLine parses flags into a fresh flag.CommandLine, the set
+// effectiveConfig reports, until the test ends.
+func useCommandLine(t *testing.T, flags ...string) {
+	t.Helper()
+	saved := flag.CommandLine
+	t.Cleanup(func() { flag.CommandLine = saved })
+	flag.CommandLine = flag.NewFlagSet("fylshr", flag.PanicOnError)
+	if _, err := parseArgs(flag.CommandLine, flags, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestStats checks that /.debug/stats is only served with -debug-endpoints,
+// behind the auth of the share, and never shows a secret flag.
+func TestStats(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+
+	tests := []struct {
+		flags  []string
+		target string
+		status int
+		secret string
+	}{
+		{nil, statsPath, http.StatusNotFound, ""},
+		{[]string{"-debug-endpoints"}, statsPath, http.StatusOK, ""},
+		{[]string{"-debug-endpoints", "-token", "s3cret"}, statsPath, http.StatusUnauthorized, ""},
+		{[]string{"-debug-endpoints", "-token", "s3cret"}, statsPath + "?token=s3cret", http.StatusOK, "token"},
+		{[]string{"-debug-endpoints", "-auth", "me:passw0rd"}, statsPath, http.StatusUnauthorized, ""},
+		{[]string{"-debug-endpoints", "-auth", "me:passw0rd"}, statsPath, http.StatusOK, "auth"},
+	}
+	for _, tt := range tests {
+		useCommandLine(t, append([]string{"-folder", dir}, tt.flags...)...)
+		srv := newTestServer(t, dir, tt.flags...)
+		var headers []string
+		if tt.secret == "auth" {
+			headers = append(headers, "Authorization: Basic bWU6cGFzc3cwcmQ=")
+		}
+		resp, body := do(t, srv, http.MethodGet, tt.target, nil, headers...)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%v GET %s = %d, want %d", tt.flags, tt.target, resp.StatusCode, tt.status)
+		}
+		if strings.Contains(body, "s3cret") || strings.Contains(body, "passw0rd") {
+			t.Errorf("%v GET %s shows a secret: %s", tt.flags, tt.target, body)
+		}
+		if resp.StatusCode != http.StatusOK || tt.flags == nil {
+			continue
+		}
+
+		if cc := resp.Header.Get("Cache-Control"); cc != "no-store" {
+			t.Errorf("%v GET %s Cache-Control %q, want no-store", tt.flags, tt.target, cc)
+		}
+		var stats map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(body), &stats); err != nil {
+			t.Fatalf("%v GET %s: %s in %s", tt.flags, tt.target, err, body)
+		}
+		for _, key := range []string{"uptime", "goroutines", "requests", "memory", "config"} {
+			if _, ok := stats[key]; !ok {
+				t.Errorf("%v GET %s has no %q in %s", tt.flags, tt.target, key, body)
+			}
+		}
+		var config map[string]string
+		json.Unmarshal(stats["config"], &config)
+		if config["folder"] != dir || config["debug-endpoints"] != "true" {
+			t.Errorf("%v GET %s config %v, want -folder %s and -debug-endpoints", tt.flags, tt.target, config, dir)
+		}
+		if tt.secret != "" && config[tt.secret] != "[redacted]" {
+			t.Errorf("%v GET %s config -%s %q, want it redacted", tt.flags, tt.target, tt.secret, config[tt.secret])
+		}
+	}
+}
+
+// TestStatsRequests checks that the request count of /.debug/stats grows with
+// every request served.
+func TestStatsRequests(t *testing.T) {
+	srv := newTestServer(t, t.TempDir(), "-debug-endpoints")
+	requests := func() uint64 {
+		var stats struct{ Requests uint64 }
+		_, body := do(t, srv, http.MethodGet, statsPath, nil)
+		if err := json.Unmarshal([]byte(body), &stats); err != nil {
+			t.Fatal(err)
+		}
+		return stats.Requests
+	}
+
+	before := requests()
+	do(t, srv, http.MethodGet, "/missing.txt", nil)
+	if after := requests(); after < before+2 {
+		t.Errorf("requests = %d after %d and 2 more requests", after, before)
+	}
+}
+
+// TestConfigEndpoint checks that /.config shows the flags the server was
+// started with, behind its auth, with secrets redacted and out of the log.
+func TestConfigEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{".config": "served file"})
+	flags := []string{"-config-endpoint", "-token", "s3cret", "-gzip-level", "9", "-dirs-first=false", "-silent=false"}
+	useCommandLine(t, append([]string{"-folder", dir}, flags...)...)
+	h := newHandler(testArgs(t, dir, flags...))
+
+	tests := []struct {
+		target string
+		status int
+	}{
+		{configPath, http.StatusUnauthorized},
+		{configPath + "?token=s3cret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		logged := capture(t, &os.Stdout, func() { h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil)) })
+		if w.Code != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.target, w.Code, tt.status)
+		}
+		if strings.Contains(w.Body.String(), "s3cret") || strings.Contains(w.Body.String(), "served file") {
+			t.Errorf("GET %s = %s, want the configuration without secrets", tt.target, w.Body)
+		}
+		if tt.status == http.StatusOK && logged != "" {
+			t.Errorf("GET %s logs %q", tt.target, logged)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, configPath+"?token=s3cret", nil))
+	var config map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &config); err != nil {
+		t.Fatalf("GET %s: %s in %s", configPath, err, w.Body)
+	}
+	want := map[string]string{"folder": dir, "gzip-level": "9", "dirs-first": "false", "token": "[redacted]", "auth": ""}
+	for name, value := range want {
+		if config[name] != value {
+			t.Errorf("GET %s -%s = %q, want %q", configPath, name, config[name], value)
+		}
+	}
+
+	if resp, body := do(t, newTestServer(t, dir, "-hide-dotfiles=false"), http.MethodGet, configPath, nil); body != "served file" {
+		t.Errorf("GET %s without -config-endpoint = %d %q, want the file", configPath, resp.StatusCode, body)
+	}
+}
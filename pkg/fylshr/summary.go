@@ -0,0 +1,160 @@
+package fylshr
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// topDownloads is how many files the shutdown summary lists.
+const topDownloads = 5
+
+// session counts what was served since startup, for the shutdown summary and
+// the -stats page.
+type session struct {
+	sync.Mutex
+	active    atomic.Int64
+	requests  uint64
+	bytes     int64
+	clients   map[string]*clientStats
+	downloads map[string]*fileStats
+	transfers map[*transfer]string
+	// history counts the bytes sent per minute over the last statsHistory
+	// minutes, indexed by the unix minute modulo statsHistory.
+	history [statsHistory]struct {
+		minute int64
+		bytes  int64
+	}
+}
+
+func newSession() *session {
+	return &session{clients: map[string]*clientStats{}, downloads: map[string]*fileStats{}, transfers: map[*transfer]string{}}
+}
+
+// withSession records every request h serves in s.
+func withSession(s *session, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.active.Add(1)
+		defer s.active.Add(-1)
+
+		sw := &statusWriter{ResponseWriter: w}
+		if isDownload(r) {
+			sw.transfer = s.start(r)
+		}
+		h.ServeHTTP(sw, r)
+		s.record(sw, r)
+	})
+}
+
+// isDownload reports whether r may download a file, rather than list a
+// folder or use one of the endpoints of the server.
+func isDownload(r *http.Request) bool {
+	return r.Method == http.MethodGet && !strings.HasSuffix(r.URL.Path, "/") && !slices.ContainsFunc(internalPaths, func(prefix string) bool {
+		return hasPathPrefix(r.URL.Path, prefix)
+	})
+}
+
+func (s *session) record(w *statusWriter, r *http.Request) {
+	now := time.Now()
+	ip := clientIP(r)
+
+	s.Lock()
+	defer s.Unlock()
+	s.requests++
+	s.bytes += w.bytes
+	client := s.clients[ip]
+	if client == nil {
+		client = &clientStats{}
+		s.clients[ip] = client
+	}
+	client.requests++
+	client.bytes += w.bytes
+	client.last = now
+
+	start := now
+	if w.transfer != nil {
+		delete(s.transfers, w.transfer)
+		start = w.transfer.start
+	}
+	s.credit(start, now, w.bytes)
+
+	status := cmp.Or(w.status, http.StatusOK)
+	if !isDownload(r) || status != http.StatusOK && status != http.StatusPartialContent {
+		return
+	}
+	file := s.downloads[r.URL.Path]
+	if file == nil {
+		if len(s.downloads) >= maxTrackedPaths {
+			return
+		}
+		file = &fileStats{clients: map[string]struct{}{}}
+		s.downloads[r.URL.Path] = file
+	}
+	file.bytes += w.bytes
+	file.last = now
+	// A video played with many range requests is one download.
+	if r.Header.Get("Range") == "" || strings.HasPrefix(r.Header.Get("Range"), "bytes=0-") {
+		file.count++
+		file.clients[ip] = struct{}{}
+		client.downloads++
+	}
+}
+
+type download struct {
+	Path  string `json:"path"`
+	Count int    `json:"count"`
+}
+
+type sessionSummary struct {
+	Duration  string     `json:"duration"`
+	Requests  uint64     `json:"requests"`
+	Bytes     int64      `json:"bytes"`
+	Clients   int        `json:"clients"`
+	Downloads []download `json:"topDownloads"`
+}
+
+func (s *session) summary() sessionSummary {
+	s.Lock()
+	defer s.Unlock()
+	summary := sessionSummary{
+		Duration:  time.Since(startTime).Round(time.Second).String(),
+		Requests:  s.requests,
+		Bytes:     s.bytes,
+		Clients:   len(s.clients),
+		Downloads: []download{},
+	}
+	for name, file := range s.downloads {
+		if file.count > 0 {
+			summary.Downloads = append(summary.Downloads, download{name, file.count})
+		}
+	}
+	slices.SortFunc(summary.Downloads, func(a, b download) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), strings.Compare(a.Path, b.Path))
+	})
+	if len(summary.Downloads) > topDownloads {
+		summary.Downloads = summary.Downloads[:topDownloads]
+	}
+	return summary
+}
+
+// printSummary prints what s served in the -banner format.
+func printSummary(args Args, s *session) {
+	summary := s.summary()
+	switch args.banner {
+	case "off":
+	case "json":
+		b, _ := json.Marshal(summary)
+		fmt.Println(string(b))
+	default:
+		colorPrintf(args.color, "\x1b[1mServed %d requests, %s to %d clients in %s\x1b[0m\n", summary.Requests, formatSize(uint64(summary.Bytes)), summary.Clients, summary.Duration)
+		for _, d := range summary.Downloads {
+			colorPrintf(args.color, "  %4d  \x1b[38;5;195m%s\x1b[0m\n", d.Count, d.Path)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package fylshr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+// TestSessionSummary checks that the summary counts requests, bytes and
+// clients, and only complete downloads among the top files.
+func TestSessionSummary(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "b.txt": "0123456789", "c.txt": "c", "sub/": ""})
+	s := newSession()
+	h := withSession(s, newHandler(testArgs(t, dir)))
+
+	requests := []struct {
+		path, remote, rng string
+	}{
+		{"/a.txt", "192.0.2.1:1", ""},
+		{"/a.txt", "192.0.2.2:1", ""},
+		{"/c.txt", "192.0.2.2:1", ""},
+		{"/b.txt", "192.0.2.1:1", "bytes=5-"},
+		{"/b.txt", "192.0.2.1:1", "bytes=0-4"},
+		{"/sub/", "192.0.2.3:1", ""},
+		{"/missing.txt", "192.0.2.3:1", ""},
+	}
+	for _, req := range requests {
+		r := httptest.NewRequest(http.MethodGet, req.path, nil)
+		r.RemoteAddr = req.remote
+		if req.rng != "" {
+			r.Header.Set("Range", req.rng)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	summary := s.summary()
+	if summary.Requests != 7 || summary.Clients != 3 || summary.Bytes < 5+5+1+5+5 {
+		t.Errorf("summary = %+v, want 7 requests from 3 clients", summary)
+	}
+	if want := []download{{"/a.txt", 2}, {"/b.txt", 1}, {"/c.txt", 1}}; !slices.Equal(summary.Downloads, want) {
+		t.Errorf("top downloads = %v, want %v", summary.Downloads, want)
+	}
+
+	tests := []struct {
+		banner string
+		want   *regexp.Regexp
+	}{
+		{"text", regexp.MustCompile(`^Served 7 requests, \S+ \S+ to 3 clients in \S+\n +2  /a\.txt\n +1  /b\.txt\n +1  /c\.txt\n$`)},
+		{"json", regexp.MustCompile(`^\{"duration":"[^"]+","requests":7,"bytes":\d+,"clients":3,"topDownloads":\[\{"path":"/a\.txt","count":2\},\{"path":"/b\.txt","count":1\},\{"path":"/c\.txt","count":1\}\]\}\n$`)},
+		{"off", regexp.MustCompile(`^$`)},
+	}
+	for _, tt := range tests {
+		args := testArgs(t, dir)
+		args.banner = tt.banner
+		if got := capture(t, &os.Stdout, func() { printSummary(args, s) }); !tt.want.MatchString(got) {
+			t.Errorf("-banner %s summary = %q, want %s", tt.banner, got, tt.want)
+		}
+	}
+}
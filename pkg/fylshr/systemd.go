@@ -0,0 +1,44 @@
+package fylshr
+
+import (
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd, SD_LISTEN_FDS_START.
+const listenFdsStart = 3
+
+// systemdListeners adopts the sockets passed by systemd socket activation as
+// described in sd_listen_fds(3). It returns nil when the process wasn't socket
+// activated.
+func systemdListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+
+	// Children must not think the sockets were meant for them.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, n)
+	for i := range n {
+		fd := listenFdsStart + i
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		listeners[i] = l
+	}
+
+	return listeners, nil
+}
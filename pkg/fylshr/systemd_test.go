@@ -0,0 +1,79 @@
+package fylshr
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSystemdFallback(t *testing.T) {
+	tests := []struct {
+		pid, fds string
+		flags    []string
+		err      bool
+	}{
+		{"", "", []string{"-port", "0"}, false},
+		{"", "", []string{"-port", "0", "-systemd"}, true},
+		{"1", "1", []string{"-port", "0"}, false},
+		{"1", "1", []string{"-port", "0", "-systemd"}, true},
+		{strconv.Itoa(os.Getpid()), "0", []string{"-port", "0", "-systemd"}, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("LISTEN_PID", tt.pid)
+		t.Setenv("LISTEN_FDS", tt.fds)
+		listeners, err := listen(testArgs(t, t.TempDir(), tt.flags...))
+		for _, l := range listeners {
+			l.Close()
+		}
+		if (err != nil) != tt.err || err == nil && len(listeners) == 0 {
+			t.Errorf("LISTEN_PID=%q LISTEN_FDS=%q %v listens on %d sockets, %v", tt.pid, tt.fds, tt.flags, len(listeners), err)
+		}
+	}
+}
+
+// TestSystemd checks that a socket passed like systemd does is adopted instead
+// of binding -port, in a child process since it must be fd 3.
+func TestSystemd(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSystemdHelper$")
+	cmd.Env = append(os.Environ(), "FYLSHR_SYSTEMD_HELPER=1", "LISTEN_FDS=1")
+	cmd.ExtraFiles = []*os.File{f}
+	out, err := cmd.CombinedOutput()
+	if want := "listening on " + l.Addr().String() + "\n"; err != nil || !strings.Contains(string(out), want) {
+		t.Errorf("socket activated child = %v %q, want %q", err, out, want)
+	}
+}
+
+// TestSystemdHelper is the socket activated process of TestSystemd.
+func TestSystemdHelper(t *testing.T) {
+	if os.Getenv("FYLSHR_SYSTEMD_HELPER") == "" {
+		t.Skip("run by TestSystemd")
+	}
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+
+	listeners, err := listen(testArgs(t, t.TempDir(), "-systemd", "-port", "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listeners) != 1 {
+		t.Fatalf("listens on %d sockets, want the one passed", len(listeners))
+	}
+	if os.Getenv("LISTEN_FDS") != "" || os.Getenv("LISTEN_PID") != "" {
+		t.Error("LISTEN_FDS and LISTEN_PID are left for children")
+	}
+	fmt.Printf("listening on %s\n", listeners[0].Addr())
+}
@@ -0,0 +1,346 @@
+package fylshr
+
+import (
+	"errors"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// themes are the values of -theme, auto following the preference of the
+// browser.
+var themes = []string{"dark", "light", "auto"}
+
+// lightRules recolor the dark style for well lit rooms and projectors.
+const lightRules = `
+  body {
+    background: #fafafa;
+    color: #123;
+  }
+
+  *, *::before, *::after {
+    scrollbar-color: #36b #0001;
+  }
+  *::-webkit-scrollbar-thumb {
+    background: #36b;
+  }
+  *::-webkit-scrollbar-track {
+    background: #0001;
+  }
+
+  a {
+    color: #24a;
+  }
+
+  a:visited {
+    color: #a42;
+  }
+
+  a:hover {
+    color: #07a;
+  }
+
+  .listing .time {
+    color: #567;
+  }
+
+  .upload button {
+    background: #24a;
+    color: #fff;
+  }
+
+  .upload progress {
+    accent-color: #24a;
+  }
+
+  .upload .error {
+    color: #a42;
+  }
+
+  .paste textarea {
+    background: #fff;
+    color: #123;
+  }
+
+  .markdown pre, .markdown code {
+    background: #0001;
+  }
+
+  body.dropping {
+    outline-color: #24a;
+  }
+`
+
+// look is how the pages of a server look: the style of -theme and -css, the
+// colors of highlighted source, and the templates, embedded or from
+// -template-dir.
+type look struct {
+	style   string
+	source  *chroma.Style
+	listing *template.Template
+	paste   *template.Template
+	pin     *template.Template
+	receive *template.Template
+	render  *template.Template
+}
+
+// newLook returns the embedded look, with the dark theme.
+func newLook() *look {
+	return &look{
+		style:   style,
+		source:  styles.Get("monokai"),
+		listing: listingTemplate,
+		paste:   pasteTemplate,
+		pin:     pinTemplate,
+		receive: receiveTemplate,
+		render:  renderTemplate,
+	}
+}
+
+// setTheme adds the rules of -theme to the style of the pages, followed by the
+// -css file so its rules win.
+func (l *look) setTheme(theme, cssFile string) error {
+	switch theme {
+	case "light":
+		l.style += "<style>" + lightRules + "</style>\n"
+		l.source = styles.Get("github")
+	case "auto":
+		l.style += "<style>\n@media (prefers-color-scheme: light) {" + lightRules + "}\n</style>\n"
+	}
+
+	if cssFile != "" {
+		css, err := os.ReadFile(cssFile)
+		if err != nil {
+			return err
+		}
+		l.style += "<style>\n" + string(css) + "\n</style>\n"
+	}
+	return nil
+}
+
+// loadTemplates replaces the templates with those of dir, which gets the same
+// data as the ones it replaces. Pages missing from dir keep theirs.
+func (l *look) loadTemplates(dir string) error {
+	if _, err := os.ReadDir(dir); err != nil {
+		return err
+	}
+
+	templates := map[string]**template.Template{
+		"listing.html": &l.listing,
+		"paste.html":   &l.paste,
+		"pin.html":     &l.pin,
+		"receive.html": &l.receive,
+		"render.html":  &l.render,
+	}
+	for name, t := range templates {
+		text, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		parsed, err := template.New(name).Parse(string(text))
+		if err != nil {
+			return err
+		}
+		*t = parsed
+	}
+	return nil
+}
+
+// style is the embedded look of every page, the dark theme, which -theme and
+// -css add their rules to.
+var style = `
+<style>
+  body {
+    background: #111;
+    color: #def;
+  }
+
+  *, *::before, *::after {
+    font: 20px JetBrainsMono, mono, Menlo-Regular;
+    box-sizing: border-box;
+
+    scrollbar-width: thin;
+    scrollbar-color: #aef #0003;
+  }
+  *::-webkit-scrollbar-thumb {
+    background: #aef;
+    border-radius: 20rem;
+  }
+  *::-webkit-scrollbar-track {
+    background: #0003;
+  }
+  *::-webkit-scrollbar {
+    width: 3rem;
+  }
+
+  h1 {
+    margin: 0.5rem;
+    font-size: 28px;
+    font-weight: bold;
+  }
+
+  pre {
+    margin: 0;
+    padding: 0.5rem;
+  }
+
+  a {
+    color: #abf;
+    font-weight: bold;
+  }
+
+  a:visited {
+    color: #fba;
+  }
+
+  a:hover {
+    color: #aef;
+  }
+
+  .listing {
+    border-collapse: collapse;
+    margin: 0.5rem;
+  }
+
+  .listing th {
+    text-align: left;
+  }
+
+  .listing td, .listing th {
+    padding: 0 1rem 0 0;
+    white-space: nowrap;
+  }
+
+  .listing .size {
+    text-align: right;
+  }
+
+  .listing .time {
+    color: #abc;
+  }
+
+  .listing .thumb {
+    display: block;
+    max-width: 4rem;
+    max-height: 4rem;
+  }
+
+  .actions, .search {
+    margin: 0.5rem;
+  }
+
+  .gallery {
+    display: grid;
+    grid-template-columns: repeat(auto-fill, minmax(10rem, 1fr));
+    gap: 0.5rem;
+    margin: 0.5rem;
+  }
+
+  .gallery img, .gallery video, .gallery audio {
+    width: 100%;
+  }
+
+  .gallery > a > img {
+    height: 10rem;
+    object-fit: cover;
+  }
+
+  .gallery figure {
+    margin: 0;
+  }
+
+  .gallery .lightbox {
+    display: none;
+    position: fixed;
+    inset: 0;
+    z-index: 1;
+    background: rgba(0, 0, 0, 0.9);
+    align-items: center;
+    justify-content: center;
+  }
+
+  .gallery .lightbox:target {
+    display: flex;
+  }
+
+  .gallery .lightbox img {
+    width: auto;
+    max-width: 100%;
+    max-height: 100%;
+  }
+
+  .upload {
+    padding: 0.5rem;
+    border-top: 1px solid #0003;
+  }
+
+  .upload button {
+    background: #abf;
+    color: #111;
+    border: 0;
+    border-radius: 0.25rem;
+    padding: 0 0.5rem;
+  }
+
+  .manage {
+    white-space: nowrap;
+  }
+
+  .manage button, .actions button {
+    background: none;
+    color: inherit;
+    border: 1px solid #0003;
+    border-radius: 0.25rem;
+    padding: 0 0.25rem;
+    cursor: pointer;
+  }
+
+  .upload .progress {
+    list-style: none;
+    margin: 0;
+    padding: 0;
+  }
+
+  .upload progress {
+    width: 10rem;
+    accent-color: #abf;
+  }
+
+  .upload .error {
+    color: #fba;
+  }
+
+  .paste textarea {
+    width: 100%;
+    background: #0003;
+    color: #def;
+  }
+
+  .markdown {
+    max-width: 50rem;
+    margin: 0.5rem;
+  }
+
+  .markdown pre, .markdown code {
+    background: #0003;
+  }
+
+  .source {
+    display: block;
+    margin: 0.5rem;
+    overflow-x: auto;
+  }
+
+  body.dropping {
+    outline: 0.25rem dashed #abf;
+    outline-offset: -0.25rem;
+  }
+</style>
+`
@@ -0,0 +1,103 @@
+package fylshr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// TestTheme checks that -theme and -css add their rules to every page, in
+// that order after the dark style.
+func TestTheme(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"doc.md": "# Title", "main.go": "package main", "custom.css": "h1 { color: red; }"})
+	css := filepath.Join(dir, "custom.css")
+
+	tests := []struct {
+		theme, css string
+		want       []string
+		source     string
+	}{
+		{"dark", "", nil, "monokai"},
+		{"light", "", []string{"<style>\n  body {\n    background: #fafafa;"}, "github"},
+		{"auto", "", []string{"@media (prefers-color-scheme: light) {\n  body {\n    background: #fafafa;"}, "monokai"},
+		{"light", css, []string{"background: #fafafa;", "h1 { color: red; }"}, "github"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.theme+tt.css, func(t *testing.T) {
+			flags := []string{"-theme", tt.theme, "-css", tt.css}
+			if source := testArgs(t, dir, flags...).look.source; source != styles.Get(tt.source) {
+				t.Errorf("-theme %s highlights source with %s, want %s", tt.theme, source.Name, tt.source)
+			}
+			pages := []struct {
+				srv  *httptest.Server
+				path string
+			}{
+				{newTestServer(t, dir, flags...), "/"},
+				{newTestServer(t, dir, flags...), "/doc.md?render"},
+				{newTestServer(t, dir, append(flags, "-maintenance")...), "/"},
+			}
+			for _, page := range pages {
+				_, body := do(t, page.srv, http.MethodGet, page.path, nil)
+				rest, ok := body, strings.Contains(body, "background: #111;")
+				for _, want := range tt.want {
+					var found bool
+					if _, rest, found = strings.Cut(rest, want); !found {
+						ok = false
+					}
+				}
+				if !ok || tt.theme == "dark" && strings.Contains(body, "#fafafa") {
+					t.Errorf("-theme %s -css %q GET %s doesn't have %q after the dark style", tt.theme, tt.css, page.path, tt.want)
+				}
+			}
+		})
+	}
+
+	// The light theme of the other servers isn't theirs.
+	if _, body := do(t, newTestServer(t, dir), http.MethodGet, "/", nil); strings.Contains(body, "#fafafa") {
+		t.Errorf("a server without -theme has the light style of another one")
+	}
+	if err := newLook().setTheme("light", filepath.Join(dir, "missing.css")); err == nil {
+		t.Errorf("-css of a missing file is accepted")
+	}
+	if out, err := mainCommand("-folder", dir, "-theme", "blue", "-dry-run").CombinedOutput(); err == nil || !strings.Contains(string(out), `invalid -theme "blue"`) {
+		t.Errorf("-theme blue = %v %q, want it refused", err, out)
+	}
+}
+
+// TestTemplateDir checks that -template-dir replaces the pages it has, keeps
+// the embedded ones of the others and refuses templates that don't parse.
+func TestTemplateDir(t *testing.T) {
+	dir, templates := t.TempDir(), t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello", "doc.md": "# Title"})
+	writeFiles(t, templates, map[string]string{"listing.html": "<p>custom listing of {{.Path}}</p>"})
+	if args := testArgs(t, dir, "-template-dir", templates); args.look.render != renderTemplate {
+		t.Errorf("-template-dir without render.html replaced its template")
+	}
+
+	custom, embedded := newTestServer(t, dir, "-template-dir", templates), newTestServer(t, dir)
+	tests := []struct {
+		srv        *httptest.Server
+		path, want string
+	}{
+		{custom, "/", "<p>custom listing of /</p>"},
+		{custom, "/doc.md?render", "<h1>Title</h1>"},
+		{embedded, "/", `href="a.txt"`},
+	}
+	for _, tt := range tests {
+		if _, body := do(t, tt.srv, http.MethodGet, tt.path, nil); !strings.Contains(body, tt.want) {
+			t.Errorf("-template-dir GET %s = %q, want %q", tt.path, body, tt.want)
+		}
+	}
+
+	writeFiles(t, templates, map[string]string{"pin.html": "{{.Missing"})
+	for _, dir := range []string{templates, filepath.Join(templates, "missing")} {
+		if err := newLook().loadTemplates(dir); err == nil {
+			t.Errorf("loadTemplates(%s) accepts it", dir)
+		}
+	}
+}
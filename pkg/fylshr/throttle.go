@@ -0,0 +1,128 @@
+package fylshr
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// throttleChunk is the most written between two waits, small enough that a
+// throttled download moves smoothly.
+const throttleChunk = 16 << 10
+
+// throttleBurst is how far ahead of the rate a client can get after a pause.
+const throttleBurst = 200 * time.Millisecond
+
+// rateLimiter spreads writes over time so they average rate bytes per second.
+// Up to throttleBurst worth can go out at once after a pause.
+type rateLimiter struct {
+	sync.Mutex
+	rate int64
+	next time.Time
+}
+
+// wait blocks until n more bytes fit in the rate.
+func (l *rateLimiter) wait(n int) {
+	l.Lock()
+	now := time.Now()
+	if l.next.Before(now.Add(-throttleBurst)) {
+		l.next = now.Add(-throttleBurst)
+	}
+	l.next = l.next.Add(time.Duration(n) * time.Second / time.Duration(l.rate))
+	delay := l.next.Sub(now)
+	l.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// throttle holds the -limit-total limiter and one -limit-rate limiter per
+// client, shared by its concurrent requests and dropped after the last one.
+type throttle struct {
+	sync.Mutex
+	perClient int64
+	total     *rateLimiter
+	clients   map[string]*clientLimiter
+}
+
+type clientLimiter struct {
+	rateLimiter
+	requests int
+}
+
+// withThrottle limits what h writes to perClient bytes per second for each
+// client IP and total for everyone, 0 meaning no limit. It goes outside
+// withTimeout so it isn't counted against -request-timeout.
+func withThrottle(perClient, total int64, h http.Handler) http.Handler {
+	if perClient <= 0 && total <= 0 {
+		return h
+	}
+
+	t := &throttle{perClient: perClient, clients: map[string]*clientLimiter{}}
+	if total > 0 {
+		t.total = &rateLimiter{rate: total}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var limiters []*rateLimiter
+		if t.total != nil {
+			limiters = append(limiters, t.total)
+		}
+		if t.perClient > 0 {
+			ip := clientIP(r)
+			limiters = append(limiters, t.acquire(ip))
+			defer t.release(ip)
+		}
+		h.ServeHTTP(&throttledWriter{ResponseWriter: w, limiters: limiters}, r)
+	})
+}
+
+func (t *throttle) acquire(ip string) *rateLimiter {
+	t.Lock()
+	defer t.Unlock()
+	c := t.clients[ip]
+	if c == nil {
+		c = &clientLimiter{rateLimiter: rateLimiter{rate: t.perClient}}
+		t.clients[ip] = c
+	}
+	c.requests++
+	return &c.rateLimiter
+}
+
+func (t *throttle) release(ip string) {
+	t.Lock()
+	defer t.Unlock()
+	c := t.clients[ip]
+	c.requests--
+	if c.requests == 0 {
+		delete(t.clients, ip)
+	}
+}
+
+// throttledWriter writes in chunks, waiting for every limiter before each.
+// It has no ReadFrom, so io.Copy goes through Write instead of sendfile.
+type throttledWriter struct {
+	http.ResponseWriter
+	limiters []*rateLimiter
+}
+
+func (w *throttledWriter) Write(b []byte) (int, error) {
+	var written int
+	for len(b) > 0 {
+		chunk := b[:min(len(b), throttleChunk)]
+		for _, l := range w.limiters {
+			l.wait(len(chunk))
+		}
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+func (w *throttledWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,67 @@
+package fylshr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestThrottle checks that downloads take at least as long as -limit-rate
+// and -limit-total allow, a client's requests sharing its rate, and still
+// arrive whole.
+func TestThrottle(t *testing.T) {
+	content := strings.Repeat("x", 200<<10)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"big.bin": content})
+
+	// At 400KB/s, 200KB takes 0.3s after the 80KB burst, and twice that 0.8s.
+	tests := []struct {
+		name    string
+		flags   []string
+		remotes []string
+		min     time.Duration
+	}{
+		{"unlimited", nil, []string{"192.0.2.1:1"}, 0},
+		{"per client", []string{"-limit-rate", "400KB"}, []string{"192.0.2.1:1"}, 200 * time.Millisecond},
+		{"same client", []string{"-limit-rate", "400KB"}, []string{"192.0.2.1:1", "192.0.2.1:2"}, 600 * time.Millisecond},
+		{"total", []string{"-limit-total", "400KB"}, []string{"192.0.2.1:1", "192.0.2.2:1"}, 600 * time.Millisecond},
+		{"both", []string{"-limit-rate", "400KB", "-limit-total", "400KB"}, []string{"192.0.2.1:1"}, 200 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHandler(testArgs(t, dir, tt.flags...))
+			start := time.Now()
+			var wg sync.WaitGroup
+			for _, remote := range tt.remotes {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					r := httptest.NewRequest(http.MethodGet, "/big.bin", nil)
+					r.RemoteAddr = remote
+					w := httptest.NewRecorder()
+					h.ServeHTTP(w, r)
+					if w.Code != http.StatusOK || w.Body.String() != content {
+						t.Errorf("GET /big.bin from %s = %d with %d bytes, want the file", remote, w.Code, w.Body.Len())
+					}
+				}()
+			}
+			wg.Wait()
+			if elapsed := time.Since(start); elapsed < tt.min {
+				t.Errorf("%v took %s for %d downloads, want at least %s", tt.flags, elapsed, len(tt.remotes), tt.min)
+			}
+		})
+	}
+}
+
+func TestThrottleRange(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"big.bin": strings.Repeat("0123456789", 10<<10)})
+	srv := newTestServer(t, dir, "-limit-rate", "1MB")
+	resp, body := do(t, srv, http.MethodGet, "/big.bin", nil, "Range: bytes=100-109")
+	if resp.StatusCode != http.StatusPartialContent || body != "0123456789" {
+		t.Errorf("GET /big.bin Range bytes=100-109 = %d %q, want 206 0123456789", resp.StatusCode, body)
+	}
+}
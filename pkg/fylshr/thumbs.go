@@ -0,0 +1,185 @@
+package fylshr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	thumbPath = "/_thumb"
+	// thumbSize is the longest side of a thumbnail in pixels.
+	thumbSize = 160
+	// maxThumbs is how many thumbnails are kept in memory, around 10 KB each.
+	maxThumbs = 1024
+	// maxThumbPixels keeps huge images from taking gigabytes to decode.
+	maxThumbPixels = 100_000_000
+)
+
+var (
+	thumbImages = []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
+	thumbVideos = []string{".mp4", ".m4v", ".webm", ".mov", ".mkv"}
+)
+
+// ffmpeg is the path of ffmpeg, or "" when videos get no thumbnails.
+var ffmpeg = sync.OnceValue(func() string {
+	p, _ := exec.LookPath("ffmpeg")
+	return p
+})
+
+// thumbCache keeps the thumbnails a server made, at most maxThumbs.
+type thumbCache struct {
+	sync.Mutex
+	thumbs map[thumbKey][]byte
+}
+
+type thumbKey struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// forget drops the thumbnails of the file name and of those under it.
+func (c *thumbCache) forget(name string) {
+	c.Lock()
+	defer c.Unlock()
+	maps.DeleteFunc(c.thumbs, func(key thumbKey, _ []byte) bool { return under(key.name, name, '/') })
+}
+
+// hasThumb reports whether /_thumb can make a thumbnail of the file name.
+func hasThumb(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return slices.Contains(thumbImages, ext) || slices.Contains(thumbVideos, ext) && ffmpeg() != ""
+}
+
+// thumbsURL returns the escaped URL of the directory dir under /_thumb.
+func thumbsURL(basePath, dir string) string {
+	return (&url.URL{Path: path.Join(basePath, thumbPath, dir) + "/"}).EscapedPath()
+}
+
+// serveThumb answers a JPEG thumbnail of the file name of fsys, kept in
+// cache. Videos go through ffmpeg, which needs the file's localPath. No more
+// thumbnails than slots can hold are made at once.
+func serveThumb(w http.ResponseWriter, r *http.Request, fsys http.FileSystem, localPath func(string) string, cache *thumbCache, slots chan struct{}, name string) {
+	if !hasThumb(name) {
+		writeError(w, r, http.StatusNotFound, "404 no thumbnail for this file")
+		return
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		writeListingError(w, r, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		writeError(w, r, http.StatusNotFound, "404 page not found")
+		return
+	}
+
+	key := thumbKey{name, info.Size(), info.ModTime()}
+	cache.Lock()
+	thumb, ok := cache.thumbs[key]
+	cache.Unlock()
+
+	if !ok {
+		slots <- struct{}{}
+		if slices.Contains(thumbVideos, strings.ToLower(path.Ext(name))) {
+			thumb, err = videoThumb(r.Context(), localPath(name))
+		} else {
+			thumb, err = imageThumb(f)
+		}
+		<-slots
+		if err != nil {
+			writeError(w, r, http.StatusUnprocessableEntity, "422 "+err.Error())
+			return
+		}
+
+		cache.Lock()
+		if len(cache.thumbs) >= maxThumbs {
+			clear(cache.thumbs)
+		}
+		cache.thumbs[key] = thumb
+		cache.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "max-age=86400")
+	http.ServeContent(w, r, "", info.ModTime(), bytes.NewReader(thumb))
+}
+
+func imageThumb(f http.File) ([]byte, error) {
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxThumbPixels {
+		return nil, errors.New("image too large")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > thumbSize || height > thumbSize {
+		if width > height {
+			width, height = thumbSize, max(1, height*thumbSize/width)
+		} else {
+			width, height = max(1, width*thumbSize/height), thumbSize
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+	var b bytes.Buffer
+	err = jpeg.Encode(&b, dst, &jpeg.Options{Quality: 80})
+	return b.Bytes(), err
+}
+
+// videoThumb grabs the frame at one second, or the first one for shorter
+// videos.
+func videoThumb(ctx context.Context, file string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	for _, at := range []string{"1", "0"} {
+		out, err := exec.CommandContext(ctx, ffmpeg(),
+			"-loglevel", "error", "-ss", at, "-i", file, "-frames:v", "1",
+			"-vf", fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", thumbSize, thumbSize),
+			"-f", "image2pipe", "-c:v", "mjpeg", "-",
+		).Output()
+		if err != nil {
+			return nil, err
+		}
+		if len(out) > 0 {
+			return out, nil
+		}
+	}
+	return nil, errors.New("no video frame")
+}
@@ -0,0 +1,175 @@
+package fylshr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pngImage returns a PNG of width by height pixels.
+func pngImage(t *testing.T, width, height int) string {
+	t.Helper()
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestThumbnails(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"wide.png":         pngImage(t, 640, 320),
+		"tall.png":         pngImage(t, 100, 400),
+		"small.png":        pngImage(t, 50, 40),
+		"broken.png":       "not a png",
+		"a.txt":            "hello",
+		".hidden.png":      pngImage(t, 50, 40),
+		"sec/" + tokenFile: "s3cret",
+		"sec/photo.png":    pngImage(t, 50, 40),
+	})
+
+	tests := []struct {
+		flags         []string
+		path          string
+		status        int
+		width, height int
+	}{
+		{[]string{"-thumbnails"}, "/_thumb/wide.png", http.StatusOK, 160, 80},
+		{[]string{"-thumbnails"}, "/_thumb/tall.png", http.StatusOK, 40, 160},
+		{[]string{"-thumbnails"}, "/_thumb/small.png", http.StatusOK, 50, 40},
+		{[]string{"-thumbnails"}, "/_thumb/broken.png", http.StatusUnprocessableEntity, 0, 0},
+		{[]string{"-thumbnails"}, "/_thumb/a.txt", http.StatusNotFound, 0, 0},
+		{[]string{"-thumbnails"}, "/_thumb/missing.png", http.StatusNotFound, 0, 0},
+		{[]string{"-thumbnails"}, "/_thumb/.hidden.png", http.StatusNotFound, 0, 0},
+		{[]string{"-thumbnails"}, "/_thumb/sec/photo.png", http.StatusForbidden, 0, 0},
+		{[]string{"-thumbnails"}, "/_thumb/sec/photo.png?token=s3cret", http.StatusOK, 50, 40},
+		{[]string{"-thumbnails=false"}, "/_thumb/wide.png", http.StatusNotFound, 0, 0},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, tt.flags...)
+		resp, body := do(t, srv, http.MethodGet, tt.path, nil)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%v GET %s = %d, want %d", tt.flags, tt.path, resp.StatusCode, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		config, err := jpeg.DecodeConfig(strings.NewReader(body))
+		if err != nil || config.Width != tt.width || config.Height != tt.height || resp.Header.Get("Content-Type") != "image/jpeg" {
+			t.Errorf("%v GET %s = %s %dx%d, %v, want a %dx%d JPEG", tt.flags, tt.path, resp.Header.Get("Content-Type"), config.Width, config.Height, err, tt.width, tt.height)
+		}
+	}
+}
+
+// blockingFS serves files whose reads wait for release, counting how many
+// are being read at once.
+type blockingFS struct {
+	release chan struct{}
+	mu      sync.Mutex
+	reading int
+	most    int
+}
+
+func (fsys *blockingFS) Open(name string) (http.File, error) {
+	return &blockingFile{fsys: fsys, name: name}, nil
+}
+
+func (fsys *blockingFS) readers() int {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	return fsys.reading
+}
+
+type blockingFile struct {
+	fsys    *blockingFS
+	name    string
+	reading bool
+}
+
+func (f *blockingFile) Read([]byte) (int, error) {
+	if !f.reading {
+		f.reading = true
+		f.fsys.mu.Lock()
+		f.fsys.reading++
+		f.fsys.most = max(f.fsys.most, f.fsys.reading)
+		f.fsys.mu.Unlock()
+	}
+	<-f.fsys.release
+	return 0, io.EOF
+}
+
+func (f *blockingFile) Close() error {
+	if f.reading {
+		f.fsys.mu.Lock()
+		f.fsys.reading--
+		f.fsys.mu.Unlock()
+	}
+	return nil
+}
+
+func (f *blockingFile) Seek(int64, int) (int64, error)     { return 0, nil }
+func (f *blockingFile) Readdir(int) ([]fs.FileInfo, error) { return nil, errors.New("not a directory") }
+func (f *blockingFile) Stat() (fs.FileInfo, error)         { return f, nil }
+func (f *blockingFile) Name() string                       { return path.Base(f.name) }
+func (f *blockingFile) Size() int64                        { return 1 }
+func (f *blockingFile) Mode() fs.FileMode                  { return 0o644 }
+func (f *blockingFile) ModTime() time.Time                 { return time.Time{} }
+func (f *blockingFile) IsDir() bool                        { return false }
+func (f *blockingFile) Sys() any                           { return nil }
+
+// TestThumbConcurrency checks that no more than -thumb-concurrency thumbnails
+// are made at once, the next one waiting for a free slot.
+func TestThumbConcurrency(t *testing.T) {
+	for _, n := range []int{1, 3} {
+		args := testArgs(t, t.TempDir(), "-thumb-concurrency", strconv.Itoa(n))
+		if cap(args.thumbSlots) != n {
+			t.Fatalf("-thumb-concurrency %d has %d slots", n, cap(args.thumbSlots))
+		}
+		fsys := &blockingFS{release: make(chan struct{})}
+
+		var wg sync.WaitGroup
+		for i := range n + 1 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				name := fmt.Sprintf("/blocked-%d-%d.png", n, i)
+				serveThumb(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, thumbPath+name, nil), fsys, args.localPath, args.thumbCache, args.thumbSlots, name)
+			}()
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for fsys.readers() < n && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		// Give the last request the time to start if nothing held it back.
+		time.Sleep(50 * time.Millisecond)
+		if got := fsys.readers(); got != n {
+			t.Errorf("-thumb-concurrency %d with %d requests makes %d thumbnails at once", n, n+1, got)
+		}
+
+		close(fsys.release)
+		wg.Wait()
+		if fsys.most != n {
+			t.Errorf("-thumb-concurrency %d made up to %d thumbnails at once", n, fsys.most)
+		}
+	}
+
+	if out, err := mainCommand("-folder", t.TempDir(), "-thumb-concurrency", "0", "-dry-run").CombinedOutput(); err == nil || !strings.Contains(string(out), "invalid -thumb-concurrency") {
+		t.Errorf("-thumb-concurrency 0 = %v %q, want an error", err, out)
+	}
+}
@@ -0,0 +1,27 @@
+package fylshr
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// withTimeout answers 503 when h takes longer than timeout. http.TimeoutHandler
+// buffers the whole response in memory, so downloads of the files isFile
+// reports, range, ?follow, ?tail and ?zip requests and uploads, which can be
+// large or long-lived, bypass it.
+func withTimeout(timeout time.Duration, isFile func(name string) bool, h http.Handler) http.Handler {
+	if timeout <= 0 {
+		return h
+	}
+
+	limited := http.TimeoutHandler(h, timeout, "Request timed out\n")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" || isFile(r.URL.Path) || r.URL.Query().Has("follow") || r.URL.Query().Has("tail") || archiveFormat(r) != "" || strings.HasSuffix(r.URL.Path, eventsPath) || r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		limited.ServeHTTP(w, r)
+	})
+}
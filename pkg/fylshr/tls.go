@@ -0,0 +1,131 @@
+package fylshr
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// http2Ciphers are the suites HTTP/2 requires one of below TLS 1.3.
+var http2Ciphers = []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}
+
+// parseCipherSuites parses the comma separated names of -tls-ciphers, which
+// must be among Go's secure suites and include one HTTP/2 can use unless
+// minTLS is 1.3, whose suites can't be picked. It returns nil, Go's default,
+// for an empty list.
+func parseCipherSuites(list string, minTLS uint16) ([]uint16, error) {
+	var suites []uint16
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		i := slices.IndexFunc(tls.CipherSuites(), func(s *tls.CipherSuite) bool { return s.Name == name })
+		if i < 0 {
+			if slices.ContainsFunc(tls.InsecureCipherSuites(), func(s *tls.CipherSuite) bool { return s.Name == name }) {
+				return nil, fmt.Errorf("%s is insecure", name)
+			}
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		suites = append(suites, tls.CipherSuites()[i].ID)
+	}
+
+	if suites != nil && minTLS < tls.VersionTLS13 && !slices.ContainsFunc(suites, func(id uint16) bool { return slices.Contains(http2Ciphers, id) }) {
+		return nil, fmt.Errorf("HTTP/2 needs %s or %s", tls.CipherSuiteName(http2Ciphers[0]), tls.CipherSuiteName(http2Ciphers[1]))
+	}
+	return suites, nil
+}
+
+// newTLSConfig loads -cert and -key, gets certificates from Let's Encrypt with
+// -acme, or makes a self-signed certificate for this machine otherwise.
+func newTLSConfig(args Args) (*tls.Config, error) {
+	suites, err := parseCipherSuites(args.tlsCiphers, args.minTLS)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.acme != nil {
+		config := args.acme.TLSConfig()
+		config.MinVersion = args.minTLS
+		config.CipherSuites = suites
+		return config, nil
+	}
+
+	var cert tls.Certificate
+	if args.certFile != "" {
+		cert, err = tls.LoadX509KeyPair(args.certFile, args.keyFile)
+	} else {
+		cert, err = selfSignedCert(bannerAddrs(args, true, true))
+		if err == nil {
+			log.Printf("using a self-signed certificate, SHA-256 fingerprint %X", sha256.Sum256(cert.Certificate[0]))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   args.minTLS,
+		CipherSuites: suites,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}, nil
+}
+
+// selfSignedCert makes a certificate valid for localhost and the LAN addresses
+// printed in the banner. It only lives in memory, so every run gets a new one.
+func selfSignedCert(addrs []netip.Addr) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"fylshr"}, CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	for _, ip := range addrs {
+		template.IPAddresses = append(template.IPAddresses, net.IP(ip.WithZone("").AsSlice()))
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("self-signed certificate: %w", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,194 @@
+package fylshr
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSelfSignedCert(t *testing.T) {
+	lan := netip.MustParseAddr("192.168.1.5")
+	cert, err := selfSignedCert([]netip.Addr{lan, netip.MustParseAddr("fe80::1%eth0")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"localhost", "127.0.0.1", "::1", "192.168.1.5", "fe80::1"} {
+		if err := leaf.VerifyHostname(host); err != nil {
+			t.Errorf("self-signed certificate isn't valid for %s: %v", host, err)
+		}
+	}
+	if err := leaf.VerifyHostname("example.com"); err == nil {
+		t.Error("self-signed certificate is valid for example.com")
+	}
+}
+
+// writeCert writes a self-signed certificate and its key as PEM files for
+// -cert and -key.
+func writeCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	cert, err := selfSignedCert(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// TestTLS checks that -tls serves HTTPS with the -cert and -key given or a
+// generated certificate, refusing clients older than -min-tls.
+func TestTLS(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+	certFile, keyFile := writeCert(t, t.TempDir())
+	given, _ := os.ReadFile(certFile)
+
+	tests := []struct {
+		flags      []string
+		maxVersion uint16
+		minVersion uint16
+		ok         bool
+	}{
+		{[]string{"-tls"}, 0, tls.VersionTLS12, true},
+		{[]string{"-cert", certFile, "-key", keyFile}, 0, tls.VersionTLS12, true},
+		{[]string{"-tls"}, tls.VersionTLS11, tls.VersionTLS12, false},
+		{[]string{"-tls", "-min-tls", "1.3"}, tls.VersionTLS12, tls.VersionTLS13, false},
+		{[]string{"-tls", "-min-tls", "1.3"}, tls.VersionTLS13, tls.VersionTLS13, true},
+		{[]string{"-tls", "-min-tls", "1.0"}, 0, tls.VersionTLS10, true},
+	}
+	for _, tt := range tests {
+		args := testArgs(t, dir, tt.flags...)
+		config, err := newTLSConfig(args)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.flags, err)
+		}
+		if config.MinVersion != tt.minVersion {
+			t.Errorf("%v MinVersion = %x, want %x", tt.flags, config.MinVersion, tt.minVersion)
+		}
+
+		srv := httptest.NewUnstartedServer(newHandler(args))
+		srv.TLS = config
+		srv.StartTLS()
+		defer srv.Close()
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, MaxVersion: tt.maxVersion}}}
+		resp, err := client.Get(srv.URL + "/a.txt")
+		if (err == nil) != tt.ok {
+			t.Errorf("%v GET /a.txt with TLS up to %x: %v, want ok %v", tt.flags, tt.maxVersion, err, tt.ok)
+		}
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		peer := resp.TLS.PeerCertificates[0].Raw
+		if isGiven := slices.Equal(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: peer}), given); isGiven != slices.Contains(tt.flags, "-cert") {
+			t.Errorf("%v serves the -cert certificate %v", tt.flags, isGiven)
+		}
+	}
+}
+
+func TestMinTLSFlag(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"1.2", true},
+		{"1.3", true},
+		{"1.4", false},
+		{"tls1.2", false},
+	}
+	for _, tt := range tests {
+		out, err := mainCommand("-folder", t.TempDir(), "-tls", "-min-tls", tt.value, "-dry-run").CombinedOutput()
+		if (err == nil) != tt.ok {
+			t.Errorf("-min-tls %s = %v %q, want ok %v", tt.value, err, out, tt.ok)
+		}
+	}
+}
+
+// TestTLSCiphers checks that -tls-ciphers limits the suites a TLS 1.2
+// handshake can agree on.
+func TestTLSCiphers(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "hello"})
+
+	tests := []struct {
+		ciphers string
+		client  uint16
+		ok      bool
+	}{
+		{"", tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256, true},
+		{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, true},
+		{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256, false},
+		{" TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384", tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, true},
+	}
+	for _, tt := range tests {
+		args := testArgs(t, dir, "-tls", "-tls-ciphers", tt.ciphers)
+		config, err := newTLSConfig(args)
+		if err != nil {
+			t.Fatalf("-tls-ciphers %q: %v", tt.ciphers, err)
+		}
+		srv := httptest.NewUnstartedServer(newHandler(args))
+		srv.TLS = config
+		srv.StartTLS()
+		defer srv.Close()
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tt.client}}}}
+		resp, err := client.Get(srv.URL + "/a.txt")
+		if (err == nil) != tt.ok {
+			t.Errorf("-tls-ciphers %q handshake with %s: %v, want ok %v", tt.ciphers, tls.CipherSuiteName(tt.client), err, tt.ok)
+		}
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.TLS.CipherSuite != tt.client {
+			t.Errorf("-tls-ciphers %q agreed on %s, want %s", tt.ciphers, tls.CipherSuiteName(resp.TLS.CipherSuite), tls.CipherSuiteName(tt.client))
+		}
+	}
+}
+
+func TestTLSCiphersFlag(t *testing.T) {
+	tests := []struct {
+		flags []string
+		err   string
+	}{
+		{[]string{"-tls-ciphers", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"}, ""},
+		{[]string{"-tls-ciphers", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", "-min-tls", "1.3"}, ""},
+		{[]string{"-tls-ciphers", "TLS_RSA_WITH_RC4_128_SHA"}, "TLS_RSA_WITH_RC4_128_SHA is insecure"},
+		{[]string{"-tls-ciphers", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_RSA_WITH_AES_128_CBC_SHA256"}, "TLS_RSA_WITH_AES_128_CBC_SHA256 is insecure"},
+		{[]string{"-tls-ciphers", "AES128"}, `unknown cipher suite "AES128"`},
+		{[]string{"-tls-ciphers", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"}, "HTTP/2 needs"},
+	}
+	for _, tt := range tests {
+		out, err := mainCommand(append([]string{"-folder", t.TempDir(), "-tls", "-dry-run"}, tt.flags...)...).CombinedOutput()
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(string(out), "-tls-ciphers: "+tt.err)) {
+			t.Errorf("%v = %v %q, want error %q", tt.flags, err, out, tt.err)
+		}
+	}
+}
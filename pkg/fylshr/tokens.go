@@ -0,0 +1,72 @@
+package fylshr
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// tokenFile holds the tokens, one per line, that grant access to the directory
+// it's in and everything below it.
+const tokenFile = ".fylshr-token"
+
+// checkDirToken reports whether r may access name, given the nearest token
+// file in name's directory or above it. Paths with no token file are public.
+func checkDirToken(r *http.Request, folder, name string) bool {
+	tokens, ok := nearestTokens(folder, name)
+	if !ok {
+		return true
+	}
+
+	given := r.URL.Query().Get("token")
+	if given == "" {
+		given = r.Header.Get("X-Token")
+	}
+
+	for _, token := range tokens {
+		if given != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func nearestTokens(folder, name string) ([]string, bool) {
+	dir := path.Clean("/" + name)
+	if !strings.HasSuffix(name, "/") {
+		dir = path.Dir(dir)
+	}
+
+	for {
+		tokens, err := readTokens(filepath.Join(folder, filepath.FromSlash(dir), tokenFile))
+		if err == nil {
+			return tokens, true
+		}
+
+		if dir == "/" {
+			return nil, false
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+func readTokens(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var tokens []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if token := strings.TrimSpace(scanner.Text()); token != "" && !strings.HasPrefix(token, "#") {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, scanner.Err()
+}
@@ -0,0 +1,79 @@
+package fylshr
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDirTokens(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.txt":                  "public",
+		"sec/" + tokenFile:       "# comment\ns3cret\n\nother\n",
+		"sec/f.txt":              "private",
+		"sec/deep/g.txt":         "inherited",
+		"sec/inner/" + tokenFile: "inner",
+		"sec/inner/h.txt":        "inner only",
+	})
+
+	tests := []struct {
+		name   string
+		flags  []string
+		path   string
+		header string
+		status int
+	}{
+		{"public", nil, "/a.txt", "", http.StatusOK},
+		{"missing token", nil, "/sec/f.txt", "", http.StatusForbidden},
+		{"wrong token", nil, "/sec/f.txt?token=guess", "", http.StatusForbidden},
+		{"token", nil, "/sec/f.txt?token=s3cret", "", http.StatusOK},
+		{"second token", nil, "/sec/f.txt?token=other", "", http.StatusOK},
+		{"comment is no token", nil, "/sec/f.txt?token=%23%20comment", "", http.StatusForbidden},
+		{"header", nil, "/sec/f.txt", "X-Token: s3cret", http.StatusOK},
+		{"wrong header", nil, "/sec/f.txt", "X-Token: guess", http.StatusForbidden},
+		{"listing", nil, "/sec/", "", http.StatusForbidden},
+		{"listing with token", nil, "/sec/?token=s3cret", "", http.StatusOK},
+		{"inherited", nil, "/sec/deep/g.txt", "", http.StatusForbidden},
+		{"inherited with token", nil, "/sec/deep/g.txt?token=s3cret", "", http.StatusOK},
+		{"nearest file wins", nil, "/sec/inner/h.txt?token=s3cret", "", http.StatusForbidden},
+		{"nearest token", nil, "/sec/inner/h.txt?token=inner", "", http.StatusOK},
+		{"token file itself", nil, "/sec/" + tokenFile + "?token=s3cret", "", http.StatusNotFound},
+		{"global token is not enough", []string{"-token", "global"}, "/sec/f.txt", "Authorization: Bearer global", http.StatusForbidden},
+		{"global and dir token header", []string{"-token", "global"}, "/sec/f.txt?token=s3cret", "Authorization: Bearer global", http.StatusOK},
+		{"listing without slash", []string{"-no-redirect-slash"}, "/sec", "", http.StatusForbidden},
+		{"zip without slash", []string{"-no-redirect-slash"}, "/sec?zip", "", http.StatusForbidden},
+		{"tar.gz without slash", []string{"-no-redirect-slash"}, "/sec?tar.gz", "", http.StatusForbidden},
+		{"listing without slash with token", []string{"-no-redirect-slash"}, "/sec?token=s3cret", "", http.StatusOK},
+		{"inner listing without slash", []string{"-no-redirect-slash"}, "/sec/inner?token=s3cret", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, dir, tt.flags...)
+			var headers []string
+			if tt.header != "" {
+				headers = append(headers, tt.header)
+			}
+			resp, body := do(t, srv, http.MethodGet, tt.path, nil, headers...)
+			if resp.StatusCode != tt.status {
+				t.Errorf("GET %s %s = %d, want %d", tt.path, tt.header, resp.StatusCode, tt.status)
+			}
+			if resp.StatusCode != http.StatusOK && (strings.Contains(body, "private") || strings.Contains(body, "s3cret")) {
+				t.Errorf("GET %s leaked %q", tt.path, body)
+			}
+		})
+	}
+}
+
+// TestDirTokensListing checks that the listing of a token directory carries
+// the token on its links and leaves the token file out.
+func TestDirTokensListing(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"sec/" + tokenFile: "s3cret", "sec/f.txt": "private"})
+	srv := newTestServer(t, dir)
+
+	_, body := do(t, srv, http.MethodGet, "/sec/?token=s3cret", nil)
+	if !strings.Contains(body, "f.txt?token=s3cret") || strings.Contains(body, tokenFile) {
+		t.Errorf("GET /sec/?token= body %q, want links to f.txt with the token and no %s", body, tokenFile)
+	}
+}
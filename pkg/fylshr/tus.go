@@ -0,0 +1,280 @@
+package fylshr
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tusPath is where uploads are created and resumed with the tus protocol
+// (https://tus.io/protocols/resumable-upload), with the creation and
+// termination extensions.
+const (
+	tusPath    = "/_upload"
+	tusVersion = "1.0.0"
+)
+
+// tusMethods are accepted under tusPath with -upload, besides POST.
+var tusMethods = []string{http.MethodOptions, http.MethodPatch, http.MethodDelete}
+
+// tusDir holds uploads in progress, out of the served folder, so they can be
+// resumed after a restart. It's in the user's cache directory rather than a
+// fixed name in the shared temporary one, which anyone could create first.
+var tusDir = defaultTusDir()
+
+// tusExpiry is how long an upload is kept after its last patch, so abandoned
+// ones don't pile up.
+const tusExpiry = 24 * time.Hour
+
+func defaultTusDir() string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "fylshr", "uploads")
+	}
+	return filepath.Join(os.TempDir(), "fylshr-uploads-"+strconv.Itoa(os.Getuid()))
+}
+
+// openTusDir creates tusDir if needed, checks that nobody else can reach the
+// uploads in it and removes the expired ones.
+func openTusDir(now time.Time) error {
+	if err := os.MkdirAll(tusDir, 0o700); err != nil {
+		return err
+	}
+	info, err := os.Lstat(tusDir)
+	if err != nil {
+		return err
+	}
+	if err := checkPrivate(tusDir, info); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(tusDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		id, isInfo := strings.CutSuffix(entry.Name(), ".json")
+		if isInfo || !entry.Type().IsRegular() {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && now.Sub(info.ModTime()) > tusExpiry {
+			removeTusUpload(id)
+		}
+	}
+	return nil
+}
+
+// tusInfo is what the client said about an upload when creating it.
+type tusInfo struct {
+	Length  int64     `json:"length"`
+	Dir     string    `json:"dir"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+}
+
+var tusLocks sync.Map
+
+// serveTus answers the tus requests for tusPath and the uploads under it. The
+// filename and optional dir metadata of the creation request say where the
+// finished file goes in folder; allowed checks that dir, limits the file when
+// created, and landed is called with the URL path of the file once complete.
+func serveTus(w http.ResponseWriter, r *http.Request, folder, basePath string, limits uploadLimits, allowed func(name string) bool, landed func(name string, start time.Time)) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", "creation,termination")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		writeError(w, r, http.StatusPreconditionFailed, "412 expected Tus-Resumable: "+tusVersion)
+		return
+	}
+
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, tusPath), "/")
+	if id == "" {
+		if r.Method != http.MethodPost {
+			writeError(w, r, http.StatusMethodNotAllowed, "405 POST to create an upload")
+			return
+		}
+		createTusUpload(w, r, folder, basePath, limits, allowed)
+		return
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		writeError(w, r, http.StatusNotFound, "404 unknown upload")
+		return
+	}
+
+	// Patches of the same upload must not interleave.
+	lock, _ := tusLocks.LoadOrStore(id, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	info, offset, err := readTusUpload(id)
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, "404 unknown upload")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(info.Length, 10))
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPatch:
+		patchTusUpload(w, r, folder, id, info, offset, landed)
+	case http.MethodDelete:
+		removeTusUpload(id)
+		tusLocks.Delete(id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "405 HEAD, PATCH or DELETE an upload")
+	}
+}
+
+func createTusUpload(w http.ResponseWriter, r *http.Request, folder, basePath string, limits uploadLimits, allowed func(name string) bool) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		writeError(w, r, http.StatusBadRequest, "400 expected Upload-Length")
+		return
+	}
+
+	metadata := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	info := tusInfo{Length: length, Dir: path.Clean("/" + metadata["dir"]), Name: metadata["filename"], Created: time.Now()}
+	if info.Name == "" {
+		writeError(w, r, http.StatusBadRequest, "400 expected a filename in Upload-Metadata")
+		return
+	}
+	if !allowed(strings.TrimSuffix(info.Dir, "/") + "/") {
+		writeError(w, r, http.StatusForbidden, "403 forbidden")
+		return
+	}
+	if _, err := uploadDir(folder, info.Dir); err != nil {
+		writeUploadError(w, r, err)
+		return
+	}
+	if _, err := limits.admit(folder, info.Name, length); err != nil {
+		writeUploadError(w, r, err)
+		return
+	}
+
+	b := make([]byte, 16)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+
+	if err := openTusDir(time.Now()); err != nil {
+		writeUploadError(w, r, err)
+		return
+	}
+	data, _ := json.Marshal(info)
+	if err := os.WriteFile(filepath.Join(tusDir, id+".json"), data, 0o600); err != nil {
+		writeUploadError(w, r, err)
+		return
+	}
+	// tusDir is private already, the mode is what the file keeps once moved.
+	if err := os.WriteFile(filepath.Join(tusDir, id), nil, 0o644); err != nil {
+		removeTusUpload(id)
+		writeUploadError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", (&url.URL{Path: basePath + tusPath + "/" + id}).EscapedPath())
+	w.Header().Set("Upload-Offset", "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+// patchTusUpload appends the body at offset. The upload moves to its
+// directory once complete, with a "name (n).ext" if the name is taken.
+func patchTusUpload(w http.ResponseWriter, r *http.Request, folder, id string, info tusInfo, offset int64, landed func(name string, start time.Time)) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		writeError(w, r, http.StatusUnsupportedMediaType, "415 expected Content-Type: application/offset+octet-stream")
+		return
+	}
+	if r.Header.Get("Upload-Offset") != strconv.FormatInt(offset, 10) {
+		writeError(w, r, http.StatusConflict, "409 Upload-Offset is "+strconv.FormatInt(offset, 10))
+		return
+	}
+
+	f, err := os.OpenFile(filepath.Join(tusDir, id), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		writeUploadError(w, r, err)
+		return
+	}
+	// What arrived before a dropped connection is kept for the next PATCH.
+	n, copyErr := io.Copy(f, io.LimitReader(r.Body, info.Length-offset))
+	if err := f.Close(); copyErr == nil {
+		copyErr = err
+	}
+	offset += n
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	if copyErr != nil {
+		writeError(w, r, http.StatusInternalServerError, "500 "+copyErr.Error())
+		return
+	}
+
+	if offset == info.Length {
+		dir, err := uploadDir(folder, info.Dir)
+		var name string
+		if err == nil {
+			name, err = moveUpload(dir, info.Name, filepath.Join(tusDir, id))
+		}
+		if err != nil {
+			writeUploadError(w, r, err)
+			return
+		}
+		removeTusUpload(id)
+		tusLocks.Delete(id)
+		landed(path.Join(info.Dir, name), info.Created)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func readTusUpload(id string) (tusInfo, int64, error) {
+	var info tusInfo
+	data, err := os.ReadFile(filepath.Join(tusDir, id+".json"))
+	if err != nil {
+		return info, 0, err
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, 0, err
+	}
+	stat, err := os.Stat(filepath.Join(tusDir, id))
+	if err != nil {
+		return info, 0, err
+	}
+	if time.Since(stat.ModTime()) > tusExpiry {
+		removeTusUpload(id)
+		return info, 0, os.ErrNotExist
+	}
+	return info, stat.Size(), nil
+}
+
+func removeTusUpload(id string) {
+	os.Remove(filepath.Join(tusDir, id))
+	os.Remove(filepath.Join(tusDir, id+".json"))
+}
+
+// parseTusMetadata decodes "key base64value,key base64value".
+func parseTusMetadata(header string) map[string]string {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if key != "" && err == nil {
+			metadata[key] = string(decoded)
+		}
+	}
+	return metadata
+}
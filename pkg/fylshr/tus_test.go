@@ -0,0 +1,223 @@
+package fylshr
+
+import (
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tusMetadata encodes key value pairs as an Upload-Metadata header.
+func tusMetadata(pairs ...string) string {
+	var encoded []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		encoded = append(encoded, pairs[i]+" "+base64.StdEncoding.EncodeToString([]byte(pairs[i+1])))
+	}
+	return "Upload-Metadata: " + strings.Join(encoded, ",")
+}
+
+// useTusDir keeps the uploads in progress of a test in its own private
+// folder.
+func useTusDir(t *testing.T) {
+	saved := tusDir
+	tusDir = filepath.Join(t.TempDir(), "uploads")
+	t.Cleanup(func() { tusDir = saved })
+}
+
+// TestTusResume creates an upload, sends it in two patches with a wrong
+// offset in between, and checks where it lands.
+func TestTusResume(t *testing.T) {
+	useTusDir(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"sub/up.txt": "old"})
+	srv := newTestServer(t, dir, "-upload", "-base-path", "/share")
+
+	resp, _ := do(t, srv, http.MethodPost, "/share"+tusPath, nil, "Tus-Resumable: "+tusVersion, "Upload-Length: 8", tusMetadata("filename", "up.txt", "dir", "/sub"))
+	location := resp.Header.Get("Location")
+	if resp.StatusCode != http.StatusCreated || !strings.HasPrefix(location, "/share"+tusPath+"/") {
+		t.Fatalf("POST %s = %d Location %q, want 201 under it", tusPath, resp.StatusCode, location)
+	}
+
+	steps := []struct {
+		method, offset, body string
+		status               int
+		wantOffset           string
+	}{
+		{http.MethodHead, "", "", http.StatusOK, "0"},
+		{http.MethodPatch, "0", "uplo", http.StatusNoContent, "4"},
+		{http.MethodPatch, "0", "uplo", http.StatusConflict, ""},
+		{http.MethodHead, "", "", http.StatusOK, "4"},
+		{http.MethodPatch, "4", "aded and more", http.StatusNoContent, "8"},
+		{http.MethodHead, "", "", http.StatusNotFound, ""},
+	}
+	for _, step := range steps {
+		headers := []string{"Tus-Resumable: " + tusVersion}
+		if step.method == http.MethodPatch {
+			headers = append(headers, "Content-Type: application/offset+octet-stream", "Upload-Offset: "+step.offset)
+		}
+		resp, _ := do(t, srv, step.method, location, strings.NewReader(step.body), headers...)
+		if resp.StatusCode != step.status || step.wantOffset != "" && resp.Header.Get("Upload-Offset") != step.wantOffset {
+			t.Errorf("%s offset %s = %d Upload-Offset %q, want %d %q", step.method, step.offset, resp.StatusCode, resp.Header.Get("Upload-Offset"), step.status, step.wantOffset)
+		}
+	}
+
+	if content, err := os.ReadFile(filepath.Join(dir, "sub", "up (1).txt")); string(content) != "uploaded" {
+		t.Errorf("sub/up (1).txt = %q, %v, want the upload next to the old file", content, err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "sub", "up.txt")); string(content) != "old" {
+		t.Errorf("sub/up.txt = %q, the upload replaced it", content)
+	}
+	if entries, _ := os.ReadDir(tusDir); len(entries) != 0 {
+		t.Errorf("%s keeps %d files after the upload", tusDir, len(entries))
+	}
+}
+
+func TestTusRequests(t *testing.T) {
+	create := []string{"Tus-Resumable: " + tusVersion, "Upload-Length: 8", tusMetadata("filename", "up.txt")}
+	tests := []struct {
+		name    string
+		flags   []string
+		method  string
+		path    string
+		headers []string
+		status  int
+	}{
+		{"options", []string{"-upload"}, http.MethodOptions, tusPath, nil, http.StatusNoContent},
+		{"create", []string{"-upload"}, http.MethodPost, tusPath, create, http.StatusCreated},
+		{"without upload", nil, http.MethodPost, tusPath, create, http.StatusMethodNotAllowed},
+		{"without version", []string{"-upload"}, http.MethodPost, tusPath, create[1:], http.StatusPreconditionFailed},
+		{"without length", []string{"-upload"}, http.MethodPost, tusPath, []string{create[0], create[2]}, http.StatusBadRequest},
+		{"without filename", []string{"-upload"}, http.MethodPost, tusPath, create[:2], http.StatusBadRequest},
+		{"too large", []string{"-upload", "-max-upload-size", "4B"}, http.MethodPost, tusPath, create, http.StatusRequestEntityTooLarge},
+		{"into token dir", []string{"-upload"}, http.MethodPost, tusPath, append(create[:2:2], tusMetadata("filename", "up.txt", "dir", "/sec")), http.StatusForbidden},
+		{"into token dir with token", []string{"-upload"}, http.MethodPost, tusPath + "?token=s3cret", append(create[:2:2], tusMetadata("filename", "up.txt", "dir", "/sec")), http.StatusCreated},
+		{"into missing dir", []string{"-upload"}, http.MethodPost, tusPath, append(create[:2:2], tusMetadata("filename", "up.txt", "dir", "/missing")), http.StatusConflict},
+		{"unknown upload", []string{"-upload"}, http.MethodHead, tusPath + "/00ff", create[:1], http.StatusNotFound},
+		{"not an id", []string{"-upload"}, http.MethodHead, tusPath + "/zz", create[:1], http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTusDir(t)
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"a.txt": "hello", "sec/" + tokenFile: "s3cret"})
+			srv := newTestServer(t, dir, tt.flags...)
+			if resp, body := do(t, srv, tt.method, tt.path, nil, tt.headers...); resp.StatusCode != tt.status {
+				t.Errorf("%s %s = %d %s, want %d", tt.method, tt.path, resp.StatusCode, body, tt.status)
+			}
+		})
+	}
+}
+
+func TestTusTerminate(t *testing.T) {
+	useTusDir(t)
+	srv := newTestServer(t, t.TempDir(), "-upload")
+	resp, _ := do(t, srv, http.MethodPost, tusPath, nil, "Tus-Resumable: "+tusVersion, "Upload-Length: 8", tusMetadata("filename", "up.txt"))
+	location := resp.Header.Get("Location")
+
+	if resp, _ := do(t, srv, http.MethodDelete, location, nil, "Tus-Resumable: "+tusVersion); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE %s = %d, want 204", location, resp.StatusCode)
+	}
+	if resp, _ := do(t, srv, http.MethodHead, location, nil, "Tus-Resumable: "+tusVersion); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("HEAD %s = %d after DELETE, want 404", location, resp.StatusCode)
+	}
+}
+
+// TestTusExpiry checks that uploads untouched for tusExpiry are gone, both
+// when resumed and when a new upload clears them out.
+func TestTusExpiry(t *testing.T) {
+	useTusDir(t)
+	srv := newTestServer(t, t.TempDir(), "-upload")
+	create := func() string {
+		resp, _ := do(t, srv, http.MethodPost, tusPath, nil, "Tus-Resumable: "+tusVersion, "Upload-Length: 8", tusMetadata("filename", "up.txt"))
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST %s = %d, want 201", tusPath, resp.StatusCode)
+		}
+		return resp.Header.Get("Location")
+	}
+	expire := func(location string) string {
+		name := filepath.Join(tusDir, path.Base(location))
+		old := time.Now().Add(-tusExpiry - time.Minute)
+		if err := os.Chtimes(name, old, old); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+
+	resumed, swept, fresh := create(), create(), create()
+	expire(resumed)
+	if resp, _ := do(t, srv, http.MethodHead, resumed, nil, "Tus-Resumable: "+tusVersion); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("HEAD of an expired upload = %d, want 404", resp.StatusCode)
+	}
+
+	name := expire(swept)
+	create()
+	for _, name := range []string{name, name + ".json"} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s of an expired upload is still there after a new one: %v", name, err)
+		}
+	}
+	if resp, _ := do(t, srv, http.MethodHead, fresh, nil, "Tus-Resumable: "+tusVersion); resp.StatusCode != http.StatusOK {
+		t.Errorf("HEAD of a recent upload = %d, want 200", resp.StatusCode)
+	}
+}
+
+// TestTusDir checks that uploads are only kept in a directory nobody else can
+// reach.
+func TestTusDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes don't apply")
+	}
+	private := filepath.Join(t.TempDir(), "private")
+	if err := os.Mkdir(private, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		setup func(dir string) error
+		ok    bool
+	}{
+		{"created", func(dir string) error { return nil }, true},
+		{"private", func(dir string) error { return os.Mkdir(dir, 0o700) }, true},
+		{"open to others", func(dir string) error {
+			if err := os.Mkdir(dir, 0o700); err != nil {
+				return err
+			}
+			return os.Chmod(dir, 0o777)
+		}, false},
+		{"symlink", func(dir string) error { return os.Symlink(private, dir) }, false},
+		{"file", func(dir string) error { return os.WriteFile(dir, nil, 0o600) }, false},
+		{"other user", func(dir string) error {
+			if err := os.Mkdir(dir, 0o700); err != nil {
+				return err
+			}
+			if err := os.Chown(dir, os.Getuid()+1, -1); err != nil {
+				t.Skipf("can't give a directory away: %v", err)
+			}
+			return nil
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := tusDir
+			tusDir = filepath.Join(t.TempDir(), "uploads")
+			t.Cleanup(func() { tusDir = saved })
+			if err := tt.setup(tusDir); err != nil {
+				t.Fatal(err)
+			}
+
+			err := openTusDir(time.Now())
+			if (err == nil) != tt.ok {
+				t.Errorf("uploads in a %s directory: %v, want ok %v", tt.name, err, tt.ok)
+			}
+			if info, statErr := os.Lstat(tusDir); tt.ok && (statErr != nil || info.Mode().Perm() != 0o700) {
+				t.Errorf("uploads directory %v, %v, want mode 700", info.Mode(), statErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package fylshr
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// uploadMethods are accepted everywhere with -upload on top of -methods.
+var uploadMethods = []string{http.MethodPost, http.MethodPut}
+
+// serveUpload stores the files of a multipart POST to a directory, or the body
+// of a PUT to a file name, in folder. Existing files are never replaced: the
+// upload gets a free "name (n).ext" instead, and files limits refuses aren't
+// kept, nor files of a multipart POST allowed refuses the URL path of.
+// landed is called with the URL path of each file saved, and the locations
+// answered start with basePath. A gzip or deflate body is stored decoded.
+func serveUpload(w http.ResponseWriter, r *http.Request, folder, basePath string, limits uploadLimits, allowed func(name string) bool, landed func(name string, start time.Time)) {
+	start := time.Now()
+	if err := decodeBody(r); err != nil {
+		writeUploadError(w, r, err)
+		return
+	}
+	name := path.Clean("/" + r.URL.Path)
+	isDir := strings.HasSuffix(r.URL.Path, "/") || isDirectory(filepath.Join(folder, filepath.FromSlash(name)))
+
+	var saved []string
+	switch {
+	case r.Method == http.MethodPut && !isDir:
+		dir, err := uploadDir(folder, path.Dir(name))
+		if err != nil {
+			writeUploadError(w, r, err)
+			return
+		}
+		budget, err := limits.admit(folder, path.Base(name), r.ContentLength)
+		if err != nil {
+			writeUploadError(w, r, err)
+			return
+		}
+		file, err := saveUpload(dir, path.Base(name), budget.limit(r.Body))
+		if err != nil {
+			writeUploadError(w, r, err)
+			return
+		}
+		saved = append(saved, path.Join(path.Dir(name), file))
+		landed(saved[0], start)
+	case r.Method == http.MethodPost && isDir:
+		dir, err := uploadDir(folder, name)
+		if err != nil {
+			writeUploadError(w, r, err)
+			return
+		}
+		parts, err := r.MultipartReader()
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "400 expected a multipart/form-data upload")
+			return
+		}
+		for {
+			part, err := parts.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, "400 "+err.Error())
+				return
+			}
+			if part.FileName() == "" {
+				continue
+			}
+			// A PUT can't name an excluded file either.
+			if !allowed(path.Join(name, uploadName(part.FileName()))) {
+				writeError(w, r, http.StatusForbidden, "403 forbidden")
+				return
+			}
+
+			budget, err := limits.admit(folder, part.FileName(), -1)
+			if err != nil {
+				writeUploadError(w, r, err)
+				return
+			}
+			file, err := saveUpload(dir, part.FileName(), budget.limit(part))
+			if err != nil {
+				writeUploadError(w, r, err)
+				return
+			}
+			saved = append(saved, path.Join(name, file))
+			landed(saved[len(saved)-1], start)
+		}
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "405 POST uploads to a directory, PUT to a file name")
+		return
+	}
+
+	if prefersJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string][]string{"files": saved})
+		return
+	}
+	if r.Method == http.MethodPost {
+		// Back to the listing the form was on.
+		listing := url.URL{Path: basePath + strings.TrimSuffix(name, "/") + "/", RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, listing.String(), http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Location", (&url.URL{Path: basePath + saved[0]}).EscapedPath())
+	w.WriteHeader(http.StatusCreated)
+}
+
+var (
+	errUploadName     = errors.New("invalid file name")
+	errUploadEncoding = errors.New("unsupported Content-Encoding, send gzip, deflate or identity")
+	errUploadCorrupt  = errors.New("body doesn't decode as its Content-Encoding")
+)
+
+// decodeBody replaces the body of r, encoded with gzip or deflate, by the
+// decoded bytes. Their size is unknown until read, so the limits of an upload
+// apply as it's written, which stops a small body decoding to a huge file.
+func decodeBody(r *http.Request) error {
+	var decoded io.Reader
+	switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		return nil
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return fmt.Errorf("%w: %s", errUploadCorrupt, err)
+		}
+		decoded = gz
+	case "deflate":
+		zr, err := zlib.NewReader(r.Body)
+		if err != nil {
+			return fmt.Errorf("%w: %s", errUploadCorrupt, err)
+		}
+		decoded = zr
+	default:
+		return fmt.Errorf("%w, not %s", errUploadEncoding, encoding)
+	}
+
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{decodedReader{decoded}, r.Body}
+	r.ContentLength = -1
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	return nil
+}
+
+// decodedReader tells a body that doesn't decode from one that failed to
+// arrive.
+type decodedReader struct {
+	io.Reader
+}
+
+func (d decodedReader) Read(p []byte) (int, error) {
+	n, err := d.Reader.Read(p)
+	var corrupt flate.CorruptInputError
+	if errors.As(err, &corrupt) || errors.Is(err, gzip.ErrChecksum) || errors.Is(err, gzip.ErrHeader) || errors.Is(err, zlib.ErrChecksum) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = fmt.Errorf("%w: %s", errUploadCorrupt, err)
+	}
+	return n, err
+}
+
+// uploadDir returns the directory of folder uploads to name go to, making
+// sure a symlink doesn't lead out of folder.
+func uploadDir(folder, name string) (string, error) {
+	root, err := filepath.EvalSymlinks(folder)
+	if err != nil {
+		return "", err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Join(folder, filepath.FromSlash(name)))
+	if err != nil {
+		return "", err
+	}
+	if !insideDir(root, dir) {
+		return "", fs.ErrPermission
+	}
+	return dir, nil
+}
+
+// saveUpload writes src to a new file in dir, named after the base of name or,
+// if taken, with a number appended. It returns the name used.
+func saveUpload(dir, name string, src io.Reader) (string, error) {
+	f, name, err := createUpload(dir, name)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(f, src)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return name, nil
+}
+
+// moveUpload moves the file src into dir under a free name like saveUpload,
+// copying it when it is on another file system.
+func moveUpload(dir, name, src string) (string, error) {
+	f, name, err := createUpload(dir, name)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	if os.Rename(src, f.Name()) == nil {
+		return name, nil
+	}
+
+	in, err := os.Open(src)
+	if err == nil {
+		f, err = os.OpenFile(f.Name(), os.O_WRONLY|os.O_TRUNC, 0)
+	}
+	if err == nil {
+		_, err = io.Copy(f, in)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if in != nil {
+		in.Close()
+	}
+	if err != nil {
+		os.Remove(filepath.Join(dir, name))
+		return "", err
+	}
+	os.Remove(src)
+	return name, nil
+}
+
+// createUpload creates a new file in dir named after the base of name or, if
+// taken, with a number appended.
+func createUpload(dir, name string) (*os.File, string, error) {
+	name = uploadName(name)
+	if name == "." || name == "/" || name == ".." || name == tokenFile || name == ignoreFile {
+		return nil, "", errUploadName
+	}
+
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := 1; ; n++ {
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, fs.ErrExist) {
+			name = base + " (" + strconv.Itoa(n) + ")" + ext
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		return f, name, nil
+	}
+}
+
+// uploadName returns the file name of an upload named name by the client.
+func uploadName(name string) string {
+	// Browsers used to send the client's full path.
+	return path.Base(strings.ReplaceAll(name, `\`, "/"))
+}
+
+func writeUploadError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errUploadName), errors.Is(err, errUploadCorrupt):
+		writeError(w, r, http.StatusBadRequest, "400 "+err.Error())
+	case errors.Is(err, errUploadTooLarge):
+		writeError(w, r, http.StatusRequestEntityTooLarge, "413 "+err.Error())
+	case errors.Is(err, errUploadType), errors.Is(err, errUploadEncoding):
+		writeError(w, r, http.StatusUnsupportedMediaType, "415 "+err.Error())
+	case errors.Is(err, fs.ErrNotExist):
+		writeError(w, r, http.StatusConflict, "409 the directory doesn't exist")
+	case errors.Is(err, fs.ErrPermission):
+		writeError(w, r, http.StatusForbidden, "403 forbidden")
+	default:
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("500 upload failed: %s", err))
+	}
+}
@@ -0,0 +1,153 @@
+// Uploads the files dropped on the listing or picked in its form through the
+// tus endpoint, a chunk at a time, so big files show their progress and
+// resume where they stopped after a dropped connection or a reload.
+(() => {
+  const form = document.querySelector("form.upload")
+  if (!form || !window.XMLHttpRequest) return
+
+  const endpoint = form.dataset.endpoint
+  const dir = form.dataset.dir
+  const token = new URLSearchParams(location.search).get("token")
+  const list = form.querySelector(".progress")
+  const chunkSize = 8 << 20
+  const retries = 5
+
+  const withToken = url => token ? url + "?token=" + encodeURIComponent(token) : url
+  const b64 = s => btoa(String.fromCharCode(...new TextEncoder().encode(s)))
+
+  const formatSize = n => {
+    const units = ["B", "KB", "MB", "GB", "TB"]
+    let i = 0
+    while (n >= 1024 && i < units.length - 1) {
+      n /= 1024
+      i++
+    }
+    return (i ? n.toFixed(1) : n) + " " + units[i]
+  }
+
+  const request = (method, url, headers, body, onprogress) => new Promise((resolve, reject) => {
+    const xhr = new XMLHttpRequest()
+    xhr.open(method, withToken(url))
+    xhr.setRequestHeader("Tus-Resumable", "1.0.0")
+    for (const [key, value] of Object.entries(headers)) xhr.setRequestHeader(key, value)
+    if (onprogress) xhr.upload.onprogress = onprogress
+    xhr.onload = () => resolve(xhr)
+    xhr.onerror = () => reject(new Error("connection lost"))
+    xhr.send(body)
+  })
+
+  const failed = xhr => new Error(xhr.responseText.trim() || xhr.status + " " + xhr.statusText)
+
+  // The upload URL is kept per file and directory to resume it later.
+  const key = file => ["fylshr-upload", dir, file.name, file.size, file.lastModified].join("\n")
+
+  const offsetOf = async url => {
+    const xhr = await request("HEAD", url, {})
+    return xhr.status === 200 ? Number(xhr.getResponseHeader("Upload-Offset")) : -1
+  }
+
+  const create = async file => {
+    const xhr = await request("POST", endpoint, {
+      "Upload-Length": file.size,
+      "Upload-Metadata": "filename " + b64(file.name) + ",dir " + b64(dir),
+    })
+    if (xhr.status !== 201) throw failed(xhr)
+    return new URL(xhr.getResponseHeader("Location"), location.href).pathname
+  }
+
+  const upload = async (file, show) => {
+    let url = localStorage.getItem(key(file))
+    let offset = url ? await offsetOf(url).catch(() => -1) : -1
+    if (offset < 0) {
+      url = await create(file)
+      offset = 0
+      localStorage.setItem(key(file), url)
+    }
+
+    let start = Date.now(), started = offset, attempt = 0
+    while (offset < file.size || file.size === 0) {
+      try {
+        const xhr = await request("PATCH", url, {
+          "Content-Type": "application/offset+octet-stream",
+          "Upload-Offset": offset,
+        }, file.slice(offset, offset + chunkSize), e => show(offset + e.loaded, started, start))
+        if (xhr.status === 409 || xhr.status >= 500) {
+          offset = await offsetOf(url)
+          if (offset < 0) throw failed(xhr)
+          if (++attempt > retries) throw failed(xhr)
+          continue
+        }
+        if (xhr.status !== 204) throw failed(xhr)
+        offset = Number(xhr.getResponseHeader("Upload-Offset"))
+        attempt = 0
+        show(offset, started, start)
+        if (file.size === 0) break
+      } catch (err) {
+        if (++attempt > retries) throw err
+        await new Promise(resolve => setTimeout(resolve, 1000 * attempt))
+        offset = await offsetOf(url).catch(() => offset)
+        started = offset
+        start = Date.now()
+      }
+    }
+    localStorage.removeItem(key(file))
+  }
+
+  let queue = Promise.resolve(), pending = 0, errors = 0
+
+  const add = files => {
+    for (const file of files) {
+      const item = document.createElement("li")
+      const bar = document.createElement("progress")
+      const label = document.createElement("span")
+      bar.max = file.size || 1
+      bar.value = 0
+      item.append(bar, " ", file.name, " ", label)
+      list.append(item)
+
+      const show = (sent, started, start) => {
+        const seconds = (Date.now() - start) / 1000
+        bar.value = sent
+        label.textContent = formatSize(sent) + " / " + formatSize(file.size) +
+          (seconds > 0.5 ? ", " + formatSize((sent - started) / seconds) + "/s" : "")
+      }
+
+      pending++
+      queue = queue.then(() => upload(file, show)).then(() => {
+        bar.value = bar.max
+        item.classList.add("done")
+        label.textContent = formatSize(file.size) + ", done"
+      }, err => {
+        errors++
+        item.classList.add("error")
+        label.textContent = err.message
+      }).finally(() => {
+        // The listing is reloaded once everything went through, -receive
+        // keeps showing what was sent instead.
+        if (--pending === 0 && errors === 0 && document.querySelector(".listing")) location.reload()
+      })
+    }
+  }
+
+  form.addEventListener("submit", e => {
+    e.preventDefault()
+    const input = form.querySelector("input[type=file]")
+    add(input.files)
+    input.value = ""
+  })
+
+  document.addEventListener("dragover", e => {
+    if (!e.dataTransfer.types.includes("Files")) return
+    e.preventDefault()
+    document.body.classList.add("dropping")
+  })
+  document.addEventListener("dragleave", e => {
+    if (!e.relatedTarget) document.body.classList.remove("dropping")
+  })
+  document.addEventListener("drop", e => {
+    document.body.classList.remove("dropping")
+    if (!e.dataTransfer.files.length) return
+    e.preventDefault()
+    add(e.dataTransfer.files)
+  })
+})()
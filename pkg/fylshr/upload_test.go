@@ -0,0 +1,181 @@
+package fylshr
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// multipartBody returns a form with a file field for each name to content.
+func multipartBody(t *testing.T, files map[string]string) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, content := range files {
+		part, err := form.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(content))
+	}
+	form.Close()
+	return &body, "Content-Type: " + form.FormDataContentType()
+}
+
+func TestUpload(t *testing.T) {
+	tests := []struct {
+		name     string
+		basePath string
+		method   string
+		path     string
+		status   int
+		location string
+		saved    string
+	}{
+		{"post to root", "", http.MethodPost, "/", http.StatusSeeOther, "/", "up.txt"},
+		{"post to folder", "", http.MethodPost, "/sub/", http.StatusSeeOther, "/sub/", "sub/up.txt"},
+		{"post to folder without slash", "", http.MethodPost, "/sub", http.StatusSeeOther, "/sub/", "sub/up.txt"},
+		{"post keeps the query", "", http.MethodPost, "/sub/?sort=size", http.StatusSeeOther, "/sub/?sort=size", "sub/up.txt"},
+		{"put", "", http.MethodPut, "/sub/up.txt", http.StatusCreated, "/sub/up.txt", "sub/up.txt"},
+		{"put existing", "", http.MethodPut, "/a.txt", http.StatusCreated, "/a%20%281%29.txt", "a (1).txt"},
+		{"post behind base path", "/share", http.MethodPost, "/share/", http.StatusSeeOther, "/share/", "up.txt"},
+		{"post to folder behind base path", "/share", http.MethodPost, "/share/sub/", http.StatusSeeOther, "/share/sub/", "sub/up.txt"},
+		{"put behind base path", "/share", http.MethodPut, "/share/up.txt", http.StatusCreated, "/share/up.txt", "up.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"a.txt": "old", "sub/": ""})
+			srv := newTestServer(t, dir, "-upload", "-base-path", tt.basePath)
+
+			body, contentType := multipartBody(t, map[string]string{"up.txt": "uploaded"})
+			if tt.method == http.MethodPut {
+				body, contentType = bytes.NewBufferString("uploaded"), "Content-Type: text/plain"
+			}
+			resp, _ := do(t, srv, tt.method, tt.path, body, contentType)
+			if resp.StatusCode != tt.status || resp.Header.Get("Location") != tt.location {
+				t.Errorf("%s %s = %d Location %q, want %d %q", tt.method, tt.path, resp.StatusCode, resp.Header.Get("Location"), tt.status, tt.location)
+			}
+			if content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(tt.saved))); string(content) != "uploaded" {
+				t.Errorf("%s = %q, %v, want the upload", tt.saved, content, err)
+			}
+			if content, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(content) != "old" {
+				t.Errorf("a.txt = %q, an upload replaced it", content)
+			}
+		})
+	}
+}
+
+// TestUploadExcluded checks that a multipart POST can't save files hidden by
+// -exclude or -hide-dotfiles, which a PUT couldn't name either.
+func TestUploadExcluded(t *testing.T) {
+	tests := []struct {
+		name   string
+		flags  []string
+		path   string
+		file   string
+		status int
+	}{
+		{"allowed", nil, "/", "up.txt", http.StatusSeeOther},
+		{"excluded", nil, "/", "debug.log", http.StatusForbidden},
+		{"excluded in folder", nil, "/sub/", "debug.log", http.StatusForbidden},
+		{"excluded full path", nil, "/", `C:\logs\debug.log`, http.StatusForbidden},
+		{"dotfile", nil, "/", ".env", http.StatusForbidden},
+		{"excluded folder", []string{"-exclude", "sub/"}, "/sub/", "up.txt", http.StatusNotFound},
+		{"receive", []string{"-receive"}, "/", "debug.log", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"sub/": ""})
+			srv := newTestServer(t, dir, append([]string{"-upload", "-exclude", "*.log"}, tt.flags...)...)
+			before := snapshot(t, dir)
+
+			body, contentType := multipartBody(t, map[string]string{tt.file: "uploaded"})
+			if resp, _ := do(t, srv, http.MethodPost, tt.path, body, contentType); resp.StatusCode != tt.status {
+				t.Errorf("POST %s of %s = %d, want %d", tt.path, tt.file, resp.StatusCode, tt.status)
+			}
+			if after := snapshot(t, dir); tt.status != http.StatusSeeOther && after != before {
+				t.Errorf("POST %s of %s saved it:\n%s", tt.path, tt.file, after)
+			}
+		})
+	}
+}
+
+func TestUploadJSON(t *testing.T) {
+	dir := t.TempDir()
+	srv := newTestServer(t, dir, "-upload")
+	body, contentType := multipartBody(t, map[string]string{"up.txt": "uploaded"})
+	resp, got := do(t, srv, http.MethodPost, "/", body, contentType, "Accept: application/json")
+	if resp.StatusCode != http.StatusCreated || !strings.Contains(got, `"/up.txt"`) {
+		t.Errorf("POST / = %d %q, want 201 listing /up.txt", resp.StatusCode, got)
+	}
+}
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(b)
+	gz.Close()
+	return buf.Bytes()
+}
+
+func deflateBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestUploadEncoded(t *testing.T) {
+	form, formType := multipartBody(t, map[string]string{"up.txt": "uploaded"})
+	bomb := gzipBytes(t, make([]byte, 10<<20))
+	corrupt := gzipBytes(t, []byte(strings.Repeat("uploaded", 100)))
+	corrupt[len(corrupt)/2] ^= 0xff
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     []byte
+		headers  []string
+		status   int
+		saved    string
+		notSaved string
+	}{
+		{"gzip put", http.MethodPut, "/up.txt", gzipBytes(t, []byte("uploaded")), []string{"Content-Encoding: gzip"}, http.StatusCreated, "up.txt", ""},
+		{"deflate put", http.MethodPut, "/up.txt", deflateBytes(t, []byte("uploaded")), []string{"Content-Encoding: deflate"}, http.StatusCreated, "up.txt", ""},
+		{"identity put", http.MethodPut, "/up.txt", []byte("uploaded"), []string{"Content-Encoding: identity"}, http.StatusCreated, "up.txt", ""},
+		{"gzip form", http.MethodPost, "/", gzipBytes(t, form.Bytes()), []string{formType, "Content-Encoding: gzip"}, http.StatusSeeOther, "up.txt", ""},
+		{"brotli", http.MethodPut, "/up.txt", []byte("ignored"), []string{"Content-Encoding: br"}, http.StatusUnsupportedMediaType, "", "up.txt"},
+		{"not gzip", http.MethodPut, "/up.txt", []byte("uploaded"), []string{"Content-Encoding: gzip"}, http.StatusBadRequest, "", "up.txt"},
+		{"corrupt gzip", http.MethodPut, "/up.txt", corrupt, []string{"Content-Encoding: gzip"}, http.StatusBadRequest, "", "up.txt"},
+		{"decompression bomb", http.MethodPut, "/bomb.bin", bomb, []string{"Content-Encoding: gzip"}, http.StatusRequestEntityTooLarge, "", "bomb.bin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			srv := newTestServer(t, dir, "-upload", "-max-upload-size", "1MB")
+			if resp, body := do(t, srv, tt.method, tt.path, bytes.NewReader(tt.body), tt.headers...); resp.StatusCode != tt.status {
+				t.Errorf("%s %s = %d %s, want %d", tt.method, tt.path, resp.StatusCode, body, tt.status)
+			}
+			if tt.saved != "" {
+				if content, err := os.ReadFile(filepath.Join(dir, tt.saved)); string(content) != "uploaded" {
+					t.Errorf("%s = %q, %v, want the decoded upload", tt.saved, content, err)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(dir, tt.notSaved)); tt.notSaved != "" && err == nil {
+				t.Errorf("%s was kept", tt.notSaved)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package fylshr
+
+import (
+	"strings"
+	"sync"
+)
+
+type userAgent struct {
+	browser string
+	version string
+	os      string
+}
+
+func (ua userAgent) String() string {
+	s := ua.browser
+	if ua.version != "" {
+		s += " " + ua.version
+	}
+	if ua.os != "" {
+		s += " (" + ua.os + ")"
+	}
+	return s
+}
+
+const uaCacheSize = 1024
+
+var uaCache = struct {
+	sync.Mutex
+	entries map[string]userAgent
+}{entries: map[string]userAgent{}}
+
+// parseUserAgentCached memoizes parseUserAgent, since most requests come from a
+// handful of clients. The cache is dropped when full so it can't grow forever.
+func parseUserAgentCached(s string) userAgent {
+	uaCache.Lock()
+	defer uaCache.Unlock()
+
+	if ua, ok := uaCache.entries[s]; ok {
+		return ua
+	}
+
+	if len(uaCache.entries) >= uaCacheSize {
+		clear(uaCache.entries)
+	}
+
+	ua := parseUserAgent(s)
+	uaCache.entries[s] = ua
+	return ua
+}
+
+// Order matters: Edge and Opera also claim to be Chrome, and Chrome claims to
+// be Safari.
+var browserTokens = []struct{ token, name string }{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"FxiOS/", "Firefox"},
+	{"Firefox/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Version/", "Safari"},
+	{"curl/", "curl"},
+	{"Wget/", "Wget"},
+}
+
+var osTokens = []struct{ token, name string }{
+	{"Windows NT", "Windows"},
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"Android", "Android"},
+	{"CrOS", "ChromeOS"},
+	{"Mac OS X", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// parseUserAgent extracts the browser, its major version and the OS from a
+// User-Agent header. Unknown clients are reported by their first product token.
+func parseUserAgent(s string) userAgent {
+	var ua userAgent
+
+	for _, b := range browserTokens {
+		if i := strings.Index(s, b.token); i >= 0 {
+			ua.browser = b.name
+			ua.version = majorVersion(s[i+len(b.token):])
+			break
+		}
+	}
+
+	if ua.browser == "" {
+		product, _, _ := strings.Cut(s, " ")
+		ua.browser, ua.version, _ = strings.Cut(product, "/")
+		ua.version = majorVersion(ua.version)
+	}
+
+	for _, o := range osTokens {
+		if strings.Contains(s, o.token) {
+			ua.os = o.name
+			break
+		}
+	}
+
+	return ua
+}
+
+func majorVersion(s string) string {
+	end := strings.IndexFunc(s, func(c rune) bool { return c < '0' || c > '9' })
+	if end < 0 {
+		return s
+	}
+	return s[:end]
+}
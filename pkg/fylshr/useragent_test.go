@@ -0,0 +1,59 @@
+package fylshr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", "Chrome 120 (Windows)"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91", "Edge 120 (Windows)"},
+		{"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36 OPR/105.0.0.0", "Opera 105 (Linux)"},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_2) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Safari/605.1.15", "Safari 17 (macOS)"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1", "Safari 17 (iOS)"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1", "Chrome 120 (iOS)"},
+		{"Mozilla/5.0 (Linux; Android 14; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Mobile Safari/537.36", "Samsung Internet 23 (Android)"},
+		{"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0", "Firefox 121 (Linux)"},
+		{"Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", "Chrome 120 (ChromeOS)"},
+		{"curl/8.5.0", "curl 8"},
+		{"Wget/1.21.4", "Wget 1"},
+		{"Go-http-client/1.1", "Go-http-client 1"},
+		{"rclone/v1.65.0", "rclone"},
+		{"Transmit", "Transmit"},
+	}
+	for _, tt := range tests {
+		if got := parseUserAgent(tt.in).String(); got != tt.want {
+			t.Errorf("parseUserAgent(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if got := parseUserAgentCached(tt.in).String(); got != tt.want {
+			t.Errorf("parseUserAgentCached(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLogUserAgent(t *testing.T) {
+	const chrome = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	tests := []struct {
+		parseUA bool
+		want    string
+	}{
+		{true, "| Chrome 120 (Windows)\n"},
+		{false, "| " + chrome + "\n"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+		r.Header.Set("User-Agent", chrome)
+		w := &statusWriter{ResponseWriter: httptest.NewRecorder(), status: http.StatusOK}
+		args := Args{parseUA: tt.parseUA}
+		if got := capture(t, &os.Stdout, func() { logRequest(w, r, args, time.Now()) }); !strings.HasSuffix(got, tt.want) {
+			t.Errorf("-parse-ua=%v logs %q, want it to end with %q", tt.parseUA, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package fylshr
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// validate checks the configuration beyond what flag parsing already rejected,
+// without binding any port.
+func validate(args Args) error {
+	if args.share != nil {
+		if !isFile(args.share.file) {
+			return fmt.Errorf("-file: %s is not a file", args.share.file)
+		}
+	} else if len(args.mounts) > 0 {
+		for _, m := range args.mounts {
+			if err := checkDir(m.dir); err != nil {
+				return fmt.Errorf("-mount %s: %w", m.prefix, err)
+			}
+		}
+	} else if err := checkDir(args.folder); err != nil {
+		return fmt.Errorf("-folder: %w", err)
+	}
+
+	for _, folder := range args.overlay {
+		if err := checkDir(folder); err != nil {
+			return fmt.Errorf("-overlay: %w", err)
+		}
+	}
+
+	if (args.certFile == "") != (args.keyFile == "") {
+		return errors.New("-cert and -key must be given together")
+	}
+	if args.certFile != "" {
+		if _, err := tls.LoadX509KeyPair(args.certFile, args.keyFile); err != nil {
+			return fmt.Errorf("-cert: %w", err)
+		}
+	}
+
+	if _, err := parseCipherSuites(args.tlsCiphers, args.minTLS); err != nil {
+		return fmt.Errorf("-tls-ciphers: %w", err)
+	}
+
+	if args.inbox != "" {
+		if err := checkInbox(args.folder, args.inbox); err != nil {
+			return fmt.Errorf("-inbox: %w", err)
+		}
+	}
+
+	if args.acmeWebroot != "" {
+		if err := checkDir(args.acmeWebroot); err != nil {
+			return fmt.Errorf("-acme-webroot: %w", err)
+		}
+	}
+
+	if args.favicon != "" {
+		f, err := os.Open(args.favicon)
+		if err != nil {
+			return fmt.Errorf("-favicon: %w", err)
+		}
+		f.Close()
+	}
+
+	if args.rootPage != "" && !isFile(args.rootPage) {
+		return fmt.Errorf("-root-page: %s is not a file", args.rootPage)
+	}
+
+	return nil
+}
+
+// sensitiveNames are patterns of secrets and keys that shouldn't be shared.
+var sensitiveNames = []string{".env", ".git", ".ssh", ".aws", "id_rsa", "id_ecdsa", "id_ed25519", "*.pem", "*.key"}
+
+// folderWarnings points out likely mistakes in the served folder. They are
+// hints, not errors: validate already rejected an unreadable folder.
+func folderWarnings(folder string, args Args) []string {
+	var warnings []string
+	authenticated := args.auth != "" || args.token != "" || args.pin != nil
+
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return nil
+	}
+
+	if resolved, err := filepath.EvalSymlinks(folder); err == nil {
+		resolved, _ = filepath.Abs(resolved)
+		home, _ := os.UserHomeDir()
+		switch {
+		case filepath.Dir(resolved) == resolved:
+			warnings = append(warnings, fmt.Sprintf("%s is the root of the filesystem", folder))
+		case home != "" && resolved == filepath.Clean(home):
+			warnings = append(warnings, fmt.Sprintf("%s is your home directory", folder))
+		}
+	}
+
+	if len(entries) == 0 {
+		warnings = append(warnings, fmt.Sprintf("%s is empty", folder))
+	}
+
+	for _, entry := range entries {
+		// A secret is only exposed if it isn't hidden and fylshr can read it.
+		if sensitive(entry.Name()) && !(args.hideDotfiles && strings.HasPrefix(entry.Name(), ".")) && readable(filepath.Join(folder, entry.Name())) {
+			warning := fmt.Sprintf("%s contains %s, which will be served", folder, entry.Name())
+			if !authenticated {
+				warning += " to anyone, no authentication is configured"
+			}
+			warnings = append(warnings, warning)
+		}
+		if name := filepath.Join(folder, entry.Name()); entry.Type()&fs.ModeSymlink != 0 && !confined(folder, name) {
+			if args.followSymlinks {
+				warnings = append(warnings, fmt.Sprintf("%s leads out of %s and will be served", entry.Name(), folder))
+			} else {
+				warnings = append(warnings, fmt.Sprintf("%s leads out of %s and won't be served without -follow-symlinks", entry.Name(), folder))
+			}
+		}
+	}
+
+	if info, err := os.Stat(folder); err == nil && info.Mode().Perm()&0o004 != 0 && !authenticated {
+		warnings = append(warnings, fmt.Sprintf("%s is world-readable and no authentication is configured", folder))
+	}
+
+	return warnings
+}
+
+func sensitive(name string) bool {
+	return slices.ContainsFunc(sensitiveNames, func(pattern string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	})
+}
+
+func readable(name string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+func checkDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	_, err = f.Readdirnames(1)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package fylshr
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+
+	"golang.org/x/net/webdav"
+)
+
+// davReadMethods are what mounting a share read-only needs, davWriteMethods
+// are added with -upload.
+var (
+	davReadMethods  = []string{http.MethodOptions, "PROPFIND"}
+	davWriteMethods = []string{http.MethodPut, http.MethodDelete, "MKCOL", "COPY", "MOVE", "PROPPATCH", "LOCK", "UNLOCK"}
+)
+
+// davMethods returns the WebDAV methods accepted on top of GET and HEAD.
+func davMethods(writable bool) []string {
+	if writable {
+		return append(slices.Clip(davReadMethods), davWriteMethods...)
+	}
+	return davReadMethods
+}
+
+// davFS is the served folder as seen by WebDAV clients: hidden files don't
+// exist, directories r has no token for are left out, and nothing can change
+// unless writable. Files are only created, copied or moved under the names
+// limits lets in, and have the types of the server.
+type davFS struct {
+	webdav.Dir
+	writable bool
+	hide     func(name string, info fs.FileInfo) bool
+	excluded func(name string) bool
+	allowed  func(name string) bool
+	limits   uploadLimits
+	types    mimeTypes
+}
+
+func (fsys davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	writing := flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0
+	if writing && !fsys.canWrite(ctx, name) || flag&os.O_CREATE != 0 && fsys.limits.admitType(name) != nil {
+		return nil, os.ErrPermission
+	}
+
+	f, err := fsys.Dir.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err == nil && fsys.hidden(name, info) {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return davDir{File: f, fsys: fsys, name: name}, nil
+}
+
+func (fsys davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	info, err := fsys.Dir.Stat(ctx, name)
+	if err == nil && fsys.hidden(name, info) {
+		return nil, os.ErrNotExist
+	}
+	return info, err
+}
+
+func (fsys davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if !fsys.canWrite(ctx, name) {
+		return os.ErrPermission
+	}
+	return fsys.Dir.Mkdir(ctx, name, perm)
+}
+
+func (fsys davFS) RemoveAll(ctx context.Context, name string) error {
+	if !fsys.canWrite(ctx, name) {
+		return os.ErrPermission
+	}
+	return fsys.Dir.RemoveAll(ctx, name)
+}
+
+func (fsys davFS) Rename(ctx context.Context, oldName, newName string) error {
+	if !fsys.canWrite(ctx, oldName) || !fsys.canWrite(ctx, newName) {
+		return os.ErrPermission
+	}
+	// Folders have names of their own, only files get an extension.
+	if info, err := fsys.Dir.Stat(ctx, oldName); err == nil && !info.IsDir() && fsys.limits.admitType(newName) != nil {
+		return os.ErrPermission
+	}
+	return fsys.Dir.Rename(ctx, oldName, newName)
+}
+
+// canWrite reports whether name, which may not exist yet, can be created,
+// changed or removed: only with -upload, and when a GET could see it. A COPY
+// or MOVE Destination comes here too, so it can't land in a directory r has
+// no token for, or on a hidden or excluded file.
+func (fsys davFS) canWrite(ctx context.Context, name string) bool {
+	name = path.Clean("/" + name)
+	if !fsys.writable || name == "/" || path.Base(name) == tokenFile || fsys.excluded(name) || !fsys.allowed(name) {
+		return false
+	}
+	if info, err := fsys.Dir.Stat(ctx, name); err == nil && fsys.hidden(name, info) {
+		return false
+	}
+	return true
+}
+
+func (fsys davFS) hidden(name string, info fs.FileInfo) bool {
+	name = path.Clean("/" + name)
+	if info.IsDir() {
+		return name != "/" && (fsys.hide(name, info) || !fsys.allowed(name+"/"))
+	}
+	return fsys.hide(name, info) || !fsys.allowed(name)
+}
+
+// davDir leaves what davFS hides out of directory listings.
+type davDir struct {
+	webdav.File
+	fsys davFS
+	name string
+}
+
+func (d davDir) Stat() (fs.FileInfo, error) {
+	info, err := d.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return davInfo{FileInfo: info, types: d.fsys.types}, nil
+}
+
+// davInfo gives PROPFIND the types of the server.
+type davInfo struct {
+	fs.FileInfo
+	types mimeTypes
+}
+
+// ContentType returns the type -mime-file or -mime has for the file, leaving
+// the others to the handler.
+func (info davInfo) ContentType(ctx context.Context) (string, error) {
+	if contentType := info.types.custom(info.Name()); contentType != "" {
+		return contentType, nil
+	}
+	return "", webdav.ErrNotImplemented
+}
+
+func (d davDir) Readdir(count int) ([]fs.FileInfo, error) {
+	infos, err := d.File.Readdir(count)
+	return slices.DeleteFunc(infos, func(info fs.FileInfo) bool {
+		return d.fsys.hidden(path.Join(d.name, info.Name()), info)
+	}), err
+}
+
+// serveWebDAV answers r with a WebDAV handler for the folder. The handler is
+// made per request since what's visible depends on r's tokens.
+func serveWebDAV(w http.ResponseWriter, r *http.Request, args Args, locks webdav.LockSystem) {
+	h := &webdav.Handler{
+		Prefix: args.basePath,
+		FileSystem: davFS{
+			Dir:      webdav.Dir(args.folder),
+			writable: args.upload,
+			hide:     args.hidden,
+			excluded: func(name string) bool {
+				return args.excluded(name, isDirectory(args.localPath(name))) || args.escapes(name)
+			},
+			allowed: func(name string) bool { return args.tokenAllowed(r, name) },
+			limits:  args.uploadLimits,
+			types:   args.mimeTypes,
+		},
+		LockSystem: locks,
+	}
+
+	if args.upload && r.Method == http.MethodPut {
+		budget, err := args.uploadLimits.admit(args.folder, path.Base(r.URL.Path), r.ContentLength)
+		if err != nil {
+			writeUploadError(w, r, err)
+			return
+		}
+		// The handler keeps what it wrote of a body cut short, so the length
+		// must be known up front.
+		if budget.left >= 0 && r.ContentLength < 0 {
+			writeError(w, r, http.StatusLengthRequired, "411 uploads need a Content-Length")
+			return
+		}
+	}
+
+	// Hrefs and Destination headers are full paths, including -base-path.
+	if args.basePath != "" {
+		r = r.Clone(r.Context())
+		r.URL.Path = args.basePath + r.URL.Path
+	}
+	h.ServeHTTP(w, r)
+}
@@ -0,0 +1,141 @@
+package fylshr
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWebDAVWrites(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		dest    string
+		body    string
+		allowed bool
+	}{
+		{"put", http.MethodPut, "/new.txt", "", "new", true},
+		{"put into token dir", http.MethodPut, "/sec/new.txt", "", "new", false},
+		{"put into token dir with token", http.MethodPut, "/sec/new.txt?token=s3cret", "", "new", true},
+		{"put token file", http.MethodPut, "/sec/" + tokenFile + "?token=s3cret", "", "mine", false},
+		{"put dotfile", http.MethodPut, "/.env", "", "SECRET=2", false},
+		{"put excluded", http.MethodPut, "/debug.log", "", "log", false},
+		{"copy", "COPY", "/a.txt", "/b.txt", "", true},
+		{"copy onto token dir file", "COPY", "/a.txt", "/sec/f.txt", "", false},
+		{"copy onto token dir file with token", "COPY", "/a.txt?token=s3cret", "/sec/f.txt", "", true},
+		{"copy onto ignore file", "COPY", "/a.txt", "/" + ignoreFile, "", false},
+		{"copy onto dotfile", "COPY", "/a.txt", "/.env", "", false},
+		{"move into token dir", "MOVE", "/a.txt", "/sec/new.txt", "", false},
+		{"move out of token dir", "MOVE", "/sec/f.txt", "/stolen.txt", "", false},
+		{"move token dir", "MOVE", "/sec", "/open", "", false},
+		{"move excluded", "MOVE", "/a.txt", "/a.log", "", false},
+		{"delete in token dir", http.MethodDelete, "/sec/f.txt", "", "", false},
+		{"mkcol in token dir", "MKCOL", "/sec/d", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{
+				"a.txt":            "hello",
+				"sec/" + tokenFile: "s3cret",
+				"sec/f.txt":        "private",
+				".env":             "SECRET=1",
+			})
+			srv := newTestServer(t, dir, "-webdav", "-upload", "-exclude", "*.log")
+			before := snapshot(t, dir)
+
+			var headers []string
+			if tt.dest != "" {
+				headers = append(headers, "Destination: "+srv.URL+tt.dest)
+			}
+			resp, _ := do(t, srv, tt.method, tt.path, strings.NewReader(tt.body), headers...)
+			ok := resp.StatusCode >= 200 && resp.StatusCode < 300
+			if ok != tt.allowed {
+				t.Errorf("%s %s = %d, want allowed %v", tt.method, tt.path, resp.StatusCode, tt.allowed)
+			}
+			if after := snapshot(t, dir); !tt.allowed && after != before {
+				t.Errorf("%s %s changed the folder:\n%s\nwant\n%s", tt.method, tt.path, after, before)
+			}
+		})
+	}
+}
+
+// TestWebDAVUploadExt checks that COPY and MOVE only give files the names
+// -allowed-upload-ext lets in, like PUT.
+func TestWebDAVUploadExt(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		dest    string
+		allowed bool
+	}{
+		{"put", http.MethodPut, "/new.txt", "", true},
+		{"put other extension", http.MethodPut, "/new.exe", "", false},
+		{"move", "MOVE", "/a.txt", "/b.txt", true},
+		{"move to other extension", "MOVE", "/a.txt", "/a.exe", false},
+		{"copy to other extension", "COPY", "/a.txt", "/a.exe", false},
+		{"move folder", "MOVE", "/sub", "/renamed", true},
+		{"copy folder", "COPY", "/sub", "/copied", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"a.txt": "hello", "sub/b.txt": "world"})
+			srv := newTestServer(t, dir, "-webdav", "-upload", "-allowed-upload-ext", "txt")
+			before := snapshot(t, dir)
+
+			var headers []string
+			if tt.dest != "" {
+				headers = append(headers, "Destination: "+srv.URL+tt.dest)
+			}
+			resp, _ := do(t, srv, tt.method, tt.path, strings.NewReader("new"), headers...)
+			if ok := resp.StatusCode >= 200 && resp.StatusCode < 300; ok != tt.allowed {
+				t.Errorf("%s %s %s = %d, want allowed %v", tt.method, tt.path, tt.dest, resp.StatusCode, tt.allowed)
+			}
+			if after := snapshot(t, dir); !tt.allowed && after != before {
+				t.Errorf("%s %s %s changed the folder:\n%s\nwant\n%s", tt.method, tt.path, tt.dest, after, before)
+			}
+		})
+	}
+}
+
+// TestWebDAVMimeTypes checks that PROPFIND gives the types of -mime.
+func TestWebDAVMimeTypes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.foo": "hello", "a.txt": "hello"})
+	srv := newTestServer(t, dir, "-webdav", "-mime", ".foo=video/mp4")
+
+	tests := []struct {
+		path, want string
+	}{
+		{"/a.foo", "<D:getcontenttype>video/mp4</D:getcontenttype>"},
+		{"/a.txt", "<D:getcontenttype>text/plain; charset=utf-8</D:getcontenttype>"},
+	}
+	for _, tt := range tests {
+		if _, body := do(t, srv, "PROPFIND", tt.path, nil, "Depth: 0"); !strings.Contains(body, tt.want) {
+			t.Errorf("PROPFIND %s = %q, want %s", tt.path, body, tt.want)
+		}
+	}
+}
+
+// snapshot lists the files of dir with their content.
+func snapshot(t *testing.T, dir string) string {
+	t.Helper()
+	var b strings.Builder
+	err := filepath.WalkDir(dir, func(name string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(name)
+		b.WriteString(strings.TrimPrefix(name, dir) + "=" + string(content) + "\n")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package fylshr
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestXSendfile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.txt":            "hello",
+		"My File.txt":      "spaces",
+		"photo.jpg":        "",
+		"sub/b.txt":        "nested",
+		"sec/" + tokenFile: "s3cret",
+		"sec/c.txt":        "secret",
+		".env":             "SECRET=1",
+	})
+
+	tests := []struct {
+		flags       []string
+		method      string
+		path        string
+		status      int
+		header      string
+		body        string
+		disposition string
+	}{
+		{nil, http.MethodGet, "/a.txt", http.StatusOK, "/a.txt", "", ""},
+		{nil, http.MethodHead, "/a.txt", http.StatusOK, "/a.txt", "", ""},
+		{nil, http.MethodGet, "/sub/b.txt", http.StatusOK, "/sub/b.txt", "", ""},
+		{nil, http.MethodGet, "/My%20File.txt", http.StatusOK, "/My File.txt", "", ""},
+		{nil, http.MethodGet, "/photo.jpg", http.StatusOK, "/photo.jpg", "", `attachment; filename="photo.jpg"`},
+		{nil, http.MethodGet, "/sec/c.txt?token=s3cret", http.StatusOK, "/sec/c.txt", "", ""},
+		{nil, http.MethodGet, "/sec/c.txt", http.StatusForbidden, "", "", ""},
+		{nil, http.MethodGet, "/.env", http.StatusNotFound, "", "", ""},
+		{nil, http.MethodGet, "/missing.txt", http.StatusNotFound, "", "", ""},
+		{nil, http.MethodGet, "/sub/", http.StatusOK, "", "b.txt", ""},
+		{[]string{"-xsendfile-prefix", "/internal/"}, http.MethodGet, "/sub/b.txt", http.StatusOK, "/internal/sub/b.txt", "", ""},
+		{[]string{"-base-path", "/share"}, http.MethodGet, "/share/a.txt", http.StatusOK, "/a.txt", "", ""},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, dir, append([]string{"-xsendfile", "X-Accel-Redirect"}, tt.flags...)...)
+		resp, body := do(t, srv, tt.method, tt.path, nil)
+		if resp.StatusCode != tt.status || resp.Header.Get("X-Accel-Redirect") != tt.header {
+			t.Errorf("%v %s %s = %d X-Accel-Redirect %q, want %d %q", tt.flags, tt.method, tt.path, resp.StatusCode, resp.Header.Get("X-Accel-Redirect"), tt.status, tt.header)
+		}
+		if tt.header != "" && body != "" || tt.body != "" && !strings.Contains(body, tt.body) {
+			t.Errorf("%v %s %s body %q, want %q", tt.flags, tt.method, tt.path, body, tt.body)
+		}
+		if got := resp.Header.Get("Content-Disposition"); got != tt.disposition {
+			t.Errorf("%v %s %s Content-Disposition %q, want %q", tt.flags, tt.method, tt.path, got, tt.disposition)
+		}
+	}
+
+	srv := newTestServer(t, dir)
+	if resp, body := do(t, srv, http.MethodGet, "/a.txt", nil); body != "hello" || resp.Header.Get("X-Accel-Redirect") != "" {
+		t.Errorf("GET /a.txt without -xsendfile = %q X-Accel-Redirect %q, want the file", body, resp.Header.Get("X-Accel-Redirect"))
+	}
+}